@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/MichaelSBoop/lima-backend/pkg/mockbank"
+	"github.com/spf13/pflag"
+)
+
+func main() {
+	addr, cfg := parseFlags()
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: mockbank.New(cfg),
+	}
+	log.Printf("mock banks %s listening on %s", strings.Join(cfg.Banks, ", "), addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+func parseFlags() (string, mockbank.Config) {
+	cfg := mockbank.DefaultConfig()
+	flags := pflag.NewFlagSet("MOCKBANK", pflag.ExitOnError)
+	addr := flags.StringP("addr", "a", "127.0.0.1:8090", "Address to listen on")
+	flags.StringSliceVar(&cfg.Banks, "banks", cfg.Banks, "Banks to emulate, each served under /<bank>")
+	flags.StringVar(&cfg.ConsentMode, "consent-mode", cfg.ConsentMode, "Status of new consents: approve, pending or reject")
+	flags.DurationVar(&cfg.ConsentTTL, "consent-ttl", cfg.ConsentTTL, "How long new consents stay valid")
+	flags.Uint64Var(&cfg.Seed, "seed", cfg.Seed, "Seed for generated fixture data")
+	flags.DurationVar(&cfg.Fault.Latency, "latency", 0, "Latency added to every response")
+	flags.Float64Var(&cfg.Fault.ErrorRate, "error-rate", 0, "Share of requests answered with 500")
+	flags.Float64Var(&cfg.Fault.RateLimitRate, "rate-limit-rate", 0, "Share of requests answered with 429")
+	flags.Float64Var(&cfg.Fault.MalformedRate, "malformed-rate", 0, "Share of requests answered with malformed JSON")
+	if err := flags.Parse(os.Args); err != nil {
+		log.Fatal(err)
+	}
+	return *addr, cfg
+}
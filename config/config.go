@@ -3,8 +3,21 @@ package config
 import (
 	"github.com/MichaelSBoop/lima-backend/internal/httpsrv"
 	pg "github.com/MichaelSBoop/lima-backend/internal/infra/postgres"
+	"github.com/MichaelSBoop/lima-backend/internal/infra/storage"
+	"github.com/MichaelSBoop/lima-backend/internal/service/analytics"
+	"github.com/MichaelSBoop/lima-backend/internal/service/audit"
+	"github.com/MichaelSBoop/lima-backend/internal/service/consents"
+	"github.com/MichaelSBoop/lima-backend/internal/service/events"
+	"github.com/MichaelSBoop/lima-backend/internal/service/notifications"
 	"github.com/MichaelSBoop/lima-backend/internal/service/oauth"
+	"github.com/MichaelSBoop/lima-backend/internal/service/plans"
+	"github.com/MichaelSBoop/lima-backend/internal/service/rates"
+	"github.com/MichaelSBoop/lima-backend/internal/service/reencrypt"
+	"github.com/MichaelSBoop/lima-backend/internal/service/requester"
+	"github.com/MichaelSBoop/lima-backend/internal/service/stream"
 	"github.com/MichaelSBoop/lima-backend/pkg/cache/inmem"
+	"github.com/MichaelSBoop/lima-backend/pkg/fieldcrypt"
+	"github.com/MichaelSBoop/lima-backend/pkg/httpclient"
 	"github.com/MichaelSBoop/lima-backend/pkg/logger"
 	"go.uber.org/fx"
 )
@@ -12,9 +25,22 @@ import (
 type Config struct {
 	fx.Out
 
-	HTTP     httpsrv.Config `json:"http" yaml:"http"`
-	Log      logger.Config  `json:"log" yaml:"log"`
-	Postgres pg.Config      `json:"postgres" yaml:"postgres"`
-	Oauth    oauth.Config   `json:"oauth" yaml:"oauth"`
-	Cache    inmem.Config   `json:"cache" yaml:"cache"`
+	HTTP          httpsrv.Config       `json:"http" yaml:"http"`
+	Log           logger.Config        `json:"log" yaml:"log"`
+	Postgres      pg.Config            `json:"postgres" yaml:"postgres"`
+	Oauth         oauth.Config         `json:"oauth" yaml:"oauth"`
+	Requester     requester.Config     `json:"requester" yaml:"requester"`
+	HTTPClient    httpclient.Config    `json:"http_client" yaml:"http_client"`
+	Rates         rates.Config         `json:"rates" yaml:"rates"`
+	Analytics     analytics.Config     `json:"analytics" yaml:"analytics"`
+	Consents      consents.Config      `json:"consents" yaml:"consents"`
+	Plans         plans.Config         `json:"plans" yaml:"plans"`
+	Notifications notifications.Config `json:"notifications" yaml:"notifications"`
+	Events        events.Config        `json:"events" yaml:"events"`
+	Stream        stream.Config        `json:"stream" yaml:"stream"`
+	Audit         audit.Config         `json:"audit" yaml:"audit"`
+	Encryption    fieldcrypt.Config    `json:"encryption" yaml:"encryption"`
+	Reencrypt     reencrypt.Config     `json:"reencrypt" yaml:"reencrypt"`
+	Cache         inmem.Config         `json:"cache" yaml:"cache"`
+	Storage       storage.Config       `json:"storage" yaml:"storage"`
 }
@@ -7,22 +7,81 @@ import (
 
 	"github.com/MichaelSBoop/lima-backend/internal/domain"
 	"github.com/MichaelSBoop/lima-backend/internal/service/accounts"
+	"github.com/MichaelSBoop/lima-backend/internal/service/analytics"
+	"github.com/MichaelSBoop/lima-backend/internal/service/audit"
+	"github.com/MichaelSBoop/lima-backend/internal/service/budgets"
+	"github.com/MichaelSBoop/lima-backend/internal/service/categories"
+	"github.com/MichaelSBoop/lima-backend/internal/service/consents"
+	"github.com/MichaelSBoop/lima-backend/internal/service/events"
+	"github.com/MichaelSBoop/lima-backend/internal/service/notifications"
+	"github.com/MichaelSBoop/lima-backend/internal/service/plans"
+	"github.com/MichaelSBoop/lima-backend/internal/service/rates"
+	"github.com/MichaelSBoop/lima-backend/internal/service/recurring"
+	"github.com/MichaelSBoop/lima-backend/internal/service/statements"
+	"github.com/MichaelSBoop/lima-backend/internal/service/stream"
+	"github.com/MichaelSBoop/lima-backend/internal/service/transactions"
+	"github.com/MichaelSBoop/lima-backend/internal/service/transfers"
 	"go.uber.org/fx"
+	"go.uber.org/zap"
 )
 
 type In struct {
 	fx.In
 
-	Accounts *accounts.Service
+	Accounts      *accounts.Service
+	Consents      *consents.Service
+	Rates         *rates.Service
+	Analytics     *analytics.Service
+	Transactions  *transactions.Service
+	Categories    *categories.Service
+	Budgets       *budgets.Service
+	Recurring     *recurring.Service
+	Transfers     *transfers.Service
+	Statements    *statements.Service
+	Notifications *notifications.Service
+	Stream        *stream.Service
+	Audit         *audit.Service
+	Plans         *plans.Service
+	Events        *events.Service
 }
 
 type Handler struct {
-	accounts *accounts.Service
+	accounts      *accounts.Service
+	consents      *consents.Service
+	rates         *rates.Service
+	analytics     *analytics.Service
+	transactions  *transactions.Service
+	categories    *categories.Service
+	budgets       *budgets.Service
+	recurring     *recurring.Service
+	transfers     *transfers.Service
+	statements    *statements.Service
+	notifications *notifications.Service
+	stream        *stream.Service
+	audit         *audit.Service
+	plans         *plans.Service
+	events        *events.Service
+	log           *zap.Logger
 }
 
-func New(params In) *Handler {
+func New(log *zap.Logger, params In) *Handler {
 	return &Handler{
-		accounts: params.Accounts,
+		accounts:      params.Accounts,
+		consents:      params.Consents,
+		rates:         params.Rates,
+		analytics:     params.Analytics,
+		transactions:  params.Transactions,
+		categories:    params.Categories,
+		budgets:       params.Budgets,
+		recurring:     params.Recurring,
+		transfers:     params.Transfers,
+		statements:    params.Statements,
+		notifications: params.Notifications,
+		stream:        params.Stream,
+		audit:         params.Audit,
+		plans:         params.Plans,
+		events:        params.Events,
+		log:           log,
 	}
 }
 
@@ -31,45 +90,31 @@ func (h *Handler) HandleCreateConsents() http.HandlerFunc {
 		var consents map[string]*domain.AccountConsent
 		b, err := io.ReadAll(r.Body)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			WriteError(w, BadRequest(err))
 			return
 		}
 		if err := json.Unmarshal(b, &consents); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			WriteError(w, BadRequest(err))
 			return
 		}
 
 		resConsents, err := h.accounts.CreateAccountsConsents(r.Context(), consents)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			WriteError(w, err)
 			return
 		}
-		res, err := json.Marshal(resConsents)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write(res)
+		WriteJSON(w, http.StatusOK, resConsents)
 	}
 }
 
 func (h *Handler) HandleAggregateAccounts() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		clientID := r.URL.Query().Get("client_id")
+		clientID := ClientID(r)
 		resAccounts, err := h.accounts.AggregateAccounts(r.Context(), clientID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		res, err := json.Marshal(resAccounts)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			WriteError(w, err)
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write(res)
+		WriteJSON(w, http.StatusOK, resAccounts)
 	}
 }
@@ -0,0 +1,68 @@
+package http
+
+import (
+	"net/http"
+	"time"
+)
+
+func (h *Handler) HandleNetWorth() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := dateRange(r)
+		if err != nil {
+			WriteError(w, BadRequest(err))
+			return
+		}
+		q := r.URL.Query()
+		netWorth, err := h.analytics.NetWorth(r.Context(), ClientID(r), from, to, q.Get("currency"))
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, netWorth)
+	}
+}
+
+func (h *Handler) HandleCashflow() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := dateRange(r)
+		if err != nil {
+			WriteError(w, BadRequest(err))
+			return
+		}
+		q := r.URL.Query()
+		cashflow, err := h.analytics.Cashflow(r.Context(), ClientID(r), from, to, q.Get("period"), q.Get("currency"))
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, cashflow)
+	}
+}
+
+func (h *Handler) HandleRefreshAnalytics() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := h.analytics.Refresh(r.Context(), ClientID(r)); err != nil {
+			WriteError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// dateRange parses the optional from and to query parameters as dates.
+func dateRange(r *http.Request) (time.Time, time.Time, error) {
+	var from, to time.Time
+	q := r.URL.Query()
+	for name, dst := range map[string]*time.Time{"from": &from, "to": &to} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.DateOnly, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		*dst = t
+	}
+	return from, to, nil
+}
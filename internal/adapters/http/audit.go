@@ -0,0 +1,83 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+)
+
+// HandleAuditLog lists the audit entries matching the query, oldest first.
+// Pages follow each other by passing the last sequence seen as after.
+func (h *Handler) HandleAuditLog() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		filter := domain.AuditFilter{
+			ClientID:  q.Get("client_id"),
+			Action:    q.Get("action"),
+			ConsentID: q.Get("consent_id"),
+			Bank:      q.Get("bank"),
+			RequestID: q.Get("request_id"),
+		}
+		var err error
+		if filter.AfterSequence, filter.Limit, err = page(r); err != nil {
+			WriteError(w, BadRequest(err))
+			return
+		}
+		for name, dst := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+			v := q.Get(name)
+			if v == "" {
+				continue
+			}
+			if *dst, err = time.Parse(time.RFC3339, v); err != nil {
+				WriteError(w, BadRequest(err))
+				return
+			}
+		}
+		entries, err := h.audit.Entries(r.Context(), filter)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, entries)
+	}
+}
+
+// HandleVerifyAuditLog checks the hash chain of a page of the audit log.
+func (h *Handler) HandleVerifyAuditLog() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		after, limit, err := page(r)
+		if err != nil {
+			WriteError(w, BadRequest(err))
+			return
+		}
+		res, err := h.audit.Verify(r.Context(), after, limit)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, res)
+	}
+}
+
+// page parses the optional after and limit query parameters.
+func page(r *http.Request) (int64, int, error) {
+	var (
+		after int64
+		limit int
+		err   error
+	)
+	q := r.URL.Query()
+	if v := q.Get("after"); v != "" {
+		if after, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return 0, 0, err
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil {
+			return 0, 0, err
+		}
+	}
+	return after, limit, nil
+}
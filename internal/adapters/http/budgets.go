@@ -0,0 +1,87 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/gorilla/mux"
+)
+
+func (h *Handler) HandleListBudgets() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		budgets, err := h.budgets.List(r.Context(), ClientID(r))
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, budgets)
+	}
+}
+
+func (h *Handler) HandleCreateBudget() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var budget domain.Budget
+		if err := json.NewDecoder(r.Body).Decode(&budget); err != nil {
+			WriteError(w, BadRequest(err))
+			return
+		}
+		budget.ClientID = ClientID(r)
+		progress, err := h.budgets.Create(r.Context(), &budget)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusCreated, progress)
+	}
+}
+
+func (h *Handler) HandleGetBudget() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		progress, err := h.budgets.Get(r.Context(), ClientID(r), mux.Vars(r)["id"])
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, progress)
+	}
+}
+
+func (h *Handler) HandleUpdateBudget() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var budget domain.Budget
+		if err := json.NewDecoder(r.Body).Decode(&budget); err != nil {
+			WriteError(w, BadRequest(err))
+			return
+		}
+		budget.ClientID = ClientID(r)
+		budget.BudgetID = mux.Vars(r)["id"]
+		progress, err := h.budgets.Update(r.Context(), &budget)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, progress)
+	}
+}
+
+func (h *Handler) HandleDeleteBudget() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := h.budgets.Delete(r.Context(), ClientID(r), mux.Vars(r)["id"]); err != nil {
+			WriteError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (h *Handler) HandleBudgetAlerts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		alerts, err := h.budgets.Alerts(r.Context(), ClientID(r), mux.Vars(r)["id"])
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, alerts)
+	}
+}
@@ -0,0 +1,114 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleListConsents lists the consents of the client across banks,
+// filtered by bank, status, permission, active and expires_before.
+func (h *Handler) HandleListConsents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		filter := domain.ConsentFilter{
+			Bank:       q.Get("bank"),
+			Status:     q.Get("status"),
+			Permission: q.Get("permission"),
+		}
+		if v := q.Get("active"); v != "" {
+			active, err := strconv.ParseBool(v)
+			if err != nil {
+				WriteError(w, BadRequest(err))
+				return
+			}
+			filter.Active = &active
+		}
+		if v := q.Get("expires_before"); v != "" {
+			var err error
+			if filter.ExpiresBefore, err = time.Parse(time.RFC3339, v); err != nil {
+				WriteError(w, BadRequest(err))
+				return
+			}
+		}
+		consents, err := h.consents.List(r.Context(), ClientID(r), filter)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, consents)
+	}
+}
+
+// HandleReplaceConsent asks the bank of the consent for a new one with the
+// permissions of the body, replacing it once approved.
+func (h *Handler) HandleReplaceConsent() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Permissions []string `json:"permissions"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			WriteError(w, BadRequest(err))
+			return
+		}
+		consent, err := h.consents.Replace(r.Context(), ClientID(r), mux.Vars(r)["id"], req.Permissions)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusCreated, consent)
+	}
+}
+
+// HandleReconsent asks the bank of the consent for a new one with the same permissions.
+func (h *Handler) HandleReconsent() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		consent, err := h.consents.Reconsent(r.Context(), ClientID(r), mux.Vars(r)["id"])
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusCreated, consent)
+	}
+}
+
+// HandleAuthorizeConsent starts the approval of a pending consent at its
+// bank. The body may name the deep link to return to.
+func (h *Handler) HandleAuthorizeConsent() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ReturnTo string `json:"return_to"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			WriteError(w, BadRequest(err))
+			return
+		}
+		link, err := h.consents.Authorize(r.Context(), ClientID(r), mux.Vars(r)["id"], req.ReturnTo)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, link)
+	}
+}
+
+// HandleConsentCallback is where banks send the client back to. It
+// redirects to the deep link of the flow with its outcome.
+func (h *Handler) HandleConsentCallback() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		returnTo, err := h.consents.CompleteAuthorization(r.Context(), q.Get("state"), q.Get("code"), q.Get("error"))
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		http.Redirect(w, r, returnTo, http.StatusFound)
+	}
+}
@@ -0,0 +1,152 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/internal/service/analytics"
+	"github.com/MichaelSBoop/lima-backend/internal/service/audit"
+	"github.com/MichaelSBoop/lima-backend/internal/service/budgets"
+	"github.com/MichaelSBoop/lima-backend/internal/service/categories"
+	"github.com/MichaelSBoop/lima-backend/internal/service/consents"
+	"github.com/MichaelSBoop/lima-backend/internal/service/notifications"
+	"github.com/MichaelSBoop/lima-backend/internal/service/oauth"
+	"github.com/MichaelSBoop/lima-backend/internal/service/plans"
+	"github.com/MichaelSBoop/lima-backend/internal/service/requester"
+	"github.com/MichaelSBoop/lima-backend/internal/service/requester/bankapi"
+	"github.com/MichaelSBoop/lima-backend/internal/service/statements"
+	"github.com/MichaelSBoop/lima-backend/pkg/money"
+)
+
+const (
+	CodeInvalidRequest      = "invalid_request"
+	CodeNotFound            = "not_found"
+	CodeConflict            = "conflict"
+	CodeUnauthorized        = "unauthorized"
+	CodeForbidden           = "forbidden"
+	CodeRateLimited         = "rate_limited"
+	CodeConsentInsufficient = "consent_insufficient"
+	CodePlanLimit           = "plan_limit"
+	CodeUnsupported         = "unsupported"
+	CodeUnknownBank         = "unknown_bank"
+	CodeBankError           = "bank_error"
+	CodeBankUnavailable     = "bank_unavailable"
+	CodeBankInvalidAnswer   = "bank_invalid_response"
+	CodeUnavailable         = "unavailable"
+	CodeInternal            = "internal_error"
+)
+
+// ErrorResponse is the body of every non-successful API response.
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+type APIError struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Bank    *domain.BankError `json:"bank,omitempty"`
+	// Consent tells what the consent lacks, including the permissions to add.
+	Consent *domain.ConsentError `json:"consent,omitempty"`
+	// Plan tells which limit of the plan of the client was reached.
+	Plan *domain.PlanLimitError `json:"plan,omitempty"`
+}
+
+// badRequest marks err as caused by the client.
+type badRequest struct {
+	err error
+}
+
+func (e badRequest) Error() string { return e.err.Error() }
+func (e badRequest) Unwrap() error { return e.err }
+
+func BadRequest(err error) error {
+	return badRequest{err: err}
+}
+
+// WriteError maps err to its status code and writes it in the API error model.
+func WriteError(w http.ResponseWriter, err error) {
+	var (
+		bankErr    *domain.BankError
+		consentErr *domain.ConsentError
+		planErr    *domain.PlanLimitError
+		badReq     badRequest
+	)
+	switch {
+	case errors.As(err, &bankErr):
+		status, code := http.StatusBadGateway, CodeBankError
+		if bankErr.StatusCode == http.StatusTooManyRequests || bankErr.StatusCode >= http.StatusInternalServerError {
+			status, code = http.StatusServiceUnavailable, CodeBankUnavailable
+		}
+		WriteJSON(w, status, ErrorResponse{Error: APIError{
+			Code:    code,
+			Message: bankErr.Error(),
+			Bank:    bankErr,
+		}})
+	case errors.As(err, &consentErr):
+		WriteJSON(w, http.StatusForbidden, ErrorResponse{Error: APIError{
+			Code:    CodeConsentInsufficient,
+			Message: consentErr.Error(),
+			Consent: consentErr,
+		}})
+	case errors.As(err, &planErr):
+		status, code := http.StatusPaymentRequired, CodePlanLimit
+		if planErr.RetryAfter > 0 {
+			// The plan allows it, just not this soon.
+			status, code = http.StatusTooManyRequests, CodeRateLimited
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(planErr.RetryAfter.Seconds()))))
+		}
+		WriteJSON(w, status, ErrorResponse{Error: APIError{
+			Code:    code,
+			Message: planErr.Error(),
+			Plan:    planErr,
+		}})
+	case errors.As(err, &badReq):
+		WriteErrorCode(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+	case errors.Is(err, analytics.ErrInvalidPeriod), errors.Is(err, analytics.ErrInvalidRange),
+		errors.Is(err, categories.ErrUnknownCategory), errors.Is(err, categories.ErrUnknownMatchField),
+		errors.Is(err, categories.ErrEmptyPattern), errors.Is(err, categories.ErrMissingClientID),
+		errors.Is(err, budgets.ErrInvalidBudget),
+		errors.Is(err, statements.ErrUnknownFormat), errors.Is(err, statements.ErrInvalidRange),
+		errors.Is(err, notifications.ErrInvalidPreference), errors.Is(err, audit.ErrInvalidFilter),
+		errors.Is(err, consents.ErrInvalidState), errors.Is(err, consents.ErrInvalidReturnURL),
+		errors.Is(err, consents.ErrInvalidPermissions),
+		errors.Is(err, plans.ErrUnknownPlan), errors.Is(err, plans.ErrInvalidPlanChange):
+		WriteErrorCode(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+	case errors.Is(err, consents.ErrNotPending), errors.Is(err, plans.ErrSamePlan), errors.Is(err, categories.ErrAmbiguousTransaction),
+		errors.Is(err, statements.ErrAmbiguousAccount):
+		WriteErrorCode(w, http.StatusConflict, CodeConflict, err.Error())
+	case errors.Is(err, consents.ErrAuthorizationDisabled), errors.Is(err, requester.ErrAuthorizationUnsupported):
+		WriteErrorCode(w, http.StatusUnprocessableEntity, CodeUnsupported, err.Error())
+	case errors.Is(err, requester.ErrQuotaExceeded):
+		WriteErrorCode(w, http.StatusServiceUnavailable, CodeBankUnavailable, err.Error())
+	case errors.Is(err, audit.ErrUnavailable):
+		WriteErrorCode(w, http.StatusServiceUnavailable, CodeUnavailable, err.Error())
+	case errors.Is(err, domain.ErrNotFound):
+		WriteErrorCode(w, http.StatusNotFound, CodeNotFound, err.Error())
+	case errors.Is(err, oauth.ErrProviderNotFound):
+		WriteErrorCode(w, http.StatusBadRequest, CodeUnknownBank, err.Error())
+	case errors.Is(err, bankapi.ErrUnexpectedPayload), errors.Is(err, oauth.ErrEmptyToken), errors.Is(err, money.ErrInvalidAmount):
+		WriteErrorCode(w, http.StatusBadGateway, CodeBankInvalidAnswer, err.Error())
+	default:
+		WriteErrorCode(w, http.StatusInternalServerError, CodeInternal, err.Error())
+	}
+}
+
+func WriteErrorCode(w http.ResponseWriter, status int, code, message string) {
+	WriteJSON(w, status, ErrorResponse{Error: APIError{Code: code, Message: message}})
+}
+
+func WriteJSON(w http.ResponseWriter, status int, v any) {
+	res, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(res)
+}
@@ -0,0 +1,48 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/gorilla/mux"
+)
+
+// failedEvent is an event set aside after its last delivery attempt.
+type failedEvent struct {
+	*domain.Event
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"last_error"`
+}
+
+// HandleFailedEvents lists the events set aside after their last delivery
+// attempt, oldest first. Each holds back the later events of its aggregate.
+func (h *Handler) HandleFailedEvents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		after, limit, err := page(r)
+		if err != nil {
+			WriteError(w, BadRequest(err))
+			return
+		}
+		events, err := h.events.Failed(r.Context(), after, limit)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		res := make([]failedEvent, 0, len(events))
+		for _, event := range events {
+			res = append(res, failedEvent{Event: event, Attempts: event.Attempts, LastError: event.LastError})
+		}
+		WriteJSON(w, http.StatusOK, res)
+	}
+}
+
+// HandleRetryEvent puts a failed event back in the outbox.
+func (h *Handler) HandleRetryEvent() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := h.events.Retry(r.Context(), mux.Vars(r)["event_id"]); err != nil {
+			WriteError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
@@ -0,0 +1,49 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/gorilla/mux"
+)
+
+func (h *Handler) HandleNotificationPreferences() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		prefs, err := h.notifications.Preferences(r.Context(), ClientID(r))
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, prefs)
+	}
+}
+
+func (h *Handler) HandleSetNotificationPreference() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var pref domain.NotificationPreference
+		if err := json.NewDecoder(r.Body).Decode(&pref); err != nil {
+			WriteError(w, BadRequest(err))
+			return
+		}
+		pref.ClientID = ClientID(r)
+		pref.Channel = mux.Vars(r)["channel"]
+		res, err := h.notifications.SetPreference(r.Context(), &pref)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, res)
+	}
+}
+
+func (h *Handler) HandleNotificationDeliveries() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		deliveries, err := h.notifications.Deliveries(r.Context(), ClientID(r))
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, deliveries)
+	}
+}
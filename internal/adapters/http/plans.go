@@ -0,0 +1,60 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// HandlePlans lists the plans clients can subscribe to.
+func (h *Handler) HandlePlans() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, h.plans.Tiers())
+	}
+}
+
+// HandleSubscription returns the plan of the client with its history.
+func (h *Handler) HandleSubscription() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		subscription, err := h.plans.Subscription(r.Context(), ClientID(r))
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, subscription)
+	}
+}
+
+// HandleClientPlan returns the plan of the client of the path with its history.
+func (h *Handler) HandleClientPlan() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		subscription, err := h.plans.Subscription(r.Context(), mux.Vars(r)["client_id"])
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, subscription)
+	}
+}
+
+// HandleChangePlan moves the client of the path to the plan of the body.
+func (h *Handler) HandleChangePlan() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Plan      string `json:"plan"`
+			ChangedBy string `json:"changed_by"`
+			Reason    string `json:"reason"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			WriteError(w, BadRequest(err))
+			return
+		}
+		subscription, err := h.plans.ChangePlan(r.Context(), mux.Vars(r)["client_id"], req.Plan, req.ChangedBy, req.Reason)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, subscription)
+	}
+}
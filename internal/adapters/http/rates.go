@@ -0,0 +1,36 @@
+package http
+
+import (
+	"net/http"
+	"time"
+)
+
+func (h *Handler) HandleAccountsTotals() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		totals, err := h.accounts.Totals(r.Context(), ClientID(r), r.URL.Query().Get("currency"))
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, totals)
+	}
+}
+
+func (h *Handler) HandleRates() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		date := time.Now().UTC()
+		if v := r.URL.Query().Get("date"); v != "" {
+			var err error
+			if date, err = time.Parse(time.DateOnly, v); err != nil {
+				WriteError(w, BadRequest(err))
+				return
+			}
+		}
+		rates, err := h.rates.Rates(r.Context(), date)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, rates)
+	}
+}
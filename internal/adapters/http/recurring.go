@@ -0,0 +1,14 @@
+package http
+
+import "net/http"
+
+func (h *Handler) HandleRecurring() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		payments, err := h.recurring.Detect(r.Context(), ClientID(r))
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, payments)
+	}
+}
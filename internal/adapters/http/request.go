@@ -0,0 +1,13 @@
+package http
+
+import "net/http"
+
+const ClientIDHeader = "X-Client-Id"
+
+// ClientID returns the client the request is made on behalf of.
+func ClientID(r *http.Request) string {
+	if clientID := r.URL.Query().Get("client_id"); clientID != "" {
+		return clientID
+	}
+	return r.Header.Get(ClientIDHeader)
+}
@@ -0,0 +1,71 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/service/statements"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// HandleAccountStatement exports the statement of one account of the client.
+// The bank query parameter picks the account when several banks hold the ID.
+func (h *Handler) HandleAccountStatement() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, err := statements.LookupFormat(r.URL.Query().Get("format"))
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		from, to, err := dateRange(r)
+		if err != nil {
+			WriteError(w, BadRequest(err))
+			return
+		}
+		bank := r.URL.Query().Get("bank")
+		statement, err := h.statements.Statement(r.Context(), ClientID(r), bank, mux.Vars(r)["id"], from, to)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", format.ContentType)
+		w.Header().Set("Content-Disposition", attachment(format.FileName(statement)))
+		if err = format.Write(w, statement); err != nil {
+			// The status line is already sent, all that is left is to cut the body short.
+			h.log.Error("failed to write statement", zap.String("account_id", statement.Account.AccountID), zap.Error(err))
+		}
+	}
+}
+
+// HandleStatementsArchive exports the statements of every account of the client as a zip archive.
+func (h *Handler) HandleStatementsArchive() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, err := statements.LookupFormat(r.URL.Query().Get("format"))
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		from, to, err := dateRange(r)
+		if err != nil {
+			WriteError(w, BadRequest(err))
+			return
+		}
+		res, err := h.statements.Statements(r.Context(), ClientID(r), from, to)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		name := fmt.Sprintf("statements_%s.zip", time.Now().UTC().Format(time.DateOnly))
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", attachment(name))
+		if err = format.WriteArchive(w, res); err != nil {
+			h.log.Error("failed to write statements archive", zap.Error(err))
+		}
+	}
+}
+
+func attachment(name string) string {
+	return fmt.Sprintf("attachment; filename=%q", name)
+}
@@ -0,0 +1,76 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"go.uber.org/zap"
+)
+
+const LastEventIDHeader = "Last-Event-ID"
+
+// HandleEvents streams live updates of the client as server-sent events.
+// A reconnecting client resumes after the event named by the Last-Event-ID
+// header, or the last_event_id query parameter for clients that cannot set it.
+func (h *Handler) HandleEvents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clientID := ClientID(r)
+		if clientID == "" {
+			WriteError(w, BadRequest(errors.New("client id is required")))
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			WriteErrorCode(w, http.StatusInternalServerError, CodeInternal, "streaming is not supported")
+			return
+		}
+		lastEventID := r.Header.Get(LastEventIDHeader)
+		if lastEventID == "" {
+			lastEventID = r.URL.Query().Get("last_event_id")
+		}
+		replay, events, cancel := h.stream.Subscribe(clientID, lastEventID)
+		defer cancel()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		for _, event := range replay {
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(h.stream.KeepAlive())
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				if err := writeEvent(w, event); err != nil {
+					h.log.Debug("event stream closed", zap.String("client_id", clientID), zap.Error(err))
+					return
+				}
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event *domain.StreamEvent) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+	return err
+}
@@ -0,0 +1,105 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/gorilla/mux"
+)
+
+func (h *Handler) HandleListTransactions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := dateRange(r)
+		if err != nil {
+			WriteError(w, BadRequest(err))
+			return
+		}
+		if !to.IsZero() {
+			// to is inclusive, the filter bound is not.
+			to = to.AddDate(0, 0, 1)
+		}
+		q := r.URL.Query()
+		txs, err := h.transactions.List(r.Context(), domain.TransactionFilter{
+			ClientID:  ClientID(r),
+			Bank:      q.Get("bank"),
+			AccountID: q.Get("account_id"),
+			Category:  q.Get("category"),
+			From:      from,
+			To:        to,
+		})
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, txs)
+	}
+}
+
+func (h *Handler) HandleUpdateTransaction() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Category string `json:"category"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			WriteError(w, BadRequest(err))
+			return
+		}
+		q := r.URL.Query()
+		tx, err := h.categories.SetCategory(r.Context(), domain.TransactionFilter{
+			ClientID:      ClientID(r),
+			Bank:          q.Get("bank"),
+			AccountID:     q.Get("account_id"),
+			TransactionID: mux.Vars(r)["id"],
+		}, req.Category)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, tx)
+	}
+}
+
+func (h *Handler) HandleCategories() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, domain.Categories)
+	}
+}
+
+func (h *Handler) HandleCategoryRules() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rules, err := h.categories.Rules(r.Context(), ClientID(r))
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, rules)
+	}
+}
+
+func (h *Handler) HandleCreateCategoryRule() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var rule domain.CategoryRule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			WriteError(w, BadRequest(err))
+			return
+		}
+		rule.ClientID = ClientID(r)
+		res, err := h.categories.CreateRule(r.Context(), &rule)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusCreated, res)
+	}
+}
+
+func (h *Handler) HandleDeleteCategoryRule() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := h.categories.DeleteRule(r.Context(), ClientID(r), mux.Vars(r)["id"]); err != nil {
+			WriteError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
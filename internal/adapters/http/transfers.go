@@ -0,0 +1,23 @@
+package http
+
+import "net/http"
+
+func (h *Handler) HandleTransfers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := dateRange(r)
+		if err != nil {
+			WriteError(w, BadRequest(err))
+			return
+		}
+		if !to.IsZero() {
+			// to is inclusive, the filter bound is not.
+			to = to.AddDate(0, 0, 1)
+		}
+		pairs, err := h.transfers.List(r.Context(), ClientID(r), from, to)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, pairs)
+	}
+}
@@ -6,4 +6,15 @@ type Account struct {
 	AccountType string `json:"accountType" yaml:"account_type"`
 	Nickname    string `json:"nickname" yaml:"nickname"`
 	Servicer    string `json:"servicer" yaml:"servicer"`
+	ClientID    string `json:"clientId" yaml:"client_id"`
+	Bank        string `json:"bank" yaml:"bank"`
+	// Identification is the number of the account at its bank, such as a PAN.
+	Identification string `json:"identification" yaml:"identification"`
+}
+
+// AccountRef identifies an account of a client. Account IDs are unique within
+// their bank only.
+type AccountRef struct {
+	Bank      string `json:"bank" yaml:"bank"`
+	AccountID string `json:"account_id" yaml:"account_id"`
 }
@@ -1,5 +1,54 @@
 package domain
 
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	ConsentStatusPending  = "pending"
+	ConsentStatusApproved = "approved"
+	ConsentStatusRejected = "rejected"
+	ConsentStatusRevoked  = "revoked"
+	// ConsentStatusExpired is set by Lima once an approved consent is past ExpiresAt.
+	ConsentStatusExpired = "expired"
+)
+
+// Consent permissions of the Open Banking Russia API.
+const (
+	PermissionReadAccountsBasic       = "ReadAccountsBasic"
+	PermissionReadAccountsDetail      = "ReadAccountsDetail"
+	PermissionReadBalances            = "ReadBalances"
+	PermissionReadTransactionsBasic   = "ReadTransactionsBasic"
+	PermissionReadTransactionsDetail  = "ReadTransactionsDetail"
+	PermissionReadTransactionsCredits = "ReadTransactionsCredits"
+	PermissionReadTransactionsDebits  = "ReadTransactionsDebits"
+)
+
+// Permissions lists every consent permission Lima can request.
+var Permissions = []string{
+	PermissionReadAccountsBasic,
+	PermissionReadAccountsDetail,
+	PermissionReadBalances,
+	PermissionReadTransactionsBasic,
+	PermissionReadTransactionsDetail,
+	PermissionReadTransactionsCredits,
+	PermissionReadTransactionsDebits,
+}
+
+// Reasons a consent does not allow a call.
+const (
+	ConsentReasonStatus      = "status"
+	ConsentReasonExpired     = "expired"
+	ConsentReasonPermissions = "permissions"
+)
+
+// ErrConsentInsufficient is wrapped by every *ConsentError.
+var ErrConsentInsufficient = errors.New("consent insufficient")
+
 type AccountConsent struct {
 	ClientID           string   `json:"client_id" yaml:"client_id"`
 	Permissions        []string `json:"permissions" yaml:"permissions"`
@@ -10,4 +59,84 @@ type AccountConsent struct {
 	ConsentID          string   `json:"consent_id" yaml:"consent_id"`
 	AutoApproved       bool     `json:"auto_approved" yaml:"auto_approved"`
 	ConsentProvider    string   `json:"consent_provider" yaml:"consent_provider"`
+	// ExpiresAt is when the bank stops honouring the consent, zero if it did not say.
+	ExpiresAt time.Time `json:"expires_at,omitzero" yaml:"expires_at"`
+	// CreatedAt is when the bank created the consent.
+	CreatedAt time.Time `json:"created_at,omitzero" yaml:"created_at"`
+	// LastUsedAt is when a bank call was last made under the consent.
+	LastUsedAt time.Time `json:"last_used_at,omitzero" yaml:"last_used_at"`
+	// ExpiryNotifiedAt is when the client was told the consent expires soon.
+	ExpiryNotifiedAt time.Time `json:"expiry_notified_at,omitzero" yaml:"expiry_notified_at"`
+	// ReplacesConsentID is the consent revoked once this one is approved.
+	ReplacesConsentID string `json:"replaces_consent_id,omitempty" yaml:"replaces_consent_id"`
+}
+
+// ConsentOverview is a consent of the client with the accounts it gives access to.
+type ConsentOverview struct {
+	AccountConsent
+	// Active tells whether bank calls can be made under the consent.
+	Active   bool       `json:"active" yaml:"active"`
+	Accounts []*Account `json:"accounts" yaml:"accounts"`
 }
+
+// ConsentFilter narrows down the consents of a client. Zero fields match any consent.
+type ConsentFilter struct {
+	Bank       string
+	Status     string
+	Permission string
+	// Active keeps only the consents that are, or are not, active.
+	Active *bool
+	// ExpiresBefore keeps the consents that expire before it.
+	ExpiresBefore time.Time
+}
+
+// Authorize checks that the consent is approved, unexpired at now and
+// grants every one of permissions.
+func (c *AccountConsent) Authorize(now time.Time, permissions ...string) error {
+	consentErr := &ConsentError{
+		Bank:      c.ConsentProvider,
+		ConsentID: c.ConsentID,
+		Status:    c.Status,
+	}
+	switch {
+	case c.Status != ConsentStatusApproved:
+		consentErr.Reason = ConsentReasonStatus
+		return consentErr
+	case !c.ExpiresAt.IsZero() && !now.Before(c.ExpiresAt):
+		consentErr.Reason = ConsentReasonExpired
+		return consentErr
+	}
+	for _, permission := range permissions {
+		if !slices.Contains(c.Permissions, permission) {
+			consentErr.Missing = append(consentErr.Missing, permission)
+		}
+	}
+	if len(consentErr.Missing) > 0 {
+		consentErr.Reason = ConsentReasonPermissions
+		return consentErr
+	}
+	return nil
+}
+
+// ConsentError tells why the consent of a bank does not allow a call.
+type ConsentError struct {
+	Bank      string `json:"bank" yaml:"bank"`
+	ConsentID string `json:"consent_id,omitempty" yaml:"consent_id"`
+	Reason    string `json:"reason" yaml:"reason"`
+	Status    string `json:"status,omitempty" yaml:"status"`
+	// Missing lists the permissions a new consent has to add.
+	Missing []string `json:"missing_permissions,omitempty" yaml:"missing_permissions"`
+}
+
+func (e *ConsentError) Error() string {
+	switch e.Reason {
+	case ConsentReasonStatus:
+		return fmt.Sprintf("%s: consent of bank %s is %s", ErrConsentInsufficient, e.Bank, e.Status)
+	case ConsentReasonExpired:
+		return fmt.Sprintf("%s: consent of bank %s has expired", ErrConsentInsufficient, e.Bank)
+	default:
+		return fmt.Sprintf("%s: consent of bank %s lacks %s", ErrConsentInsufficient, e.Bank, strings.Join(e.Missing, ", "))
+	}
+}
+
+func (e *ConsentError) Unwrap() error { return ErrConsentInsufficient }
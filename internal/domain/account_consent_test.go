@@ -0,0 +1,96 @@
+package domain_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+)
+
+func TestAccountConsentAuthorize(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	consent := func(status string, expiresAt time.Time) *domain.AccountConsent {
+		return &domain.AccountConsent{
+			ConsentID:       "consent-1",
+			ConsentProvider: "vbank",
+			Status:          status,
+			Permissions:     []string{domain.PermissionReadAccountsDetail, domain.PermissionReadBalances},
+			ExpiresAt:       expiresAt,
+		}
+	}
+
+	tests := []struct {
+		name        string
+		consent     *domain.AccountConsent
+		permissions []string
+		// wantReason is the reason of the *ConsentError, empty when allowed.
+		wantReason  string
+		wantMissing []string
+	}{
+		{
+			name:        "approved with the permissions",
+			consent:     consent(domain.ConsentStatusApproved, now.Add(time.Hour)),
+			permissions: []string{domain.PermissionReadBalances},
+		},
+		{
+			name:    "approved without an expiry",
+			consent: consent(domain.ConsentStatusApproved, time.Time{}),
+		},
+		{
+			name:        "lacking permissions",
+			consent:     consent(domain.ConsentStatusApproved, now.Add(time.Hour)),
+			permissions: []string{domain.PermissionReadBalances, domain.PermissionReadTransactionsDetail, domain.PermissionReadTransactionsCredits},
+			wantReason:  domain.ConsentReasonPermissions,
+			wantMissing: []string{domain.PermissionReadTransactionsDetail, domain.PermissionReadTransactionsCredits},
+		},
+		{
+			name:       "expiring now",
+			consent:    consent(domain.ConsentStatusApproved, now),
+			wantReason: domain.ConsentReasonExpired,
+		},
+		{
+			name:        "expired before its status caught up",
+			consent:     consent(domain.ConsentStatusApproved, now.Add(-time.Hour)),
+			permissions: []string{domain.PermissionReadTransactionsDetail},
+			wantReason:  domain.ConsentReasonExpired,
+		},
+		{
+			name:       "pending",
+			consent:    consent(domain.ConsentStatusPending, now.Add(time.Hour)),
+			wantReason: domain.ConsentReasonStatus,
+		},
+		{
+			name:       "revoked",
+			consent:    consent(domain.ConsentStatusRevoked, now.Add(time.Hour)),
+			wantReason: domain.ConsentReasonStatus,
+		},
+		{
+			name:       "marked expired",
+			consent:    consent(domain.ConsentStatusExpired, now.Add(-time.Hour)),
+			wantReason: domain.ConsentReasonStatus,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.consent.Authorize(now, tt.permissions...)
+			if tt.wantReason == "" {
+				if err != nil {
+					t.Fatalf("Authorize = %v, want nil", err)
+				}
+				return
+			}
+			var consentErr *domain.ConsentError
+			if !errors.As(err, &consentErr) || !errors.Is(err, domain.ErrConsentInsufficient) {
+				t.Fatalf("Authorize = %v, want a consent error", err)
+			}
+			if consentErr.Reason != tt.wantReason || !slices.Equal(consentErr.Missing, tt.wantMissing) {
+				t.Errorf("got reason %s missing %q, want %s missing %q", consentErr.Reason, consentErr.Missing, tt.wantReason, tt.wantMissing)
+			}
+			if consentErr.Bank != "vbank" || consentErr.ConsentID != "consent-1" || consentErr.Status != tt.consent.Status {
+				t.Errorf("got %+v, want the bank, ID and status of the consent", consentErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package domain
+
+import "time"
+
+const (
+	PeriodDay   = "day"
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+)
+
+// BalanceTypes lists balance types in order of preference when an account
+// reports several balances.
+var BalanceTypes = []string{
+	"InterimAvailable",
+	"InterimBooked",
+	"ClosingAvailable",
+	"ClosingBooked",
+	"Expected",
+	"OpeningAvailable",
+	"OpeningBooked",
+}
+
+// AccountSnapshot is the end of day state of an account, in its own currency.
+type AccountSnapshot struct {
+	ClientID  string    `json:"client_id" yaml:"client_id"`
+	AccountID string    `json:"account_id" yaml:"account_id"`
+	Bank      string    `json:"bank" yaml:"bank"`
+	Date      time.Time `json:"date" yaml:"date"`
+	Currency  string    `json:"currency" yaml:"currency"`
+	Balance   string    `json:"balance" yaml:"balance"`
+	Income    string    `json:"income" yaml:"income"`
+	Spending  string    `json:"spending" yaml:"spending"`
+}
+
+type NetWorth struct {
+	ClientID string             `json:"client_id" yaml:"client_id"`
+	Currency string             `json:"currency" yaml:"currency"`
+	From     time.Time          `json:"from" yaml:"from"`
+	To       time.Time          `json:"to" yaml:"to"`
+	Points   []*NetWorthPoint   `json:"points" yaml:"points"`
+	Accounts []*AccountNetWorth `json:"accounts" yaml:"accounts"`
+	Rates    []*ExchangeRate    `json:"rates" yaml:"rates"`
+	Unpriced []AccountRef       `json:"unpriced,omitempty" yaml:"unpriced"`
+}
+
+type NetWorthPoint struct {
+	Date  time.Time `json:"date" yaml:"date"`
+	Value string    `json:"value" yaml:"value"`
+}
+
+type AccountNetWorth struct {
+	AccountID string                  `json:"account_id" yaml:"account_id"`
+	Bank      string                  `json:"bank" yaml:"bank"`
+	Currency  string                  `json:"currency" yaml:"currency"`
+	Points    []*AccountNetWorthPoint `json:"points" yaml:"points"`
+}
+
+type AccountNetWorthPoint struct {
+	Date      time.Time `json:"date" yaml:"date"`
+	Balance   string    `json:"balance" yaml:"balance"`
+	Converted string    `json:"converted,omitempty" yaml:"converted"`
+}
+
+type Cashflow struct {
+	ClientID string             `json:"client_id" yaml:"client_id"`
+	Currency string             `json:"currency" yaml:"currency"`
+	Period   string             `json:"period" yaml:"period"`
+	From     time.Time          `json:"from" yaml:"from"`
+	To       time.Time          `json:"to" yaml:"to"`
+	Periods  []*CashflowPeriod  `json:"periods" yaml:"periods"`
+	Accounts []*AccountCashflow `json:"accounts" yaml:"accounts"`
+	Rates    []*ExchangeRate    `json:"rates" yaml:"rates"`
+	Unpriced []AccountRef       `json:"unpriced,omitempty" yaml:"unpriced"`
+}
+
+type CashflowPeriod struct {
+	Start    time.Time `json:"start" yaml:"start"`
+	Income   string    `json:"income" yaml:"income"`
+	Spending string    `json:"spending" yaml:"spending"`
+	Net      string    `json:"net" yaml:"net"`
+}
+
+type AccountCashflow struct {
+	AccountID string `json:"account_id" yaml:"account_id"`
+	Bank      string `json:"bank" yaml:"bank"`
+	Currency  string `json:"currency" yaml:"currency"`
+	Income    string `json:"income" yaml:"income"`
+	Spending  string `json:"spending" yaml:"spending"`
+	Net       string `json:"net" yaml:"net"`
+}
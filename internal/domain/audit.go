@@ -0,0 +1,64 @@
+package domain
+
+import "time"
+
+// Audited actions.
+const (
+	AuditActionAPIRequest  = "api.request"
+	AuditActionBankRequest = "bank.request"
+	// Consent actions reuse the types of the domain events recording them.
+	AuditActionConsentCreated       = EventTypeConsentCreated
+	AuditActionConsentStatusChanged = EventTypeConsentStatusChanged
+)
+
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeDenied  = "denied"
+	AuditOutcomeFailure = "failure"
+)
+
+// AuditEntry records an access to the data of a client or an action on one
+// of their consents. Entries are chained: Hash covers the entry and the Hash
+// of the entry before it, so that changing or removing an entry breaks the
+// chain from there on.
+type AuditEntry struct {
+	Sequence  int64  `json:"sequence" yaml:"sequence"`
+	ClientID  string `json:"client_id" yaml:"client_id"`
+	Action    string `json:"action" yaml:"action"`
+	ConsentID string `json:"consent_id,omitempty" yaml:"consent_id"`
+	Bank      string `json:"bank,omitempty" yaml:"bank"`
+	// Endpoint is the method and the route of the API or the path of the bank API called.
+	Endpoint   string    `json:"endpoint,omitempty" yaml:"endpoint"`
+	Outcome    string    `json:"outcome" yaml:"outcome"`
+	StatusCode int       `json:"status_code,omitempty" yaml:"status_code"`
+	Error      string    `json:"error,omitempty" yaml:"error"`
+	RequestID  string    `json:"request_id,omitempty" yaml:"request_id"`
+	OccurredAt time.Time `json:"occurred_at" yaml:"occurred_at"`
+	PrevHash   string    `json:"prev_hash" yaml:"prev_hash"`
+	Hash       string    `json:"hash" yaml:"hash"`
+}
+
+// AuditFilter selects audit entries in sequence order. Empty fields match everything.
+type AuditFilter struct {
+	ClientID  string
+	Action    string
+	ConsentID string
+	Bank      string
+	RequestID string
+	From      time.Time
+	To        time.Time
+	// AfterSequence skips the entries up to and including it, for paging.
+	AfterSequence int64
+	Limit         int
+}
+
+// AuditVerification is the result of checking a stretch of the audit chain.
+type AuditVerification struct {
+	Valid         bool  `json:"valid" yaml:"valid"`
+	FirstSequence int64 `json:"first_sequence" yaml:"first_sequence"`
+	LastSequence  int64 `json:"last_sequence" yaml:"last_sequence"`
+	Checked       int   `json:"checked" yaml:"checked"`
+	// BrokenAt is the sequence of the first entry that does not match the chain.
+	BrokenAt int64  `json:"broken_at,omitempty" yaml:"broken_at"`
+	Reason   string `json:"reason,omitempty" yaml:"reason"`
+}
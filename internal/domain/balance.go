@@ -0,0 +1,20 @@
+package domain
+
+import "time"
+
+const (
+	CreditDebitCredit = "Credit"
+	CreditDebitDebit  = "Debit"
+)
+
+type Balance struct {
+	// ClientID and Bank scope AccountID, which banks only keep unique among their own accounts.
+	ClientID  string `json:"-" yaml:"client_id"`
+	Bank      string `json:"-" yaml:"bank"`
+	AccountID string `json:"account_id" yaml:"account_id"`
+	Type      string `json:"type" yaml:"type"`
+	// Amount is a signed decimal, negative for debit balances.
+	Amount   string    `json:"amount" yaml:"amount"`
+	Currency string    `json:"currency" yaml:"currency"`
+	AsOf     time.Time `json:"as_of" yaml:"as_of"`
+}
@@ -1 +1,26 @@
 package domain
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// BankError is a non-successful response of a bank API.
+type BankError struct {
+	Bank          string `json:"bank" yaml:"bank"`
+	StatusCode    int    `json:"status_code" yaml:"status_code"`
+	Code          string `json:"code,omitempty" yaml:"code"`
+	Message       string `json:"message,omitempty" yaml:"message"`
+	InteractionID string `json:"interaction_id,omitempty" yaml:"interaction_id"`
+}
+
+func (e *BankError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	if e.Code != "" {
+		return fmt.Sprintf("bank %s responded %d %s: %s", e.Bank, e.StatusCode, e.Code, msg)
+	}
+	return fmt.Sprintf("bank %s responded %d: %s", e.Bank, e.StatusCode, msg)
+}
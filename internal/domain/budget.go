@@ -0,0 +1,46 @@
+package domain
+
+import "time"
+
+// Budget limits the monthly spending of a client in a category or at a
+// merchant. Exactly one of Category and Merchant is set.
+type Budget struct {
+	BudgetID string `json:"budget_id" yaml:"budget_id"`
+	ClientID string `json:"client_id" yaml:"client_id"`
+	Name     string `json:"name" yaml:"name"`
+	Category string `json:"category,omitempty" yaml:"category"`
+	Merchant string `json:"merchant,omitempty" yaml:"merchant"`
+	Limit    string `json:"limit" yaml:"limit"`
+	Currency string `json:"currency" yaml:"currency"`
+	// Rollover carries the unspent amount, or the overspend, into the next month.
+	Rollover  bool      `json:"rollover" yaml:"rollover"`
+	CreatedAt time.Time `json:"created_at" yaml:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" yaml:"updated_at"`
+}
+
+type BudgetProgress struct {
+	Budget      *Budget   `json:"budget" yaml:"budget"`
+	PeriodStart time.Time `json:"period_start" yaml:"period_start"`
+	PeriodEnd   time.Time `json:"period_end" yaml:"period_end"`
+	Carryover   string    `json:"carryover" yaml:"carryover"`
+	// Available is the limit adjusted by the carryover.
+	Available string `json:"available" yaml:"available"`
+	Spent     string `json:"spent" yaml:"spent"`
+	Remaining string `json:"remaining" yaml:"remaining"`
+	// Percent is the share of Available spent, rounded down.
+	Percent int `json:"percent" yaml:"percent"`
+}
+
+// BudgetAlert records that spending of a budget crossed Threshold percent
+// within the period starting at Period. It is raised once per threshold and period.
+type BudgetAlert struct {
+	AlertID   string    `json:"alert_id" yaml:"alert_id"`
+	BudgetID  string    `json:"budget_id" yaml:"budget_id"`
+	ClientID  string    `json:"client_id" yaml:"client_id"`
+	Period    time.Time `json:"period" yaml:"period"`
+	Threshold int       `json:"threshold" yaml:"threshold"`
+	Spent     string    `json:"spent" yaml:"spent"`
+	Available string    `json:"available" yaml:"available"`
+	Currency  string    `json:"currency" yaml:"currency"`
+	CreatedAt time.Time `json:"created_at" yaml:"created_at"`
+}
@@ -0,0 +1,79 @@
+package domain
+
+import "time"
+
+const (
+	CategoryGroceries     = "groceries"
+	CategoryRestaurants   = "restaurants"
+	CategoryTransport     = "transport"
+	CategoryTravel        = "travel"
+	CategoryShopping      = "shopping"
+	CategoryHealth        = "health"
+	CategoryUtilities     = "utilities"
+	CategorySubscriptions = "subscriptions"
+	CategoryEntertainment = "entertainment"
+	CategorySport         = "sport"
+	CategoryCash          = "cash"
+	CategoryFees          = "fees"
+	CategorySalary        = "salary"
+	CategoryIncome        = "income"
+	CategoryTransfers     = "transfers"
+	CategoryOther         = "other"
+)
+
+// Categories lists every category a transaction can be classified into.
+var Categories = []string{
+	CategoryGroceries,
+	CategoryRestaurants,
+	CategoryTransport,
+	CategoryTravel,
+	CategoryShopping,
+	CategoryHealth,
+	CategoryUtilities,
+	CategorySubscriptions,
+	CategoryEntertainment,
+	CategorySport,
+	CategoryCash,
+	CategoryFees,
+	CategorySalary,
+	CategoryIncome,
+	CategoryTransfers,
+	CategoryOther,
+}
+
+// CategorySource tells which step of categorisation assigned the category.
+const (
+	CategorySourceOverride = "override"
+	CategorySourceRule     = "rule"
+	CategorySourceMCC      = "mcc"
+	CategorySourceTransfer = "transfer"
+	CategorySourceDefault  = "default"
+)
+
+const (
+	MatchFieldMerchant    = "merchant"
+	MatchFieldDescription = "description"
+)
+
+// CategoryRule assigns Category to transactions whose MatchField contains
+// Pattern, ignoring case. Rules without a ClientID apply to every client.
+type CategoryRule struct {
+	RuleID     string    `json:"rule_id" yaml:"rule_id"`
+	ClientID   string    `json:"client_id,omitempty" yaml:"client_id"`
+	MatchField string    `json:"match_field" yaml:"match_field"`
+	Pattern    string    `json:"pattern" yaml:"pattern"`
+	Category   string    `json:"category" yaml:"category"`
+	CreatedAt  time.Time `json:"created_at" yaml:"created_at"`
+}
+
+type TransactionFilter struct {
+	ClientID string
+	// Bank scopes AccountID, which banks only keep unique among their own accounts.
+	Bank      string
+	AccountID string
+	// TransactionID is unique within its account only.
+	TransactionID string
+	Category      string
+	From          time.Time
+	To            time.Time
+}
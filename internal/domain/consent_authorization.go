@@ -0,0 +1,34 @@
+package domain
+
+import "time"
+
+// ConsentAuthorization is a pending redirect of the client to its bank to
+// approve a consent. It is looked up by the hash of its state when the bank
+// redirects back and can be completed once.
+type ConsentAuthorization struct {
+	StateHash string `json:"-" yaml:"state_hash"`
+	ClientID  string `json:"client_id" yaml:"client_id"`
+	ConsentID string `json:"consent_id" yaml:"consent_id"`
+	Bank      string `json:"bank" yaml:"bank"`
+	// CodeVerifier is the PKCE secret sent to the bank with the authorisation code.
+	CodeVerifier string `json:"-" yaml:"code_verifier"`
+	// ReturnTo is the deep link the client is sent to once the flow ends.
+	ReturnTo  string    `json:"return_to" yaml:"return_to"`
+	CreatedAt time.Time `json:"created_at" yaml:"created_at"`
+	ExpiresAt time.Time `json:"expires_at" yaml:"expires_at"`
+}
+
+// ConsentAuthorizationRedirect tells the bank where to send the client back
+// and how to bind the authorisation code to the flow.
+type ConsentAuthorizationRedirect struct {
+	RedirectURI   string
+	State         string
+	CodeChallenge string
+}
+
+// ConsentAuthorizationLink is where to send the client to approve a consent.
+type ConsentAuthorizationLink struct {
+	AuthorizationURL string    `json:"authorization_url" yaml:"authorization_url"`
+	State            string    `json:"state" yaml:"state"`
+	ExpiresAt        time.Time `json:"expires_at" yaml:"expires_at"`
+}
@@ -0,0 +1,6 @@
+package domain
+
+import "errors"
+
+// ErrNotFound is returned by repositories when the requested entity does not exist.
+var ErrNotFound = errors.New("not found")
@@ -0,0 +1,117 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Domain event types.
+const (
+	EventTypeConsentCreated       = "consent.created"
+	EventTypeConsentStatusChanged = "consent.status_changed"
+	EventTypeConsentExpiring      = "consent.expiring"
+	EventTypeConsentExpired       = "consent.expired"
+	EventTypeAccountDiscovered    = "account.discovered"
+	EventTypeTransactionsSynced   = "transactions.synced"
+	EventTypePlanChanged          = "plan.changed"
+)
+
+const (
+	EventStatusPending    = "pending"
+	EventStatusDispatched = "dispatched"
+	EventStatusFailed     = "failed"
+)
+
+// Event records a state change of the domain. It is written to the outbox in
+// the same unit of work as the change and dispatched once that commits.
+type Event struct {
+	EventID string `json:"event_id" yaml:"event_id"`
+	// Sequence orders the events in the outbox.
+	Sequence int64  `json:"sequence" yaml:"sequence"`
+	Type     string `json:"type" yaml:"type"`
+	ClientID string `json:"client_id" yaml:"client_id"`
+	// AggregateID identifies the entity the event is about, such as a consent or an account.
+	AggregateID string          `json:"aggregate_id" yaml:"aggregate_id"`
+	Payload     json.RawMessage `json:"payload" yaml:"payload"`
+	OccurredAt  time.Time       `json:"occurred_at" yaml:"occurred_at"`
+
+	Status       string    `json:"-" yaml:"status"`
+	Attempts     int       `json:"-" yaml:"attempts"`
+	LastError    string    `json:"-" yaml:"last_error"`
+	DispatchedAt time.Time `json:"-" yaml:"dispatched_at"`
+	// ClaimedUntil is when the event may be claimed again: when the claim of
+	// the dispatcher delivering it lapses, or when the backoff after a failed
+	// delivery ends. Zero when it may be claimed at once.
+	ClaimedUntil time.Time `json:"-" yaml:"claimed_until"`
+	// Delivered names what the event has reached so far: its subscribers and
+	// the sinks that accepted it. A retried delivery skips them.
+	Delivered []string `json:"-" yaml:"delivered"`
+}
+
+// NewEvent creates an event of eventType about the aggregate with payload encoded as JSON.
+func NewEvent(eventType, clientID, aggregateID string, payload any) (*Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &Event{
+		Type:        eventType,
+		ClientID:    clientID,
+		AggregateID: aggregateID,
+		Payload:     data,
+	}, nil
+}
+
+// Decode unmarshals the payload of the event into v.
+func (e *Event) Decode(v any) error {
+	return json.Unmarshal(e.Payload, v)
+}
+
+// ConsentCreated is the payload of EventTypeConsentCreated.
+type ConsentCreated struct {
+	ConsentID   string   `json:"consent_id" yaml:"consent_id"`
+	Bank        string   `json:"bank" yaml:"bank"`
+	Status      string   `json:"status" yaml:"status"`
+	Permissions []string `json:"permissions" yaml:"permissions"`
+}
+
+// ConsentStatusChanged is the payload of EventTypeConsentStatusChanged.
+type ConsentStatusChanged struct {
+	ConsentID      string `json:"consent_id" yaml:"consent_id"`
+	Bank           string `json:"bank" yaml:"bank"`
+	PreviousStatus string `json:"previous_status" yaml:"previous_status"`
+	Status         string `json:"status" yaml:"status"`
+}
+
+// ConsentExpiry is the payload of EventTypeConsentExpiring and EventTypeConsentExpired.
+type ConsentExpiry struct {
+	ConsentID   string    `json:"consent_id" yaml:"consent_id"`
+	Bank        string    `json:"bank" yaml:"bank"`
+	Permissions []string  `json:"permissions" yaml:"permissions"`
+	ExpiresAt   time.Time `json:"expires_at" yaml:"expires_at"`
+}
+
+// AccountDiscovered is the payload of EventTypeAccountDiscovered.
+type AccountDiscovered struct {
+	AccountID   string `json:"account_id" yaml:"account_id"`
+	Bank        string `json:"bank" yaml:"bank"`
+	Currency    string `json:"currency" yaml:"currency"`
+	AccountType string `json:"account_type" yaml:"account_type"`
+}
+
+// TransactionsSynced is the payload of EventTypeTransactionsSynced.
+type TransactionsSynced struct {
+	Accounts []AccountRef `json:"accounts" yaml:"accounts"`
+	From     time.Time    `json:"from" yaml:"from"`
+	Count    int          `json:"count" yaml:"count"`
+	// New is how many of the transactions were seen for the first time.
+	New int `json:"new" yaml:"new"`
+}
+
+// PlanChanged is the payload of EventTypePlanChanged.
+type PlanChanged struct {
+	PreviousPlan string `json:"previous_plan" yaml:"previous_plan"`
+	Plan         string `json:"plan" yaml:"plan"`
+	ChangedBy    string `json:"changed_by,omitempty" yaml:"changed_by"`
+	Reason       string `json:"reason,omitempty" yaml:"reason"`
+}
@@ -0,0 +1,29 @@
+package domain
+
+import "time"
+
+// ExchangeRate is the price of one unit of Currency in BaseCurrency on Date.
+type ExchangeRate struct {
+	Date         time.Time `json:"date" yaml:"date"`
+	Currency     string    `json:"currency" yaml:"currency"`
+	BaseCurrency string    `json:"base_currency" yaml:"base_currency"`
+	Rate         string    `json:"rate" yaml:"rate"`
+	Source       string    `json:"source" yaml:"source"`
+}
+
+type AccountTotal struct {
+	Account *Account `json:"account" yaml:"account"`
+	Balance *Balance `json:"balance" yaml:"balance"`
+	// Converted is the balance in the currency of the enclosing Totals.
+	Converted string `json:"converted" yaml:"converted"`
+}
+
+type Totals struct {
+	ClientID string          `json:"client_id" yaml:"client_id"`
+	Currency string          `json:"currency" yaml:"currency"`
+	Date     time.Time       `json:"date" yaml:"date"`
+	Total    string          `json:"total" yaml:"total"`
+	Accounts []*AccountTotal `json:"accounts" yaml:"accounts"`
+	Rates    []*ExchangeRate `json:"rates" yaml:"rates"`
+	Unpriced []AccountRef    `json:"unpriced,omitempty" yaml:"unpriced"`
+}
@@ -0,0 +1,17 @@
+package domain
+
+import "time"
+
+type IdempotencyRecord struct {
+	Key         string    `json:"key" yaml:"key"`
+	ClientID    string    `json:"client_id" yaml:"client_id"`
+	Method      string    `json:"method" yaml:"method"`
+	Path        string    `json:"path" yaml:"path"`
+	Fingerprint string    `json:"fingerprint" yaml:"fingerprint"`
+	Completed   bool      `json:"completed" yaml:"completed"`
+	StatusCode  int       `json:"status_code" yaml:"status_code"`
+	ContentType string    `json:"content_type" yaml:"content_type"`
+	Body        []byte    `json:"body" yaml:"body"`
+	CreatedAt   time.Time `json:"created_at" yaml:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at" yaml:"expires_at"`
+}
@@ -0,0 +1,67 @@
+package domain
+
+import "time"
+
+// Notification events.
+const (
+	EventConsentApproved = "consent.approved"
+	EventConsentExpiring = "consent.expiring"
+	EventConsentExpired  = "consent.expired"
+	EventSyncFailed      = "sync.failed"
+	EventBudgetAlert     = "budget.alert"
+)
+
+// Notification channels.
+const (
+	ChannelWebhook = "webhook"
+	ChannelEmail   = "email"
+	ChannelPush    = "push"
+)
+
+const (
+	DeliveryStatusPending = "pending"
+	DeliveryStatusSent    = "sent"
+	DeliveryStatusFailed  = "failed"
+)
+
+// Notification is something that happened to a client that they may want to
+// hear about. Data holds the values rendered into the message templates.
+type Notification struct {
+	NotificationID string            `json:"notification_id" yaml:"notification_id"`
+	ClientID       string            `json:"client_id" yaml:"client_id"`
+	Event          string            `json:"event" yaml:"event"`
+	Data           map[string]string `json:"data" yaml:"data"`
+	CreatedAt      time.Time         `json:"created_at" yaml:"created_at"`
+}
+
+// NotificationPreference tells where, and for which events, a client is
+// notified over a channel.
+type NotificationPreference struct {
+	ClientID string `json:"client_id" yaml:"client_id"`
+	Channel  string `json:"channel" yaml:"channel"`
+	Enabled  bool   `json:"enabled" yaml:"enabled"`
+	// Target is the webhook URL, the email address or the push device token.
+	Target string `json:"target" yaml:"target"`
+	// Events limits the notifications to the listed events, all when empty.
+	Events    []string  `json:"events" yaml:"events"`
+	UpdatedAt time.Time `json:"updated_at" yaml:"updated_at"`
+}
+
+// NotificationDelivery is a rendered notification on its way over a channel.
+type NotificationDelivery struct {
+	DeliveryID     string            `json:"delivery_id" yaml:"delivery_id"`
+	NotificationID string            `json:"notification_id" yaml:"notification_id"`
+	ClientID       string            `json:"client_id" yaml:"client_id"`
+	Event          string            `json:"event" yaml:"event"`
+	Channel        string            `json:"channel" yaml:"channel"`
+	Target         string            `json:"target" yaml:"target"`
+	Subject        string            `json:"subject" yaml:"subject"`
+	Body           string            `json:"body" yaml:"body"`
+	Data           map[string]string `json:"data" yaml:"data"`
+	Status         string            `json:"status" yaml:"status"`
+	Attempts       int               `json:"attempts" yaml:"attempts"`
+	LastError      string            `json:"last_error,omitempty" yaml:"last_error"`
+	NextAttemptAt  time.Time         `json:"next_attempt_at" yaml:"next_attempt_at"`
+	CreatedAt      time.Time         `json:"created_at" yaml:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at" yaml:"updated_at"`
+}
@@ -0,0 +1,123 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Plan names of the subscription tiers.
+const (
+	PlanFree    = "free"
+	PlanPlus    = "plus"
+	PlanPremium = "premium"
+)
+
+// Features gated by the plan of a client.
+const (
+	FeatureBanks     = "banks"
+	FeatureSync      = "sync"
+	FeatureAnalytics = "analytics"
+	FeatureExport    = "export"
+	FeaturePayments  = "payments"
+)
+
+// ErrPlanLimit is wrapped by every *PlanLimitError.
+var ErrPlanLimit = errors.New("plan limit reached")
+
+// Plan is a subscription tier and what it allows.
+type Plan struct {
+	Name string `json:"name" yaml:"name"`
+	// MaxBanks caps the banks connected at once, zero means no cap.
+	MaxBanks int `json:"max_banks" yaml:"max_banks"`
+	// SyncInterval is the least time between two syncs with the banks,
+	// zero means no limit.
+	SyncInterval time.Duration `json:"-" yaml:"sync_interval"`
+	Analytics    bool          `json:"analytics" yaml:"analytics"`
+	Export       bool          `json:"export" yaml:"export"`
+	// PaymentLimit caps the amount of a single payment, empty means no cap.
+	PaymentLimit string `json:"payment_limit,omitempty" yaml:"payment_limit"`
+}
+
+// MarshalJSON writes the sync interval in whole seconds.
+func (p Plan) MarshalJSON() ([]byte, error) {
+	type plan Plan
+	return json.Marshal(struct {
+		plan
+		SyncIntervalSeconds int64 `json:"sync_interval_seconds"`
+	}{plan(p), int64(p.SyncInterval / time.Second)})
+}
+
+// Includes reports whether the plan gives access to the on/off feature.
+func (p *Plan) Includes(feature string) bool {
+	switch feature {
+	case FeatureAnalytics:
+		return p.Analytics
+	case FeatureExport:
+		return p.Export
+	default:
+		return true
+	}
+}
+
+// ClientPlan is the plan a client is subscribed to.
+type ClientPlan struct {
+	ClientID string `json:"client_id" yaml:"client_id"`
+	Plan     string `json:"plan" yaml:"plan"`
+	// ChangedAt is when the client moved to the plan, zero for the default plan.
+	ChangedAt time.Time `json:"changed_at,omitzero" yaml:"changed_at"`
+}
+
+// ClientSync is when a client last synced with its banks and whether a sync
+// of the client is running.
+type ClientSync struct {
+	ClientID string `json:"client_id" yaml:"client_id"`
+	// SyncedAt is when the last sync succeeded, zero if none did.
+	SyncedAt time.Time `json:"synced_at,omitzero" yaml:"synced_at"`
+	// ReservedUntil is when the reservation of the running sync lapses, zero
+	// if none is running.
+	ReservedUntil time.Time `json:"reserved_until,omitzero" yaml:"reserved_until"`
+}
+
+// PlanChange records a client moving from one plan to another.
+type PlanChange struct {
+	ClientID     string `json:"client_id" yaml:"client_id"`
+	PreviousPlan string `json:"previous_plan" yaml:"previous_plan"`
+	Plan         string `json:"plan" yaml:"plan"`
+	// ChangedBy identifies who made the change.
+	ChangedBy string    `json:"changed_by,omitempty" yaml:"changed_by"`
+	Reason    string    `json:"reason,omitempty" yaml:"reason"`
+	ChangedAt time.Time `json:"changed_at" yaml:"changed_at"`
+}
+
+// Subscription is the current plan of a client and how it got there.
+type Subscription struct {
+	ClientID  string        `json:"client_id" yaml:"client_id"`
+	Plan      Plan          `json:"plan" yaml:"plan"`
+	ChangedAt time.Time     `json:"changed_at,omitzero" yaml:"changed_at"`
+	History   []*PlanChange `json:"history,omitempty" yaml:"history"`
+}
+
+// PlanLimitError tells which limit of its plan a client ran into.
+type PlanLimitError struct {
+	Plan    string `json:"plan" yaml:"plan"`
+	Feature string `json:"feature" yaml:"feature"`
+	// Limit is the cap of the plan, empty for features it does not include.
+	Limit string `json:"limit,omitempty" yaml:"limit"`
+	// RetryAfter is how long until the next sync is allowed.
+	RetryAfter time.Duration `json:"-" yaml:"-"`
+}
+
+func (e *PlanLimitError) Error() string {
+	switch {
+	case e.Limit == "":
+		return fmt.Sprintf("%s: %s is not included in plan %s", ErrPlanLimit, e.Feature, e.Plan)
+	case e.Feature == FeatureSync:
+		return fmt.Sprintf("%s: plan %s syncs once every %s", ErrPlanLimit, e.Plan, e.Limit)
+	default:
+		return fmt.Sprintf("%s: plan %s allows %s up to %s", ErrPlanLimit, e.Plan, e.Feature, e.Limit)
+	}
+}
+
+func (e *PlanLimitError) Unwrap() error { return ErrPlanLimit }
@@ -0,0 +1,45 @@
+package domain
+
+import "time"
+
+const (
+	FrequencyWeekly    = "weekly"
+	FrequencyBiweekly  = "biweekly"
+	FrequencyMonthly   = "monthly"
+	FrequencyQuarterly = "quarterly"
+	FrequencyYearly    = "yearly"
+)
+
+const (
+	RecurringStatusActive = "active"
+	// RecurringStatusMissed marks a charge that did not come when expected.
+	RecurringStatusMissed = "missed"
+)
+
+// RecurringPayment is a charge detected to repeat at a regular interval.
+// Amounts are positive.
+type RecurringPayment struct {
+	ClientID    string       `json:"client_id" yaml:"client_id"`
+	Merchant    string       `json:"merchant" yaml:"merchant"`
+	Category    string       `json:"category" yaml:"category"`
+	AccountID   string       `json:"account_id" yaml:"account_id"`
+	Bank        string       `json:"bank" yaml:"bank"`
+	Frequency   string       `json:"frequency" yaml:"frequency"`
+	Currency    string       `json:"currency" yaml:"currency"`
+	Amount      string       `json:"amount" yaml:"amount"`
+	Occurrences int          `json:"occurrences" yaml:"occurrences"`
+	LastDate    time.Time    `json:"last_date" yaml:"last_date"`
+	LastAmount  string       `json:"last_amount" yaml:"last_amount"`
+	NextDate    time.Time    `json:"next_date" yaml:"next_date"`
+	NextAmount  string       `json:"next_amount" yaml:"next_amount"`
+	Status      string       `json:"status" yaml:"status"`
+	PriceChange *PriceChange `json:"price_change,omitempty" yaml:"price_change"`
+	// TransactionIDs of the detected charges, oldest first.
+	TransactionIDs []string `json:"transaction_ids" yaml:"transaction_ids"`
+}
+
+type PriceChange struct {
+	Date     time.Time `json:"date" yaml:"date"`
+	Previous string    `json:"previous" yaml:"previous"`
+	Current  string    `json:"current" yaml:"current"`
+}
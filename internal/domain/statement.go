@@ -0,0 +1,16 @@
+package domain
+
+import "time"
+
+// Statement is the booked history of an account over a period, bounded by
+// the balances at its start and end.
+type Statement struct {
+	Account        *Account       `json:"account" yaml:"account"`
+	From           time.Time      `json:"from" yaml:"from"`
+	To             time.Time      `json:"to" yaml:"to"`
+	Currency       string         `json:"currency" yaml:"currency"`
+	OpeningBalance string         `json:"opening_balance" yaml:"opening_balance"`
+	ClosingBalance string         `json:"closing_balance" yaml:"closing_balance"`
+	Transactions   []*Transaction `json:"transactions" yaml:"transactions"`
+	GeneratedAt    time.Time      `json:"generated_at" yaml:"generated_at"`
+}
@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Live stream event types, besides the domain event types forwarded as is.
+const (
+	StreamEventSyncProgress    = "sync.progress"
+	StreamEventNewTransactions = "transactions.new"
+	// StreamEventReset tells the client that events were missed while it was
+	// away, so it has to reload its state instead of resuming.
+	StreamEventReset = "stream.reset"
+)
+
+const (
+	SyncStatusStarted   = "started"
+	SyncStatusCompleted = "completed"
+	SyncStatusFailed    = "failed"
+)
+
+// StreamEvent is an update pushed live to the connected clients of a user.
+type StreamEvent struct {
+	// ID grows with every event pushed, so the client can resume after it.
+	ID        uint64          `json:"id" yaml:"id"`
+	ClientID  string          `json:"client_id" yaml:"client_id"`
+	Type      string          `json:"type" yaml:"type"`
+	Data      json.RawMessage `json:"data" yaml:"data"`
+	CreatedAt time.Time       `json:"created_at" yaml:"created_at"`
+}
+
+// SyncProgress reports how fetching data from a bank goes.
+type SyncProgress struct {
+	Bank     string `json:"bank" yaml:"bank"`
+	Status   string `json:"status" yaml:"status"`
+	Accounts int    `json:"accounts,omitempty" yaml:"accounts"`
+	Error    string `json:"error,omitempty" yaml:"error"`
+}
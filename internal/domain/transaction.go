@@ -0,0 +1,33 @@
+package domain
+
+import "time"
+
+const (
+	TransactionStatusBooked  = "Booked"
+	TransactionStatusPending = "Pending"
+)
+
+type Transaction struct {
+	TransactionID string `json:"transaction_id" yaml:"transaction_id"`
+	AccountID     string `json:"account_id" yaml:"account_id"`
+	ClientID      string `json:"client_id" yaml:"client_id"`
+	Bank          string `json:"bank" yaml:"bank"`
+	// Amount is a signed decimal, negative for debits.
+	Amount      string    `json:"amount" yaml:"amount"`
+	Currency    string    `json:"currency" yaml:"currency"`
+	Status      string    `json:"status" yaml:"status"`
+	BookedAt    time.Time `json:"booked_at" yaml:"booked_at"`
+	ValueAt     time.Time `json:"value_at" yaml:"value_at"`
+	Description string    `json:"description" yaml:"description"`
+	Merchant    string    `json:"merchant,omitempty" yaml:"merchant"`
+	// MCC is the ISO 18245 merchant category code.
+	MCC string `json:"mcc,omitempty" yaml:"mcc"`
+	// Counterparty identifies the other account, if the bank reports it.
+	Counterparty     string `json:"counterparty,omitempty" yaml:"counterparty"`
+	CounterpartyName string `json:"counterparty_name,omitempty" yaml:"counterparty_name"`
+	Category         string `json:"category" yaml:"category"`
+	CategorySource   string `json:"category_source" yaml:"category_source"`
+	// TransferID links the transaction to the other leg of a transfer between
+	// the client's own accounts.
+	TransferID string `json:"transfer_id,omitempty" yaml:"transfer_id"`
+}
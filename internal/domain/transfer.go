@@ -0,0 +1,29 @@
+package domain
+
+import "time"
+
+const (
+	// TransferMatchCounterparty marks pairs where a counterparty names one of the client's accounts.
+	TransferMatchCounterparty = "counterparty"
+	// TransferMatchCategory marks pairs found by amount, date and transfer category alone.
+	TransferMatchCategory = "category"
+)
+
+// TransferPair links the debit and credit legs of money moved between two
+// accounts of the same client. Both legs carry its TransferID.
+type TransferPair struct {
+	TransferID          string    `json:"transfer_id" yaml:"transfer_id"`
+	ClientID            string    `json:"client_id" yaml:"client_id"`
+	DebitBank           string    `json:"debit_bank" yaml:"debit_bank"`
+	DebitAccountID      string    `json:"debit_account_id" yaml:"debit_account_id"`
+	DebitTransactionID  string    `json:"debit_transaction_id" yaml:"debit_transaction_id"`
+	CreditBank          string    `json:"credit_bank" yaml:"credit_bank"`
+	CreditAccountID     string    `json:"credit_account_id" yaml:"credit_account_id"`
+	CreditTransactionID string    `json:"credit_transaction_id" yaml:"credit_transaction_id"`
+	Amount              string    `json:"amount" yaml:"amount"`
+	Currency            string    `json:"currency" yaml:"currency"`
+	DebitBookedAt       time.Time `json:"debit_booked_at" yaml:"debit_booked_at"`
+	CreditBookedAt      time.Time `json:"credit_booked_at" yaml:"credit_booked_at"`
+	MatchedBy           string    `json:"matched_by" yaml:"matched_by"`
+	CreatedAt           time.Time `json:"created_at" yaml:"created_at"`
+}
@@ -1,11 +1,29 @@
 package domain
 
-import uuid "github.com/google/uuid"
+import (
+	uuid "github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
 
 type User struct {
-	ID               uuid.UUID
-	Name             string
-	Email            string
-	SubscriptionType int
-	Password         string
+	ID    uuid.UUID
+	Name  string
+	Email string
+	// PasswordHash is the bcrypt hash of the password, which itself is never kept.
+	PasswordHash []byte
+}
+
+// SetPassword replaces the password of the user.
+func (u *User) SetPassword(password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.PasswordHash = hash
+	return nil
+}
+
+// CheckPassword reports whether password is the password of the user.
+func (u *User) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword(u.PasswordHash, []byte(password)) == nil
 }
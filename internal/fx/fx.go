@@ -1,15 +1,36 @@
 package fx
 
 import (
+	"fmt"
+
 	"github.com/MichaelSBoop/lima-backend/config"
 	httpadapters "github.com/MichaelSBoop/lima-backend/internal/adapters/http"
 	"github.com/MichaelSBoop/lima-backend/internal/httpsrv"
+	"github.com/MichaelSBoop/lima-backend/internal/infra/memory"
 	"github.com/MichaelSBoop/lima-backend/internal/infra/postgres"
+	"github.com/MichaelSBoop/lima-backend/internal/infra/storage"
 	"github.com/MichaelSBoop/lima-backend/internal/service/accounts"
+	"github.com/MichaelSBoop/lima-backend/internal/service/analytics"
+	"github.com/MichaelSBoop/lima-backend/internal/service/audit"
+	"github.com/MichaelSBoop/lima-backend/internal/service/budgets"
+	"github.com/MichaelSBoop/lima-backend/internal/service/categories"
+	"github.com/MichaelSBoop/lima-backend/internal/service/consents"
+	"github.com/MichaelSBoop/lima-backend/internal/service/events"
+	"github.com/MichaelSBoop/lima-backend/internal/service/notifications"
 	"github.com/MichaelSBoop/lima-backend/internal/service/oauth"
+	"github.com/MichaelSBoop/lima-backend/internal/service/plans"
+	"github.com/MichaelSBoop/lima-backend/internal/service/rates"
+	"github.com/MichaelSBoop/lima-backend/internal/service/recurring"
+	"github.com/MichaelSBoop/lima-backend/internal/service/reencrypt"
 	"github.com/MichaelSBoop/lima-backend/internal/service/requester"
+	"github.com/MichaelSBoop/lima-backend/internal/service/statements"
+	"github.com/MichaelSBoop/lima-backend/internal/service/stream"
+	"github.com/MichaelSBoop/lima-backend/internal/service/transactions"
+	"github.com/MichaelSBoop/lima-backend/internal/service/transfers"
 	"github.com/MichaelSBoop/lima-backend/pkg/cache"
 	"github.com/MichaelSBoop/lima-backend/pkg/cache/inmem"
+	"github.com/MichaelSBoop/lima-backend/pkg/fieldcrypt"
+	"github.com/MichaelSBoop/lima-backend/pkg/httpclient"
 	"github.com/MichaelSBoop/lima-backend/pkg/logger"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
@@ -21,11 +42,120 @@ func New(cfg *config.Config) fx.App {
 		fx.Provide(
 			logger.New,
 		),
+		fx.Provide(
+			httpclient.New,
+		),
 		fx.Provide(
 			httpadapters.New,
 		),
 		fx.Provide(
-			accounts.New,
+			fx.Annotate(
+				accounts.New,
+				fx.As(new(analytics.BalancesSyncer)),
+				fx.As(new(consents.ConsentCreator)),
+				fx.As(new(consents.StatusSetter)),
+				fx.As(fx.Self()),
+			),
+			fx.Annotate(
+				transactions.New,
+				fx.As(new(analytics.TransactionsSyncer)),
+				fx.As(fx.Self()),
+			),
+			analytics.New,
+			consents.New,
+			fx.Annotate(
+				budgets.New,
+				fx.As(new(transactions.SyncListener)),
+				fx.As(fx.Self()),
+			),
+			fx.Annotate(
+				notifications.New,
+				fx.As(new(budgets.AlertPublisher)),
+				fx.As(new(analytics.Notifier)),
+				fx.As(fx.Self()),
+			),
+			fx.Annotate(
+				func(s *notifications.Service) events.Subscriber { return s },
+				fx.ResultTags(`group:"event_subscribers"`),
+			),
+			fx.Annotate(
+				notifications.NewWebhookSender,
+				fx.As(new(notifications.Sender)),
+				fx.ResultTags(`group:"notification_senders"`),
+			),
+			fx.Annotate(
+				notifications.NewSMTPSender,
+				fx.As(new(notifications.Sender)),
+				fx.ResultTags(`group:"notification_senders"`),
+			),
+			fx.Annotate(
+				notifications.NewPushSender,
+				fx.As(new(notifications.Sender)),
+				fx.ResultTags(`group:"notification_senders"`),
+			),
+			fx.Annotate(
+				notifications.NewLogPushProvider,
+				fx.As(new(notifications.PushProvider)),
+			),
+			fx.Annotate(
+				events.New,
+				fx.As(new(accounts.EventPublisher)),
+				fx.As(new(transactions.EventPublisher)),
+				fx.As(new(consents.EventPublisher)),
+				fx.As(new(plans.EventPublisher)),
+				fx.As(fx.Self()),
+			),
+			fx.Annotate(
+				events.NewWebhookSink,
+				fx.As(new(events.Sink)),
+				fx.ResultTags(`group:"event_sinks"`),
+			),
+			fx.Annotate(
+				stream.New,
+				fx.As(new(requester.Feed)),
+				fx.As(new(transactions.Feed)),
+				fx.As(fx.Self()),
+			),
+			fx.Annotate(
+				func(s *stream.Service) events.Subscriber { return s },
+				fx.ResultTags(`group:"event_subscribers"`),
+			),
+			fx.Annotate(
+				audit.New,
+				fx.As(new(requester.Auditor)),
+				fx.As(fx.Self()),
+			),
+			fx.Annotate(
+				func(s *audit.Service) events.Subscriber { return s },
+				fx.ResultTags(`group:"event_subscribers"`),
+			),
+			fx.Annotate(
+				plans.New,
+				fx.As(new(accounts.PlanLimiter)),
+				fx.As(new(analytics.SyncLimiter)),
+				fx.As(new(transactions.SyncLimiter)),
+				fx.As(fx.Self()),
+			),
+			recurring.New,
+			reencrypt.New,
+			statements.New,
+			fx.Annotate(
+				transfers.New,
+				fx.As(new(transactions.TransferMatcher)),
+				fx.As(fx.Self()),
+			),
+			fx.Annotate(
+				categories.New,
+				fx.As(new(transactions.Categorizer)),
+				fx.As(fx.Self()),
+			),
+			fx.Annotate(
+				rates.New,
+				fx.As(new(accounts.RatesProvider)),
+				fx.As(new(analytics.RatesProvider)),
+				fx.As(new(budgets.RatesProvider)),
+				fx.As(fx.Self()),
+			),
 		),
 		fx.Provide(
 			fx.Annotate(
@@ -37,6 +167,10 @@ func New(cfg *config.Config) fx.App {
 				requester.New,
 				fx.As(new(accounts.ConsentPoster)),
 				fx.As(new(accounts.AccountsGetter)),
+				fx.As(new(accounts.BalancesGetter)),
+				fx.As(new(transactions.TransactionsGetter)),
+				fx.As(new(consents.Authorizer)),
+				fx.As(new(consents.Revoker)),
 				fx.As(fx.Self()),
 			),
 		),
@@ -48,12 +182,9 @@ func New(cfg *config.Config) fx.App {
 			),
 		),
 		fx.Provide(
-			fx.Annotate(postgres.New,
-				fx.As(new(accounts.ConsentSaver)),
-				fx.As(new(requester.ConsentsProvider)),
-				fx.As(new(accounts.AccountsSaver)),
-				fx.As(fx.Self())),
+			fieldcrypt.New,
 		),
+		repositories(cfg.Storage),
 		fx.Provide(
 			httpsrv.New,
 		),
@@ -61,11 +192,60 @@ func New(cfg *config.Config) fx.App {
 	)
 }
 
+// repositories provides the storage implementation selected by the storage driver.
+func repositories(cfg storage.Config) fx.Option {
+	var constructor any
+	switch cfg.Driver {
+	case storage.DriverPostgres:
+		constructor = postgres.New
+	case storage.DriverMemory:
+		constructor = memory.New
+	default:
+		return fx.Error(fmt.Errorf("unknown storage driver %q", cfg.Driver))
+	}
+	return fx.Provide(
+		fx.Annotate(constructor,
+			fx.As(new(accounts.ConsentSaver)),
+			fx.As(new(requester.ConsentsProvider)),
+			fx.As(new(consents.Store)),
+			fx.As(new(consents.UnitOfWork)),
+			fx.As(new(accounts.AccountsSaver)),
+			fx.As(new(accounts.AccountsLister)),
+			fx.As(new(accounts.UnitOfWork)),
+			fx.As(new(accounts.BalancesSaver)),
+			fx.As(new(accounts.StoredBalanceGetter)),
+			fx.As(new(rates.Store)),
+			fx.As(new(transactions.Store)),
+			fx.As(new(transactions.UnitOfWork)),
+			fx.As(new(analytics.Store)),
+			fx.As(new(categories.Store)),
+			fx.As(new(categories.UnitOfWork)),
+			fx.As(new(budgets.Store)),
+			fx.As(new(budgets.UnitOfWork)),
+			fx.As(new(recurring.Store)),
+			fx.As(new(statements.Store)),
+			fx.As(new(notifications.Store)),
+			fx.As(new(notifications.UnitOfWork)),
+			fx.As(new(events.Store)),
+			fx.As(new(events.UnitOfWork)),
+			fx.As(new(transfers.Store)),
+			fx.As(new(transfers.UnitOfWork)),
+			fx.As(new(reencrypt.Store)),
+			fx.As(new(reencrypt.UnitOfWork)),
+			fx.As(new(audit.Store)),
+			fx.As(new(audit.UnitOfWork)),
+			fx.As(new(plans.Store)),
+			fx.As(new(plans.UnitOfWork)),
+			fx.As(new(httpsrv.IdempotencyStore)),
+			fx.As(fx.Self())),
+	)
+}
+
 func onStart(
 	_ cache.Cache,
-	_ *postgres.Client,
 	_ *zap.Logger,
 	_ *httpsrv.Server,
+	_ *reencrypt.Service,
 ) {
 
 }
@@ -0,0 +1,38 @@
+package fx_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/MichaelSBoop/lima-backend/config"
+	limafx "github.com/MichaelSBoop/lima-backend/internal/fx"
+	"github.com/MichaelSBoop/lima-backend/internal/infra/storage"
+)
+
+func TestNewSelectsTheStorageDriver(t *testing.T) {
+	tests := []struct {
+		driver  string
+		wantErr string
+	}{
+		{driver: storage.DriverMemory},
+		{driver: "sqlite", wantErr: `unknown storage driver "sqlite"`},
+		{driver: "", wantErr: `unknown storage driver ""`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.driver, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Storage.Driver = tt.driver
+			app := limafx.New(cfg)
+			err := app.Err()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("building the app on %s storage: %v", tt.driver, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package httpsrv
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	httpadapter "github.com/MichaelSBoop/lima-backend/internal/adapters/http"
+)
+
+// AdminConfig lists the bearer tokens accepted on the admin API. The admin
+// API rejects every request when none are set.
+type AdminConfig struct {
+	Tokens []string `json:"tokens" yaml:"tokens"`
+}
+
+type admin struct {
+	tokens [][]byte
+}
+
+func newAdmin(cfg AdminConfig) *admin {
+	a := &admin{}
+	for _, token := range cfg.Tokens {
+		if token != "" {
+			a.tokens = append(a.tokens, []byte(token))
+		}
+	}
+	return a
+}
+
+// middleware lets through requests bearing one of the admin tokens.
+func (a *admin) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			httpadapter.WriteErrorCode(w, http.StatusUnauthorized, httpadapter.CodeUnauthorized, "admin token is required")
+			return
+		}
+		for _, allowed := range a.tokens {
+			if subtle.ConstantTimeCompare([]byte(token), allowed) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		httpadapter.WriteErrorCode(w, http.StatusForbidden, httpadapter.CodeForbidden, "admin token is not valid")
+	})
+}
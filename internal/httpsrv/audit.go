@@ -0,0 +1,107 @@
+package httpsrv
+
+import (
+	"net/http"
+
+	httpadapter "github.com/MichaelSBoop/lima-backend/internal/adapters/http"
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/internal/service/audit"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	RequestIDHeader    = "X-Request-Id"
+	maxRequestIDLength = 128
+)
+
+type auditor struct {
+	audit *audit.Service
+}
+
+func newAuditor(audit *audit.Service) *auditor {
+	return &auditor{audit: audit}
+}
+
+// middleware tags every request with an ID, taken from X-Request-Id when the
+// caller sets one, and records it in the audit log once it is served. It runs
+// before the other middlewares, so that rejected requests are recorded too.
+// Requests the log has no room for are refused with 503 before being served.
+func (a *auditor) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if requestID == "" || len(requestID) > maxRequestIDLength {
+			requestID = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+		r = r.WithContext(audit.WithRequestID(r.Context(), requestID))
+		record, err := a.audit.Reserve(r.Context())
+		if err != nil {
+			httpadapter.WriteError(w, err)
+			return
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		endpoint := r.URL.Path
+		if route := mux.CurrentRoute(r); route != nil {
+			if tmpl, err := route.GetPathTemplate(); err == nil {
+				endpoint = tmpl
+			}
+		}
+		entry := &domain.AuditEntry{
+			ClientID:   httpadapter.ClientID(r),
+			Action:     domain.AuditActionAPIRequest,
+			Endpoint:   r.Method + " " + endpoint,
+			Outcome:    outcome(rec.statusCode),
+			StatusCode: rec.statusCode,
+		}
+		record(entry)
+	})
+}
+
+func outcome(statusCode int) string {
+	switch {
+	case statusCode == http.StatusUnauthorized, statusCode == http.StatusForbidden, statusCode == http.StatusTooManyRequests:
+		return domain.AuditOutcomeDenied
+	case statusCode >= http.StatusBadRequest:
+		return domain.AuditOutcomeFailure
+	default:
+		return domain.AuditOutcomeSuccess
+	}
+}
+
+// statusRecorder captures the status code of a response it passes through,
+// flushing included, so that streamed responses keep working.
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(statusCode int) {
+	if r.wroteHeader {
+		return
+	}
+	r.wroteHeader = true
+	r.statusCode = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
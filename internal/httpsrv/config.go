@@ -1,5 +1,10 @@
 package httpsrv
 
+import "time"
+
 type Config struct {
-	Addr string `json:"addr" yaml:"addr"`
+	Addr           string          `json:"addr" yaml:"addr"`
+	IdempotencyTTL time.Duration   `json:"idempotency_ttl" yaml:"idempotency_ttl"`
+	RateLimit      RateLimitConfig `json:"rate_limit" yaml:"rate_limit"`
+	Admin          AdminConfig     `json:"admin" yaml:"admin"`
 }
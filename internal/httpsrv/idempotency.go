@@ -0,0 +1,251 @@
+package httpsrv
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	httpadapter "github.com/MichaelSBoop/lima-backend/internal/adapters/http"
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	CodeIdempotencyKeyReused = "idempotency_key_reused"
+
+	maxIdempotencyKeyLength  = 255
+	defaultIdempotencyTTL    = 24 * time.Hour
+	idempotencyPurgeInterval = time.Hour
+	idempotencyPurgeTimeout  = 30 * time.Second
+	// idempotencyStoreAttempts bounds the tries at storing the outcome of a
+	// request, each within idempotencyStoreTimeout.
+	idempotencyStoreAttempts = 3
+	idempotencyStoreTimeout  = 5 * time.Second
+	idempotencyStoreBackoff  = 100 * time.Millisecond
+)
+
+type IdempotencyStore interface {
+	// ReserveIdempotencyKey stores record unless an unexpired record with the same key exists,
+	// in which case that record is returned.
+	ReserveIdempotencyKey(ctx context.Context, record *domain.IdempotencyRecord) (*domain.IdempotencyRecord, bool, error)
+	CompleteIdempotencyKey(ctx context.Context, record *domain.IdempotencyRecord) error
+	ReleaseIdempotencyKey(ctx context.Context, key, clientID string) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error)
+}
+
+type idempotency struct {
+	store IdempotencyStore
+	ttl   time.Duration
+	log   *zap.Logger
+}
+
+func newIdempotency(log *zap.Logger, lc fx.Lifecycle, cfg Config, store IdempotencyStore) *idempotency {
+	ttl := cfg.IdempotencyTTL
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	i := &idempotency{
+		store: store,
+		ttl:   ttl,
+		log:   log,
+	}
+	stop := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			go i.purge(stop)
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			close(stop)
+			return nil
+		},
+	})
+	return i
+}
+
+// middleware makes POST requests carrying an Idempotency-Key header safe to retry:
+// the first completed response is stored and replayed for repeats with the same body.
+func (i *idempotency) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if r.Method != http.MethodPost || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			httpadapter.WriteErrorCode(w, http.StatusBadRequest, httpadapter.CodeInvalidRequest, "idempotency key is too long")
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			httpadapter.WriteError(w, httpadapter.BadRequest(err))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		now := time.Now().UTC()
+		record := &domain.IdempotencyRecord{
+			Key:         key,
+			ClientID:    httpadapter.ClientID(r),
+			Method:      r.Method,
+			Path:        r.URL.Path,
+			Fingerprint: fingerprint(r, body),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(i.ttl),
+		}
+		existing, reserved, err := i.store.ReserveIdempotencyKey(r.Context(), record)
+		if err != nil {
+			i.log.Error("failed to reserve idempotency key", zap.Error(err))
+			httpadapter.WriteError(w, err)
+			return
+		}
+		if !reserved {
+			i.replay(w, existing, record)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		// Outcomes worth retrying must not be pinned to the key.
+		ctx := context.WithoutCancel(r.Context())
+		if retryable(rec.statusCode) {
+			i.release(ctx, record)
+			return
+		}
+		record.Completed = true
+		record.StatusCode = rec.statusCode
+		record.ContentType = rec.Header().Get("Content-Type")
+		record.Body = rec.body.Bytes()
+		err = i.retry(ctx, func(ctx context.Context) error {
+			return i.store.CompleteIdempotencyKey(ctx, record)
+		})
+		if err != nil {
+			// A key left in progress would turn every retry away until it expires.
+			i.log.Error("failed to store idempotent response, releasing the key", zap.Error(err))
+			i.release(ctx, record)
+		}
+	})
+}
+
+// retryable tells whether a request answered with statusCode may be answered
+// otherwise when made again: server errors, and refusals that depend on
+// limits, time or the state of the client rather than on the request.
+func retryable(statusCode int) bool {
+	switch statusCode {
+	case http.StatusUnauthorized, http.StatusPaymentRequired, http.StatusForbidden, http.StatusNotFound,
+		http.StatusRequestTimeout, http.StatusConflict, http.StatusLocked, http.StatusTooEarly, http.StatusTooManyRequests:
+		return true
+	}
+	return statusCode >= http.StatusInternalServerError
+}
+
+// release frees the key of record for the request to be made again.
+func (i *idempotency) release(ctx context.Context, record *domain.IdempotencyRecord) {
+	err := i.retry(ctx, func(ctx context.Context) error {
+		return i.store.ReleaseIdempotencyKey(ctx, record.Key, record.ClientID)
+	})
+	if err != nil {
+		i.log.Error("failed to release idempotency key", zap.Error(err))
+	}
+}
+
+// retry calls f up to idempotencyStoreAttempts times until it succeeds, and
+// returns its last error.
+func (i *idempotency) retry(ctx context.Context, f func(ctx context.Context) error) error {
+	var err error
+	for attempt := 1; attempt <= idempotencyStoreAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(idempotencyStoreBackoff << (attempt - 2))
+		}
+		attemptCtx, cancel := context.WithTimeout(ctx, idempotencyStoreTimeout)
+		err = f(attemptCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (i *idempotency) replay(w http.ResponseWriter, existing, requested *domain.IdempotencyRecord) {
+	if existing.Fingerprint != requested.Fingerprint {
+		httpadapter.WriteErrorCode(w, http.StatusUnprocessableEntity, CodeIdempotencyKeyReused,
+			"idempotency key was already used with a different request")
+		return
+	}
+	if !existing.Completed {
+		httpadapter.WriteErrorCode(w, http.StatusConflict, httpadapter.CodeConflict, "request with this idempotency key is in progress")
+		return
+	}
+	if existing.ContentType != "" {
+		w.Header().Set("Content-Type", existing.ContentType)
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(existing.StatusCode)
+	if _, err := w.Write(existing.Body); err != nil {
+		i.log.Error("failed to write replayed response", zap.Error(err))
+	}
+}
+
+func (i *idempotency) purge(stop <-chan struct{}) {
+	ticker := time.NewTicker(idempotencyPurgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), idempotencyPurgeTimeout)
+			n, err := i.store.DeleteExpiredIdempotencyKeys(ctx, time.Now().UTC())
+			cancel()
+			if err != nil {
+				i.log.Error("failed to purge idempotency keys", zap.Error(err))
+				continue
+			}
+			i.log.Debug("purged idempotency keys", zap.Int64("count", n))
+		}
+	}
+}
+
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(r.URL.RequestURI()))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	if r.wroteHeader {
+		return
+	}
+	r.wroteHeader = true
+	r.statusCode = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
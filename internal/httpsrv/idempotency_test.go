@@ -0,0 +1,210 @@
+package httpsrv
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+// idempotencyStore keeps records in a map and fails the first completeFails
+// completions.
+type idempotencyStore struct {
+	mu            sync.Mutex
+	records       map[[2]string]domain.IdempotencyRecord
+	completeFails int
+}
+
+func (s *idempotencyStore) ReserveIdempotencyKey(_ context.Context, record *domain.IdempotencyRecord) (*domain.IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := [2]string{record.Key, record.ClientID}
+	if existing, ok := s.records[k]; ok {
+		return &existing, false, nil
+	}
+	s.records[k] = *record
+	return nil, true, nil
+}
+
+func (s *idempotencyStore) CompleteIdempotencyKey(_ context.Context, record *domain.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.completeFails > 0 {
+		s.completeFails--
+		return errors.New("store is down")
+	}
+	s.records[[2]string{record.Key, record.ClientID}] = *record
+	return nil
+}
+
+func (s *idempotencyStore) ReleaseIdempotencyKey(_ context.Context, key, clientID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := [2]string{key, clientID}
+	if !s.records[k].Completed {
+		delete(s.records, k)
+	}
+	return nil
+}
+
+func (s *idempotencyStore) DeleteExpiredIdempotencyKeys(context.Context, time.Time) (int64, error) {
+	return 0, nil
+}
+
+type idempotentCall struct {
+	key  string
+	body string
+	// status is the status the handler answers with.
+	status int
+
+	wantStatus   int
+	wantBody     string
+	wantReplayed bool
+}
+
+func TestIdempotency(t *testing.T) {
+	tests := []struct {
+		name          string
+		completeFails int
+		calls         []idempotentCall
+		wantHandled   int
+	}{
+		{
+			name: "replay",
+			calls: []idempotentCall{
+				{key: "k1", body: `{"a":1}`, status: http.StatusCreated, wantStatus: http.StatusCreated, wantBody: "handled 1"},
+				{key: "k1", body: `{"a":1}`, status: http.StatusCreated, wantStatus: http.StatusCreated, wantBody: "handled 1", wantReplayed: true},
+			},
+			wantHandled: 1,
+		},
+		{
+			name: "different keys",
+			calls: []idempotentCall{
+				{key: "k1", body: `{"a":1}`, status: http.StatusCreated, wantStatus: http.StatusCreated, wantBody: "handled 1"},
+				{key: "k2", body: `{"a":1}`, status: http.StatusCreated, wantStatus: http.StatusCreated, wantBody: "handled 2"},
+			},
+			wantHandled: 2,
+		},
+		{
+			name: "body mismatch",
+			calls: []idempotentCall{
+				{key: "k1", body: `{"a":1}`, status: http.StatusCreated, wantStatus: http.StatusCreated, wantBody: "handled 1"},
+				{key: "k1", body: `{"a":2}`, status: http.StatusCreated, wantStatus: http.StatusUnprocessableEntity, wantBody: CodeIdempotencyKeyReused},
+			},
+			wantHandled: 1,
+		},
+		{
+			name: "server error releases the key",
+			calls: []idempotentCall{
+				{key: "k1", body: `{"a":1}`, status: http.StatusInternalServerError, wantStatus: http.StatusInternalServerError, wantBody: "handled 1"},
+				{key: "k1", body: `{"a":1}`, status: http.StatusCreated, wantStatus: http.StatusCreated, wantBody: "handled 2"},
+			},
+			wantHandled: 2,
+		},
+		{
+			name: "rate limit releases the key",
+			calls: []idempotentCall{
+				{key: "k1", body: `{"a":1}`, status: http.StatusTooManyRequests, wantStatus: http.StatusTooManyRequests, wantBody: "handled 1"},
+				{key: "k1", body: `{"a":1}`, status: http.StatusCreated, wantStatus: http.StatusCreated, wantBody: "handled 2"},
+			},
+			wantHandled: 2,
+		},
+		{
+			name: "plan limit releases the key",
+			calls: []idempotentCall{
+				{key: "k1", body: `{"a":1}`, status: http.StatusPaymentRequired, wantStatus: http.StatusPaymentRequired, wantBody: "handled 1"},
+				{key: "k1", body: `{"a":1}`, status: http.StatusCreated, wantStatus: http.StatusCreated, wantBody: "handled 2"},
+			},
+			wantHandled: 2,
+		},
+		{
+			name: "invalid request keeps the key",
+			calls: []idempotentCall{
+				{key: "k1", body: `{"a":1}`, status: http.StatusBadRequest, wantStatus: http.StatusBadRequest, wantBody: "handled 1"},
+				{key: "k1", body: `{"a":1}`, status: http.StatusCreated, wantStatus: http.StatusBadRequest, wantBody: "handled 1", wantReplayed: true},
+			},
+			wantHandled: 1,
+		},
+		{
+			name:          "completion retried",
+			completeFails: idempotencyStoreAttempts - 1,
+			calls: []idempotentCall{
+				{key: "k1", body: `{"a":1}`, status: http.StatusCreated, wantStatus: http.StatusCreated, wantBody: "handled 1"},
+				{key: "k1", body: `{"a":1}`, status: http.StatusCreated, wantStatus: http.StatusCreated, wantBody: "handled 1", wantReplayed: true},
+			},
+			wantHandled: 1,
+		},
+		{
+			name:          "failed completion releases the key",
+			completeFails: idempotencyStoreAttempts,
+			calls: []idempotentCall{
+				{key: "k1", body: `{"a":1}`, status: http.StatusCreated, wantStatus: http.StatusCreated, wantBody: "handled 1"},
+				{key: "k1", body: `{"a":1}`, status: http.StatusCreated, wantStatus: http.StatusCreated, wantBody: "handled 2"},
+			},
+			wantHandled: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &idempotencyStore{records: make(map[[2]string]domain.IdempotencyRecord), completeFails: tt.completeFails}
+			i := newIdempotency(zap.NewNop(), fxtest.NewLifecycle(t), Config{}, store)
+			handled := 0
+			status := http.StatusOK
+			h := i.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handled++
+				w.WriteHeader(status)
+				_, _ = w.Write([]byte("handled " + strconv.Itoa(handled)))
+			}))
+			for n, call := range tt.calls {
+				status = call.status
+				res := serveIdempotent(h, call.key, call.body)
+				if res.Code != call.wantStatus || !strings.Contains(res.Body.String(), call.wantBody) {
+					t.Fatalf("call %d: got %d %q, want %d with %q", n, res.Code, res.Body.String(), call.wantStatus, call.wantBody)
+				}
+				if replayed := res.Header().Get(IdempotentReplayedHeader) == "true"; replayed != call.wantReplayed {
+					t.Fatalf("call %d: replayed %v, want %v", n, replayed, call.wantReplayed)
+				}
+			}
+			if handled != tt.wantHandled {
+				t.Fatalf("handled %d requests, want %d", handled, tt.wantHandled)
+			}
+		})
+	}
+}
+
+func TestIdempotencyKeyInProgress(t *testing.T) {
+	store := &idempotencyStore{records: make(map[[2]string]domain.IdempotencyRecord)}
+	i := newIdempotency(zap.NewNop(), fxtest.NewLifecycle(t), Config{}, store)
+	var h http.Handler
+	var concurrent *httptest.ResponseRecorder
+	h = i.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if concurrent == nil {
+			concurrent = serveIdempotent(h, "k1", `{"a":1}`)
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	if res := serveIdempotent(h, "k1", `{"a":1}`); res.Code != http.StatusCreated {
+		t.Fatalf("got %d, want %d", res.Code, http.StatusCreated)
+	}
+	if concurrent.Code != http.StatusConflict {
+		t.Fatalf("concurrent request got %d, want %d", concurrent.Code, http.StatusConflict)
+	}
+}
+
+func serveIdempotent(h http.Handler, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/things?client_id=c1", strings.NewReader(body))
+	req.Header.Set(IdempotencyKeyHeader, key)
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	return res
+}
@@ -0,0 +1,54 @@
+package httpsrv
+
+import (
+	"net/http"
+
+	httpadapter "github.com/MichaelSBoop/lima-backend/internal/adapters/http"
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/internal/service/plans"
+	"github.com/gorilla/mux"
+)
+
+// gatedRoutes maps the path templates of routes to the plan features they
+// use, checked in order.
+var gatedRoutes = map[string][]string{
+	"/api/v1/accounts/statements":     {domain.FeatureExport},
+	"/api/v1/accounts/{id}/statement": {domain.FeatureExport},
+	"/api/v1/analytics/net-worth":     {domain.FeatureAnalytics},
+	"/api/v1/analytics/cashflow":      {domain.FeatureAnalytics},
+	"/api/v1/analytics/refresh":       {domain.FeatureAnalytics},
+}
+
+type planGate struct {
+	plans *plans.Service
+}
+
+func newPlanGate(plans *plans.Service) *planGate {
+	return &planGate{plans: plans}
+}
+
+// middleware rejects requests to features the plan of the client does not
+// include with 402 Payment Required. Syncs with the banks are limited by the
+// services that make them, wherever they are called from.
+func (g *planGate) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientID := httpadapter.ClientID(r)
+		route := mux.CurrentRoute(r)
+		if clientID == "" || route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		tmpl, err := route.GetPathTemplate()
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, feature := range gatedRoutes[tmpl] {
+			if err := g.plans.Allow(r.Context(), clientID, feature); err != nil {
+				httpadapter.WriteError(w, err)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
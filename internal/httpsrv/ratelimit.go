@@ -0,0 +1,96 @@
+package httpsrv
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	httpadapter "github.com/MichaelSBoop/lima-backend/internal/adapters/http"
+	"github.com/MichaelSBoop/lima-backend/pkg/ratelimit"
+	"github.com/gorilla/mux"
+)
+
+type RateLimitConfig struct {
+	PerUser ratelimit.Config `json:"per_user" yaml:"per_user"`
+	PerIP   ratelimit.Config `json:"per_ip" yaml:"per_ip"`
+	// Routes adds limits to expensive routes, keyed by their path template.
+	// They apply per user, or per IP for requests without one.
+	Routes map[string]ratelimit.Config `json:"routes" yaml:"routes"`
+	// TrustProxy takes the client IP from X-Forwarded-For. Enable it only
+	// behind a proxy that sets the header.
+	TrustProxy bool `json:"trust_proxy" yaml:"trust_proxy"`
+}
+
+type rateLimiter struct {
+	perUser    *ratelimit.Limiter
+	perIP      *ratelimit.Limiter
+	routes     map[string]*ratelimit.Limiter
+	trustProxy bool
+}
+
+func newRateLimiter(cfg RateLimitConfig) *rateLimiter {
+	l := &rateLimiter{
+		perUser:    ratelimit.New(cfg.PerUser),
+		perIP:      ratelimit.New(cfg.PerIP),
+		routes:     make(map[string]*ratelimit.Limiter, len(cfg.Routes)),
+		trustProxy: cfg.TrustProxy,
+	}
+	for route, routeCfg := range cfg.Routes {
+		l.routes[route] = ratelimit.New(routeCfg)
+	}
+	return l
+}
+
+// middleware rejects requests over any of the limits with 429 Too Many Requests
+// and a Retry-After telling when to try again.
+func (l *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := l.clientIP(r)
+		clientID := httpadapter.ClientID(r)
+		key := "ip:" + ip
+		if clientID != "" {
+			key = "user:" + clientID
+		}
+		if ok, retryAfter := l.perIP.Allow(ip); !ok {
+			tooManyRequests(w, retryAfter)
+			return
+		}
+		if clientID != "" {
+			if ok, retryAfter := l.perUser.Allow(clientID); !ok {
+				tooManyRequests(w, retryAfter)
+				return
+			}
+		}
+		if route := mux.CurrentRoute(r); route != nil {
+			if tmpl, err := route.GetPathTemplate(); err == nil {
+				if ok, retryAfter := l.routes[tmpl].Allow(key); !ok {
+					tooManyRequests(w, retryAfter)
+					return
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *rateLimiter) clientIP(r *http.Request) string {
+	if l.trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func tooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	httpadapter.WriteErrorCode(w, http.StatusTooManyRequests, httpadapter.CodeRateLimited, "too many requests")
+}
@@ -0,0 +1,124 @@
+package httpsrv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	httpadapter "github.com/MichaelSBoop/lima-backend/internal/adapters/http"
+	"github.com/MichaelSBoop/lima-backend/pkg/ratelimit"
+	"github.com/gorilla/mux"
+)
+
+// rateLimitRequest is a request to path from the client at ip, as clientID
+// when set.
+type rateLimitRequest struct {
+	path      string
+	ip        string
+	clientID  string
+	forwarded string
+	// want is the status the request should get.
+	want int
+}
+
+func TestRateLimit(t *testing.T) {
+	hourly := func(rate int) ratelimit.Config { return ratelimit.Config{Rate: rate, Per: time.Hour} }
+
+	tests := []struct {
+		name     string
+		cfg      RateLimitConfig
+		requests []rateLimitRequest
+	}{
+		{
+			name: "per user",
+			cfg:  RateLimitConfig{PerUser: hourly(2)},
+			requests: []rateLimitRequest{
+				{path: "/api/v1/accounts", ip: "10.0.0.1", clientID: "c1", want: http.StatusOK},
+				{path: "/api/v1/accounts", ip: "10.0.0.2", clientID: "c1", want: http.StatusOK},
+				{path: "/api/v1/accounts", ip: "10.0.0.3", clientID: "c1", want: http.StatusTooManyRequests},
+				{path: "/api/v1/accounts", ip: "10.0.0.1", clientID: "c2", want: http.StatusOK},
+				{path: "/api/v1/accounts", ip: "10.0.0.1", want: http.StatusOK},
+			},
+		},
+		{
+			name: "per IP",
+			cfg:  RateLimitConfig{PerIP: hourly(2)},
+			requests: []rateLimitRequest{
+				{path: "/api/v1/accounts", ip: "10.0.0.1", clientID: "c1", want: http.StatusOK},
+				{path: "/api/v1/accounts", ip: "10.0.0.1", clientID: "c2", want: http.StatusOK},
+				{path: "/api/v1/accounts", ip: "10.0.0.1", want: http.StatusTooManyRequests},
+				{path: "/api/v1/accounts", ip: "10.0.0.2", want: http.StatusOK},
+			},
+		},
+		{
+			name: "per route template",
+			cfg:  RateLimitConfig{Routes: map[string]ratelimit.Config{"/api/v1/accounts/{id}": hourly(1)}},
+			requests: []rateLimitRequest{
+				{path: "/api/v1/accounts/a1", ip: "10.0.0.1", clientID: "c1", want: http.StatusOK},
+				{path: "/api/v1/accounts/a2", ip: "10.0.0.1", clientID: "c1", want: http.StatusTooManyRequests},
+				{path: "/api/v1/accounts", ip: "10.0.0.1", clientID: "c1", want: http.StatusOK},
+				{path: "/api/v1/accounts/a1", ip: "10.0.0.1", clientID: "c2", want: http.StatusOK},
+				{path: "/api/v1/accounts/a1", ip: "10.0.0.1", want: http.StatusOK},
+				{path: "/api/v1/accounts/a1", ip: "10.0.0.1", want: http.StatusTooManyRequests},
+			},
+		},
+		{
+			name: "forwarded for ignored without a trusted proxy",
+			cfg:  RateLimitConfig{PerIP: hourly(1)},
+			requests: []rateLimitRequest{
+				{path: "/api/v1/accounts", ip: "10.0.0.1", forwarded: "192.0.2.1", want: http.StatusOK},
+				{path: "/api/v1/accounts", ip: "10.0.0.1", forwarded: "192.0.2.2", want: http.StatusTooManyRequests},
+			},
+		},
+		{
+			name: "forwarded for behind a trusted proxy",
+			cfg:  RateLimitConfig{PerIP: hourly(1), TrustProxy: true},
+			requests: []rateLimitRequest{
+				{path: "/api/v1/accounts", ip: "10.0.0.1", forwarded: "192.0.2.1, 10.0.0.1", want: http.StatusOK},
+				{path: "/api/v1/accounts", ip: "10.0.0.1", forwarded: "192.0.2.2, 10.0.0.1", want: http.StatusOK},
+				{path: "/api/v1/accounts", ip: "10.0.0.1", forwarded: "192.0.2.1", want: http.StatusTooManyRequests},
+			},
+		},
+		{
+			name: "no limits",
+			requests: []rateLimitRequest{
+				{path: "/api/v1/accounts", ip: "10.0.0.1", clientID: "c1", want: http.StatusOK},
+				{path: "/api/v1/accounts", ip: "10.0.0.1", clientID: "c1", want: http.StatusOK},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+			router := mux.NewRouter()
+			router.Use(newRateLimiter(tt.cfg).middleware)
+			router.Handle("/api/v1/accounts", ok)
+			router.Handle("/api/v1/accounts/{id}", ok)
+
+			for i, req := range tt.requests {
+				r := httptest.NewRequest(http.MethodGet, req.path, nil)
+				r.RemoteAddr = req.ip + ":40000"
+				if req.clientID != "" {
+					r.Header.Set(httpadapter.ClientIDHeader, req.clientID)
+				}
+				if req.forwarded != "" {
+					r.Header.Set("X-Forwarded-For", req.forwarded)
+				}
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, r)
+				if w.Code != req.want {
+					t.Fatalf("request %d: status %d, want %d", i, w.Code, req.want)
+				}
+				if w.Code != http.StatusTooManyRequests {
+					continue
+				}
+				retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+				if err != nil || retryAfter <= 0 || retryAfter > int(time.Hour.Seconds()) {
+					t.Errorf("request %d: Retry-After %q, want seconds within the hour", i, w.Header().Get("Retry-After"))
+				}
+			}
+		})
+	}
+}
@@ -1,14 +1,57 @@
 package httpsrv
 
 import (
+	"net/http"
+
 	httpadapter "github.com/MichaelSBoop/lima-backend/internal/adapters/http"
 	"github.com/gorilla/mux"
 )
 
-func newRouter(h *httpadapter.Handler) *mux.Router {
+func newRouter(h *httpadapter.Handler, admin mux.MiddlewareFunc) *mux.Router {
 	r := mux.NewRouter()
 	r.HandleFunc("/api/v1/accounts/form-consents", h.HandleCreateConsents())
+	r.HandleFunc("/api/v1/consents", h.HandleListConsents()).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/consents/callback", h.HandleConsentCallback()).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/consents/{id}/replace", h.HandleReplaceConsent()).Methods(http.MethodPost)
+	r.HandleFunc("/api/v1/consents/{id}/reconsent", h.HandleReconsent()).Methods(http.MethodPost)
+	r.HandleFunc("/api/v1/consents/{id}/authorize", h.HandleAuthorizeConsent()).Methods(http.MethodPost)
 	r.HandleFunc("/api/v1/accounts/aggregate", h.HandleAggregateAccounts())
+	r.HandleFunc("/api/v1/accounts/totals", h.HandleAccountsTotals()).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/accounts/statements", h.HandleStatementsArchive()).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/accounts/{id}/statement", h.HandleAccountStatement()).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/rates", h.HandleRates()).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/analytics/net-worth", h.HandleNetWorth()).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/analytics/cashflow", h.HandleCashflow()).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/analytics/refresh", h.HandleRefreshAnalytics()).Methods(http.MethodPost)
+	r.HandleFunc("/api/v1/transactions", h.HandleListTransactions()).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/transactions/{id}", h.HandleUpdateTransaction()).Methods(http.MethodPatch)
+	r.HandleFunc("/api/v1/categories", h.HandleCategories()).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/categories/rules", h.HandleCategoryRules()).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/categories/rules", h.HandleCreateCategoryRule()).Methods(http.MethodPost)
+	r.HandleFunc("/api/v1/categories/rules/{id}", h.HandleDeleteCategoryRule()).Methods(http.MethodDelete)
+	r.HandleFunc("/api/v1/budgets", h.HandleListBudgets()).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/budgets", h.HandleCreateBudget()).Methods(http.MethodPost)
+	r.HandleFunc("/api/v1/budgets/{id}", h.HandleGetBudget()).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/budgets/{id}", h.HandleUpdateBudget()).Methods(http.MethodPut)
+	r.HandleFunc("/api/v1/budgets/{id}", h.HandleDeleteBudget()).Methods(http.MethodDelete)
+	r.HandleFunc("/api/v1/budgets/{id}/alerts", h.HandleBudgetAlerts()).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/recurring", h.HandleRecurring()).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/transfers", h.HandleTransfers()).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/notifications/preferences", h.HandleNotificationPreferences()).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/notifications/preferences/{channel}", h.HandleSetNotificationPreference()).Methods(http.MethodPut)
+	r.HandleFunc("/api/v1/notifications/deliveries", h.HandleNotificationDeliveries()).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/events", h.HandleEvents()).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/plans", h.HandlePlans()).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/plan", h.HandleSubscription()).Methods(http.MethodGet)
+
+	a := r.PathPrefix("/api/v1/admin").Subrouter()
+	a.Use(admin)
+	a.HandleFunc("/audit", h.HandleAuditLog()).Methods(http.MethodGet)
+	a.HandleFunc("/audit/verify", h.HandleVerifyAuditLog()).Methods(http.MethodGet)
+	a.HandleFunc("/plans/{client_id}", h.HandleClientPlan()).Methods(http.MethodGet)
+	a.HandleFunc("/plans/{client_id}", h.HandleChangePlan()).Methods(http.MethodPut)
+	a.HandleFunc("/events/failed", h.HandleFailedEvents()).Methods(http.MethodGet)
+	a.HandleFunc("/events/{event_id}/retry", h.HandleRetryEvent()).Methods(http.MethodPost)
 
 	return r
 }
@@ -6,6 +6,8 @@ import (
 	"net/http"
 
 	httpadapter "github.com/MichaelSBoop/lima-backend/internal/adapters/http"
+	"github.com/MichaelSBoop/lima-backend/internal/service/audit"
+	"github.com/MichaelSBoop/lima-backend/internal/service/plans"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 )
@@ -15,8 +17,12 @@ type Server struct {
 	log *zap.Logger
 }
 
-func New(logger *zap.Logger, lc fx.Lifecycle, cfg Config, h *httpadapter.Handler) (*Server, error) {
-	router := newRouter(h)
+func New(logger *zap.Logger, lc fx.Lifecycle, cfg Config, h *httpadapter.Handler, idempotencyStore IdempotencyStore, audit *audit.Service, plans *plans.Service) (*Server, error) {
+	router := newRouter(h, newAdmin(cfg.Admin).middleware)
+	router.Use(newAuditor(audit).middleware)
+	router.Use(newRateLimiter(cfg.RateLimit).middleware)
+	router.Use(newIdempotency(logger, lc, cfg, idempotencyStore).middleware)
+	router.Use(newPlanGate(plans).middleware)
 	srv := &Server{
 		Server: http.Server{
 			Addr:    cfg.Addr,
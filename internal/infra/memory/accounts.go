@@ -0,0 +1,138 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+)
+
+func (s *Store) SaveConsent(ctx context.Context, consent *domain.AccountConsent, consentProvider string) error {
+	defer s.lock(ctx)()
+	c := *consent
+	c.Permissions = slices.Clone(consent.Permissions)
+	c.ConsentProvider = consentProvider
+	s.state.consents = append(s.state.consents, c)
+	return nil
+}
+
+func (s *Store) UpdateConsent(ctx context.Context, consent *domain.AccountConsent, consentProvider string) error {
+	defer s.lock(ctx)()
+	for i := range s.state.consents {
+		if s.state.consents[i].ConsentID != consent.ConsentID {
+			continue
+		}
+		c := *consent
+		c.Permissions = slices.Clone(consent.Permissions)
+		c.ConsentProvider = consentProvider
+		s.state.consents[i] = c
+	}
+	return nil
+}
+
+func (s *Store) GetConsents(_ context.Context, clientID string) ([]*domain.AccountConsent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	consents := make([]*domain.AccountConsent, 0)
+	for _, consent := range s.state.consents {
+		if consent.ClientID != clientID {
+			continue
+		}
+		consent.Permissions = slices.Clone(consent.Permissions)
+		consents = append(consents, &consent)
+	}
+	return consents, nil
+}
+
+// MarkConsentUsed records that a bank call was made under the consent at at,
+// keeping a later time already recorded.
+func (s *Store) MarkConsentUsed(ctx context.Context, consentID string, at time.Time) error {
+	defer s.lock(ctx)()
+	for i := range s.state.consents {
+		if s.state.consents[i].ConsentID == consentID && s.state.consents[i].LastUsedAt.Before(at) {
+			s.state.consents[i].LastUsedAt = at
+		}
+	}
+	return nil
+}
+
+// GetExpiringConsents returns up to limit approved consents of any client that
+// expire before before and either have expired at now or have not been
+// notified about yet.
+func (s *Store) GetExpiringConsents(_ context.Context, now, before time.Time, limit int) ([]*domain.AccountConsent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	consents := make([]*domain.AccountConsent, 0)
+	for _, consent := range s.state.consents {
+		if consent.Status != domain.ConsentStatusApproved || consent.ExpiresAt.IsZero() || !consent.ExpiresAt.Before(before) {
+			continue
+		}
+		if now.Before(consent.ExpiresAt) && !consent.ExpiryNotifiedAt.IsZero() {
+			continue
+		}
+		consent.Permissions = slices.Clone(consent.Permissions)
+		consents = append(consents, &consent)
+	}
+	slices.SortFunc(consents, func(a, b *domain.AccountConsent) int {
+		return a.ExpiresAt.Compare(b.ExpiresAt)
+	})
+	if len(consents) > limit {
+		consents = consents[:limit]
+	}
+	return consents, nil
+}
+
+// accountKey identifies an account: banks only keep account IDs unique among
+// their own accounts, and a client only sees accounts through its consents.
+type accountKey struct {
+	clientID  string
+	bank      string
+	accountID string
+}
+
+func (s *Store) SaveAccount(ctx context.Context, account *domain.Account) error {
+	defer s.lock(ctx)()
+	s.state.accounts[accountKey{clientID: account.ClientID, bank: account.Bank, accountID: account.AccountID}] = *account
+	return nil
+}
+
+func (s *Store) ListAccounts(_ context.Context, clientID string) ([]*domain.Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	accounts := make([]*domain.Account, 0)
+	for _, account := range s.state.accounts {
+		if account.ClientID == clientID {
+			accounts = append(accounts, &account)
+		}
+	}
+	slices.SortFunc(accounts, func(a, b *domain.Account) int { return strings.Compare(a.AccountID, b.AccountID) })
+	return accounts, nil
+}
+
+type balanceKey struct {
+	accountKey
+	balanceType string
+}
+
+func (s *Store) SaveBalance(ctx context.Context, balance *domain.Balance) error {
+	defer s.lock(ctx)()
+	k := balanceKey{
+		accountKey:  accountKey{clientID: balance.ClientID, bank: balance.Bank, accountID: balance.AccountID},
+		balanceType: balance.Type,
+	}
+	s.state.balances[k] = *balance
+	return nil
+}
+
+func (s *Store) GetBalance(_ context.Context, clientID, bank, accountID string) (*domain.Balance, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	balance, ok := s.preferredBalance(accountKey{clientID: clientID, bank: bank, accountID: accountID})
+	if !ok {
+		return nil, fmt.Errorf("balance of account %s: %w", accountID, domain.ErrNotFound)
+	}
+	return &balance, nil
+}
@@ -0,0 +1,157 @@
+package memory
+
+import (
+	"context"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/pkg/money"
+)
+
+type snapshotKey struct {
+	accountKey
+	date time.Time
+}
+
+// RefreshSnapshots mirrors the snapshot derivation done in Postgres.
+func (s *Store) RefreshSnapshots(ctx context.Context, clientID string, from, to time.Time) error {
+	defer s.lock(ctx)()
+	from, to = day(from), day(to)
+
+	for k, snap := range s.state.snapshots {
+		if snap.ClientID == clientID && !k.date.Before(from) && !k.date.After(to) {
+			delete(s.state.snapshots, k)
+		}
+	}
+
+	type flow struct{ income, spending, net *big.Rat }
+	flows := make(map[snapshotKey]*flow)
+	for _, tx := range s.state.transactions {
+		if tx.ClientID != clientID || tx.Status != domain.TransactionStatusBooked {
+			continue
+		}
+		amount, err := money.Parse(tx.Amount)
+		if err != nil {
+			return err
+		}
+		k := snapshotKey{
+			accountKey: accountKey{clientID: tx.ClientID, bank: tx.Bank, accountID: tx.AccountID},
+			date:       day(tx.BookedAt),
+		}
+		f, ok := flows[k]
+		if !ok {
+			f = &flow{income: money.Zero(), spending: money.Zero(), net: money.Zero()}
+			flows[k] = f
+		}
+		f.net.Add(f.net, amount)
+		// Transfers between the client's own accounts are neither income nor
+		// spending, yet they still move the balances.
+		if tx.TransferID != "" {
+			continue
+		}
+		if amount.Sign() > 0 {
+			f.income.Add(f.income, amount)
+		} else {
+			f.spending.Sub(f.spending, amount)
+		}
+	}
+
+	for key, account := range s.state.accounts {
+		if account.ClientID != clientID {
+			continue
+		}
+		balance, ok := s.preferredBalance(key)
+		if !ok {
+			continue
+		}
+		current, err := money.Parse(balance.Amount)
+		if err != nil {
+			return err
+		}
+		for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+			value := new(big.Rat).Set(current)
+			for k, f := range flows {
+				if k.accountKey == key && k.date.After(d) {
+					value.Sub(value, f.net)
+				}
+			}
+			snap := domain.AccountSnapshot{
+				ClientID:  clientID,
+				AccountID: account.AccountID,
+				Bank:      account.Bank,
+				Date:      d,
+				Currency:  balance.Currency,
+				Balance:   money.Format(value),
+				Income:    money.Format(money.Zero()),
+				Spending:  money.Format(money.Zero()),
+			}
+			if f, ok := flows[snapshotKey{accountKey: key, date: d}]; ok {
+				snap.Income = money.Format(f.income)
+				snap.Spending = money.Format(f.spending)
+			}
+			s.state.snapshots[snapshotKey{accountKey: key, date: d}] = snap
+		}
+	}
+	return nil
+}
+
+func (s *Store) preferredBalance(account accountKey) (domain.Balance, bool) {
+	var (
+		res  domain.Balance
+		best = -1
+	)
+	for k, balance := range s.state.balances {
+		if k.accountKey != account {
+			continue
+		}
+		rank := slices.IndexFunc(domain.BalanceTypes, func(t string) bool { return strings.EqualFold(t, balance.Type) })
+		if rank < 0 {
+			rank = len(domain.BalanceTypes)
+		}
+		if best < 0 || rank < best {
+			res, best = balance, rank
+		}
+	}
+	return res, best >= 0
+}
+
+func (s *Store) GetSnapshots(_ context.Context, clientID string, from, to time.Time) ([]*domain.AccountSnapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	from, to = day(from), day(to)
+	snapshots := make([]*domain.AccountSnapshot, 0)
+	for k, snap := range s.state.snapshots {
+		if snap.ClientID != clientID || k.date.Before(from) || k.date.After(to) {
+			continue
+		}
+		snapshots = append(snapshots, &snap)
+	}
+	slices.SortFunc(snapshots, func(a, b *domain.AccountSnapshot) int {
+		if c := a.Date.Compare(b.Date); c != 0 {
+			return c
+		}
+		return strings.Compare(a.AccountID, b.AccountID)
+	})
+	return snapshots, nil
+}
+
+func (s *Store) ClientIDs(_ context.Context) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	clientIDs := make([]string, 0)
+	for _, consent := range s.state.consents {
+		if !slices.Contains(clientIDs, consent.ClientID) {
+			clientIDs = append(clientIDs, consent.ClientID)
+		}
+	}
+	slices.Sort(clientIDs)
+	return clientIDs, nil
+}
+
+func day(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+)
+
+// LastAuditEntry relies on InTx serializing units of work instead of a lock.
+func (s *Store) LastAuditEntry(_ context.Context) (*domain.AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.state.auditLog) == 0 {
+		return nil, nil
+	}
+	entry := s.state.auditLog[len(s.state.auditLog)-1]
+	return &entry, nil
+}
+
+func (s *Store) AppendAuditEntries(ctx context.Context, entries []*domain.AuditEntry) error {
+	defer s.lock(ctx)()
+	for _, entry := range entries {
+		s.state.auditLog = append(s.state.auditLog, *entry)
+	}
+	return nil
+}
+
+func (s *Store) GetAuditEntries(_ context.Context, filter domain.AuditFilter) ([]*domain.AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries := make([]*domain.AuditEntry, 0)
+	for _, entry := range s.state.auditLog {
+		if filter.Limit > 0 && len(entries) == filter.Limit {
+			break
+		}
+		if entry.Sequence <= filter.AfterSequence ||
+			filter.ClientID != "" && entry.ClientID != filter.ClientID ||
+			filter.Action != "" && entry.Action != filter.Action ||
+			filter.ConsentID != "" && entry.ConsentID != filter.ConsentID ||
+			filter.Bank != "" && entry.Bank != filter.Bank ||
+			filter.RequestID != "" && entry.RequestID != filter.RequestID ||
+			!filter.From.IsZero() && entry.OccurredAt.Before(filter.From) ||
+			!filter.To.IsZero() && !entry.OccurredAt.Before(filter.To) {
+			continue
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,90 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+)
+
+type budgetAlertKey struct {
+	budgetID  string
+	period    int64
+	threshold int
+}
+
+func (s *Store) SaveBudget(ctx context.Context, budget *domain.Budget) error {
+	defer s.lock(ctx)()
+	s.state.budgets[budget.BudgetID] = *budget
+	return nil
+}
+
+func (s *Store) UpdateBudget(ctx context.Context, budget *domain.Budget) error {
+	defer s.lock(ctx)()
+	if existing, ok := s.state.budgets[budget.BudgetID]; !ok || existing.ClientID != budget.ClientID {
+		return fmt.Errorf("budget %s: %w", budget.BudgetID, domain.ErrNotFound)
+	}
+	s.state.budgets[budget.BudgetID] = *budget
+	return nil
+}
+
+func (s *Store) DeleteBudget(ctx context.Context, clientID, budgetID string) error {
+	defer s.lock(ctx)()
+	if existing, ok := s.state.budgets[budgetID]; !ok || existing.ClientID != clientID {
+		return fmt.Errorf("budget %s: %w", budgetID, domain.ErrNotFound)
+	}
+	delete(s.state.budgets, budgetID)
+	for k := range s.state.budgetAlerts {
+		if k.budgetID == budgetID {
+			delete(s.state.budgetAlerts, k)
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetBudget(_ context.Context, clientID, budgetID string) (*domain.Budget, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	budget, ok := s.state.budgets[budgetID]
+	if !ok || budget.ClientID != clientID {
+		return nil, fmt.Errorf("budget %s: %w", budgetID, domain.ErrNotFound)
+	}
+	return &budget, nil
+}
+
+func (s *Store) GetBudgets(_ context.Context, clientID string) ([]*domain.Budget, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	budgets := make([]*domain.Budget, 0)
+	for _, budget := range s.state.budgets {
+		if budget.ClientID == clientID {
+			budgets = append(budgets, &budget)
+		}
+	}
+	slices.SortFunc(budgets, func(a, b *domain.Budget) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return budgets, nil
+}
+
+func (s *Store) SaveBudgetAlert(ctx context.Context, alert *domain.BudgetAlert) (bool, error) {
+	defer s.lock(ctx)()
+	k := budgetAlertKey{budgetID: alert.BudgetID, period: alert.Period.Unix(), threshold: alert.Threshold}
+	if _, ok := s.state.budgetAlerts[k]; ok {
+		return false, nil
+	}
+	s.state.budgetAlerts[k] = *alert
+	return true, nil
+}
+
+func (s *Store) GetBudgetAlerts(_ context.Context, clientID, budgetID string) ([]*domain.BudgetAlert, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	alerts := make([]*domain.BudgetAlert, 0)
+	for _, alert := range s.state.budgetAlerts {
+		if alert.ClientID == clientID && alert.BudgetID == budgetID {
+			alerts = append(alerts, &alert)
+		}
+	}
+	slices.SortFunc(alerts, func(a, b *domain.BudgetAlert) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return alerts, nil
+}
@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+)
+
+func (s *Store) GetCategoryRules(_ context.Context, clientID string) ([]*domain.CategoryRule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rules := make([]*domain.CategoryRule, 0)
+	for _, rule := range s.state.categoryRules {
+		if rule.ClientID == clientID || rule.ClientID == "" {
+			rules = append(rules, &rule)
+		}
+	}
+	slices.SortFunc(rules, func(a, b *domain.CategoryRule) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return rules, nil
+}
+
+func (s *Store) SaveCategoryRule(ctx context.Context, rule *domain.CategoryRule) error {
+	defer s.lock(ctx)()
+	for id, existing := range s.state.categoryRules {
+		if existing.ClientID == rule.ClientID && existing.MatchField == rule.MatchField &&
+			strings.EqualFold(existing.Pattern, rule.Pattern) {
+			delete(s.state.categoryRules, id)
+			rule.RuleID = id
+		}
+	}
+	s.state.categoryRules[rule.RuleID] = *rule
+	return nil
+}
+
+func (s *Store) DeleteCategoryRule(ctx context.Context, clientID, ruleID string) error {
+	defer s.lock(ctx)()
+	rule, ok := s.state.categoryRules[ruleID]
+	if !ok || rule.ClientID != clientID {
+		return fmt.Errorf("category rule %s: %w", ruleID, domain.ErrNotFound)
+	}
+	delete(s.state.categoryRules, ruleID)
+	return nil
+}
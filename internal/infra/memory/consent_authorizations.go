@@ -0,0 +1,30 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+)
+
+func (s *Store) SaveConsentAuthorization(ctx context.Context, authorization *domain.ConsentAuthorization, now time.Time) error {
+	defer s.lock(ctx)()
+	for stateHash, existing := range s.state.consentAuthorizations {
+		if !now.Before(existing.ExpiresAt) {
+			delete(s.state.consentAuthorizations, stateHash)
+		}
+	}
+	s.state.consentAuthorizations[authorization.StateHash] = *authorization
+	return nil
+}
+
+func (s *Store) TakeConsentAuthorization(ctx context.Context, stateHash string, now time.Time) (*domain.ConsentAuthorization, error) {
+	defer s.lock(ctx)()
+	authorization, ok := s.state.consentAuthorizations[stateHash]
+	delete(s.state.consentAuthorizations, stateHash)
+	if !ok || !now.Before(authorization.ExpiresAt) {
+		return nil, fmt.Errorf("consent authorization: %w", domain.ErrNotFound)
+	}
+	return &authorization, nil
+}
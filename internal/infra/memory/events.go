@@ -0,0 +1,101 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+)
+
+func (s *Store) SaveOutboxEvents(ctx context.Context, events []*domain.Event) error {
+	defer s.lock(ctx)()
+	for _, event := range events {
+		s.state.outboxSequence++
+		event.Sequence = s.state.outboxSequence
+		e := *event
+		e.Payload = slices.Clone(event.Payload)
+		e.Delivered = slices.Clone(event.Delivered)
+		s.state.outbox = append(s.state.outbox, e)
+	}
+	return nil
+}
+
+// HeadOutboxEvents relies on InTx serializing units of work instead of row locks.
+func (s *Store) HeadOutboxEvents(_ context.Context, now time.Time, limit int) ([]*domain.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	events := make([]*domain.Event, 0)
+	seen := make(map[[2]string]struct{})
+	for _, event := range s.state.outbox {
+		if len(events) == limit {
+			break
+		}
+		if event.Status == domain.EventStatusDispatched {
+			continue
+		}
+		aggregate := [2]string{event.ClientID, event.AggregateID}
+		if _, ok := seen[aggregate]; ok {
+			continue
+		}
+		seen[aggregate] = struct{}{}
+		if event.Status == domain.EventStatusPending && !event.ClaimedUntil.After(now) {
+			event.Payload = slices.Clone(event.Payload)
+			event.Delivered = slices.Clone(event.Delivered)
+			events = append(events, &event)
+		}
+	}
+	return events, nil
+}
+
+func (s *Store) FailedOutboxEvents(_ context.Context, after int64, limit int) ([]*domain.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	events := make([]*domain.Event, 0)
+	for _, event := range s.state.outbox {
+		if len(events) == limit {
+			break
+		}
+		if event.Status == domain.EventStatusFailed && event.Sequence > after {
+			event.Payload = slices.Clone(event.Payload)
+			event.Delivered = slices.Clone(event.Delivered)
+			events = append(events, &event)
+		}
+	}
+	return events, nil
+}
+
+func (s *Store) RetryOutboxEvent(ctx context.Context, eventID string) error {
+	defer s.lock(ctx)()
+	for i := range s.state.outbox {
+		e := &s.state.outbox[i]
+		if e.EventID != eventID || e.Status != domain.EventStatusFailed {
+			continue
+		}
+		e.Status = domain.EventStatusPending
+		e.Attempts = 0
+		e.ClaimedUntil = time.Time{}
+		return nil
+	}
+	return fmt.Errorf("outbox event: %w", domain.ErrNotFound)
+}
+
+func (s *Store) UpdateOutboxEvent(ctx context.Context, event *domain.Event) error {
+	defer s.lock(ctx)()
+	i, ok := slices.BinarySearchFunc(s.state.outbox, event.Sequence, func(e domain.Event, seq int64) int {
+		return cmp.Compare(e.Sequence, seq)
+	})
+	if !ok {
+		return nil
+	}
+	e := &s.state.outbox[i]
+	e.Status = event.Status
+	e.Attempts = event.Attempts
+	e.LastError = event.LastError
+	e.DispatchedAt = event.DispatchedAt
+	e.ClaimedUntil = event.ClaimedUntil
+	e.Delivered = slices.Clone(event.Delivered)
+	return nil
+}
@@ -0,0 +1,61 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+)
+
+type idempotencyKey struct {
+	key      string
+	clientID string
+}
+
+func (s *Store) ReserveIdempotencyKey(ctx context.Context, record *domain.IdempotencyRecord) (*domain.IdempotencyRecord, bool, error) {
+	defer s.lock(ctx)()
+	k := idempotencyKey{key: record.Key, clientID: record.ClientID}
+	if existing, ok := s.state.idempotency[k]; ok && existing.ExpiresAt.After(record.CreatedAt) {
+		existing.Body = slices.Clone(existing.Body)
+		return &existing, false, nil
+	}
+	s.state.idempotency[k] = *record
+	return nil, true, nil
+}
+
+func (s *Store) CompleteIdempotencyKey(ctx context.Context, record *domain.IdempotencyRecord) error {
+	defer s.lock(ctx)()
+	k := idempotencyKey{key: record.Key, clientID: record.ClientID}
+	existing, ok := s.state.idempotency[k]
+	if !ok {
+		return nil
+	}
+	existing.Completed = true
+	existing.StatusCode = record.StatusCode
+	existing.ContentType = record.ContentType
+	existing.Body = slices.Clone(record.Body)
+	s.state.idempotency[k] = existing
+	return nil
+}
+
+func (s *Store) ReleaseIdempotencyKey(ctx context.Context, key, clientID string) error {
+	defer s.lock(ctx)()
+	k := idempotencyKey{key: key, clientID: clientID}
+	if existing, ok := s.state.idempotency[k]; ok && !existing.Completed {
+		delete(s.state.idempotency, k)
+	}
+	return nil
+}
+
+func (s *Store) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+	defer s.lock(ctx)()
+	var n int64
+	for k, record := range s.state.idempotency {
+		if !record.ExpiresAt.After(now) {
+			delete(s.state.idempotency, k)
+			n++
+		}
+	}
+	return n, nil
+}
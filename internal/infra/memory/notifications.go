@@ -0,0 +1,102 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+)
+
+type notificationPreferenceKey struct {
+	clientID string
+	channel  string
+}
+
+func (s *Store) SaveNotificationPreference(ctx context.Context, pref *domain.NotificationPreference) error {
+	defer s.lock(ctx)()
+	p := *pref
+	p.Events = slices.Clone(pref.Events)
+	s.state.notificationPreferences[notificationPreferenceKey{clientID: pref.ClientID, channel: pref.Channel}] = p
+	return nil
+}
+
+func (s *Store) GetNotificationPreferences(_ context.Context, clientID string) ([]*domain.NotificationPreference, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	prefs := make([]*domain.NotificationPreference, 0)
+	for _, pref := range s.state.notificationPreferences {
+		if pref.ClientID == clientID {
+			pref.Events = slices.Clone(pref.Events)
+			prefs = append(prefs, &pref)
+		}
+	}
+	slices.SortFunc(prefs, func(a, b *domain.NotificationPreference) int { return strings.Compare(a.Channel, b.Channel) })
+	return prefs, nil
+}
+
+func (s *Store) SaveNotificationDelivery(ctx context.Context, delivery *domain.NotificationDelivery) error {
+	defer s.lock(ctx)()
+	d := *delivery
+	d.Data = maps.Clone(delivery.Data)
+	s.state.notificationDeliveries[delivery.DeliveryID] = d
+	return nil
+}
+
+func (s *Store) UpdateNotificationDelivery(ctx context.Context, delivery *domain.NotificationDelivery) error {
+	defer s.lock(ctx)()
+	d, ok := s.state.notificationDeliveries[delivery.DeliveryID]
+	if !ok {
+		return nil
+	}
+	d.Status = delivery.Status
+	d.Attempts = delivery.Attempts
+	d.LastError = delivery.LastError
+	d.NextAttemptAt = delivery.NextAttemptAt
+	d.UpdatedAt = delivery.UpdatedAt
+	s.state.notificationDeliveries[delivery.DeliveryID] = d
+	return nil
+}
+
+func (s *Store) ClaimNotificationDeliveries(ctx context.Context, now, until time.Time, limit int) ([]*domain.NotificationDelivery, error) {
+	defer s.lock(ctx)()
+	due := make([]domain.NotificationDelivery, 0)
+	for _, d := range s.state.notificationDeliveries {
+		if d.Status == domain.DeliveryStatusPending && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	slices.SortFunc(due, func(a, b domain.NotificationDelivery) int { return a.NextAttemptAt.Compare(b.NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	res := make([]*domain.NotificationDelivery, 0, len(due))
+	for _, d := range due {
+		d.NextAttemptAt = until
+		s.state.notificationDeliveries[d.DeliveryID] = d
+		d.Data = maps.Clone(d.Data)
+		res = append(res, &d)
+	}
+	return res, nil
+}
+
+func (s *Store) GetNotificationDeliveries(_ context.Context, clientID string) ([]*domain.NotificationDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	deliveries := make([]*domain.NotificationDelivery, 0)
+	for _, d := range s.state.notificationDeliveries {
+		if d.ClientID == clientID {
+			d.Data = maps.Clone(d.Data)
+			deliveries = append(deliveries, &d)
+		}
+	}
+	slices.SortFunc(deliveries, func(a, b *domain.NotificationDelivery) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.DeliveryID, b.DeliveryID)
+	})
+	return deliveries, nil
+}
@@ -0,0 +1,80 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+)
+
+func (s *Store) GetClientPlan(_ context.Context, clientID string) (*domain.ClientPlan, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	plan, ok := s.state.clientPlans[clientID]
+	if !ok {
+		return nil, fmt.Errorf("client plan: %w", domain.ErrNotFound)
+	}
+	return &plan, nil
+}
+
+func (s *Store) SaveClientPlan(ctx context.Context, plan *domain.ClientPlan) error {
+	defer s.lock(ctx)()
+	s.state.clientPlans[plan.ClientID] = *plan
+	return nil
+}
+
+func (s *Store) SavePlanChange(ctx context.Context, change *domain.PlanChange) error {
+	defer s.lock(ctx)()
+	s.state.planChanges = append(s.state.planChanges, *change)
+	return nil
+}
+
+func (s *Store) GetPlanChanges(_ context.Context, clientID string) ([]*domain.PlanChange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	changes := make([]*domain.PlanChange, 0)
+	for _, change := range s.state.planChanges {
+		if change.ClientID == clientID {
+			changes = append(changes, &change)
+		}
+	}
+	return changes, nil
+}
+
+func (s *Store) ReserveSync(ctx context.Context, clientID string, now, syncedBefore, reservedUntil time.Time) (*domain.ClientSync, bool, error) {
+	defer s.lock(ctx)()
+	sync, ok := s.state.clientSyncs[clientID]
+	if !ok {
+		sync = domain.ClientSync{ClientID: clientID}
+	}
+	if sync.SyncedAt.After(syncedBefore) || sync.ReservedUntil.After(now) {
+		return &sync, false, nil
+	}
+	sync.ReservedUntil = reservedUntil
+	s.state.clientSyncs[clientID] = sync
+	return &sync, true, nil
+}
+
+func (s *Store) CompleteSync(ctx context.Context, clientID string, reservedUntil, syncedAt time.Time) error {
+	defer s.lock(ctx)()
+	sync, ok := s.state.clientSyncs[clientID]
+	if !ok || !sync.ReservedUntil.Equal(reservedUntil) {
+		return nil
+	}
+	sync.SyncedAt = syncedAt
+	sync.ReservedUntil = time.Time{}
+	s.state.clientSyncs[clientID] = sync
+	return nil
+}
+
+func (s *Store) ReleaseSync(ctx context.Context, clientID string, reservedUntil time.Time) error {
+	defer s.lock(ctx)()
+	sync, ok := s.state.clientSyncs[clientID]
+	if !ok || !sync.ReservedUntil.Equal(reservedUntil) {
+		return nil
+	}
+	sync.ReservedUntil = time.Time{}
+	s.state.clientSyncs[clientID] = sync
+	return nil
+}
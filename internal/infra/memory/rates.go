@@ -0,0 +1,43 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+)
+
+type rateKey struct {
+	date         time.Time
+	currency     string
+	baseCurrency string
+}
+
+func (s *Store) SaveRates(ctx context.Context, rates []*domain.ExchangeRate) error {
+	defer s.lock(ctx)()
+	for _, rate := range rates {
+		s.state.rates[rateKey{date: rate.Date, currency: rate.Currency, baseCurrency: rate.BaseCurrency}] = *rate
+	}
+	return nil
+}
+
+func (s *Store) GetRates(_ context.Context, date time.Time) ([]*domain.ExchangeRate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	type pair struct{ currency, baseCurrency string }
+	latest := make(map[pair]domain.ExchangeRate)
+	for k, rate := range s.state.rates {
+		if k.date.After(date) {
+			continue
+		}
+		p := pair{currency: k.currency, baseCurrency: k.baseCurrency}
+		if prev, ok := latest[p]; !ok || prev.Date.Before(rate.Date) {
+			latest[p] = rate
+		}
+	}
+	rates := make([]*domain.ExchangeRate, 0, len(latest))
+	for _, rate := range latest {
+		rates = append(rates, &rate)
+	}
+	return rates, nil
+}
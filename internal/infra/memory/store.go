@@ -0,0 +1,192 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/internal/httpsrv"
+	"github.com/MichaelSBoop/lima-backend/internal/service/accounts"
+	"github.com/MichaelSBoop/lima-backend/internal/service/analytics"
+	"github.com/MichaelSBoop/lima-backend/internal/service/audit"
+	"github.com/MichaelSBoop/lima-backend/internal/service/budgets"
+	"github.com/MichaelSBoop/lima-backend/internal/service/categories"
+	"github.com/MichaelSBoop/lima-backend/internal/service/consents"
+	"github.com/MichaelSBoop/lima-backend/internal/service/events"
+	"github.com/MichaelSBoop/lima-backend/internal/service/notifications"
+	"github.com/MichaelSBoop/lima-backend/internal/service/plans"
+	"github.com/MichaelSBoop/lima-backend/internal/service/rates"
+	"github.com/MichaelSBoop/lima-backend/internal/service/recurring"
+	"github.com/MichaelSBoop/lima-backend/internal/service/reencrypt"
+	"github.com/MichaelSBoop/lima-backend/internal/service/requester"
+	"github.com/MichaelSBoop/lima-backend/internal/service/statements"
+	"github.com/MichaelSBoop/lima-backend/internal/service/transactions"
+	"github.com/MichaelSBoop/lima-backend/internal/service/transfers"
+	"go.uber.org/zap"
+)
+
+type txKey struct{}
+
+// Store keeps every repository in process memory. It is meant for local
+// development and integration tests and loses all data on restart.
+type Store struct {
+	mu sync.RWMutex
+	// txMu serializes units of work and the writes made outside of them, so a
+	// rollback only discards the writes of its own unit of work.
+	txMu sync.Mutex
+
+	state *state
+	log   *zap.Logger
+}
+
+type state struct {
+	consents     []domain.AccountConsent
+	accounts     map[accountKey]domain.Account
+	balances     map[balanceKey]domain.Balance
+	rates        map[rateKey]domain.ExchangeRate
+	idempotency  map[idempotencyKey]domain.IdempotencyRecord
+	transactions map[transactionKey]domain.Transaction
+	snapshots    map[snapshotKey]domain.AccountSnapshot
+	// categoryRules are keyed by rule ID.
+	categoryRules map[string]domain.CategoryRule
+	budgets       map[string]domain.Budget
+	budgetAlerts  map[budgetAlertKey]domain.BudgetAlert
+	// transferPairs are keyed by transfer ID.
+	transferPairs           map[string]domain.TransferPair
+	notificationPreferences map[notificationPreferenceKey]domain.NotificationPreference
+	// notificationDeliveries are keyed by delivery ID.
+	notificationDeliveries map[string]domain.NotificationDelivery
+	// outbox is ordered by sequence.
+	outbox         []domain.Event
+	outboxSequence int64
+	// auditLog is ordered by sequence.
+	auditLog []domain.AuditEntry
+	// consentAuthorizations are keyed by state hash.
+	consentAuthorizations map[string]domain.ConsentAuthorization
+	// clientPlans are keyed by client ID.
+	clientPlans map[string]domain.ClientPlan
+	// planChanges are ordered by the time of the change.
+	planChanges []domain.PlanChange
+	// clientSyncs are keyed by client ID.
+	clientSyncs map[string]domain.ClientSync
+}
+
+func New(log *zap.Logger) *Store {
+	return &Store{
+		state: &state{
+			accounts:      make(map[accountKey]domain.Account),
+			balances:      make(map[balanceKey]domain.Balance),
+			rates:         make(map[rateKey]domain.ExchangeRate),
+			idempotency:   make(map[idempotencyKey]domain.IdempotencyRecord),
+			transactions:  make(map[transactionKey]domain.Transaction),
+			snapshots:     make(map[snapshotKey]domain.AccountSnapshot),
+			categoryRules: make(map[string]domain.CategoryRule),
+			budgets:       make(map[string]domain.Budget),
+			budgetAlerts:  make(map[budgetAlertKey]domain.BudgetAlert),
+			transferPairs: make(map[string]domain.TransferPair),
+
+			notificationPreferences: make(map[notificationPreferenceKey]domain.NotificationPreference),
+			notificationDeliveries:  make(map[string]domain.NotificationDelivery),
+			consentAuthorizations:   make(map[string]domain.ConsentAuthorization),
+			clientPlans:             make(map[string]domain.ClientPlan),
+			clientSyncs:             make(map[string]domain.ClientSync),
+		},
+		log: log,
+	}
+}
+
+// InTx runs f against a snapshot of the store that is restored if f fails.
+func (s *Store) InTx(ctx context.Context, f func(ctx context.Context) error) error {
+	if ctx.Value(txKey{}) == nil {
+		s.txMu.Lock()
+		defer s.txMu.Unlock()
+		ctx = context.WithValue(ctx, txKey{}, struct{}{})
+	}
+
+	s.mu.RLock()
+	snapshot := s.state.clone()
+	s.mu.RUnlock()
+
+	if err := f(ctx); err != nil {
+		s.mu.Lock()
+		s.state = snapshot
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// lock takes the write lock and returns its release. Outside a unit of work
+// it waits for the running one to end first, so that its rollback cannot
+// discard the write.
+func (s *Store) lock(ctx context.Context) func() {
+	if ctx.Value(txKey{}) == nil {
+		s.txMu.Lock()
+		s.mu.Lock()
+		return func() {
+			s.mu.Unlock()
+			s.txMu.Unlock()
+		}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+func (st *state) clone() *state {
+	consents := make([]domain.AccountConsent, len(st.consents))
+	for i, consent := range st.consents {
+		consent.Permissions = slices.Clone(consent.Permissions)
+		consents[i] = consent
+	}
+	return &state{
+		consents:      consents,
+		accounts:      maps.Clone(st.accounts),
+		balances:      maps.Clone(st.balances),
+		rates:         maps.Clone(st.rates),
+		idempotency:   maps.Clone(st.idempotency),
+		transactions:  maps.Clone(st.transactions),
+		snapshots:     maps.Clone(st.snapshots),
+		categoryRules: maps.Clone(st.categoryRules),
+		budgets:       maps.Clone(st.budgets),
+		budgetAlerts:  maps.Clone(st.budgetAlerts),
+		transferPairs: maps.Clone(st.transferPairs),
+
+		notificationPreferences: maps.Clone(st.notificationPreferences),
+		notificationDeliveries:  maps.Clone(st.notificationDeliveries),
+		consentAuthorizations:   maps.Clone(st.consentAuthorizations),
+		clientPlans:             maps.Clone(st.clientPlans),
+		planChanges:             slices.Clone(st.planChanges),
+		clientSyncs:             maps.Clone(st.clientSyncs),
+
+		outbox:         slices.Clone(st.outbox),
+		outboxSequence: st.outboxSequence,
+		auditLog:       slices.Clone(st.auditLog),
+	}
+}
+
+var (
+	_ accounts.ConsentSaver      = (*Store)(nil)
+	_ accounts.AccountsSaver     = (*Store)(nil)
+	_ accounts.UnitOfWork        = (*Store)(nil)
+	_ accounts.BalancesSaver     = (*Store)(nil)
+	_ rates.Store                = (*Store)(nil)
+	_ transactions.Store         = (*Store)(nil)
+	_ transactions.UnitOfWork    = (*Store)(nil)
+	_ analytics.Store            = (*Store)(nil)
+	_ categories.Store           = (*Store)(nil)
+	_ budgets.Store              = (*Store)(nil)
+	_ recurring.Store            = (*Store)(nil)
+	_ statements.Store           = (*Store)(nil)
+	_ notifications.Store        = (*Store)(nil)
+	_ events.Store               = (*Store)(nil)
+	_ transfers.Store            = (*Store)(nil)
+	_ reencrypt.Store            = (*Store)(nil)
+	_ audit.Store                = (*Store)(nil)
+	_ requester.ConsentsProvider = (*Store)(nil)
+	_ consents.Store             = (*Store)(nil)
+	_ plans.Store                = (*Store)(nil)
+	_ plans.UnitOfWork           = (*Store)(nil)
+	_ httpsrv.IdempotencyStore   = (*Store)(nil)
+)
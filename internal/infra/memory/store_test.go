@@ -0,0 +1,265 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/internal/infra/memory"
+	"go.uber.org/zap"
+)
+
+var errAbort = errors.New("abort")
+
+func account(clientID, bank, accountID string) *domain.Account {
+	return &domain.Account{ClientID: clientID, Bank: bank, AccountID: accountID, Currency: "RUB"}
+}
+
+// accountIDs lists the banks and IDs of the accounts of the client.
+func accountIDs(t *testing.T, s *memory.Store, clientID string) []string {
+	t.Helper()
+	accounts, err := s.ListAccounts(context.Background(), clientID)
+	if err != nil {
+		t.Fatalf("ListAccounts: %v", err)
+	}
+	res := make([]string, 0, len(accounts))
+	for _, a := range accounts {
+		res = append(res, a.Bank+"/"+a.AccountID)
+	}
+	slices.Sort(res)
+	return res
+}
+
+func TestInTx(t *testing.T) {
+	tests := []struct {
+		name string
+		f    func(s *memory.Store) func(ctx context.Context) error
+		want []string
+		// wantEvents is how many events the outbox keeps.
+		wantEvents int
+		wantErr    error
+	}{
+		{
+			name: "commits",
+			f: func(s *memory.Store) func(ctx context.Context) error {
+				return func(ctx context.Context) error {
+					if err := s.SaveAccount(ctx, account("c1", "vbank", "a2")); err != nil {
+						return err
+					}
+					return s.SaveOutboxEvents(ctx, []*domain.Event{{EventID: "e1", ClientID: "c1", Status: domain.EventStatusPending}})
+				}
+			},
+			want:       []string{"vbank/a1", "vbank/a2"},
+			wantEvents: 1,
+		},
+		{
+			name: "rolls back every repository",
+			f: func(s *memory.Store) func(ctx context.Context) error {
+				return func(ctx context.Context) error {
+					if err := s.SaveAccount(ctx, account("c1", "vbank", "a2")); err != nil {
+						return err
+					}
+					if err := s.SaveOutboxEvents(ctx, []*domain.Event{{EventID: "e1", ClientID: "c1", Status: domain.EventStatusPending}}); err != nil {
+						return err
+					}
+					return errAbort
+				}
+			},
+			want:    []string{"vbank/a1"},
+			wantErr: errAbort,
+		},
+		{
+			name: "rolls back a nested unit of work alone",
+			f: func(s *memory.Store) func(ctx context.Context) error {
+				return func(ctx context.Context) error {
+					if err := s.SaveAccount(ctx, account("c1", "vbank", "a2")); err != nil {
+						return err
+					}
+					err := s.InTx(ctx, func(ctx context.Context) error {
+						if err := s.SaveAccount(ctx, account("c1", "vbank", "a3")); err != nil {
+							return err
+						}
+						return errAbort
+					})
+					if !errors.Is(err, errAbort) {
+						return fmt.Errorf("nested InTx = %v", err)
+					}
+					return nil
+				}
+			},
+			want: []string{"vbank/a1", "vbank/a2"},
+		},
+		{
+			name: "rolls back nested units of work with their parent",
+			f: func(s *memory.Store) func(ctx context.Context) error {
+				return func(ctx context.Context) error {
+					err := s.InTx(ctx, func(ctx context.Context) error {
+						return s.SaveAccount(ctx, account("c1", "vbank", "a3"))
+					})
+					if err != nil {
+						return err
+					}
+					return errAbort
+				}
+			},
+			want:    []string{"vbank/a1"},
+			wantErr: errAbort,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := memory.New(zap.NewNop())
+			if err := s.SaveAccount(ctx, account("c1", "vbank", "a1")); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.InTx(ctx, tt.f(s)); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("InTx = %v, want %v", err, tt.wantErr)
+			}
+			if got := accountIDs(t, s, "c1"); !slices.Equal(got, tt.want) {
+				t.Errorf("got accounts %q, want %q", got, tt.want)
+			}
+			events, err := s.HeadOutboxEvents(ctx, time.Now(), 10)
+			if err != nil {
+				t.Fatalf("HeadOutboxEvents: %v", err)
+			}
+			if len(events) != tt.wantEvents {
+				t.Errorf("outbox keeps %d events, want %d", len(events), tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestRollbackKeepsWritesOutsideTheUnitOfWork(t *testing.T) {
+	ctx := context.Background()
+	s := memory.New(zap.NewNop())
+	started, release := make(chan struct{}), make(chan struct{})
+	txDone := make(chan error)
+	go func() {
+		txDone <- s.InTx(ctx, func(ctx context.Context) error {
+			if err := s.SaveAccount(ctx, account("c1", "vbank", "in-tx")); err != nil {
+				return err
+			}
+			close(started)
+			<-release
+			return errAbort
+		})
+	}()
+	<-started
+
+	saved := make(chan error)
+	go func() { saved <- s.SaveAccount(ctx, account("c1", "vbank", "outside")) }()
+	select {
+	case err := <-saved:
+		t.Fatalf("write outside the unit of work ran during it: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	if err := <-txDone; !errors.Is(err, errAbort) {
+		t.Fatalf("InTx = %v, want %v", err, errAbort)
+	}
+	if err := <-saved; err != nil {
+		t.Fatalf("SaveAccount: %v", err)
+	}
+	if got, want := accountIDs(t, s, "c1"), []string{"vbank/outside"}; !slices.Equal(got, want) {
+		t.Errorf("got accounts %q, want %q", got, want)
+	}
+}
+
+func TestAccountsAreScopedByClientAndBank(t *testing.T) {
+	ctx := context.Background()
+	s := memory.New(zap.NewNop())
+	for _, a := range []*domain.Account{
+		account("c1", "vbank", "a1"),
+		account("c1", "abank", "a1"),
+		account("c2", "vbank", "a1"),
+		// Saving again replaces the account.
+		{ClientID: "c1", Bank: "vbank", AccountID: "a1", Currency: "RUB", Nickname: "Main"},
+	} {
+		if err := s.SaveAccount(ctx, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := accountIDs(t, s, "c1"), []string{"abank/a1", "vbank/a1"}; !slices.Equal(got, want) {
+		t.Errorf("got accounts %q, want %q", got, want)
+	}
+	if got, want := accountIDs(t, s, "c2"), []string{"vbank/a1"}; !slices.Equal(got, want) {
+		t.Errorf("got accounts %q of c2, want %q", got, want)
+	}
+
+	for _, balance := range []*domain.Balance{
+		{ClientID: "c1", Bank: "vbank", AccountID: "a1", Type: "InterimAvailable", Amount: "100.00", Currency: "RUB"},
+		{ClientID: "c1", Bank: "abank", AccountID: "a1", Type: "InterimAvailable", Amount: "200.00", Currency: "RUB"},
+	} {
+		if err := s.SaveBalance(ctx, balance); err != nil {
+			t.Fatal(err)
+		}
+	}
+	balance, err := s.GetBalance(ctx, "c1", "abank", "a1")
+	if err != nil || balance.Amount != "200.00" {
+		t.Errorf("GetBalance = %+v, %v, want the abank balance", balance, err)
+	}
+	if _, err = s.GetBalance(ctx, "c2", "abank", "a1"); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("GetBalance of another client = %v, want not found", err)
+	}
+}
+
+func TestReadsReturnCopies(t *testing.T) {
+	ctx := context.Background()
+	s := memory.New(zap.NewNop())
+	consent := &domain.AccountConsent{ClientID: "c1", ConsentID: "consent-1", Status: domain.ConsentStatusApproved, Permissions: []string{domain.PermissionReadBalances}}
+	if err := s.SaveConsent(ctx, consent, "vbank"); err != nil {
+		t.Fatal(err)
+	}
+	consent.Permissions[0] = "changed by the caller"
+
+	stored, err := s.GetConsents(ctx, "c1")
+	if err != nil || len(stored) != 1 {
+		t.Fatalf("GetConsents = %v, %v", stored, err)
+	}
+	stored[0].Status = domain.ConsentStatusRevoked
+	stored[0].Permissions[0] = "changed by the reader"
+
+	again, err := s.GetConsents(ctx, "c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again[0].Status != domain.ConsentStatusApproved || again[0].Permissions[0] != domain.PermissionReadBalances || again[0].ConsentProvider != "vbank" {
+		t.Errorf("stored consent changed to %+v", again[0])
+	}
+}
+
+func TestConcurrentUse(t *testing.T) {
+	ctx := context.Background()
+	s := memory.New(zap.NewNop())
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Go(func() {
+			for j := range 50 {
+				tx := &domain.Transaction{ClientID: "c1", Bank: "vbank", AccountID: "a1", TransactionID: fmt.Sprintf("t%d-%d", i, j), Amount: "-1.00", BookedAt: time.Now()}
+				err := s.InTx(ctx, func(ctx context.Context) error { return s.SaveTransaction(ctx, tx) })
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err = s.GetTransactions(ctx, domain.TransactionFilter{ClientID: "c1"}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		})
+	}
+	wg.Wait()
+	txs, err := s.GetTransactions(ctx, domain.TransactionFilter{ClientID: "c1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 8*50 {
+		t.Errorf("stored %d transactions, want %d", len(txs), 8*50)
+	}
+}
@@ -0,0 +1,72 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+)
+
+type transactionKey struct {
+	accountKey
+	transactionID string
+}
+
+func txKeyOf(tx *domain.Transaction) transactionKey {
+	return transactionKey{
+		accountKey:    accountKey{clientID: tx.ClientID, bank: tx.Bank, accountID: tx.AccountID},
+		transactionID: tx.TransactionID,
+	}
+}
+
+func (s *Store) SaveTransaction(ctx context.Context, tx *domain.Transaction) error {
+	defer s.lock(ctx)()
+	k := txKeyOf(tx)
+	t := *tx
+	if existing, ok := s.state.transactions[k]; ok {
+		t.TransferID = existing.TransferID
+		if existing.CategorySource == domain.CategorySourceOverride || existing.TransferID != "" {
+			t.Category, t.CategorySource = existing.Category, existing.CategorySource
+		}
+	}
+	s.state.transactions[k] = t
+	return nil
+}
+
+func (s *Store) GetTransactions(_ context.Context, filter domain.TransactionFilter) ([]*domain.Transaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	txs := make([]*domain.Transaction, 0)
+	for _, tx := range s.state.transactions {
+		if tx.ClientID != filter.ClientID ||
+			(filter.Bank != "" && tx.Bank != filter.Bank) ||
+			(filter.AccountID != "" && tx.AccountID != filter.AccountID) ||
+			(filter.TransactionID != "" && tx.TransactionID != filter.TransactionID) ||
+			(filter.Category != "" && tx.Category != filter.Category) ||
+			(!filter.From.IsZero() && tx.BookedAt.Before(filter.From)) ||
+			(!filter.To.IsZero() && !tx.BookedAt.Before(filter.To)) {
+			continue
+		}
+		txs = append(txs, &tx)
+	}
+	slices.SortFunc(txs, func(a, b *domain.Transaction) int {
+		if c := b.BookedAt.Compare(a.BookedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.TransactionID, b.TransactionID)
+	})
+	return txs, nil
+}
+
+func (s *Store) UpdateTransactionCategory(ctx context.Context, tx *domain.Transaction) error {
+	defer s.lock(ctx)()
+	k := txKeyOf(tx)
+	existing, ok := s.state.transactions[k]
+	if !ok {
+		return nil
+	}
+	existing.Category, existing.CategorySource = tx.Category, tx.CategorySource
+	s.state.transactions[k] = existing
+	return nil
+}
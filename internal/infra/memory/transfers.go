@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+)
+
+func (s *Store) SaveTransferPair(ctx context.Context, pair *domain.TransferPair) error {
+	defer s.lock(ctx)()
+	s.state.transferPairs[pair.TransferID] = *pair
+	for k, tx := range s.state.transactions {
+		if tx.ClientID != pair.ClientID ||
+			!(tx.Bank == pair.DebitBank && tx.AccountID == pair.DebitAccountID && tx.TransactionID == pair.DebitTransactionID ||
+				tx.Bank == pair.CreditBank && tx.AccountID == pair.CreditAccountID && tx.TransactionID == pair.CreditTransactionID) {
+			continue
+		}
+		tx.TransferID = pair.TransferID
+		if tx.CategorySource != domain.CategorySourceOverride {
+			tx.Category, tx.CategorySource = domain.CategoryTransfers, domain.CategorySourceTransfer
+		}
+		s.state.transactions[k] = tx
+	}
+	return nil
+}
+
+func (s *Store) GetTransferPairs(_ context.Context, clientID string, from, to time.Time) ([]*domain.TransferPair, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	pairs := make([]*domain.TransferPair, 0)
+	for _, pair := range s.state.transferPairs {
+		if pair.ClientID != clientID ||
+			(!from.IsZero() && pair.DebitBookedAt.Before(from)) ||
+			(!to.IsZero() && !pair.DebitBookedAt.Before(to)) {
+			continue
+		}
+		pairs = append(pairs, &pair)
+	}
+	slices.SortFunc(pairs, func(a, b *domain.TransferPair) int {
+		if c := b.DebitBookedAt.Compare(a.DebitBookedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.TransferID, b.TransferID)
+	})
+	return pairs, nil
+}
@@ -1,146 +1,391 @@
 package postgres
 
 import (
+	"cmp"
 	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
 
 	"github.com/MichaelSBoop/lima-backend/internal/domain"
 	"github.com/jackc/pgx/v5"
 )
 
 func (c *Client) SaveConsent(ctx context.Context, consent *domain.AccountConsent, consentProvider string) error {
-	err := c.InTxWithOpts(ctx, func(tx pgx.Tx) error {
-		_, err := c.pool.Exec(ctx, `INSERT INTO account_consents (
-		client_id, 
-		permissions,
-		reason, 
-		requesting_bank, 
-		requesting_bank_name, 
-		status, 
-		consent_id, 
-		auto_approved,
-		consent_provider) VALUES (
-		@client_id, 
-		@permissions, 
-		@reason, 
-		@requesting_bank, 
-		@requesting_bank_name, 
-		@status, 
-		@consent_id, 
-		@auto_approved, 
-		@consent_provider)`, pgx.NamedArgs{
-			"client_id":            consent.ClientID,
-			"permissions":          consent.Permissions,
-			"reason":               consent.Reason,
-			"requesting_bank":      consent.RequestingBank,
-			"requesting_bank_name": consent.RequestingBankName,
-			"status":               consent.Status,
-			"consent_id":           consent.ConsentID,
-			"auto_approved":        consent.AutoApproved,
-			"consent_provider":     consentProvider,
-		})
-		return err
-	}, pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+	args, err := c.consentArgs(consent, consentProvider)
 	if err != nil {
 		return err
 	}
-	return nil
+	_, err = c.conn(ctx).Exec(ctx, `INSERT INTO account_consents (
+		client_id,
+		permissions,
+		reason,
+		requesting_bank,
+		requesting_bank_name,
+		status,
+		consent_id,
+		consent_id_bidx,
+		auto_approved,
+		consent_provider,
+		expires_at,
+		created_at,
+		last_used_at,
+		expiry_notified_at,
+		replaces_consent_id) VALUES (
+		@client_id,
+		@permissions,
+		@reason,
+		@requesting_bank,
+		@requesting_bank_name,
+		@status,
+		@consent_id,
+		NULLIF(@consent_id_bidx, ''),
+		@auto_approved,
+		@consent_provider,
+		@expires_at,
+		@created_at,
+		@last_used_at,
+		@expiry_notified_at,
+		NULLIF(@replaces_consent_id, ''))`, args)
+	return err
 }
 
+// UpdateConsent finds the consent by the blind index of its id, or by the id
+// itself while the row has not been sealed yet.
 func (c *Client) UpdateConsent(ctx context.Context, consent *domain.AccountConsent, consentProvider string) error {
-	err := c.InTxWithOpts(ctx, func(tx pgx.Tx) error {
-		_, err := c.pool.Exec(ctx, `UPDATE account_consents
-		SET client_id = @client_id, 
-		permissions = @permissions, 
-		reason = @reason, 
-		requesting_bank = @requesting_bank, 
-		requesting_bank_name = @requesting_bank_name, 
-		status = @status, 
-		consent_id = @consent_id, 
-		auto_approved = @auto_approved,
-		consent_provider = @consent_provider)`, pgx.NamedArgs{
-			"client_id":            consent.ClientID,
-			"permissions":          consent.Permissions,
-			"reason":               consent.Reason,
-			"requesting_bank":      consent.RequestingBank,
-			"requesting_bank_name": consent.RequestingBankName,
-			"status":               consent.Status,
-			"consent_id":           consent.ConsentID,
-			"auto_approved":        consent.AutoApproved,
-			"consent_provider":     consentProvider,
-		})
-		if err != nil {
-			return err
-		}
-		return nil
-	}, pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+	args, err := c.consentArgs(consent, consentProvider)
 	if err != nil {
 		return err
 	}
-	return nil
+	args["plain_consent_id"] = consent.ConsentID
+	_, err = c.conn(ctx).Exec(ctx, `UPDATE account_consents
+		SET client_id = @client_id,
+		permissions = @permissions,
+		reason = @reason,
+		requesting_bank = @requesting_bank,
+		requesting_bank_name = @requesting_bank_name,
+		status = @status,
+		consent_id = @consent_id,
+		consent_id_bidx = NULLIF(@consent_id_bidx, ''),
+		auto_approved = @auto_approved,
+		consent_provider = @consent_provider,
+		expires_at = @expires_at,
+		created_at = @created_at,
+		last_used_at = @last_used_at,
+		expiry_notified_at = @expiry_notified_at,
+		replaces_consent_id = NULLIF(@replaces_consent_id, '')
+		WHERE consent_id_bidx = NULLIF(@consent_id_bidx, '')
+		OR (consent_id_bidx IS NULL AND consent_id = @plain_consent_id)`, args)
+	return err
+}
+
+// MarkConsentUsed records that a bank call was made under the consent at at,
+// keeping a later time already recorded.
+func (c *Client) MarkConsentUsed(ctx context.Context, consentID string, at time.Time) error {
+	f := c.fields()
+	args := pgx.NamedArgs{
+		"consent_id_bidx":  f.index(consentID, fieldConsentID),
+		"plain_consent_id": consentID,
+		"at":               at,
+	}
+	if f.err != nil {
+		return f.err
+	}
+	_, err := c.conn(ctx).Exec(ctx, `UPDATE account_consents
+		SET last_used_at = GREATEST(COALESCE(last_used_at, @at), @at)
+		WHERE consent_id_bidx = NULLIF(@consent_id_bidx, '')
+		OR (consent_id_bidx IS NULL AND consent_id = @plain_consent_id)`, args)
+	return err
+}
+
+func (c *Client) consentArgs(consent *domain.AccountConsent, consentProvider string) (pgx.NamedArgs, error) {
+	f := c.fields()
+	index := f.index(consent.ConsentID, fieldConsentID)
+	args := pgx.NamedArgs{
+		"client_id":            consent.ClientID,
+		"permissions":          consent.Permissions,
+		"reason":               f.seal(consent.Reason, rowField(fieldConsentReason, consent.ClientID, consent.ConsentID)),
+		"requesting_bank":      consent.RequestingBank,
+		"requesting_bank_name": consent.RequestingBankName,
+		"status":               consent.Status,
+		"consent_id":           f.seal(consent.ConsentID, rowField(fieldConsentID, consent.ClientID, index)),
+		"consent_id_bidx":      index,
+		"auto_approved":        consent.AutoApproved,
+		"consent_provider":     consentProvider,
+		"expires_at":           nullTime(consent.ExpiresAt),
+		"created_at":           nullTime(consent.CreatedAt),
+		"last_used_at":         nullTime(consent.LastUsedAt),
+		"expiry_notified_at":   nullTime(consent.ExpiryNotifiedAt),
+		"replaces_consent_id":  f.seal(consent.ReplacesConsentID, rowField(fieldConsentReplaces, consent.ClientID, consent.ConsentID)),
+	}
+	return args, f.err
 }
 
+const consentColumns = `client_id,
+	permissions,
+	COALESCE(reason, ''),
+	COALESCE(requesting_bank, ''),
+	COALESCE(requesting_bank_name, ''),
+	COALESCE(status, ''),
+	consent_id,
+	COALESCE(consent_id_bidx, ''),
+	COALESCE(auto_approved, false),
+	COALESCE(consent_provider, ''),
+	expires_at,
+	created_at,
+	last_used_at,
+	expiry_notified_at,
+	COALESCE(replaces_consent_id, '')`
+
 func (c *Client) GetConsents(ctx context.Context, clientID string) ([]*domain.AccountConsent, error) {
-	consents := make([]*domain.AccountConsent, 0)
-	err := c.InTxWithOpts(ctx, func(tx pgx.Tx) error {
-		rows, err := c.pool.Query(ctx, `SELECT *
+	rows, err := c.conn(ctx).Query(ctx, `SELECT `+consentColumns+`
 		FROM account_consents WHERE client_id = @client_id`, pgx.NamedArgs{
-			"client_id": clientID,
-		})
-		if err != nil {
-			return err
-		}
-		defer rows.Close()
-		for rows.Next() {
-			var consent domain.AccountConsent
-			if err = rows.Scan(
-				&consent.ClientID,
-				&consent.Permissions,
-				&consent.Reason,
-				&consent.RequestingBank,
-				&consent.RequestingBankName,
-				&consent.Status,
-				&consent.ConsentID,
-				&consent.AutoApproved,
-				&consent.ConsentProvider,
-			); err != nil {
-				return err
-			}
-			consents = append(consents, &consent)
-		}
-		if rows.Err() != nil {
-			return rows.Err()
-		}
-		return nil
-	}, pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+		"client_id": clientID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.scanConsents(rows)
+}
+
+// GetExpiringConsents locks up to limit approved consents of any client that
+// expire before before and either have expired at now or have not been
+// notified about yet. Call it inside a unit of work.
+func (c *Client) GetExpiringConsents(ctx context.Context, now, before time.Time, limit int) ([]*domain.AccountConsent, error) {
+	rows, err := c.conn(ctx).Query(ctx, `SELECT `+consentColumns+`
+		FROM account_consents
+		WHERE status = @status
+		AND expires_at < @before
+		AND (expires_at <= @now OR expiry_notified_at IS NULL)
+		ORDER BY expires_at
+		LIMIT @limit
+		FOR UPDATE`, pgx.NamedArgs{
+		"status": domain.ConsentStatusApproved,
+		"now":    now,
+		"before": before,
+		"limit":  limit,
+	})
 	if err != nil {
 		return nil, err
 	}
+	return c.scanConsents(rows)
+}
+
+func (c *Client) scanConsents(rows pgx.Rows) ([]*domain.AccountConsent, error) {
+	defer rows.Close()
+
+	consents := make([]*domain.AccountConsent, 0)
+	for rows.Next() {
+		var (
+			consent                                            domain.AccountConsent
+			index                                              string
+			expiresAt, createdAt, lastUsedAt, expiryNotifiedAt *time.Time
+		)
+		if err := rows.Scan(
+			&consent.ClientID,
+			&consent.Permissions,
+			&consent.Reason,
+			&consent.RequestingBank,
+			&consent.RequestingBankName,
+			&consent.Status,
+			&consent.ConsentID,
+			&index,
+			&consent.AutoApproved,
+			&consent.ConsentProvider,
+			&expiresAt,
+			&createdAt,
+			&lastUsedAt,
+			&expiryNotifiedAt,
+			&consent.ReplacesConsentID,
+		); err != nil {
+			return nil, err
+		}
+		consent.ExpiresAt = timeOrZero(expiresAt)
+		consent.CreatedAt = timeOrZero(createdAt)
+		consent.LastUsedAt = timeOrZero(lastUsedAt)
+		consent.ExpiryNotifiedAt = timeOrZero(expiryNotifiedAt)
+		f := c.fields()
+		f.open(&consent.ConsentID, rowField(fieldConsentID, consent.ClientID, index))
+		f.open(&consent.Reason, rowField(fieldConsentReason, consent.ClientID, consent.ConsentID))
+		f.open(&consent.ReplacesConsentID, rowField(fieldConsentReplaces, consent.ClientID, consent.ConsentID))
+		if f.err != nil {
+			return nil, f.err
+		}
+		consents = append(consents, &consent)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
 	return consents, nil
 }
 
+// SaveAccount seals the account id and tells accounts apart by its blind
+// index.
 func (c *Client) SaveAccount(ctx context.Context, account *domain.Account) error {
-	err := c.InTxWithOpts(ctx, func(tx pgx.Tx) error {
-		_, err := c.pool.Exec(ctx, `INSERT INTO accounts (
-		account_id, 
+	f := c.fields()
+	accountID, index := f.sealAccount(account.ClientID, account.Bank, account.AccountID)
+	identification := f.seal(account.Identification, rowField(fieldAccountIdentification, account.ClientID, account.Bank, account.AccountID))
+	if f.err != nil {
+		return f.err
+	}
+	_, err := c.conn(ctx).Exec(ctx, `INSERT INTO accounts (
+		account_id,
+		account_id_bidx,
 		currency,
-		account_type, 
-		nickname, 
-		servicer 
-		) VALUES (@account_id, @currency, @account_type, @nickname, @servicer) ON CONFLICT (account_id) DO UPDATE SET 
+		account_type,
+		nickname,
+		servicer,
+		client_id,
+		bank,
+		identification
+		) VALUES (@account_id, NULLIF(@account_id_bidx, ''), @currency, @account_type, @nickname, @servicer, @client_id, @bank, @identification)
+		ON CONFLICT (client_id, bank, (COALESCE(account_id_bidx, account_id))) DO UPDATE SET
 		 currency = EXCLUDED.currency,
 		 account_type = EXCLUDED.account_type,
 		 nickname = EXCLUDED.nickname,
-		 servicer = EXCLUDED.servicer`, pgx.NamedArgs{
-			"account_id":   account.AccountID,
-			"currency":     account.Currency,
-			"account_type": account.AccountType,
-			"nickname":     account.Nickname,
-			"servicer":     account.Servicer,
-		})
-		return err
-	}, pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+		 servicer = EXCLUDED.servicer,
+		 identification = EXCLUDED.identification`, pgx.NamedArgs{
+		"account_id":      accountID,
+		"account_id_bidx": index,
+		"currency":        account.Currency,
+		"account_type":    account.AccountType,
+		"nickname":        account.Nickname,
+		"servicer":        account.Servicer,
+		"client_id":       account.ClientID,
+		"bank":            account.Bank,
+		"identification":  identification,
+	})
+	return err
+}
+
+// ListAccounts orders the accounts by their id once opened, as sealed ids
+// have no order.
+func (c *Client) ListAccounts(ctx context.Context, clientID string) ([]*domain.Account, error) {
+	rows, err := c.conn(ctx).Query(ctx, `SELECT
+		account_id,
+		COALESCE(account_id_bidx, ''),
+		COALESCE(currency, ''),
+		COALESCE(account_type, ''),
+		COALESCE(nickname, ''),
+		COALESCE(servicer, ''),
+		COALESCE(client_id, ''),
+		COALESCE(bank, ''),
+		COALESCE(identification, '')
+		FROM accounts WHERE client_id = @client_id`, pgx.NamedArgs{
+		"client_id": clientID,
+	})
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := make([]*domain.Account, 0)
+	for rows.Next() {
+		var (
+			account domain.Account
+			index   string
+		)
+		if err = rows.Scan(
+			&account.AccountID,
+			&index,
+			&account.Currency,
+			&account.AccountType,
+			&account.Nickname,
+			&account.Servicer,
+			&account.ClientID,
+			&account.Bank,
+			&account.Identification,
+		); err != nil {
+			return nil, err
+		}
+		f := c.fields()
+		f.openAccount(&account.AccountID, account.ClientID, account.Bank, index)
+		f.open(&account.Identification, rowField(fieldAccountIdentification, account.ClientID, account.Bank, account.AccountID))
+		if f.err != nil {
+			return nil, f.err
+		}
+		accounts = append(accounts, &account)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	slices.SortFunc(accounts, func(a, b *domain.Account) int {
+		return cmp.Or(cmp.Compare(a.AccountID, b.AccountID), cmp.Compare(a.Bank, b.Bank))
+	})
+	return accounts, nil
+}
+
+func (c *Client) SaveBalance(ctx context.Context, balance *domain.Balance) error {
+	f := c.fields()
+	accountID, index := f.sealAccount(balance.ClientID, balance.Bank, balance.AccountID)
+	if f.err != nil {
+		return f.err
+	}
+	_, err := c.conn(ctx).Exec(ctx, `INSERT INTO account_balances (
+		client_id,
+		bank,
+		account_id,
+		account_id_bidx,
+		balance_type,
+		amount,
+		currency,
+		as_of
+		) VALUES (@client_id, @bank, @account_id, NULLIF(@account_id_bidx, ''), @balance_type, @amount::numeric, @currency, @as_of)
+		ON CONFLICT (client_id, bank, (COALESCE(account_id_bidx, account_id)), balance_type) DO UPDATE SET
+		 amount = EXCLUDED.amount,
+		 currency = EXCLUDED.currency,
+		 as_of = EXCLUDED.as_of`, pgx.NamedArgs{
+		"client_id":       balance.ClientID,
+		"bank":            balance.Bank,
+		"account_id":      accountID,
+		"account_id_bidx": index,
+		"balance_type":    balance.Type,
+		"amount":          balance.Amount,
+		"currency":        balance.Currency,
+		"as_of":           balance.AsOf,
+	})
+	return err
+}
+
+// GetBalance returns the balance of the account of the most preferred type.
+func (c *Client) GetBalance(ctx context.Context, clientID, bank, accountID string) (*domain.Balance, error) {
+	f := c.fields()
+	index := f.index(accountID, fieldAccountID)
+	if f.err != nil {
+		return nil, f.err
+	}
+	var balance domain.Balance
+	err := c.conn(ctx).QueryRow(ctx, `SELECT
+		client_id,
+		bank,
+		balance_type,
+		amount::text,
+		currency,
+		as_of
+		FROM account_balances
+		WHERE client_id = @client_id AND bank = @bank AND `+accountMatch("account_id", "account_id")+`
+		ORDER BY array_position(@balance_types::text[], balance_type::text) NULLS LAST
+		LIMIT 1`, pgx.NamedArgs{
+		"client_id":       clientID,
+		"bank":            bank,
+		"account_id":      accountID,
+		"account_id_bidx": index,
+		"balance_types":   domain.BalanceTypes,
+	}).Scan(
+		&balance.ClientID,
+		&balance.Bank,
+		&balance.Type,
+		&balance.Amount,
+		&balance.Currency,
+		&balance.AsOf,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("balance of account %s: %w", accountID, domain.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	balance.AccountID = accountID
+	return &balance, nil
 }
@@ -0,0 +1,157 @@
+package postgres
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+// RefreshSnapshots derives the end of day balance of every account of the
+// client by rolling its preferred current balance back through the booked
+// transactions, along with the income and spending of each day. Rows of an
+// account are joined by the blind index of its id, and the snapshots take the
+// sealed id of the account, which is bound to that index.
+func (c *Client) RefreshSnapshots(ctx context.Context, clientID string, from, to time.Time) error {
+	args := pgx.NamedArgs{
+		"client_id":     clientID,
+		"from":          from,
+		"to":            to,
+		"balance_types": domain.BalanceTypes,
+		"booked":        domain.TransactionStatusBooked,
+	}
+	return c.InTx(ctx, func(ctx context.Context) error {
+		_, err := c.conn(ctx).Exec(ctx, `DELETE FROM account_daily_snapshots
+			WHERE client_id = @client_id AND snapshot_date BETWEEN @from::date AND @to::date`, args)
+		if err != nil {
+			return err
+		}
+		_, err = c.conn(ctx).Exec(ctx, `WITH days AS (
+				SELECT generate_series(@from::date, @to::date, INTERVAL '1 day')::date AS day
+			), current_balances AS (
+				SELECT DISTINCT ON (a.bank, COALESCE(a.account_id_bidx, a.account_id))
+					a.account_id,
+					a.account_id_bidx,
+					COALESCE(a.account_id_bidx, a.account_id) AS account_key,
+					a.bank,
+					b.currency,
+					b.amount
+				FROM accounts a
+				JOIN account_balances b ON b.client_id = a.client_id
+					AND b.bank = a.bank
+					AND COALESCE(b.account_id_bidx, b.account_id) = COALESCE(a.account_id_bidx, a.account_id)
+				WHERE a.client_id = @client_id
+				ORDER BY a.bank, COALESCE(a.account_id_bidx, a.account_id),
+					array_position(@balance_types::text[], b.balance_type::text) NULLS LAST
+			), flows AS (
+				SELECT
+					bank,
+					COALESCE(account_id_bidx, account_id) AS account_key,
+					(booked_at AT TIME ZONE 'UTC')::date AS day,
+					COALESCE(SUM(amount) FILTER (WHERE amount > 0 AND transfer_id IS NULL), 0) AS income,
+					COALESCE(-SUM(amount) FILTER (WHERE amount < 0 AND transfer_id IS NULL), 0) AS spending,
+					SUM(amount) AS net
+				FROM transactions
+				WHERE client_id = @client_id AND status = @booked
+				GROUP BY 1, 2, 3
+			)
+			INSERT INTO account_daily_snapshots (
+				client_id,
+				account_id,
+				account_id_bidx,
+				bank,
+				snapshot_date,
+				currency,
+				balance,
+				income,
+				spending)
+			SELECT
+				@client_id,
+				cb.account_id,
+				cb.account_id_bidx,
+				cb.bank,
+				d.day,
+				cb.currency,
+				cb.amount - COALESCE((
+					SELECT SUM(later.net) FROM flows later
+					WHERE later.bank = cb.bank AND later.account_key = cb.account_key AND later.day > d.day
+				), 0),
+				COALESCE(f.income, 0),
+				COALESCE(f.spending, 0)
+			FROM current_balances cb
+			CROSS JOIN days d
+			LEFT JOIN flows f ON f.bank = cb.bank AND f.account_key = cb.account_key AND f.day = d.day`, args)
+		return err
+	})
+}
+
+// GetSnapshots orders the snapshots of a day by account id once opened, as
+// sealed ids have no order.
+func (c *Client) GetSnapshots(ctx context.Context, clientID string, from, to time.Time) ([]*domain.AccountSnapshot, error) {
+	rows, err := c.conn(ctx).Query(ctx, `SELECT
+		client_id,
+		account_id,
+		COALESCE(account_id_bidx, ''),
+		bank,
+		snapshot_date,
+		currency,
+		balance::text,
+		income::text,
+		spending::text
+		FROM account_daily_snapshots
+		WHERE client_id = @client_id AND snapshot_date BETWEEN @from::date AND @to::date
+		ORDER BY snapshot_date`, pgx.NamedArgs{
+		"client_id": clientID,
+		"from":      from,
+		"to":        to,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := make([]*domain.AccountSnapshot, 0)
+	for rows.Next() {
+		var (
+			snap  domain.AccountSnapshot
+			index string
+		)
+		if err = rows.Scan(
+			&snap.ClientID,
+			&snap.AccountID,
+			&index,
+			&snap.Bank,
+			&snap.Date,
+			&snap.Currency,
+			&snap.Balance,
+			&snap.Income,
+			&snap.Spending,
+		); err != nil {
+			return nil, err
+		}
+		f := c.fields()
+		f.openAccount(&snap.AccountID, snap.ClientID, snap.Bank, index)
+		if f.err != nil {
+			return nil, f.err
+		}
+		snapshots = append(snapshots, &snap)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	slices.SortFunc(snapshots, func(a, b *domain.AccountSnapshot) int {
+		return cmp.Or(a.Date.Compare(b.Date), cmp.Compare(a.AccountID, b.AccountID), cmp.Compare(a.Bank, b.Bank))
+	})
+	return snapshots, nil
+}
+
+func (c *Client) ClientIDs(ctx context.Context) ([]string, error) {
+	rows, err := c.conn(ctx).Query(ctx, `SELECT DISTINCT client_id FROM account_consents ORDER BY client_id`)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
@@ -0,0 +1,177 @@
+package postgres
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+const auditEntryColumns = `sequence,
+		client_id,
+		action,
+		COALESCE(consent_id, ''),
+		COALESCE(bank, ''),
+		COALESCE(endpoint, ''),
+		outcome,
+		COALESCE(status_code, 0),
+		COALESCE(error, ''),
+		COALESCE(request_id, ''),
+		occurred_at,
+		prev_hash,
+		hash`
+
+// LastAuditEntry takes a transaction-level advisory lock serializing the
+// writers of the log, as an empty log has no row to lock.
+func (c *Client) LastAuditEntry(ctx context.Context) (*domain.AuditEntry, error) {
+	if _, err := c.conn(ctx).Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('lima.audit_log'))`); err != nil {
+		return nil, err
+	}
+	rows, err := c.conn(ctx).Query(ctx, `SELECT `+auditEntryColumns+`
+		FROM audit_log
+		ORDER BY sequence DESC
+		LIMIT 1`)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := c.scanAuditEntries(rows)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+	return entries[0], nil
+}
+
+func (c *Client) AppendAuditEntries(ctx context.Context, entries []*domain.AuditEntry) error {
+	for _, entry := range entries {
+		f := c.fields()
+		args := pgx.NamedArgs{
+			"sequence":        entry.Sequence,
+			"client_id":       entry.ClientID,
+			"action":          entry.Action,
+			"consent_id":      f.seal(entry.ConsentID, auditConsentField(entry)),
+			"consent_id_bidx": f.index(entry.ConsentID, fieldAuditConsentID),
+			"bank":            entry.Bank,
+			"endpoint":        entry.Endpoint,
+			"outcome":         entry.Outcome,
+			"status_code":     entry.StatusCode,
+			"error":           entry.Error,
+			"request_id":      entry.RequestID,
+			"occurred_at":     entry.OccurredAt,
+			"prev_hash":       entry.PrevHash,
+			"hash":            entry.Hash,
+		}
+		if f.err != nil {
+			return f.err
+		}
+		if _, err := c.conn(ctx).Exec(ctx, `INSERT INTO audit_log (
+			sequence,
+			client_id,
+			action,
+			consent_id,
+			consent_id_bidx,
+			bank,
+			endpoint,
+			outcome,
+			status_code,
+			error,
+			request_id,
+			occurred_at,
+			prev_hash,
+			hash
+			) VALUES (
+			@sequence,
+			@client_id,
+			@action,
+			NULLIF(@consent_id, ''),
+			NULLIF(@consent_id_bidx, ''),
+			NULLIF(@bank, ''),
+			NULLIF(@endpoint, ''),
+			@outcome,
+			NULLIF(@status_code, 0),
+			NULLIF(@error, ''),
+			NULLIF(@request_id, ''),
+			@occurred_at,
+			@prev_hash,
+			@hash)`, args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAuditEntries looks sealed consent ids up by their blind index, or by
+// the id itself when encryption is disabled.
+func (c *Client) GetAuditEntries(ctx context.Context, filter domain.AuditFilter) ([]*domain.AuditEntry, error) {
+	consentIndex, err := c.cipher.BlindIndex(filter.ConsentID, fieldAuditConsentID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := c.conn(ctx).Query(ctx, `SELECT `+auditEntryColumns+`
+		FROM audit_log
+		WHERE sequence > @after
+		AND (@client_id = '' OR client_id = @client_id)
+		AND (@action = '' OR action = @action)
+		AND (@consent_id = '' OR consent_id_bidx = NULLIF(@consent_id_bidx, '')
+		 OR (consent_id_bidx IS NULL AND consent_id = @consent_id))
+		AND (@bank = '' OR bank = @bank)
+		AND (@request_id = '' OR request_id = @request_id)
+		AND (@from::timestamptz IS NULL OR occurred_at >= @from)
+		AND (@to::timestamptz IS NULL OR occurred_at < @to)
+		ORDER BY sequence
+		LIMIT @limit`, pgx.NamedArgs{
+		"after":           filter.AfterSequence,
+		"client_id":       filter.ClientID,
+		"action":          filter.Action,
+		"consent_id":      filter.ConsentID,
+		"consent_id_bidx": consentIndex,
+		"bank":            filter.Bank,
+		"request_id":      filter.RequestID,
+		"from":            nullTime(filter.From),
+		"to":              nullTime(filter.To),
+		"limit":           filter.Limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.scanAuditEntries(rows)
+}
+
+func (c *Client) scanAuditEntries(rows pgx.Rows) ([]*domain.AuditEntry, error) {
+	defer rows.Close()
+	entries := make([]*domain.AuditEntry, 0)
+	for rows.Next() {
+		var entry domain.AuditEntry
+		err := rows.Scan(
+			&entry.Sequence,
+			&entry.ClientID,
+			&entry.Action,
+			&entry.ConsentID,
+			&entry.Bank,
+			&entry.Endpoint,
+			&entry.Outcome,
+			&entry.StatusCode,
+			&entry.Error,
+			&entry.RequestID,
+			&entry.OccurredAt,
+			&entry.PrevHash,
+			&entry.Hash,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if entry.ConsentID, err = c.cipher.Decrypt(entry.ConsentID, auditConsentField(&entry)); err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return entries, nil
+}
+
+// auditConsentField binds the sealed consent id of an entry to its sequence.
+func auditConsentField(entry *domain.AuditEntry) string {
+	return rowField(fieldAuditConsentID, strconv.FormatInt(entry.Sequence, 10))
+}
@@ -0,0 +1,239 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+func (c *Client) SaveBudget(ctx context.Context, budget *domain.Budget) error {
+	_, err := c.conn(ctx).Exec(ctx, `INSERT INTO budgets (
+		budget_id,
+		client_id,
+		name,
+		category,
+		merchant,
+		limit_amount,
+		currency,
+		rollover,
+		created_at,
+		updated_at
+		) VALUES (
+		@budget_id,
+		@client_id,
+		@name,
+		NULLIF(@category, ''),
+		NULLIF(@merchant, ''),
+		@limit_amount::numeric,
+		@currency,
+		@rollover,
+		@created_at,
+		@updated_at)`, budgetArgs(budget))
+	return err
+}
+
+func (c *Client) UpdateBudget(ctx context.Context, budget *domain.Budget) error {
+	tag, err := c.conn(ctx).Exec(ctx, `UPDATE budgets
+		SET name = @name,
+		category = NULLIF(@category, ''),
+		merchant = NULLIF(@merchant, ''),
+		limit_amount = @limit_amount::numeric,
+		currency = @currency,
+		rollover = @rollover,
+		updated_at = @updated_at
+		WHERE budget_id::text = @budget_id AND client_id = @client_id`, budgetArgs(budget))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("budget %s: %w", budget.BudgetID, domain.ErrNotFound)
+	}
+	return nil
+}
+
+func budgetArgs(budget *domain.Budget) pgx.NamedArgs {
+	return pgx.NamedArgs{
+		"budget_id":    budget.BudgetID,
+		"client_id":    budget.ClientID,
+		"name":         budget.Name,
+		"category":     budget.Category,
+		"merchant":     budget.Merchant,
+		"limit_amount": budget.Limit,
+		"currency":     budget.Currency,
+		"rollover":     budget.Rollover,
+		"created_at":   budget.CreatedAt,
+		"updated_at":   budget.UpdatedAt,
+	}
+}
+
+func (c *Client) DeleteBudget(ctx context.Context, clientID, budgetID string) error {
+	tag, err := c.conn(ctx).Exec(ctx, `DELETE FROM budgets
+		WHERE budget_id::text = @budget_id AND client_id = @client_id`, pgx.NamedArgs{
+		"budget_id": budgetID,
+		"client_id": clientID,
+	})
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("budget %s: %w", budgetID, domain.ErrNotFound)
+	}
+	return nil
+}
+
+const budgetColumns = `budget_id::text,
+		client_id,
+		name,
+		COALESCE(category, ''),
+		COALESCE(merchant, ''),
+		limit_amount::text,
+		currency,
+		rollover,
+		created_at,
+		updated_at`
+
+func (c *Client) GetBudget(ctx context.Context, clientID, budgetID string) (*domain.Budget, error) {
+	rows, err := c.conn(ctx).Query(ctx, `SELECT `+budgetColumns+`
+		FROM budgets
+		WHERE budget_id::text = @budget_id AND client_id = @client_id`, pgx.NamedArgs{
+		"budget_id": budgetID,
+		"client_id": clientID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	budgets, err := scanBudgets(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(budgets) == 0 {
+		return nil, fmt.Errorf("budget %s: %w", budgetID, domain.ErrNotFound)
+	}
+	return budgets[0], nil
+}
+
+func (c *Client) GetBudgets(ctx context.Context, clientID string) ([]*domain.Budget, error) {
+	rows, err := c.conn(ctx).Query(ctx, `SELECT `+budgetColumns+`
+		FROM budgets
+		WHERE client_id = @client_id
+		ORDER BY created_at`, pgx.NamedArgs{
+		"client_id": clientID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return scanBudgets(rows)
+}
+
+func scanBudgets(rows pgx.Rows) ([]*domain.Budget, error) {
+	defer rows.Close()
+	budgets := make([]*domain.Budget, 0)
+	for rows.Next() {
+		var budget domain.Budget
+		if err := rows.Scan(
+			&budget.BudgetID,
+			&budget.ClientID,
+			&budget.Name,
+			&budget.Category,
+			&budget.Merchant,
+			&budget.Limit,
+			&budget.Currency,
+			&budget.Rollover,
+			&budget.CreatedAt,
+			&budget.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		budgets = append(budgets, &budget)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return budgets, nil
+}
+
+func (c *Client) SaveBudgetAlert(ctx context.Context, alert *domain.BudgetAlert) (bool, error) {
+	tag, err := c.conn(ctx).Exec(ctx, `INSERT INTO budget_alerts (
+		alert_id,
+		budget_id,
+		client_id,
+		period,
+		threshold,
+		spent,
+		available,
+		currency,
+		created_at
+		) VALUES (
+		@alert_id,
+		@budget_id::uuid,
+		@client_id,
+		@period,
+		@threshold,
+		@spent::numeric,
+		@available::numeric,
+		@currency,
+		@created_at)
+		ON CONFLICT (budget_id, period, threshold) DO NOTHING`, pgx.NamedArgs{
+		"alert_id":   alert.AlertID,
+		"budget_id":  alert.BudgetID,
+		"client_id":  alert.ClientID,
+		"period":     alert.Period,
+		"threshold":  alert.Threshold,
+		"spent":      alert.Spent,
+		"available":  alert.Available,
+		"currency":   alert.Currency,
+		"created_at": alert.CreatedAt,
+	})
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (c *Client) GetBudgetAlerts(ctx context.Context, clientID, budgetID string) ([]*domain.BudgetAlert, error) {
+	rows, err := c.conn(ctx).Query(ctx, `SELECT
+		alert_id::text,
+		budget_id::text,
+		client_id,
+		period,
+		threshold,
+		spent::text,
+		available::text,
+		currency,
+		created_at
+		FROM budget_alerts
+		WHERE client_id = @client_id AND budget_id::text = @budget_id
+		ORDER BY created_at DESC`, pgx.NamedArgs{
+		"client_id": clientID,
+		"budget_id": budgetID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := make([]*domain.BudgetAlert, 0)
+	for rows.Next() {
+		var alert domain.BudgetAlert
+		if err = rows.Scan(
+			&alert.AlertID,
+			&alert.BudgetID,
+			&alert.ClientID,
+			&alert.Period,
+			&alert.Threshold,
+			&alert.Spent,
+			&alert.Available,
+			&alert.Currency,
+			&alert.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, &alert)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return alerts, nil
+}
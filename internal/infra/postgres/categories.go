@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+func (c *Client) GetCategoryRules(ctx context.Context, clientID string) ([]*domain.CategoryRule, error) {
+	rows, err := c.conn(ctx).Query(ctx, `SELECT
+		rule_id::text,
+		COALESCE(client_id, ''),
+		match_field,
+		pattern,
+		category,
+		created_at
+		FROM category_rules
+		WHERE client_id = @client_id OR client_id IS NULL
+		ORDER BY created_at`, pgx.NamedArgs{
+		"client_id": clientID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := make([]*domain.CategoryRule, 0)
+	for rows.Next() {
+		var rule domain.CategoryRule
+		if err = rows.Scan(
+			&rule.RuleID,
+			&rule.ClientID,
+			&rule.MatchField,
+			&rule.Pattern,
+			&rule.Category,
+			&rule.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if rule.ClientID != "" {
+			if rule.Pattern, err = c.cipher.Decrypt(rule.Pattern, rowField(fieldCategoryRulePattern, rule.ClientID, rule.RuleID)); err != nil {
+				return nil, err
+			}
+		}
+		rules = append(rules, &rule)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return rules, nil
+}
+
+// SaveCategoryRule seals the patterns of rules of a client, which are learned
+// from its transactions, and tells them apart by their blind index. A rule
+// saved again keeps its id and its sealed pattern.
+func (c *Client) SaveCategoryRule(ctx context.Context, rule *domain.CategoryRule) error {
+	pattern, index := rule.Pattern, ""
+	if rule.ClientID != "" {
+		f := c.fields()
+		pattern = f.seal(rule.Pattern, rowField(fieldCategoryRulePattern, rule.ClientID, rule.RuleID))
+		index = f.index(strings.ToLower(rule.Pattern), fieldCategoryRulePattern)
+		if f.err != nil {
+			return f.err
+		}
+	}
+	return c.conn(ctx).QueryRow(ctx, `INSERT INTO category_rules (
+		rule_id,
+		client_id,
+		match_field,
+		pattern,
+		pattern_bidx,
+		category,
+		created_at
+		) VALUES (@rule_id, NULLIF(@client_id, ''), @match_field, @pattern, NULLIF(@pattern_bidx, ''), @category, @created_at)
+		ON CONFLICT (COALESCE(client_id, ''), match_field, COALESCE(pattern_bidx, lower(pattern))) DO UPDATE SET
+		 category = EXCLUDED.category,
+		 created_at = EXCLUDED.created_at
+		RETURNING rule_id::text`, pgx.NamedArgs{
+		"rule_id":      rule.RuleID,
+		"client_id":    rule.ClientID,
+		"match_field":  rule.MatchField,
+		"pattern":      pattern,
+		"pattern_bidx": index,
+		"category":     rule.Category,
+		"created_at":   rule.CreatedAt,
+	}).Scan(&rule.RuleID)
+}
+
+func (c *Client) DeleteCategoryRule(ctx context.Context, clientID, ruleID string) error {
+	tag, err := c.conn(ctx).Exec(ctx, `DELETE FROM category_rules
+		WHERE rule_id::text = @rule_id AND client_id = @client_id`, pgx.NamedArgs{
+		"rule_id":   ruleID,
+		"client_id": clientID,
+	})
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("category rule %s: %w", ruleID, domain.ErrNotFound)
+	}
+	return nil
+}
@@ -5,7 +5,7 @@ import (
 	"errors"
 
 	"github.com/MichaelSBoop/lima-backend/migrations"
-	"github.com/jackc/pgx/v5"
+	"github.com/MichaelSBoop/lima-backend/pkg/fieldcrypt"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
@@ -16,10 +16,14 @@ var ErrFailedToRollback = errors.New("failed to execute rollback on transaction"
 type Client struct {
 	log  *zap.Logger
 	pool *pgxpool.Pool
-	cfg  *Config
+	// beginner starts top-level transactions, it is the pool outside of tests.
+	beginner txBeginner
+	cfg      *Config
+	// cipher seals the sensitive columns, see encryption.go.
+	cipher *fieldcrypt.Cipher
 }
 
-func New(logger *zap.Logger, lc fx.Lifecycle, cfg Config) (*Client, error) {
+func New(logger *zap.Logger, lc fx.Lifecycle, cfg Config, cipher *fieldcrypt.Cipher) (*Client, error) {
 	pgxcfg, err := pgxpool.ParseConfig(cfg.String())
 	if err != nil {
 		return nil, err
@@ -29,9 +33,11 @@ func New(logger *zap.Logger, lc fx.Lifecycle, cfg Config) (*Client, error) {
 		return nil, err
 	}
 	cl := &Client{
-		pool: pool,
-		cfg:  &cfg,
-		log:  logger,
+		pool:     pool,
+		beginner: pool,
+		cfg:      &cfg,
+		log:      logger,
+		cipher:   cipher,
 	}
 	lc.Append(
 		fx.Hook{
@@ -51,17 +57,3 @@ func New(logger *zap.Logger, lc fx.Lifecycle, cfg Config) (*Client, error) {
 	)
 	return cl, nil
 }
-
-func (c *Client) InTxWithOpts(ctx context.Context, f func(tx pgx.Tx) error, txOpts pgx.TxOptions) error {
-	tx, err := c.pool.BeginTx(ctx, txOpts)
-	if err != nil {
-		return err
-	}
-	if err = f(tx); err != nil {
-		if rbErr := tx.Rollback(ctx); rbErr != nil {
-			c.log.Error(ErrFailedToRollback.Error(), zap.Error(rbErr))
-			return errors.Join(err, rbErr)
-		}
-	}
-	return tx.Commit(ctx)
-}
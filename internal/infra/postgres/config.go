@@ -19,6 +19,7 @@ type Config struct {
 	PoolMaxConnIdleTime       time.Duration `json:"pool_max_conn_idle_time" yaml:"pool_max_conn_idle_time"`
 	PoolHealthCheckPeriod     time.Duration `json:"pool_health_check_period" yaml:"pool_health_check_period"`
 	PoolMaxConnLifetimeJitter time.Duration `json:"pool_max_conn_lifetime_jitter" yaml:"pool_max_conn_lifetime_jitter"`
+	TxMaxRetries              int           `json:"tx_max_retries" yaml:"tx_max_retries"`
 }
 
 func (c Config) String() string {
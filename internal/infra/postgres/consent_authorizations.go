@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+// SaveConsentAuthorization stores a started authorisation, dropping the ones
+// expired at now.
+func (c *Client) SaveConsentAuthorization(ctx context.Context, authorization *domain.ConsentAuthorization, now time.Time) error {
+	f := c.fields()
+	args := pgx.NamedArgs{
+		"state_hash":    authorization.StateHash,
+		"client_id":     authorization.ClientID,
+		"consent_id":    f.seal(authorization.ConsentID, rowField(fieldAuthConsentID, authorization.StateHash)),
+		"bank":          authorization.Bank,
+		"code_verifier": f.seal(authorization.CodeVerifier, rowField(fieldAuthCodeVerifier, authorization.StateHash)),
+		"return_to":     authorization.ReturnTo,
+		"created_at":    authorization.CreatedAt,
+		"expires_at":    authorization.ExpiresAt,
+	}
+	if f.err != nil {
+		return f.err
+	}
+	if _, err := c.conn(ctx).Exec(ctx, `DELETE FROM consent_authorizations WHERE expires_at <= @now`, pgx.NamedArgs{
+		"now": now,
+	}); err != nil {
+		return err
+	}
+	_, err := c.conn(ctx).Exec(ctx, `INSERT INTO consent_authorizations (
+		state_hash,
+		client_id,
+		consent_id,
+		bank,
+		code_verifier,
+		return_to,
+		created_at,
+		expires_at
+		) VALUES (@state_hash, @client_id, @consent_id, @bank, @code_verifier, @return_to, @created_at, @expires_at)`, args)
+	return err
+}
+
+// TakeConsentAuthorization deletes and returns the authorisation with the
+// state hash, so that a state is honoured once.
+func (c *Client) TakeConsentAuthorization(ctx context.Context, stateHash string, now time.Time) (*domain.ConsentAuthorization, error) {
+	var authorization domain.ConsentAuthorization
+	err := c.conn(ctx).QueryRow(ctx, `DELETE FROM consent_authorizations
+		WHERE state_hash = @state_hash
+		RETURNING state_hash, client_id, consent_id, bank, code_verifier, return_to, created_at, expires_at`, pgx.NamedArgs{
+		"state_hash": stateHash,
+	}).Scan(
+		&authorization.StateHash,
+		&authorization.ClientID,
+		&authorization.ConsentID,
+		&authorization.Bank,
+		&authorization.CodeVerifier,
+		&authorization.ReturnTo,
+		&authorization.CreatedAt,
+		&authorization.ExpiresAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) || err == nil && !now.Before(authorization.ExpiresAt) {
+		return nil, fmt.Errorf("consent authorization: %w", domain.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	f := c.fields()
+	f.open(&authorization.ConsentID, rowField(fieldAuthConsentID, authorization.StateHash))
+	f.open(&authorization.CodeVerifier, rowField(fieldAuthCodeVerifier, authorization.StateHash))
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &authorization, nil
+}
@@ -0,0 +1,515 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/MichaelSBoop/lima-backend/pkg/fieldcrypt"
+	"github.com/jackc/pgx/v5"
+)
+
+// Sealed columns. The names bind the sealed values to their column, and
+// rowField binds them to the key of their row. Account ids are sealed alike
+// in every table keyed by the account, bound to the client, the bank and the
+// blind index of the id, so that rows of the account can be joined and copied
+// by that index. The audit log is append-only and is not sealed again on
+// rotation, retired keys must be kept for as long as its entries are.
+// Consent authorisations live for minutes and are not sealed again either.
+// Category rule patterns are sealed for rules of a client only, as those are
+// learned from its transactions.
+const (
+	fieldConsentID             = "account_consents.consent_id"
+	fieldConsentReason         = "account_consents.reason"
+	fieldConsentReplaces       = "account_consents.replaces_consent_id"
+	fieldAccountID             = "accounts.account_id"
+	fieldAccountIdentification = "accounts.identification"
+	fieldTxDescription         = "transactions.description"
+	fieldTxCounterparty        = "transactions.counterparty"
+	fieldTxCounterpartyName    = "transactions.counterparty_name"
+	fieldCategoryRulePattern   = "category_rules.pattern"
+	fieldAuditConsentID        = "audit_log.consent_id"
+	fieldAuthConsentID         = "consent_authorizations.consent_id"
+	fieldAuthCodeVerifier      = "consent_authorizations.code_verifier"
+	fieldOutboxAggregateID     = "outbox_events.aggregate_id"
+	fieldOutboxPayload         = "outbox_events.payload"
+)
+
+// rowField binds a sealed column to the key of its row, so that a value
+// copied into another row does not open there.
+func rowField(field string, key ...string) string {
+	return field + "\x00" + strings.Join(key, "\x00")
+}
+
+// accountMatch matches the account id in column by its blind index in the
+// column_bidx argument, or by the id itself while the row has not been
+// sealed yet.
+func accountMatch(column, arg string) string {
+	return fmt.Sprintf(`(%[1]s_bidx = NULLIF(@%[2]s_bidx, '') OR (%[1]s_bidx IS NULL AND %[1]s = @%[2]s))`, column, arg)
+}
+
+// fields seals and opens column values, keeping the first error so that a
+// row can be handled without checking every column.
+type fields struct {
+	cipher *fieldcrypt.Cipher
+	err    error
+}
+
+func (c *Client) fields() *fields {
+	return &fields{cipher: c.cipher}
+}
+
+func (f *fields) seal(value, field string) string {
+	if f.err != nil {
+		return ""
+	}
+	var sealed string
+	sealed, f.err = f.cipher.Encrypt(value, field)
+	return sealed
+}
+
+func (f *fields) open(value *string, field string) {
+	if f.err != nil {
+		return
+	}
+	*value, f.err = f.cipher.Decrypt(*value, field)
+}
+
+func (f *fields) index(value, field string) string {
+	if f.err != nil {
+		return ""
+	}
+	var index string
+	index, f.err = f.cipher.BlindIndex(value, field)
+	return index
+}
+
+// sealAccount seals the id of an account of the client at the bank and
+// returns it along with its blind index.
+func (f *fields) sealAccount(clientID, bank, accountID string) (sealed, index string) {
+	index = f.index(accountID, fieldAccountID)
+	return f.seal(accountID, rowField(fieldAccountID, clientID, bank, index)), index
+}
+
+func (f *fields) openAccount(accountID *string, clientID, bank, index string) {
+	f.open(accountID, rowField(fieldAccountID, clientID, bank, index))
+}
+
+// ReencryptFields seals again up to limit rows of each table holding values
+// in plaintext or sealed with a retired key, and returns how many it
+// rewrote. Call it inside a unit of work, the rows are locked until it ends.
+func (c *Client) ReencryptFields(ctx context.Context, limit int) (int, error) {
+	if c.cipher == nil {
+		return 0, nil
+	}
+	current, err := c.cipher.CurrentPrefix()
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, reencrypt := range []func(context.Context, string, int) (int, error){
+		c.reencryptConsents,
+		c.reencryptAccounts,
+		c.reencryptAccountIDs("account_balances"),
+		c.reencryptTransactions,
+		c.reencryptAccountIDs("account_daily_snapshots"),
+		c.reencryptTransferPairs,
+		c.reencryptCategoryRules,
+		c.reencryptOutboxEvents,
+	} {
+		n, err := reencrypt(ctx, current+"%", limit)
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+func (c *Client) reencryptConsents(ctx context.Context, current string, limit int) (int, error) {
+	rows, err := c.conn(ctx).Query(ctx, `SELECT
+		client_id,
+		consent_id,
+		COALESCE(consent_id_bidx, ''),
+		COALESCE(reason, ''),
+		COALESCE(replaces_consent_id, '')
+		FROM account_consents
+		WHERE (COALESCE(consent_id, '') <> '' AND consent_id NOT LIKE @current)
+		OR (COALESCE(reason, '') <> '' AND reason NOT LIKE @current)
+		OR (COALESCE(replaces_consent_id, '') <> '' AND replaces_consent_id NOT LIKE @current)
+		LIMIT @limit
+		FOR UPDATE`, pgx.NamedArgs{
+		"current": current,
+		"limit":   limit,
+	})
+	if err != nil {
+		return 0, err
+	}
+	type consent struct{ clientID, stored, consentID, index, reason, replaces string }
+	consents, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (consent, error) {
+		var c consent
+		err := row.Scan(&c.clientID, &c.stored, &c.index, &c.reason, &c.replaces)
+		c.consentID = c.stored
+		return c, err
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, consent := range consents {
+		f := c.fields()
+		f.open(&consent.consentID, rowField(fieldConsentID, consent.clientID, consent.index))
+		f.open(&consent.reason, rowField(fieldConsentReason, consent.clientID, consent.consentID))
+		f.open(&consent.replaces, rowField(fieldConsentReplaces, consent.clientID, consent.consentID))
+		index := f.index(consent.consentID, fieldConsentID)
+		args := pgx.NamedArgs{
+			"stored":          consent.stored,
+			"consent_id":      f.seal(consent.consentID, rowField(fieldConsentID, consent.clientID, index)),
+			"consent_id_bidx": index,
+			"reason":          f.seal(consent.reason, rowField(fieldConsentReason, consent.clientID, consent.consentID)),
+			"replaces":        f.seal(consent.replaces, rowField(fieldConsentReplaces, consent.clientID, consent.consentID)),
+		}
+		if f.err != nil {
+			return 0, f.err
+		}
+		if _, err := c.conn(ctx).Exec(ctx, `UPDATE account_consents
+			SET consent_id = @consent_id,
+			consent_id_bidx = NULLIF(@consent_id_bidx, ''),
+			reason = @reason,
+			replaces_consent_id = NULLIF(@replaces, '')
+			WHERE consent_id = @stored`, args); err != nil {
+			return 0, err
+		}
+	}
+	return len(consents), nil
+}
+
+func (c *Client) reencryptAccounts(ctx context.Context, current string, limit int) (int, error) {
+	rows, err := c.conn(ctx).Query(ctx, `SELECT
+		client_id,
+		bank,
+		account_id,
+		COALESCE(account_id_bidx, ''),
+		COALESCE(identification, '')
+		FROM accounts
+		WHERE account_id NOT LIKE @current
+		OR (COALESCE(identification, '') <> '' AND identification NOT LIKE @current)
+		LIMIT @limit
+		FOR UPDATE`, pgx.NamedArgs{
+		"current": current,
+		"limit":   limit,
+	})
+	if err != nil {
+		return 0, err
+	}
+	type account struct{ clientID, bank, stored, accountID, index, identification string }
+	accounts, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (account, error) {
+		var a account
+		err := row.Scan(&a.clientID, &a.bank, &a.stored, &a.index, &a.identification)
+		a.accountID = a.stored
+		return a, err
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, account := range accounts {
+		f := c.fields()
+		f.openAccount(&account.accountID, account.clientID, account.bank, account.index)
+		identificationField := rowField(fieldAccountIdentification, account.clientID, account.bank, account.accountID)
+		f.open(&account.identification, identificationField)
+		accountID, index := f.sealAccount(account.clientID, account.bank, account.accountID)
+		args := pgx.NamedArgs{
+			"client_id":       account.clientID,
+			"bank":            account.bank,
+			"stored":          account.stored,
+			"account_id":      accountID,
+			"account_id_bidx": index,
+			"identification":  f.seal(account.identification, identificationField),
+		}
+		if f.err != nil {
+			return 0, f.err
+		}
+		if _, err := c.conn(ctx).Exec(ctx, `UPDATE accounts
+			SET account_id = @account_id,
+			account_id_bidx = NULLIF(@account_id_bidx, ''),
+			identification = NULLIF(@identification, '')
+			WHERE client_id = @client_id AND bank = @bank AND account_id = @stored`, args); err != nil {
+			return 0, err
+		}
+	}
+	return len(accounts), nil
+}
+
+// reencryptAccountIDs seals again the account ids of a table keyed by the
+// account that seals nothing else.
+func (c *Client) reencryptAccountIDs(table string) func(context.Context, string, int) (int, error) {
+	return func(ctx context.Context, current string, limit int) (int, error) {
+		rows, err := c.conn(ctx).Query(ctx, `SELECT client_id, bank, account_id, COALESCE(account_id_bidx, '')
+			FROM `+table+`
+			WHERE account_id NOT LIKE @current
+			LIMIT @limit
+			FOR UPDATE`, pgx.NamedArgs{
+			"current": current,
+			"limit":   limit,
+		})
+		if err != nil {
+			return 0, err
+		}
+		type account struct{ clientID, bank, stored, accountID, index string }
+		accounts, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (account, error) {
+			var a account
+			err := row.Scan(&a.clientID, &a.bank, &a.stored, &a.index)
+			a.accountID = a.stored
+			return a, err
+		})
+		if err != nil {
+			return 0, err
+		}
+		for _, account := range accounts {
+			f := c.fields()
+			f.openAccount(&account.accountID, account.clientID, account.bank, account.index)
+			accountID, index := f.sealAccount(account.clientID, account.bank, account.accountID)
+			if f.err != nil {
+				return 0, f.err
+			}
+			if _, err := c.conn(ctx).Exec(ctx, `UPDATE `+table+`
+				SET account_id = @account_id,
+				account_id_bidx = NULLIF(@account_id_bidx, '')
+				WHERE client_id = @client_id AND bank = @bank AND account_id = @stored`, pgx.NamedArgs{
+				"client_id":       account.clientID,
+				"bank":            account.bank,
+				"stored":          account.stored,
+				"account_id":      accountID,
+				"account_id_bidx": index,
+			}); err != nil {
+				return 0, err
+			}
+		}
+		return len(accounts), nil
+	}
+}
+
+func (c *Client) reencryptTransactions(ctx context.Context, current string, limit int) (int, error) {
+	rows, err := c.conn(ctx).Query(ctx, `SELECT
+		client_id,
+		bank,
+		account_id,
+		COALESCE(account_id_bidx, ''),
+		transaction_id,
+		COALESCE(description, ''),
+		COALESCE(counterparty, ''),
+		COALESCE(counterparty_name, '')
+		FROM transactions
+		WHERE account_id NOT LIKE @current
+		OR (COALESCE(description, '') <> '' AND description NOT LIKE @current)
+		OR (COALESCE(counterparty, '') <> '' AND counterparty NOT LIKE @current)
+		OR (COALESCE(counterparty_name, '') <> '' AND counterparty_name NOT LIKE @current)
+		LIMIT @limit
+		FOR UPDATE`, pgx.NamedArgs{
+		"current": current,
+		"limit":   limit,
+	})
+	if err != nil {
+		return 0, err
+	}
+	type transaction struct {
+		clientID, bank, stored, accountID, index, transactionID string
+		description, counterparty, counterpartyName             string
+	}
+	txs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (transaction, error) {
+		var tx transaction
+		err := row.Scan(&tx.clientID, &tx.bank, &tx.stored, &tx.index, &tx.transactionID, &tx.description, &tx.counterparty, &tx.counterpartyName)
+		tx.accountID = tx.stored
+		return tx, err
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, tx := range txs {
+		f := c.fields()
+		f.openAccount(&tx.accountID, tx.clientID, tx.bank, tx.index)
+		key := []string{tx.clientID, tx.bank, tx.accountID, tx.transactionID}
+		f.open(&tx.description, rowField(fieldTxDescription, key...))
+		f.open(&tx.counterparty, rowField(fieldTxCounterparty, key...))
+		f.open(&tx.counterpartyName, rowField(fieldTxCounterpartyName, key...))
+		accountID, index := f.sealAccount(tx.clientID, tx.bank, tx.accountID)
+		args := pgx.NamedArgs{
+			"client_id":         tx.clientID,
+			"bank":              tx.bank,
+			"stored":            tx.stored,
+			"account_id":        accountID,
+			"account_id_bidx":   index,
+			"transaction_id":    tx.transactionID,
+			"description":       f.seal(tx.description, rowField(fieldTxDescription, key...)),
+			"counterparty":      f.seal(tx.counterparty, rowField(fieldTxCounterparty, key...)),
+			"counterparty_name": f.seal(tx.counterpartyName, rowField(fieldTxCounterpartyName, key...)),
+		}
+		if f.err != nil {
+			return 0, f.err
+		}
+		if _, err := c.conn(ctx).Exec(ctx, `UPDATE transactions
+			SET account_id = @account_id,
+			account_id_bidx = NULLIF(@account_id_bidx, ''),
+			description = @description,
+			counterparty = @counterparty,
+			counterparty_name = @counterparty_name
+			WHERE client_id = @client_id AND bank = @bank
+			AND account_id = @stored AND transaction_id = @transaction_id`, args); err != nil {
+			return 0, err
+		}
+	}
+	return len(txs), nil
+}
+
+func (c *Client) reencryptTransferPairs(ctx context.Context, current string, limit int) (int, error) {
+	rows, err := c.conn(ctx).Query(ctx, `SELECT
+		transfer_id::text,
+		client_id,
+		debit_bank,
+		debit_account_id,
+		COALESCE(debit_account_id_bidx, ''),
+		credit_bank,
+		credit_account_id,
+		COALESCE(credit_account_id_bidx, '')
+		FROM transfer_pairs
+		WHERE debit_account_id NOT LIKE @current OR credit_account_id NOT LIKE @current
+		LIMIT @limit
+		FOR UPDATE`, pgx.NamedArgs{
+		"current": current,
+		"limit":   limit,
+	})
+	if err != nil {
+		return 0, err
+	}
+	type pair struct {
+		transferID, clientID                     string
+		debitBank, debitAccountID, debitIndex    string
+		creditBank, creditAccountID, creditIndex string
+	}
+	pairs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (pair, error) {
+		var p pair
+		err := row.Scan(&p.transferID, &p.clientID, &p.debitBank, &p.debitAccountID, &p.debitIndex, &p.creditBank, &p.creditAccountID, &p.creditIndex)
+		return p, err
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, pair := range pairs {
+		f := c.fields()
+		f.openAccount(&pair.debitAccountID, pair.clientID, pair.debitBank, pair.debitIndex)
+		f.openAccount(&pair.creditAccountID, pair.clientID, pair.creditBank, pair.creditIndex)
+		debitAccountID, debitIndex := f.sealAccount(pair.clientID, pair.debitBank, pair.debitAccountID)
+		creditAccountID, creditIndex := f.sealAccount(pair.clientID, pair.creditBank, pair.creditAccountID)
+		if f.err != nil {
+			return 0, f.err
+		}
+		if _, err := c.conn(ctx).Exec(ctx, `UPDATE transfer_pairs
+			SET debit_account_id = @debit_account_id,
+			debit_account_id_bidx = NULLIF(@debit_account_id_bidx, ''),
+			credit_account_id = @credit_account_id,
+			credit_account_id_bidx = NULLIF(@credit_account_id_bidx, '')
+			WHERE transfer_id::text = @transfer_id`, pgx.NamedArgs{
+			"transfer_id":            pair.transferID,
+			"debit_account_id":       debitAccountID,
+			"debit_account_id_bidx":  debitIndex,
+			"credit_account_id":      creditAccountID,
+			"credit_account_id_bidx": creditIndex,
+		}); err != nil {
+			return 0, err
+		}
+	}
+	return len(pairs), nil
+}
+
+func (c *Client) reencryptCategoryRules(ctx context.Context, current string, limit int) (int, error) {
+	rows, err := c.conn(ctx).Query(ctx, `SELECT rule_id::text, client_id, pattern
+		FROM category_rules
+		WHERE client_id IS NOT NULL AND pattern NOT LIKE @current
+		LIMIT @limit
+		FOR UPDATE`, pgx.NamedArgs{
+		"current": current,
+		"limit":   limit,
+	})
+	if err != nil {
+		return 0, err
+	}
+	type rule struct{ ruleID, clientID, pattern string }
+	rules, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (rule, error) {
+		var r rule
+		err := row.Scan(&r.ruleID, &r.clientID, &r.pattern)
+		return r, err
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, rule := range rules {
+		f := c.fields()
+		patternField := rowField(fieldCategoryRulePattern, rule.clientID, rule.ruleID)
+		f.open(&rule.pattern, patternField)
+		args := pgx.NamedArgs{
+			"rule_id":      rule.ruleID,
+			"pattern":      f.seal(rule.pattern, patternField),
+			"pattern_bidx": f.index(strings.ToLower(rule.pattern), fieldCategoryRulePattern),
+		}
+		if f.err != nil {
+			return 0, f.err
+		}
+		if _, err := c.conn(ctx).Exec(ctx, `UPDATE category_rules
+			SET pattern = @pattern,
+			pattern_bidx = NULLIF(@pattern_bidx, '')
+			WHERE rule_id::text = @rule_id`, args); err != nil {
+			return 0, err
+		}
+	}
+	return len(rules), nil
+}
+
+func (c *Client) reencryptOutboxEvents(ctx context.Context, current string, limit int) (int, error) {
+	rows, err := c.conn(ctx).Query(ctx, `SELECT sequence, event_id::text, client_id, aggregate_id, payload
+		FROM outbox_events
+		WHERE (aggregate_id <> '' AND aggregate_id NOT LIKE @current)
+		OR (payload <> '' AND payload NOT LIKE @current)
+		LIMIT @limit
+		FOR UPDATE`, pgx.NamedArgs{
+		"current": current,
+		"limit":   limit,
+	})
+	if err != nil {
+		return 0, err
+	}
+	type event struct {
+		sequence                                int64
+		eventID, clientID, aggregateID, payload string
+	}
+	events, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (event, error) {
+		var e event
+		err := row.Scan(&e.sequence, &e.eventID, &e.clientID, &e.aggregateID, &e.payload)
+		return e, err
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, event := range events {
+		f := c.fields()
+		aggregateField := rowField(fieldOutboxAggregateID, event.clientID, event.eventID)
+		payloadField := rowField(fieldOutboxPayload, event.clientID, event.eventID)
+		f.open(&event.aggregateID, aggregateField)
+		f.open(&event.payload, payloadField)
+		args := pgx.NamedArgs{
+			"sequence":          event.sequence,
+			"aggregate_id":      f.seal(event.aggregateID, aggregateField),
+			"aggregate_id_bidx": f.index(event.aggregateID, fieldOutboxAggregateID),
+			"payload":           f.seal(event.payload, payloadField),
+		}
+		if f.err != nil {
+			return 0, f.err
+		}
+		if _, err := c.conn(ctx).Exec(ctx, `UPDATE outbox_events
+			SET aggregate_id = @aggregate_id,
+			aggregate_id_bidx = NULLIF(@aggregate_id_bidx, ''),
+			payload = @payload
+			WHERE sequence = @sequence`, args); err != nil {
+			return 0, err
+		}
+	}
+	return len(events), nil
+}
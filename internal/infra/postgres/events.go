@@ -0,0 +1,199 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+// SaveOutboxEvents takes a transaction-level advisory lock on each client it
+// saves events of, in client order so that units of work cannot deadlock on
+// the events of one call.
+func (c *Client) SaveOutboxEvents(ctx context.Context, events []*domain.Event) error {
+	clientIDs := make([]string, 0, len(events))
+	for _, event := range events {
+		clientIDs = append(clientIDs, event.ClientID)
+	}
+	slices.Sort(clientIDs)
+	for _, clientID := range slices.Compact(clientIDs) {
+		if _, err := c.conn(ctx).Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('lima.outbox_events'), hashtext(@client_id))`, pgx.NamedArgs{
+			"client_id": clientID,
+		}); err != nil {
+			return err
+		}
+	}
+	for _, event := range events {
+		f := c.fields()
+		args := pgx.NamedArgs{
+			"event_id":          event.EventID,
+			"event_type":        event.Type,
+			"client_id":         event.ClientID,
+			"aggregate_id":      f.seal(event.AggregateID, rowField(fieldOutboxAggregateID, event.ClientID, event.EventID)),
+			"aggregate_id_bidx": f.index(event.AggregateID, fieldOutboxAggregateID),
+			"payload":           f.seal(string(event.Payload), rowField(fieldOutboxPayload, event.ClientID, event.EventID)),
+			"occurred_at":       event.OccurredAt,
+			"status":            event.Status,
+		}
+		if f.err != nil {
+			return f.err
+		}
+		err := c.conn(ctx).QueryRow(ctx, `INSERT INTO outbox_events (
+			event_id,
+			event_type,
+			client_id,
+			aggregate_id,
+			aggregate_id_bidx,
+			payload,
+			occurred_at,
+			status
+			) VALUES (@event_id, @event_type, @client_id, @aggregate_id, NULLIF(@aggregate_id_bidx, ''), @payload, @occurred_at, @status)
+			RETURNING sequence`, args).Scan(&event.Sequence)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const outboxEventColumns = `sequence,
+		event_id::text,
+		event_type,
+		client_id,
+		aggregate_id,
+		payload,
+		occurred_at,
+		status,
+		attempts,
+		COALESCE(last_error, ''),
+		claimed_until,
+		delivered`
+
+// HeadOutboxEvents finds the head of every aggregate among the undispatched
+// events, and skips the heads other dispatchers hold locked. Sealed aggregate
+// ids differ from event to event, so the events of an aggregate are told
+// apart by the blind index of its id.
+func (c *Client) HeadOutboxEvents(ctx context.Context, now time.Time, limit int) ([]*domain.Event, error) {
+	rows, err := c.conn(ctx).Query(ctx, `SELECT `+outboxEventColumns+`
+		FROM outbox_events
+		WHERE sequence IN (
+			SELECT DISTINCT ON (client_id, COALESCE(aggregate_id_bidx, aggregate_id)) sequence
+			FROM outbox_events
+			WHERE status <> @dispatched
+			ORDER BY client_id, COALESCE(aggregate_id_bidx, aggregate_id), sequence
+		)
+		AND status = @pending
+		AND (claimed_until IS NULL OR claimed_until <= @now)
+		ORDER BY sequence
+		LIMIT @limit
+		FOR UPDATE SKIP LOCKED`, pgx.NamedArgs{
+		"dispatched": domain.EventStatusDispatched,
+		"pending":    domain.EventStatusPending,
+		"now":        now,
+		"limit":      limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.scanOutboxEvents(rows)
+}
+
+func (c *Client) FailedOutboxEvents(ctx context.Context, after int64, limit int) ([]*domain.Event, error) {
+	rows, err := c.conn(ctx).Query(ctx, `SELECT `+outboxEventColumns+`
+		FROM outbox_events
+		WHERE status = @failed AND sequence > @after
+		ORDER BY sequence
+		LIMIT @limit`, pgx.NamedArgs{
+		"failed": domain.EventStatusFailed,
+		"after":  after,
+		"limit":  limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.scanOutboxEvents(rows)
+}
+
+func (c *Client) RetryOutboxEvent(ctx context.Context, eventID string) error {
+	tag, err := c.conn(ctx).Exec(ctx, `UPDATE outbox_events
+		SET status = @pending,
+		attempts = 0,
+		claimed_until = NULL
+		WHERE event_id = @event_id AND status = @failed`, pgx.NamedArgs{
+		"event_id": eventID,
+		"pending":  domain.EventStatusPending,
+		"failed":   domain.EventStatusFailed,
+	})
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("outbox event: %w", domain.ErrNotFound)
+	}
+	return nil
+}
+
+func (c *Client) scanOutboxEvents(rows pgx.Rows) ([]*domain.Event, error) {
+	defer rows.Close()
+
+	events := make([]*domain.Event, 0)
+	for rows.Next() {
+		var (
+			event        domain.Event
+			payload      string
+			claimedUntil *time.Time
+		)
+		if err := rows.Scan(
+			&event.Sequence,
+			&event.EventID,
+			&event.Type,
+			&event.ClientID,
+			&event.AggregateID,
+			&payload,
+			&event.OccurredAt,
+			&event.Status,
+			&event.Attempts,
+			&event.LastError,
+			&claimedUntil,
+			&event.Delivered,
+		); err != nil {
+			return nil, err
+		}
+		f := c.fields()
+		f.open(&event.AggregateID, rowField(fieldOutboxAggregateID, event.ClientID, event.EventID))
+		f.open(&payload, rowField(fieldOutboxPayload, event.ClientID, event.EventID))
+		if f.err != nil {
+			return nil, f.err
+		}
+		event.Payload = []byte(payload)
+		event.ClaimedUntil = timeOrZero(claimedUntil)
+		events = append(events, &event)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return events, nil
+}
+
+func (c *Client) UpdateOutboxEvent(ctx context.Context, event *domain.Event) error {
+	_, err := c.conn(ctx).Exec(ctx, `UPDATE outbox_events
+		SET status = @status,
+		attempts = @attempts,
+		last_error = NULLIF(@last_error, ''),
+		dispatched_at = @dispatched_at,
+		claimed_until = @claimed_until,
+		delivered = COALESCE(@delivered::text[], '{}')
+		WHERE sequence = @sequence`, pgx.NamedArgs{
+		"sequence":      event.Sequence,
+		"status":        event.Status,
+		"attempts":      event.Attempts,
+		"last_error":    event.LastError,
+		"dispatched_at": nullTime(event.DispatchedAt),
+		"claimed_until": nullTime(event.ClaimedUntil),
+		"delivered":     event.Delivered,
+	})
+	return err
+}
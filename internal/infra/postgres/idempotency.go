@@ -0,0 +1,131 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+func (c *Client) ReserveIdempotencyKey(ctx context.Context, record *domain.IdempotencyRecord) (*domain.IdempotencyRecord, bool, error) {
+	var (
+		existing *domain.IdempotencyRecord
+		reserved bool
+	)
+	err := c.InTx(ctx, func(ctx context.Context) error {
+		args := pgx.NamedArgs{
+			"idempotency_key": record.Key,
+			"client_id":       record.ClientID,
+			"method":          record.Method,
+			"path":            record.Path,
+			"fingerprint":     record.Fingerprint,
+			"created_at":      record.CreatedAt,
+			"expires_at":      record.ExpiresAt,
+		}
+		if _, err := c.conn(ctx).Exec(ctx, `DELETE FROM idempotency_keys
+			WHERE idempotency_key = @idempotency_key AND client_id = @client_id AND expires_at <= @created_at`, args); err != nil {
+			return err
+		}
+		tag, err := c.conn(ctx).Exec(ctx, `INSERT INTO idempotency_keys (
+			idempotency_key,
+			client_id,
+			method,
+			path,
+			fingerprint,
+			created_at,
+			expires_at) VALUES (
+			@idempotency_key,
+			@client_id,
+			@method,
+			@path,
+			@fingerprint,
+			@created_at,
+			@expires_at) ON CONFLICT (idempotency_key, client_id) DO NOTHING`, args)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 1 {
+			reserved = true
+			return nil
+		}
+
+		var rec domain.IdempotencyRecord
+		var statusCode *int32
+		var contentType *string
+		if err = c.conn(ctx).QueryRow(ctx, `SELECT
+			idempotency_key,
+			client_id,
+			method,
+			path,
+			fingerprint,
+			completed,
+			status_code,
+			content_type,
+			response_body,
+			created_at,
+			expires_at
+			FROM idempotency_keys WHERE idempotency_key = @idempotency_key AND client_id = @client_id`, args).Scan(
+			&rec.Key,
+			&rec.ClientID,
+			&rec.Method,
+			&rec.Path,
+			&rec.Fingerprint,
+			&rec.Completed,
+			&statusCode,
+			&contentType,
+			&rec.Body,
+			&rec.CreatedAt,
+			&rec.ExpiresAt,
+		); err != nil {
+			return err
+		}
+		if statusCode != nil {
+			rec.StatusCode = int(*statusCode)
+		}
+		if contentType != nil {
+			rec.ContentType = *contentType
+		}
+		existing = &rec
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return existing, reserved, nil
+}
+
+func (c *Client) CompleteIdempotencyKey(ctx context.Context, record *domain.IdempotencyRecord) error {
+	_, err := c.conn(ctx).Exec(ctx, `UPDATE idempotency_keys
+		SET completed = TRUE,
+		status_code = @status_code,
+		content_type = @content_type,
+		response_body = @response_body
+		WHERE idempotency_key = @idempotency_key AND client_id = @client_id`, pgx.NamedArgs{
+		"idempotency_key": record.Key,
+		"client_id":       record.ClientID,
+		"status_code":     record.StatusCode,
+		"content_type":    record.ContentType,
+		"response_body":   record.Body,
+	})
+	return err
+}
+
+func (c *Client) ReleaseIdempotencyKey(ctx context.Context, key, clientID string) error {
+	_, err := c.conn(ctx).Exec(ctx, `DELETE FROM idempotency_keys
+		WHERE idempotency_key = @idempotency_key AND client_id = @client_id AND NOT completed`, pgx.NamedArgs{
+		"idempotency_key": key,
+		"client_id":       clientID,
+	})
+	return err
+}
+
+func (c *Client) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+	tag, err := c.conn(ctx).Exec(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= @now`, pgx.NamedArgs{
+		"now": now,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,226 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+func (c *Client) SaveNotificationPreference(ctx context.Context, pref *domain.NotificationPreference) error {
+	_, err := c.conn(ctx).Exec(ctx, `INSERT INTO notification_preferences (
+		client_id,
+		channel,
+		enabled,
+		target,
+		events,
+		updated_at
+		) VALUES (@client_id, @channel, @enabled, @target, @events, @updated_at)
+		ON CONFLICT (client_id, channel) DO UPDATE SET
+		 enabled = EXCLUDED.enabled,
+		 target = EXCLUDED.target,
+		 events = EXCLUDED.events,
+		 updated_at = EXCLUDED.updated_at`, pgx.NamedArgs{
+		"client_id":  pref.ClientID,
+		"channel":    pref.Channel,
+		"enabled":    pref.Enabled,
+		"target":     pref.Target,
+		"events":     pref.Events,
+		"updated_at": pref.UpdatedAt,
+	})
+	return err
+}
+
+func (c *Client) GetNotificationPreferences(ctx context.Context, clientID string) ([]*domain.NotificationPreference, error) {
+	rows, err := c.conn(ctx).Query(ctx, `SELECT
+		client_id,
+		channel,
+		enabled,
+		target,
+		events,
+		updated_at
+		FROM notification_preferences
+		WHERE client_id = @client_id
+		ORDER BY channel`, pgx.NamedArgs{
+		"client_id": clientID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prefs := make([]*domain.NotificationPreference, 0)
+	for rows.Next() {
+		var pref domain.NotificationPreference
+		if err = rows.Scan(
+			&pref.ClientID,
+			&pref.Channel,
+			&pref.Enabled,
+			&pref.Target,
+			&pref.Events,
+			&pref.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		prefs = append(prefs, &pref)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return prefs, nil
+}
+
+func (c *Client) SaveNotificationDelivery(ctx context.Context, delivery *domain.NotificationDelivery) error {
+	_, err := c.conn(ctx).Exec(ctx, `INSERT INTO notification_deliveries (
+		delivery_id,
+		notification_id,
+		client_id,
+		event,
+		channel,
+		target,
+		subject,
+		body,
+		data,
+		status,
+		attempts,
+		last_error,
+		next_attempt_at,
+		created_at,
+		updated_at
+		) VALUES (
+		@delivery_id,
+		@notification_id,
+		@client_id,
+		@event,
+		@channel,
+		@target,
+		@subject,
+		@body,
+		@data,
+		@status,
+		@attempts,
+		NULLIF(@last_error, ''),
+		@next_attempt_at,
+		@created_at,
+		@updated_at)`, deliveryArgs(delivery))
+	return err
+}
+
+func (c *Client) UpdateNotificationDelivery(ctx context.Context, delivery *domain.NotificationDelivery) error {
+	_, err := c.conn(ctx).Exec(ctx, `UPDATE notification_deliveries
+		SET status = @status,
+		attempts = @attempts,
+		last_error = NULLIF(@last_error, ''),
+		next_attempt_at = @next_attempt_at,
+		updated_at = @updated_at
+		WHERE delivery_id = @delivery_id`, deliveryArgs(delivery))
+	return err
+}
+
+func (c *Client) ClaimNotificationDeliveries(ctx context.Context, now, until time.Time, limit int) ([]*domain.NotificationDelivery, error) {
+	rows, err := c.conn(ctx).Query(ctx, `UPDATE notification_deliveries
+		SET next_attempt_at = @until
+		WHERE delivery_id IN (
+			SELECT delivery_id FROM notification_deliveries
+			WHERE status = @pending AND next_attempt_at <= @now
+			ORDER BY next_attempt_at
+			LIMIT @limit
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+deliveryColumns, pgx.NamedArgs{
+		"pending": domain.DeliveryStatusPending,
+		"now":     now,
+		"until":   until,
+		"limit":   limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return scanDeliveries(rows)
+}
+
+func (c *Client) GetNotificationDeliveries(ctx context.Context, clientID string) ([]*domain.NotificationDelivery, error) {
+	rows, err := c.conn(ctx).Query(ctx, `SELECT `+deliveryColumns+`
+		FROM notification_deliveries
+		WHERE client_id = @client_id
+		ORDER BY created_at DESC, delivery_id`, pgx.NamedArgs{
+		"client_id": clientID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return scanDeliveries(rows)
+}
+
+const deliveryColumns = `delivery_id::text,
+		notification_id::text,
+		client_id,
+		event,
+		channel,
+		target,
+		subject,
+		body,
+		data,
+		status,
+		attempts,
+		COALESCE(last_error, ''),
+		next_attempt_at,
+		created_at,
+		updated_at`
+
+func deliveryArgs(delivery *domain.NotificationDelivery) pgx.NamedArgs {
+	data := delivery.Data
+	if data == nil {
+		data = map[string]string{}
+	}
+	return pgx.NamedArgs{
+		"delivery_id":     delivery.DeliveryID,
+		"notification_id": delivery.NotificationID,
+		"client_id":       delivery.ClientID,
+		"event":           delivery.Event,
+		"channel":         delivery.Channel,
+		"target":          delivery.Target,
+		"subject":         delivery.Subject,
+		"body":            delivery.Body,
+		"data":            data,
+		"status":          delivery.Status,
+		"attempts":        delivery.Attempts,
+		"last_error":      delivery.LastError,
+		"next_attempt_at": delivery.NextAttemptAt,
+		"created_at":      delivery.CreatedAt,
+		"updated_at":      delivery.UpdatedAt,
+	}
+}
+
+func scanDeliveries(rows pgx.Rows) ([]*domain.NotificationDelivery, error) {
+	defer rows.Close()
+	deliveries := make([]*domain.NotificationDelivery, 0)
+	for rows.Next() {
+		var delivery domain.NotificationDelivery
+		if err := rows.Scan(
+			&delivery.DeliveryID,
+			&delivery.NotificationID,
+			&delivery.ClientID,
+			&delivery.Event,
+			&delivery.Channel,
+			&delivery.Target,
+			&delivery.Subject,
+			&delivery.Body,
+			&delivery.Data,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.LastError,
+			&delivery.NextAttemptAt,
+			&delivery.CreatedAt,
+			&delivery.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return deliveries, nil
+}
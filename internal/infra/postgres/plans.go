@@ -0,0 +1,175 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetClientPlan returns the plan the client was last moved to, locked until
+// the unit of work ends. The lock is a transaction-level advisory lock on the
+// client, as clients on the default plan have no row to lock.
+func (c *Client) GetClientPlan(ctx context.Context, clientID string) (*domain.ClientPlan, error) {
+	if _, err := c.conn(ctx).Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('lima.client_plans'), hashtext(@client_id))`, pgx.NamedArgs{
+		"client_id": clientID,
+	}); err != nil {
+		return nil, err
+	}
+	var plan domain.ClientPlan
+	err := c.conn(ctx).QueryRow(ctx, `SELECT
+		client_id,
+		plan,
+		changed_at
+		FROM client_plans
+		WHERE client_id = @client_id`, pgx.NamedArgs{
+		"client_id": clientID,
+	}).Scan(
+		&plan.ClientID,
+		&plan.Plan,
+		&plan.ChangedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("client plan: %w", domain.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+func (c *Client) SaveClientPlan(ctx context.Context, plan *domain.ClientPlan) error {
+	_, err := c.conn(ctx).Exec(ctx, `INSERT INTO client_plans (
+		client_id,
+		plan,
+		changed_at
+		) VALUES (@client_id, @plan, @changed_at)
+		ON CONFLICT (client_id) DO UPDATE SET
+		 plan = EXCLUDED.plan,
+		 changed_at = EXCLUDED.changed_at`, pgx.NamedArgs{
+		"client_id":  plan.ClientID,
+		"plan":       plan.Plan,
+		"changed_at": plan.ChangedAt,
+	})
+	return err
+}
+
+func (c *Client) SavePlanChange(ctx context.Context, change *domain.PlanChange) error {
+	_, err := c.conn(ctx).Exec(ctx, `INSERT INTO plan_changes (
+		client_id,
+		previous_plan,
+		plan,
+		changed_by,
+		reason,
+		changed_at
+		) VALUES (@client_id, @previous_plan, @plan, @changed_by, @reason, @changed_at)`, pgx.NamedArgs{
+		"client_id":     change.ClientID,
+		"previous_plan": change.PreviousPlan,
+		"plan":          change.Plan,
+		"changed_by":    change.ChangedBy,
+		"reason":        change.Reason,
+		"changed_at":    change.ChangedAt,
+	})
+	return err
+}
+
+func (c *Client) GetPlanChanges(ctx context.Context, clientID string) ([]*domain.PlanChange, error) {
+	rows, err := c.conn(ctx).Query(ctx, `SELECT
+		client_id,
+		previous_plan,
+		plan,
+		changed_by,
+		reason,
+		changed_at
+		FROM plan_changes
+		WHERE client_id = @client_id
+		ORDER BY changed_at, id`, pgx.NamedArgs{
+		"client_id": clientID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := make([]*domain.PlanChange, 0)
+	for rows.Next() {
+		var change domain.PlanChange
+		if err = rows.Scan(
+			&change.ClientID,
+			&change.PreviousPlan,
+			&change.Plan,
+			&change.ChangedBy,
+			&change.Reason,
+			&change.ChangedAt,
+		); err != nil {
+			return nil, err
+		}
+		changes = append(changes, &change)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return changes, nil
+}
+
+func (c *Client) ReserveSync(ctx context.Context, clientID string, now, syncedBefore, reservedUntil time.Time) (*domain.ClientSync, bool, error) {
+	var syncedAt, until *time.Time
+	err := c.conn(ctx).QueryRow(ctx, `INSERT INTO client_syncs (
+		client_id,
+		reserved_until
+		) VALUES (@client_id, @reserved_until)
+		ON CONFLICT (client_id) DO UPDATE SET
+		 reserved_until = EXCLUDED.reserved_until
+		WHERE (client_syncs.synced_at IS NULL OR client_syncs.synced_at <= @synced_before)
+		 AND (client_syncs.reserved_until IS NULL OR client_syncs.reserved_until <= @now)
+		RETURNING synced_at, reserved_until`, pgx.NamedArgs{
+		"client_id":      clientID,
+		"reserved_until": reservedUntil,
+		"synced_before":  syncedBefore,
+		"now":            now,
+	}).Scan(&syncedAt, &until)
+	reserved := true
+	if errors.Is(err, pgx.ErrNoRows) {
+		reserved = false
+		err = c.conn(ctx).QueryRow(ctx, `SELECT
+			synced_at,
+			reserved_until
+			FROM client_syncs
+			WHERE client_id = @client_id`, pgx.NamedArgs{
+			"client_id": clientID,
+		}).Scan(&syncedAt, &until)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &domain.ClientSync{
+		ClientID:      clientID,
+		SyncedAt:      timeOrZero(syncedAt),
+		ReservedUntil: timeOrZero(until),
+	}, reserved, nil
+}
+
+func (c *Client) CompleteSync(ctx context.Context, clientID string, reservedUntil, syncedAt time.Time) error {
+	_, err := c.conn(ctx).Exec(ctx, `UPDATE client_syncs SET
+		synced_at = @synced_at,
+		reserved_until = NULL
+		WHERE client_id = @client_id AND reserved_until = @reserved_until`, pgx.NamedArgs{
+		"client_id":      clientID,
+		"reserved_until": reservedUntil,
+		"synced_at":      syncedAt,
+	})
+	return err
+}
+
+func (c *Client) ReleaseSync(ctx context.Context, clientID string, reservedUntil time.Time) error {
+	_, err := c.conn(ctx).Exec(ctx, `UPDATE client_syncs SET
+		reserved_until = NULL
+		WHERE client_id = @client_id AND reserved_until = @reserved_until`, pgx.NamedArgs{
+		"client_id":      clientID,
+		"reserved_until": reservedUntil,
+	})
+	return err
+}
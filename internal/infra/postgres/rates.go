@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+func (c *Client) SaveRates(ctx context.Context, rates []*domain.ExchangeRate) error {
+	return c.InTx(ctx, func(ctx context.Context) error {
+		for _, rate := range rates {
+			_, err := c.conn(ctx).Exec(ctx, `INSERT INTO exchange_rates (
+				rate_date,
+				currency,
+				base_currency,
+				rate,
+				source
+				) VALUES (@rate_date, @currency, @base_currency, @rate::numeric, @source)
+				ON CONFLICT (rate_date, currency, base_currency) DO UPDATE SET
+				 rate = EXCLUDED.rate,
+				 source = EXCLUDED.source`, pgx.NamedArgs{
+				"rate_date":     rate.Date,
+				"currency":      rate.Currency,
+				"base_currency": rate.BaseCurrency,
+				"rate":          rate.Rate,
+				"source":        rate.Source,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (c *Client) GetRates(ctx context.Context, date time.Time) ([]*domain.ExchangeRate, error) {
+	rows, err := c.conn(ctx).Query(ctx, `SELECT DISTINCT ON (currency, base_currency)
+		rate_date,
+		currency,
+		base_currency,
+		rate::text,
+		source
+		FROM exchange_rates
+		WHERE rate_date <= @rate_date
+		ORDER BY currency, base_currency, rate_date DESC`, pgx.NamedArgs{
+		"rate_date": date,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := make([]*domain.ExchangeRate, 0)
+	for rows.Next() {
+		var rate domain.ExchangeRate
+		if err = rows.Scan(
+			&rate.Date,
+			&rate.Currency,
+			&rate.BaseCurrency,
+			&rate.Rate,
+			&rate.Source,
+		); err != nil {
+			return nil, err
+		}
+		rates = append(rates, &rate)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return rates, nil
+}
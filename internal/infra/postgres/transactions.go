@@ -0,0 +1,231 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+func (c *Client) SaveTransaction(ctx context.Context, tx *domain.Transaction) error {
+	f := c.fields()
+	accountID, index := f.sealAccount(tx.ClientID, tx.Bank, tx.AccountID)
+	key := transactionKey(tx)
+	description := f.seal(tx.Description, rowField(fieldTxDescription, key...))
+	counterparty := f.seal(tx.Counterparty, rowField(fieldTxCounterparty, key...))
+	counterpartyName := f.seal(tx.CounterpartyName, rowField(fieldTxCounterpartyName, key...))
+	if f.err != nil {
+		return f.err
+	}
+	_, err := c.conn(ctx).Exec(ctx, `INSERT INTO transactions (
+		account_id,
+		account_id_bidx,
+		transaction_id,
+		client_id,
+		bank,
+		amount,
+		currency,
+		status,
+		booked_at,
+		value_at,
+		description,
+		merchant,
+		mcc,
+		counterparty,
+		counterparty_name,
+		category,
+		category_source
+		) VALUES (
+		@account_id,
+		NULLIF(@account_id_bidx, ''),
+		@transaction_id,
+		@client_id,
+		@bank,
+		@amount::numeric,
+		@currency,
+		@status,
+		@booked_at,
+		@value_at,
+		@description,
+		@merchant,
+		@mcc,
+		@counterparty,
+		@counterparty_name,
+		@category,
+		@category_source)
+		ON CONFLICT (client_id, bank, (COALESCE(account_id_bidx, account_id)), transaction_id) DO UPDATE SET
+		 amount = EXCLUDED.amount,
+		 currency = EXCLUDED.currency,
+		 status = EXCLUDED.status,
+		 booked_at = EXCLUDED.booked_at,
+		 value_at = EXCLUDED.value_at,
+		 description = EXCLUDED.description,
+		 merchant = EXCLUDED.merchant,
+		 mcc = EXCLUDED.mcc,
+		 counterparty = EXCLUDED.counterparty,
+		 counterparty_name = EXCLUDED.counterparty_name,
+		 category = CASE WHEN transactions.category_source = @override OR transactions.transfer_id IS NOT NULL
+		  THEN transactions.category ELSE EXCLUDED.category END,
+		 category_source = CASE WHEN transactions.category_source = @override OR transactions.transfer_id IS NOT NULL
+		  THEN transactions.category_source ELSE EXCLUDED.category_source END`, pgx.NamedArgs{
+		"account_id":        accountID,
+		"account_id_bidx":   index,
+		"transaction_id":    tx.TransactionID,
+		"client_id":         tx.ClientID,
+		"bank":              tx.Bank,
+		"amount":            tx.Amount,
+		"currency":          tx.Currency,
+		"status":            tx.Status,
+		"booked_at":         tx.BookedAt,
+		"value_at":          tx.ValueAt,
+		"description":       description,
+		"merchant":          tx.Merchant,
+		"mcc":               tx.MCC,
+		"counterparty":      counterparty,
+		"counterparty_name": counterpartyName,
+		"category":          tx.Category,
+		"category_source":   tx.CategorySource,
+		"override":          domain.CategorySourceOverride,
+	})
+	return err
+}
+
+// transactionKey is the key the sealed columns of a transaction are bound to.
+func transactionKey(tx *domain.Transaction) []string {
+	return []string{tx.ClientID, tx.Bank, tx.AccountID, tx.TransactionID}
+}
+
+const transactionColumns = `account_id,
+		COALESCE(account_id_bidx, ''),
+		transaction_id,
+		client_id,
+		bank,
+		amount::text,
+		currency,
+		status,
+		booked_at,
+		COALESCE(value_at, booked_at),
+		COALESCE(description, ''),
+		COALESCE(merchant, ''),
+		COALESCE(mcc, ''),
+		COALESCE(counterparty, ''),
+		COALESCE(counterparty_name, ''),
+		category,
+		category_source,
+		COALESCE(transfer_id::text, '')`
+
+// GetTransactions looks sealed account ids up by their blind index, or by
+// the id itself when encryption is disabled.
+func (c *Client) GetTransactions(ctx context.Context, filter domain.TransactionFilter) ([]*domain.Transaction, error) {
+	index, err := c.cipher.BlindIndex(filter.AccountID, fieldAccountID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := c.conn(ctx).Query(ctx, `SELECT `+transactionColumns+`
+		FROM transactions
+		WHERE client_id = @client_id
+		AND (@bank = '' OR bank = @bank)
+		AND (@account_id = '' OR `+accountMatch("account_id", "account_id")+`)
+		AND (@transaction_id = '' OR transaction_id = @transaction_id)
+		AND (@category = '' OR category = @category)
+		AND (@from::timestamptz IS NULL OR booked_at >= @from)
+		AND (@to::timestamptz IS NULL OR booked_at < @to)
+		ORDER BY booked_at DESC, transaction_id`, pgx.NamedArgs{
+		"client_id":       filter.ClientID,
+		"bank":            filter.Bank,
+		"account_id":      filter.AccountID,
+		"account_id_bidx": index,
+		"transaction_id":  filter.TransactionID,
+		"category":        filter.Category,
+		"from":            nullTime(filter.From),
+		"to":              nullTime(filter.To),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.scanTransactions(rows)
+}
+
+func (c *Client) UpdateTransactionCategory(ctx context.Context, tx *domain.Transaction) error {
+	index, err := c.cipher.BlindIndex(tx.AccountID, fieldAccountID)
+	if err != nil {
+		return err
+	}
+	_, err = c.conn(ctx).Exec(ctx, `UPDATE transactions
+		SET category = @category,
+		category_source = @category_source
+		WHERE client_id = @client_id AND bank = @bank
+		AND `+accountMatch("account_id", "account_id")+` AND transaction_id = @transaction_id`, pgx.NamedArgs{
+		"client_id":       tx.ClientID,
+		"bank":            tx.Bank,
+		"account_id":      tx.AccountID,
+		"account_id_bidx": index,
+		"transaction_id":  tx.TransactionID,
+		"category":        tx.Category,
+		"category_source": tx.CategorySource,
+	})
+	return err
+}
+
+func (c *Client) scanTransactions(rows pgx.Rows) ([]*domain.Transaction, error) {
+	defer rows.Close()
+	txs := make([]*domain.Transaction, 0)
+	for rows.Next() {
+		var (
+			tx    domain.Transaction
+			index string
+		)
+		if err := rows.Scan(
+			&tx.AccountID,
+			&index,
+			&tx.TransactionID,
+			&tx.ClientID,
+			&tx.Bank,
+			&tx.Amount,
+			&tx.Currency,
+			&tx.Status,
+			&tx.BookedAt,
+			&tx.ValueAt,
+			&tx.Description,
+			&tx.Merchant,
+			&tx.MCC,
+			&tx.Counterparty,
+			&tx.CounterpartyName,
+			&tx.Category,
+			&tx.CategorySource,
+			&tx.TransferID,
+		); err != nil {
+			return nil, err
+		}
+		f := c.fields()
+		f.openAccount(&tx.AccountID, tx.ClientID, tx.Bank, index)
+		key := transactionKey(&tx)
+		f.open(&tx.Description, rowField(fieldTxDescription, key...))
+		f.open(&tx.Counterparty, rowField(fieldTxCounterparty, key...))
+		f.open(&tx.CounterpartyName, rowField(fieldTxCounterpartyName, key...))
+		if f.err != nil {
+			return nil, f.err
+		}
+		txs = append(txs, &tx)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return txs, nil
+}
+
+// nullTime maps the zero time to NULL.
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func timeOrZero(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
@@ -0,0 +1,168 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+// SaveTransferPair seals the account ids of both legs, and finds their
+// transactions by the blind index of the ids.
+func (c *Client) SaveTransferPair(ctx context.Context, pair *domain.TransferPair) error {
+	f := c.fields()
+	debitAccountID, debitIndex := f.sealAccount(pair.ClientID, pair.DebitBank, pair.DebitAccountID)
+	creditAccountID, creditIndex := f.sealAccount(pair.ClientID, pair.CreditBank, pair.CreditAccountID)
+	if f.err != nil {
+		return f.err
+	}
+	_, err := c.conn(ctx).Exec(ctx, `INSERT INTO transfer_pairs (
+		transfer_id,
+		client_id,
+		debit_bank,
+		debit_account_id,
+		debit_account_id_bidx,
+		debit_transaction_id,
+		credit_bank,
+		credit_account_id,
+		credit_account_id_bidx,
+		credit_transaction_id,
+		amount,
+		currency,
+		debit_booked_at,
+		credit_booked_at,
+		matched_by,
+		created_at
+		) VALUES (
+		@transfer_id,
+		@client_id,
+		@debit_bank,
+		@debit_account_id,
+		NULLIF(@debit_account_id_bidx, ''),
+		@debit_transaction_id,
+		@credit_bank,
+		@credit_account_id,
+		NULLIF(@credit_account_id_bidx, ''),
+		@credit_transaction_id,
+		@amount::numeric,
+		@currency,
+		@debit_booked_at,
+		@credit_booked_at,
+		@matched_by,
+		@created_at)`, pgx.NamedArgs{
+		"transfer_id":            pair.TransferID,
+		"client_id":              pair.ClientID,
+		"debit_bank":             pair.DebitBank,
+		"debit_account_id":       debitAccountID,
+		"debit_account_id_bidx":  debitIndex,
+		"debit_transaction_id":   pair.DebitTransactionID,
+		"credit_bank":            pair.CreditBank,
+		"credit_account_id":      creditAccountID,
+		"credit_account_id_bidx": creditIndex,
+		"credit_transaction_id":  pair.CreditTransactionID,
+		"amount":                 pair.Amount,
+		"currency":               pair.Currency,
+		"debit_booked_at":        pair.DebitBookedAt,
+		"credit_booked_at":       pair.CreditBookedAt,
+		"matched_by":             pair.MatchedBy,
+		"created_at":             pair.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.conn(ctx).Exec(ctx, `UPDATE transactions
+		SET transfer_id = @transfer_id,
+		category = CASE WHEN category_source = @override THEN category ELSE @category END,
+		category_source = CASE WHEN category_source = @override THEN category_source ELSE @category_source END
+		WHERE client_id = @client_id
+		AND ((bank = @debit_bank AND `+accountMatch("account_id", "debit_account_id")+` AND transaction_id = @debit_transaction_id)
+		OR (bank = @credit_bank AND `+accountMatch("account_id", "credit_account_id")+` AND transaction_id = @credit_transaction_id))`, pgx.NamedArgs{
+		"transfer_id":            pair.TransferID,
+		"client_id":              pair.ClientID,
+		"debit_bank":             pair.DebitBank,
+		"debit_account_id":       pair.DebitAccountID,
+		"debit_account_id_bidx":  debitIndex,
+		"debit_transaction_id":   pair.DebitTransactionID,
+		"credit_bank":            pair.CreditBank,
+		"credit_account_id":      pair.CreditAccountID,
+		"credit_account_id_bidx": creditIndex,
+		"credit_transaction_id":  pair.CreditTransactionID,
+		"category":               domain.CategoryTransfers,
+		"category_source":        domain.CategorySourceTransfer,
+		"override":               domain.CategorySourceOverride,
+	})
+	return err
+}
+
+func (c *Client) GetTransferPairs(ctx context.Context, clientID string, from, to time.Time) ([]*domain.TransferPair, error) {
+	rows, err := c.conn(ctx).Query(ctx, `SELECT
+		transfer_id::text,
+		client_id,
+		debit_bank,
+		debit_account_id,
+		COALESCE(debit_account_id_bidx, ''),
+		debit_transaction_id,
+		credit_bank,
+		credit_account_id,
+		COALESCE(credit_account_id_bidx, ''),
+		credit_transaction_id,
+		amount::text,
+		currency,
+		debit_booked_at,
+		credit_booked_at,
+		matched_by,
+		created_at
+		FROM transfer_pairs
+		WHERE client_id = @client_id
+		AND (@from::timestamptz IS NULL OR debit_booked_at >= @from)
+		AND (@to::timestamptz IS NULL OR debit_booked_at < @to)
+		ORDER BY debit_booked_at DESC, transfer_id`, pgx.NamedArgs{
+		"client_id": clientID,
+		"from":      nullTime(from),
+		"to":        nullTime(to),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pairs := make([]*domain.TransferPair, 0)
+	for rows.Next() {
+		var (
+			pair                    domain.TransferPair
+			debitIndex, creditIndex string
+		)
+		if err = rows.Scan(
+			&pair.TransferID,
+			&pair.ClientID,
+			&pair.DebitBank,
+			&pair.DebitAccountID,
+			&debitIndex,
+			&pair.DebitTransactionID,
+			&pair.CreditBank,
+			&pair.CreditAccountID,
+			&creditIndex,
+			&pair.CreditTransactionID,
+			&pair.Amount,
+			&pair.Currency,
+			&pair.DebitBookedAt,
+			&pair.CreditBookedAt,
+			&pair.MatchedBy,
+			&pair.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		f := c.fields()
+		f.openAccount(&pair.DebitAccountID, pair.ClientID, pair.DebitBank, debitIndex)
+		f.openAccount(&pair.CreditAccountID, pair.ClientID, pair.CreditBank, creditIndex)
+		if f.err != nil {
+			return nil, f.err
+		}
+		pairs = append(pairs, &pair)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return pairs, nil
+}
@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+const defaultTxMaxRetries = 3
+
+type txKey struct{}
+
+// querier is the subset of pgx API shared by the pool and transactions,
+// so repository methods run inside the caller's unit of work when there is one.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+type txBeginner interface {
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+}
+
+func (c *Client) conn(ctx context.Context) querier {
+	if tx, ok := txFromContext(ctx); ok {
+		return tx
+	}
+	return c.pool
+}
+
+func txFromContext(ctx context.Context) (pgx.Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(pgx.Tx)
+	return tx, ok
+}
+
+// InTx runs f as a single unit of work with the default isolation level.
+func (c *Client) InTx(ctx context.Context, f func(ctx context.Context) error) error {
+	return c.InTxWithOpts(ctx, f, pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+}
+
+// InTxWithOpts runs f inside a transaction carried in the context passed to f.
+// When ctx already holds a transaction, f runs inside a savepoint instead and
+// txOpts are ignored. Top-level transactions are retried on serialization
+// failures and deadlocks.
+func (c *Client) InTxWithOpts(ctx context.Context, f func(ctx context.Context) error, txOpts pgx.TxOptions) error {
+	if parent, ok := txFromContext(ctx); ok {
+		return c.runTx(ctx, f, func(ctx context.Context) (pgx.Tx, error) {
+			return parent.Begin(ctx)
+		})
+	}
+
+	maxRetries := c.cfg.TxMaxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultTxMaxRetries
+	}
+	var err error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		err = c.runTx(ctx, f, func(ctx context.Context) (pgx.Tx, error) {
+			return c.beginner.BeginTx(ctx, txOpts)
+		})
+		if !isRetryable(err) {
+			return err
+		}
+		c.log.Warn("retrying transaction", zap.Int("attempt", attempt+1), zap.Error(err))
+	}
+	return err
+}
+
+func (c *Client) runTx(ctx context.Context, f func(ctx context.Context) error, begin func(ctx context.Context) (pgx.Tx, error)) error {
+	tx, err := begin(ctx)
+	if err != nil {
+		return err
+	}
+	if err = f(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		if rbErr := tx.Rollback(ctx); rbErr != nil && !errors.Is(rbErr, pgx.ErrTxClosed) {
+			c.log.Error(ErrFailedToRollback.Error(), zap.Error(rbErr))
+			return errors.Join(err, rbErr)
+		}
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == pgerrcode.SerializationFailure || pgErr.Code == pgerrcode.DeadlockDetected
+}
@@ -0,0 +1,203 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+// fakePool begins fakeTxs, recording what happens to them in events.
+type fakePool struct {
+	events []string
+	// commitErrs are returned by the commits of the transactions begun, in
+	// order.
+	commitErrs []error
+	begins     int
+}
+
+func (p *fakePool) BeginTx(context.Context, pgx.TxOptions) (pgx.Tx, error) {
+	p.begins++
+	tx := &fakeTx{pool: p, name: fmt.Sprintf("tx%d", p.begins)}
+	if len(p.commitErrs) > 0 {
+		tx.commitErr, p.commitErrs = p.commitErrs[0], p.commitErrs[1:]
+	}
+	p.events = append(p.events, "begin "+tx.name)
+	return tx, nil
+}
+
+// fakeTx is a transaction, or a savepoint within one, that only records
+// being begun, committed and rolled back.
+type fakeTx struct {
+	pgx.Tx
+	pool      *fakePool
+	name      string
+	commitErr error
+	closed    bool
+}
+
+func (tx *fakeTx) Begin(context.Context) (pgx.Tx, error) {
+	savepoint := &fakeTx{pool: tx.pool, name: tx.name + "/sp"}
+	tx.pool.events = append(tx.pool.events, "begin "+savepoint.name)
+	return savepoint, nil
+}
+
+func (tx *fakeTx) Commit(context.Context) error {
+	tx.pool.events = append(tx.pool.events, "commit "+tx.name)
+	tx.closed = true
+	return tx.commitErr
+}
+
+func (tx *fakeTx) Rollback(context.Context) error {
+	if tx.closed {
+		return pgx.ErrTxClosed
+	}
+	tx.pool.events = append(tx.pool.events, "rollback "+tx.name)
+	tx.closed = true
+	return nil
+}
+
+func newTxClient(pool *fakePool) *Client {
+	return &Client{log: zap.NewNop(), beginner: pool, cfg: &Config{TxMaxRetries: 2}}
+}
+
+var (
+	errSerialization = &pgconn.PgError{Code: pgerrcode.SerializationFailure}
+	errDeadlock      = &pgconn.PgError{Code: pgerrcode.DeadlockDetected}
+	errUnique        = &pgconn.PgError{Code: pgerrcode.UniqueViolation}
+)
+
+// failing returns a unit of work failing with errs on its first calls.
+func failing(errs ...error) func(ctx context.Context) error {
+	return func(context.Context) error {
+		if len(errs) == 0 {
+			return nil
+		}
+		err := errs[0]
+		errs = errs[1:]
+		return err
+	}
+}
+
+func TestInTxRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		f          func(ctx context.Context) error
+		commitErrs []error
+		wantErr    error
+		wantEvents []string
+	}{
+		{
+			name:       "commits",
+			f:          failing(),
+			wantEvents: []string{"begin tx1", "commit tx1"},
+		},
+		{
+			name:       "retries a serialization failure",
+			f:          failing(errSerialization),
+			wantEvents: []string{"begin tx1", "rollback tx1", "begin tx2", "commit tx2"},
+		},
+		{
+			name:       "retries a deadlock",
+			f:          failing(fmt.Errorf("save balance: %w", errDeadlock)),
+			wantEvents: []string{"begin tx1", "rollback tx1", "begin tx2", "commit tx2"},
+		},
+		{
+			name:       "retries a serialization failure on commit",
+			f:          failing(),
+			commitErrs: []error{errSerialization},
+			wantEvents: []string{"begin tx1", "commit tx1", "begin tx2", "commit tx2"},
+		},
+		{
+			name:    "gives up after the retries",
+			f:       failing(errSerialization, errDeadlock, errSerialization, errSerialization),
+			wantErr: errSerialization,
+			wantEvents: []string{
+				"begin tx1", "rollback tx1",
+				"begin tx2", "rollback tx2",
+				"begin tx3", "rollback tx3",
+			},
+		},
+		{
+			name:       "does not retry other errors",
+			f:          failing(errUnique),
+			wantErr:    errUnique,
+			wantEvents: []string{"begin tx1", "rollback tx1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := &fakePool{commitErrs: tt.commitErrs}
+			err := newTxClient(pool).InTx(context.Background(), tt.f)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("InTx = %v, want %v", err, tt.wantErr)
+			}
+			if !slices.Equal(pool.events, tt.wantEvents) {
+				t.Errorf("got %q, want %q", pool.events, tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestInTxNests(t *testing.T) {
+	errInner := errors.New("inner failed")
+	tests := []struct {
+		name string
+		// inner runs in the nested unit of work, outer decides what the
+		// outer one makes of its result.
+		inner      func(ctx context.Context) error
+		outer      func(err error) error
+		wantErr    error
+		wantEvents []string
+	}{
+		{
+			name:       "savepoint released with the transaction",
+			inner:      failing(),
+			outer:      func(err error) error { return err },
+			wantEvents: []string{"begin tx1", "begin tx1/sp", "commit tx1/sp", "commit tx1"},
+		},
+		{
+			name:       "failed savepoint rolled back alone",
+			inner:      failing(errInner),
+			outer:      func(error) error { return nil },
+			wantEvents: []string{"begin tx1", "begin tx1/sp", "rollback tx1/sp", "commit tx1"},
+		},
+		{
+			name:       "failed savepoint fails the transaction",
+			inner:      failing(errInner),
+			outer:      func(err error) error { return err },
+			wantErr:    errInner,
+			wantEvents: []string{"begin tx1", "begin tx1/sp", "rollback tx1/sp", "rollback tx1"},
+		},
+		{
+			name:  "serialization failure retries the whole transaction",
+			inner: failing(errSerialization),
+			outer: func(err error) error { return err },
+			wantEvents: []string{
+				"begin tx1", "begin tx1/sp", "rollback tx1/sp", "rollback tx1",
+				"begin tx2", "begin tx2/sp", "commit tx2/sp", "commit tx2",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := &fakePool{}
+			c := newTxClient(pool)
+			err := c.InTx(context.Background(), func(ctx context.Context) error {
+				return tt.outer(c.InTxWithOpts(ctx, tt.inner, pgx.TxOptions{IsoLevel: pgx.Serializable}))
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("InTx = %v, want %v", err, tt.wantErr)
+			}
+			if !slices.Equal(pool.events, tt.wantEvents) {
+				t.Errorf("got %q, want %q", pool.events, tt.wantEvents)
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+package storage
+
+const (
+	DriverPostgres = "postgres"
+	DriverMemory   = "memory"
+)
+
+type Config struct {
+	Driver string `json:"driver" yaml:"driver"`
+}
@@ -3,13 +3,18 @@ package accounts
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/internal/service/rates"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 )
 
+// revokeTimeout bounds revoking a consent that could not be saved.
+const revokeTimeout = 30 * time.Second
+
 type Service struct {
 	mu sync.Mutex
 
@@ -17,6 +22,14 @@ type Service struct {
 	consentSaver  ConsentSaver
 	accountSaver  AccountsSaver
 	accountGetter AccountsGetter
+	balanceGetter BalancesGetter
+	balanceSaver  BalancesSaver
+	storedBalance StoredBalanceGetter
+	accountLister AccountsLister
+	rates         RatesProvider
+	events        EventPublisher
+	uow           UnitOfWork
+	plans         PlanLimiter
 
 	log *zap.Logger
 }
@@ -28,6 +41,14 @@ type In struct {
 	ConsentSaver  ConsentSaver
 	AccountGetter AccountsGetter
 	AccountsSaver AccountsSaver
+	BalanceGetter BalancesGetter
+	BalanceSaver  BalancesSaver
+	StoredBalance StoredBalanceGetter
+	AccountLister AccountsLister
+	Rates         RatesProvider
+	Events        EventPublisher
+	UnitOfWork    UnitOfWork
+	Plans         PlanLimiter
 }
 
 func New(log *zap.Logger, params In) *Service {
@@ -36,11 +57,34 @@ func New(log *zap.Logger, params In) *Service {
 		consentPoster: params.ConsentPoster,
 		accountGetter: params.AccountGetter,
 		accountSaver:  params.AccountsSaver,
+		balanceGetter: params.BalanceGetter,
+		balanceSaver:  params.BalanceSaver,
+		storedBalance: params.StoredBalance,
+		accountLister: params.AccountLister,
+		rates:         params.Rates,
+		events:        params.Events,
+		uow:           params.UnitOfWork,
+		plans:         params.Plans,
 		log:           log,
 	}
 }
 
+// CreateAccountsConsents asks each bank for its consent, as long as the
+// plan of the client allows connecting the banks. The banks are checked
+// upfront, and again as each consent is saved, so that concurrent requests
+// cannot connect more banks than the plan allows together. A consent the bank
+// granted but that cannot be saved is revoked at the bank.
 func (s *Service) CreateAccountsConsents(ctx context.Context, consents map[string]*domain.AccountConsent) (map[string]*domain.AccountConsent, error) {
+	byClient := make(map[string][]string)
+	for providerName, consent := range consents {
+		byClient[consent.ClientID] = append(byClient[consent.ClientID], providerName)
+	}
+	for clientID, banks := range byClient {
+		if err := s.plans.CheckBanks(ctx, clientID, banks); err != nil {
+			return nil, err
+		}
+	}
+
 	eg, egCtx := errgroup.WithContext(ctx)
 	resMap := make(map[string]*domain.AccountConsent)
 
@@ -50,7 +94,26 @@ func (s *Service) CreateAccountsConsents(ctx context.Context, consents map[strin
 			if err != nil {
 				return err
 			}
-			if err := s.consentSaver.SaveConsent(egCtx, consent, providerName); err != nil {
+			err = s.uow.InTx(egCtx, func(ctx context.Context) error {
+				if err := s.plans.CheckBanks(ctx, consent.ClientID, []string{providerName}); err != nil {
+					return err
+				}
+				if err := s.consentSaver.SaveConsent(ctx, consent, providerName); err != nil {
+					return err
+				}
+				event, err := domain.NewEvent(domain.EventTypeConsentCreated, consent.ClientID, consent.ConsentID, domain.ConsentCreated{
+					ConsentID:   consent.ConsentID,
+					Bank:        providerName,
+					Status:      consent.Status,
+					Permissions: consent.Permissions,
+				})
+				if err != nil {
+					return err
+				}
+				return s.events.Publish(ctx, event)
+			})
+			if err != nil {
+				s.revoke(egCtx, consent)
 				return err
 			}
 			s.mu.Lock()
@@ -64,36 +127,150 @@ func (s *Service) CreateAccountsConsents(ctx context.Context, consents map[strin
 	if err != nil {
 		return nil, err
 	}
-
 	return resMap, nil
 }
 
+// revoke withdraws a consent that was granted at its bank but not saved, so
+// that it does not outlive the request. Failures are only logged.
+func (s *Service) revoke(ctx context.Context, consent *domain.AccountConsent) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), revokeTimeout)
+	defer cancel()
+	if err := s.consentPoster.RevokeConsent(ctx, consent); err != nil {
+		s.log.Error("failed to revoke unsaved consent",
+			zap.String("client_id", consent.ClientID),
+			zap.String("bank", consent.ConsentProvider),
+			zap.Error(err))
+	}
+}
+
+// AggregateAccounts fetches the accounts of the client from its banks and
+// stores them. It counts as a sync against the plan of the client.
 func (s *Service) AggregateAccounts(ctx context.Context, userID string) ([]*domain.Account, error) {
-	resAccounts, err := s.accountGetter.GetAccounts(ctx, userID)
+	var resAccounts []*domain.Account
+	err := s.plans.Sync(ctx, userID, func(ctx context.Context) error {
+		var err error
+		resAccounts, err = s.accountGetter.GetAccounts(ctx, userID)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	for _, account := range resAccounts {
-		if err = s.accountSaver.SaveAccount(ctx, account); err != nil {
-			return nil, err
+	err = s.uow.InTx(ctx, func(ctx context.Context) error {
+		known, err := s.accountLister.ListAccounts(ctx, userID)
+		if err != nil {
+			return err
+		}
+		knownKeys := make(map[[2]string]struct{}, len(known))
+		for _, account := range known {
+			knownKeys[[2]string{account.Bank, account.AccountID}] = struct{}{}
+		}
+		for _, account := range resAccounts {
+			if err := s.accountSaver.SaveAccount(ctx, account); err != nil {
+				return err
+			}
+			if _, ok := knownKeys[[2]string{account.Bank, account.AccountID}]; ok {
+				continue
+			}
+			event, err := domain.NewEvent(domain.EventTypeAccountDiscovered, userID, account.AccountID, domain.AccountDiscovered{
+				AccountID:   account.AccountID,
+				Bank:        account.Bank,
+				Currency:    account.Currency,
+				AccountType: account.AccountType,
+			})
+			if err != nil {
+				return err
+			}
+			if err := s.events.Publish(ctx, event); err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return resAccounts, nil
 }
 
+// SetConsentStatus moves consent to status and records the change.
+func (s *Service) SetConsentStatus(ctx context.Context, consent *domain.AccountConsent, status string) error {
+	if consent.Status == status {
+		return nil
+	}
+	previous := consent.Status
+	consent.Status = status
+	return s.uow.InTx(ctx, func(ctx context.Context) error {
+		if err := s.consentSaver.UpdateConsent(ctx, consent, consent.ConsentProvider); err != nil {
+			return err
+		}
+		event, err := domain.NewEvent(domain.EventTypeConsentStatusChanged, consent.ClientID, consent.ConsentID, domain.ConsentStatusChanged{
+			ConsentID:      consent.ConsentID,
+			Bank:           consent.ConsentProvider,
+			PreviousStatus: previous,
+			Status:         status,
+		})
+		if err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, event)
+	})
+}
+
+// UnitOfWork groups repository calls made with the ctx passed to f into a single atomic change.
+type UnitOfWork interface {
+	InTx(ctx context.Context, f func(ctx context.Context) error) error
+}
+
+// EventPublisher writes domain events within the unit of work of ctx.
+type EventPublisher interface {
+	Publish(ctx context.Context, events ...*domain.Event) error
+}
+
+// PlanLimiter checks connecting and syncing banks against the plan of the client.
+type PlanLimiter interface {
+	CheckBanks(ctx context.Context, clientID string, banks []string) error
+	Sync(ctx context.Context, clientID string, f func(ctx context.Context) error) error
+}
+
 type ConsentSaver interface {
 	SaveConsent(ctx context.Context, consent *domain.AccountConsent, consentProvider string) error
+	UpdateConsent(ctx context.Context, consent *domain.AccountConsent, consentProvider string) error
 }
 
+// ConsentPoster asks the banks for consents and withdraws them.
 type ConsentPoster interface {
 	PostConsent(ctx context.Context, consent domain.AccountConsent, providerName string) (*domain.AccountConsent, error)
+	RevokeConsent(ctx context.Context, consent *domain.AccountConsent) error
 }
 
 type AccountsSaver interface {
 	SaveAccount(ctx context.Context, accounts *domain.Account) error
 }
 
+type AccountsLister interface {
+	ListAccounts(ctx context.Context, clientID string) ([]*domain.Account, error)
+}
+
 type AccountsGetter interface {
 	GetAccounts(ctx context.Context, clientID string) ([]*domain.Account, error)
 }
+
+type BalancesGetter interface {
+	GetBalances(ctx context.Context, clientID string, accounts []*domain.Account) ([]*domain.Balance, error)
+}
+
+type BalancesSaver interface {
+	SaveBalance(ctx context.Context, balance *domain.Balance) error
+}
+
+// StoredBalanceGetter returns the stored balance of an account of the most
+// preferred type.
+type StoredBalanceGetter interface {
+	GetBalance(ctx context.Context, clientID, bank, accountID string) (*domain.Balance, error)
+}
+
+type RatesProvider interface {
+	Table(ctx context.Context, date time.Time) (*rates.Table, error)
+	DefaultCurrency() string
+}
@@ -0,0 +1,146 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/internal/service/rates"
+	"github.com/MichaelSBoop/lima-backend/pkg/money"
+	"go.uber.org/zap"
+)
+
+// Totals aggregates the accounts of the client with their balances converted
+// into currency. When the plan of the client refuses the sync, the totals are
+// made of the accounts and balances stored by the last one, so that reading
+// them does not use up the syncs of the plan.
+func (s *Service) Totals(ctx context.Context, clientID, currency string) (*domain.Totals, error) {
+	if currency == "" {
+		currency = s.rates.DefaultCurrency()
+	}
+	currency = strings.ToUpper(currency)
+
+	resAccounts, balances, err := s.SyncBalances(ctx, clientID)
+	if errors.Is(err, domain.ErrPlanLimit) {
+		s.log.Debug("totals served from stored balances", zap.String("client_id", clientID), zap.Error(err))
+		resAccounts, balances, err = s.storedBalances(ctx, clientID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	table, err := s.rates.Table(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	byAccount := preferredBalances(balances)
+	total := money.Zero()
+	res := &domain.Totals{
+		ClientID: clientID,
+		Currency: currency,
+		Date:     now,
+		Accounts: make([]*domain.AccountTotal, 0, len(resAccounts)),
+	}
+	for _, account := range resAccounts {
+		accountTotal := &domain.AccountTotal{Account: account}
+		res.Accounts = append(res.Accounts, accountTotal)
+		balance, ok := byAccount[[2]string{account.Bank, account.AccountID}]
+		if !ok {
+			continue
+		}
+		accountTotal.Balance = balance
+		amount, err := money.Parse(balance.Amount)
+		if err != nil {
+			return nil, err
+		}
+		converted, err := table.Convert(amount, balance.Currency, currency)
+		if errors.Is(err, rates.ErrNoRate) {
+			s.log.Warn("account balance left out of totals", zap.String("account_id", account.AccountID), zap.Error(err))
+			res.Unpriced = append(res.Unpriced, domain.AccountRef{Bank: account.Bank, AccountID: account.AccountID})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		accountTotal.Converted = money.Format(converted)
+		total.Add(total, converted)
+	}
+	res.Total = money.Format(total)
+	res.Rates = table.Used()
+	return res, nil
+}
+
+// SyncBalances aggregates the accounts of the client and stores their
+// current balances. It counts as a single sync against the plan of the client.
+func (s *Service) SyncBalances(ctx context.Context, clientID string) ([]*domain.Account, []*domain.Balance, error) {
+	var resAccounts []*domain.Account
+	var balances []*domain.Balance
+	err := s.plans.Sync(ctx, clientID, func(ctx context.Context) error {
+		var err error
+		if resAccounts, err = s.AggregateAccounts(ctx, clientID); err != nil {
+			return err
+		}
+		balances, err = s.balanceGetter.GetBalances(ctx, clientID, resAccounts)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	err = s.uow.InTx(ctx, func(ctx context.Context) error {
+		for _, balance := range balances {
+			if err := s.balanceSaver.SaveBalance(ctx, balance); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return resAccounts, balances, nil
+}
+
+// storedBalances returns the stored accounts of the client with their stored
+// balances. Accounts without a stored balance are returned without one.
+func (s *Service) storedBalances(ctx context.Context, clientID string) ([]*domain.Account, []*domain.Balance, error) {
+	resAccounts, err := s.accountLister.ListAccounts(ctx, clientID)
+	if err != nil {
+		return nil, nil, err
+	}
+	balances := make([]*domain.Balance, 0, len(resAccounts))
+	for _, account := range resAccounts {
+		balance, err := s.storedBalance.GetBalance(ctx, clientID, account.Bank, account.AccountID)
+		if errors.Is(err, domain.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		balances = append(balances, balance)
+	}
+	return resAccounts, balances, nil
+}
+
+// preferredBalances picks the balance of the most preferred type of each
+// account, keyed by the bank and ID of the account.
+func preferredBalances(balances []*domain.Balance) map[[2]string]*domain.Balance {
+	rank := func(t string) int {
+		for i, bt := range domain.BalanceTypes {
+			if strings.EqualFold(bt, t) {
+				return i
+			}
+		}
+		return len(domain.BalanceTypes)
+	}
+	res := make(map[[2]string]*domain.Balance)
+	for _, balance := range balances {
+		k := [2]string{balance.Bank, balance.AccountID}
+		if current, ok := res[k]; !ok || rank(balance.Type) < rank(current.Type) {
+			res[k] = balance
+		}
+	}
+	return res
+}
@@ -0,0 +1,11 @@
+package analytics
+
+import "time"
+
+type Config struct {
+	// HistoryDays is how far back transactions are synced and snapshots kept.
+	HistoryDays int `json:"history_days" yaml:"history_days"`
+	// RefreshInterval is how often snapshots of every client are rebuilt in
+	// the background. Zero disables the background refresh.
+	RefreshInterval time.Duration `json:"refresh_interval" yaml:"refresh_interval"`
+}
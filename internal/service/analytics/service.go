@@ -0,0 +1,448 @@
+package analytics
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/internal/service/rates"
+	"github.com/MichaelSBoop/lima-backend/pkg/money"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultHistoryDays = 90
+	defaultRangeDays   = 30
+	refreshTimeout     = 5 * time.Minute
+)
+
+var (
+	ErrInvalidPeriod = errors.New("invalid period")
+	ErrInvalidRange  = errors.New("invalid date range")
+)
+
+type Service struct {
+	cfg          Config
+	accounts     BalancesSyncer
+	transactions TransactionsSyncer
+	store        Store
+	rates        RatesProvider
+	notifier     Notifier
+	plans        SyncLimiter
+	log          *zap.Logger
+
+	mu        sync.Mutex
+	refreshed map[string]struct{}
+}
+
+type In struct {
+	fx.In
+
+	Config       Config
+	Accounts     BalancesSyncer
+	Transactions TransactionsSyncer
+	Store        Store
+	Rates        RatesProvider
+	Notifier     Notifier
+	Plans        SyncLimiter
+}
+
+func New(log *zap.Logger, lc fx.Lifecycle, params In) *Service {
+	cfg := params.Config
+	if cfg.HistoryDays <= 0 {
+		cfg.HistoryDays = defaultHistoryDays
+	}
+	s := &Service{
+		cfg:          cfg,
+		accounts:     params.Accounts,
+		transactions: params.Transactions,
+		store:        params.Store,
+		rates:        params.Rates,
+		notifier:     params.Notifier,
+		plans:        params.Plans,
+		log:          log,
+		refreshed:    make(map[string]struct{}),
+	}
+	if cfg.RefreshInterval > 0 {
+		stop := make(chan struct{})
+		lc.Append(fx.Hook{
+			OnStart: func(ctx context.Context) error {
+				go s.refreshLoop(stop)
+				return nil
+			},
+			OnStop: func(ctx context.Context) error {
+				close(stop)
+				return nil
+			},
+		})
+	}
+	return s
+}
+
+// Refresh syncs balances and transactions of the client and rebuilds its
+// daily snapshots over the history window, as often as the plan of the
+// client allows syncs.
+func (s *Service) Refresh(ctx context.Context, clientID string) error {
+	today := truncateDay(time.Now())
+	from := today.AddDate(0, 0, -s.cfg.HistoryDays)
+	err := s.plans.Sync(ctx, clientID, func(ctx context.Context) error {
+		accounts, _, err := s.accounts.SyncBalances(ctx, clientID)
+		if err != nil {
+			return err
+		}
+		if _, err = s.transactions.Sync(ctx, clientID, accounts, from); err != nil {
+			return err
+		}
+		return s.store.RefreshSnapshots(ctx, clientID, from, today)
+	})
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.refreshed[clientID] = struct{}{}
+	s.mu.Unlock()
+	return nil
+}
+
+// NetWorth returns the daily net worth of the client across all connected
+// banks within [from, to], converted into currency at the rates of to.
+func (s *Service) NetWorth(ctx context.Context, clientID string, from, to time.Time, currency string) (*domain.NetWorth, error) {
+	from, to, err := normalizeRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+	currency = s.currency(currency)
+	snapshots, err := s.snapshots(ctx, clientID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	table, err := s.rates.Table(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &domain.NetWorth{
+		ClientID: clientID,
+		Currency: currency,
+		From:     from,
+		To:       to,
+		Points:   make([]*domain.NetWorthPoint, 0),
+		Accounts: make([]*domain.AccountNetWorth, 0),
+	}
+	byDate := make(map[time.Time]*big.Rat)
+	byAccount := make(map[[2]string]*domain.AccountNetWorth)
+	unpriced := make(map[domain.AccountRef]struct{})
+	for _, snap := range snapshots {
+		key := [2]string{snap.Bank, snap.AccountID}
+		account, ok := byAccount[key]
+		if !ok {
+			account = &domain.AccountNetWorth{
+				AccountID: snap.AccountID,
+				Bank:      snap.Bank,
+				Currency:  snap.Currency,
+			}
+			byAccount[key] = account
+			res.Accounts = append(res.Accounts, account)
+		}
+		point := &domain.AccountNetWorthPoint{Date: snap.Date, Balance: snap.Balance}
+		account.Points = append(account.Points, point)
+
+		total, ok := byDate[snap.Date]
+		if !ok {
+			total = money.Zero()
+			byDate[snap.Date] = total
+		}
+		converted, err := s.convert(table, snap.Balance, snap.Currency, currency)
+		if errors.Is(err, rates.ErrNoRate) {
+			unpriced[domain.AccountRef{Bank: snap.Bank, AccountID: snap.AccountID}] = struct{}{}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		point.Converted = money.Format(converted)
+		total.Add(total, converted)
+	}
+	for _, date := range sortedDates(byDate) {
+		res.Points = append(res.Points, &domain.NetWorthPoint{Date: date, Value: money.Format(byDate[date])})
+	}
+	res.Unpriced = sortedRefs(unpriced)
+	res.Rates = table.Used()
+	return res, nil
+}
+
+// Cashflow returns income and spending of the client per period within
+// [from, to], converted into currency at the rates of to, together with the
+// totals of every account in its own currency.
+func (s *Service) Cashflow(ctx context.Context, clientID string, from, to time.Time, period, currency string) (*domain.Cashflow, error) {
+	if period == "" {
+		period = domain.PeriodMonth
+	}
+	if !slices.Contains([]string{domain.PeriodDay, domain.PeriodWeek, domain.PeriodMonth}, period) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPeriod, period)
+	}
+	from, to, err := normalizeRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+	currency = s.currency(currency)
+	snapshots, err := s.snapshots(ctx, clientID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	table, err := s.rates.Table(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+
+	type flow struct{ income, spending *big.Rat }
+	newFlow := func() *flow { return &flow{income: money.Zero(), spending: money.Zero()} }
+	byPeriod := make(map[time.Time]*flow)
+	byAccount := make(map[[2]string]*flow)
+	res := &domain.Cashflow{
+		ClientID: clientID,
+		Currency: currency,
+		Period:   period,
+		From:     from,
+		To:       to,
+		Periods:  make([]*domain.CashflowPeriod, 0),
+		Accounts: make([]*domain.AccountCashflow, 0),
+	}
+	accounts := make(map[[2]string]*domain.AccountCashflow)
+	unpriced := make(map[domain.AccountRef]struct{})
+	for _, snap := range snapshots {
+		income, err := money.Parse(snap.Income)
+		if err != nil {
+			return nil, err
+		}
+		spending, err := money.Parse(snap.Spending)
+		if err != nil {
+			return nil, err
+		}
+		key := [2]string{snap.Bank, snap.AccountID}
+		if _, ok := accounts[key]; !ok {
+			accounts[key] = &domain.AccountCashflow{
+				AccountID: snap.AccountID,
+				Bank:      snap.Bank,
+				Currency:  snap.Currency,
+			}
+			res.Accounts = append(res.Accounts, accounts[key])
+			byAccount[key] = newFlow()
+		}
+		acc := byAccount[key]
+		acc.income.Add(acc.income, income)
+		acc.spending.Add(acc.spending, spending)
+
+		start := periodStart(snap.Date, period)
+		p, ok := byPeriod[start]
+		if !ok {
+			p = newFlow()
+			byPeriod[start] = p
+		}
+		convIncome, err := table.Convert(income, snap.Currency, currency)
+		if errors.Is(err, rates.ErrNoRate) {
+			unpriced[domain.AccountRef{Bank: snap.Bank, AccountID: snap.AccountID}] = struct{}{}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		convSpending, err := table.Convert(spending, snap.Currency, currency)
+		if err != nil {
+			return nil, err
+		}
+		p.income.Add(p.income, convIncome)
+		p.spending.Add(p.spending, convSpending)
+	}
+	for _, account := range res.Accounts {
+		f := byAccount[[2]string{account.Bank, account.AccountID}]
+		account.Income = money.Format(f.income)
+		account.Spending = money.Format(f.spending)
+		account.Net = money.Format(new(big.Rat).Sub(f.income, f.spending))
+	}
+	for _, start := range sortedDates(byPeriod) {
+		f := byPeriod[start]
+		res.Periods = append(res.Periods, &domain.CashflowPeriod{
+			Start:    start,
+			Income:   money.Format(f.income),
+			Spending: money.Format(f.spending),
+			Net:      money.Format(new(big.Rat).Sub(f.income, f.spending)),
+		})
+	}
+	res.Unpriced = sortedRefs(unpriced)
+	res.Rates = table.Used()
+	return res, nil
+}
+
+// snapshots reads the stored snapshots, building them first if the client has
+// not been refreshed yet and nothing is stored.
+func (s *Service) snapshots(ctx context.Context, clientID string, from, to time.Time) ([]*domain.AccountSnapshot, error) {
+	snapshots, err := s.store.GetSnapshots(ctx, clientID, from, to)
+	if err != nil || len(snapshots) > 0 {
+		return snapshots, err
+	}
+	s.mu.Lock()
+	_, ok := s.refreshed[clientID]
+	s.mu.Unlock()
+	if ok {
+		return snapshots, nil
+	}
+	if err = s.Refresh(ctx, clientID); err != nil {
+		return nil, err
+	}
+	return s.store.GetSnapshots(ctx, clientID, from, to)
+}
+
+func (s *Service) currency(currency string) string {
+	if currency == "" {
+		currency = s.rates.DefaultCurrency()
+	}
+	return strings.ToUpper(currency)
+}
+
+func (s *Service) convert(table *rates.Table, amount, from, to string) (*big.Rat, error) {
+	v, err := money.Parse(amount)
+	if err != nil {
+		return nil, err
+	}
+	return table.Convert(v, from, to)
+}
+
+func (s *Service) refreshLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(s.cfg.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		s.refreshAll()
+	}
+}
+
+func (s *Service) refreshAll() {
+	ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+	defer cancel()
+	clientIDs, err := s.store.ClientIDs(ctx)
+	if err != nil {
+		s.log.Warn("failed to list clients for analytics refresh", zap.Error(err))
+		return
+	}
+	for _, clientID := range clientIDs {
+		// Clients synced sooner than their plan allows are left for later.
+		err := s.Refresh(ctx, clientID)
+		if err != nil && !errors.Is(err, domain.ErrPlanLimit) {
+			s.log.Warn("failed to refresh analytics", zap.String("client_id", clientID), zap.Error(err))
+			s.notifySyncFailed(ctx, clientID, err)
+		}
+	}
+}
+
+// notifySyncFailed tells the client that a background sync of their accounts failed.
+func (s *Service) notifySyncFailed(ctx context.Context, clientID string, syncErr error) {
+	data := map[string]string{"error": syncErr.Error()}
+	var bankErr *domain.BankError
+	if errors.As(syncErr, &bankErr) {
+		data["bank"] = bankErr.Bank
+	}
+	err := s.notifier.Notify(ctx, &domain.Notification{
+		ClientID: clientID,
+		Event:    domain.EventSyncFailed,
+		Data:     data,
+	})
+	if err != nil {
+		s.log.Warn("failed to notify about failed sync", zap.String("client_id", clientID), zap.Error(err))
+	}
+}
+
+func normalizeRange(from, to time.Time) (time.Time, time.Time, error) {
+	if to.IsZero() {
+		to = time.Now()
+	}
+	to = truncateDay(to)
+	if from.IsZero() {
+		from = to.AddDate(0, 0, -(defaultRangeDays - 1))
+	}
+	from = truncateDay(from)
+	if from.After(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: from is after to", ErrInvalidRange)
+	}
+	return from, to, nil
+}
+
+func periodStart(date time.Time, period string) time.Time {
+	switch period {
+	case domain.PeriodWeek:
+		// Weeks start on Monday.
+		return date.AddDate(0, 0, -((int(date.Weekday()) + 6) % 7))
+	case domain.PeriodMonth:
+		return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return date
+	}
+}
+
+func truncateDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func sortedDates[V any](m map[time.Time]V) []time.Time {
+	dates := make([]time.Time, 0, len(m))
+	for date := range m {
+		dates = append(dates, date)
+	}
+	slices.SortFunc(dates, func(a, b time.Time) int { return a.Compare(b) })
+	return dates
+}
+
+func sortedRefs(m map[domain.AccountRef]struct{}) []domain.AccountRef {
+	refs := make([]domain.AccountRef, 0, len(m))
+	for ref := range m {
+		refs = append(refs, ref)
+	}
+	slices.SortFunc(refs, func(a, b domain.AccountRef) int {
+		return cmp.Or(cmp.Compare(a.Bank, b.Bank), cmp.Compare(a.AccountID, b.AccountID))
+	})
+	return refs
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, n *domain.Notification) error
+}
+
+// SyncLimiter runs syncs with the banks as often as the plan of the client allows.
+type SyncLimiter interface {
+	Sync(ctx context.Context, clientID string, f func(ctx context.Context) error) error
+}
+
+type BalancesSyncer interface {
+	SyncBalances(ctx context.Context, clientID string) ([]*domain.Account, []*domain.Balance, error)
+}
+
+type TransactionsSyncer interface {
+	Sync(ctx context.Context, clientID string, accounts []*domain.Account, from time.Time) ([]*domain.Transaction, error)
+}
+
+type RatesProvider interface {
+	Table(ctx context.Context, date time.Time) (*rates.Table, error)
+	DefaultCurrency() string
+}
+
+type Store interface {
+	// RefreshSnapshots rebuilds the daily snapshots of the client's accounts
+	// within [from, to] from their stored balances and transactions.
+	RefreshSnapshots(ctx context.Context, clientID string, from, to time.Time) error
+	GetSnapshots(ctx context.Context, clientID string, from, to time.Time) ([]*domain.AccountSnapshot, error)
+	// ClientIDs lists the clients with at least one consent.
+	ClientIDs(ctx context.Context) ([]string, error)
+}
@@ -0,0 +1,236 @@
+package analytics_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/internal/infra/memory"
+	"github.com/MichaelSBoop/lima-backend/internal/service/analytics"
+	"github.com/MichaelSBoop/lima-backend/internal/service/rates"
+	"github.com/MichaelSBoop/lima-backend/pkg/money"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+// syncer leaves the stored accounts and transactions as they are.
+type syncer struct{ syncs int }
+
+func (s *syncer) SyncBalances(context.Context, string) ([]*domain.Account, []*domain.Balance, error) {
+	s.syncs++
+	return nil, nil, nil
+}
+
+func (s *syncer) Sync(context.Context, string, []*domain.Account, time.Time) ([]*domain.Transaction, error) {
+	return nil, nil
+}
+
+type ratesProvider struct{}
+
+func (ratesProvider) Table(context.Context, time.Time) (*rates.Table, error) {
+	return rates.NewTable("RUB", []*domain.ExchangeRate{{Currency: "USD", BaseCurrency: "RUB", Rate: "90"}}), nil
+}
+
+func (ratesProvider) DefaultCurrency() string { return "RUB" }
+
+type unlimited struct{}
+
+func (unlimited) Sync(ctx context.Context, _ string, f func(ctx context.Context) error) error {
+	return f(ctx)
+}
+
+type discardNotifications struct{}
+
+func (discardNotifications) Notify(context.Context, *domain.Notification) error { return nil }
+
+// today is the day snapshots are built up to.
+var today = time.Now().UTC().Truncate(24 * time.Hour)
+
+// newService returns the service over a store with the accounts of c1:
+//
+//   - vbank/a1, 1000.00 RUB, with a salary two days ago, then spending and a
+//     transfer to abank/a2 yesterday;
+//   - abank/a2, 300.00 RUB, with the other leg of the transfer;
+//   - vbank/u1, 10.00 USD, without transactions;
+//   - vbank/e1, 50.00 EUR, which has no rate.
+func newService(t *testing.T) (*analytics.Service, *syncer) {
+	t.Helper()
+	ctx := context.Background()
+	store := memory.New(zap.NewNop())
+	for _, b := range []struct{ bank, accountID, currency, balance string }{
+		{"vbank", "a1", "RUB", "1000.00"},
+		{"abank", "a2", "RUB", "300.00"},
+		{"vbank", "u1", "USD", "10.00"},
+		{"vbank", "e1", "EUR", "50.00"},
+	} {
+		if err := store.SaveAccount(ctx, &domain.Account{ClientID: "c1", Bank: b.bank, AccountID: b.accountID, Currency: b.currency}); err != nil {
+			t.Fatal(err)
+		}
+		balance := &domain.Balance{ClientID: "c1", Bank: b.bank, AccountID: b.accountID, Type: "InterimAvailable", Amount: b.balance, Currency: b.currency}
+		if err := store.SaveBalance(ctx, balance); err != nil {
+			t.Fatal(err)
+		}
+	}
+	yesterday := today.AddDate(0, 0, -1).Add(12 * time.Hour)
+	for _, tx := range []*domain.Transaction{
+		{Bank: "vbank", AccountID: "a1", TransactionID: "salary", Amount: "500.00", BookedAt: today.AddDate(0, 0, -2).Add(9 * time.Hour)},
+		{Bank: "vbank", AccountID: "a1", TransactionID: "groceries", Amount: "-200.00", BookedAt: yesterday},
+		{Bank: "vbank", AccountID: "a1", TransactionID: "transfer-out", Amount: "-100.00", BookedAt: yesterday, TransferID: "transfer-1"},
+		{Bank: "abank", AccountID: "a2", TransactionID: "transfer-in", Amount: "100.00", BookedAt: yesterday, TransferID: "transfer-1"},
+		{Bank: "vbank", AccountID: "a1", TransactionID: "pending", Amount: "-999.00", BookedAt: yesterday, Status: domain.TransactionStatusPending},
+	} {
+		tx.ClientID, tx.Currency = "c1", "RUB"
+		if tx.Status == "" {
+			tx.Status = domain.TransactionStatusBooked
+		}
+		if err := store.SaveTransaction(ctx, tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sync := &syncer{}
+	s := analytics.New(zap.NewNop(), fxtest.NewLifecycle(t), analytics.In{
+		Accounts:     sync,
+		Transactions: sync,
+		Store:        store,
+		Rates:        ratesProvider{},
+		Notifier:     discardNotifications{},
+		Plans:        unlimited{},
+	})
+	return s, sync
+}
+
+func TestNetWorth(t *testing.T) {
+	s, sync := newService(t)
+	ctx := context.Background()
+	res, err := s.NetWorth(ctx, "c1", today.AddDate(0, 0, -3), today, "")
+	if err != nil {
+		t.Fatalf("NetWorth: %v", err)
+	}
+	if sync.syncs != 1 {
+		t.Errorf("synced %d times before the first read, want once", sync.syncs)
+	}
+
+	// a1 is 800 before the salary, 1300 after it and 1000 after yesterday;
+	// a2 is 200 until the transfer; u1 is worth 900 RUB.
+	want := []string{"1900.00", "2400.00", "2200.00", "2200.00"}
+	got := make([]string, 0, len(res.Points))
+	for i, point := range res.Points {
+		if !point.Date.Equal(today.AddDate(0, 0, i-3)) {
+			t.Errorf("point %d is on %v", i, point.Date)
+		}
+		got = append(got, point.Value)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got net worth %q, want %q", got, want)
+	}
+	if res.Currency != "RUB" || len(res.Accounts) != 4 {
+		t.Errorf("got %s over %d accounts, want RUB over 4", res.Currency, len(res.Accounts))
+	}
+	for _, account := range res.Accounts {
+		if account.AccountID != "u1" {
+			continue
+		}
+		if last := account.Points[len(account.Points)-1]; last.Balance != "10.00" || last.Converted != "900.00" {
+			t.Errorf("got u1 at %s worth %s, want 10.00 worth 900.00", last.Balance, last.Converted)
+		}
+	}
+	if want := []domain.AccountRef{{Bank: "vbank", AccountID: "e1"}}; !slices.Equal(res.Unpriced, want) {
+		t.Errorf("got unpriced %v, want %v", res.Unpriced, want)
+	}
+	if len(res.Rates) != 1 || res.Rates[0].Currency != "USD" {
+		t.Errorf("got rates %+v, want the USD rate", res.Rates)
+	}
+
+	// Snapshots are read back without syncing again.
+	if _, err = s.NetWorth(ctx, "c1", today.AddDate(0, 0, -3), today, "usd"); err != nil {
+		t.Fatalf("NetWorth: %v", err)
+	}
+	if sync.syncs != 1 {
+		t.Errorf("synced %d times, want once", sync.syncs)
+	}
+}
+
+func TestCashflow(t *testing.T) {
+	s, _ := newService(t)
+	ctx := context.Background()
+	from := today.AddDate(0, 0, -3)
+	res, err := s.Cashflow(ctx, "c1", from, today, domain.PeriodDay, "")
+	if err != nil {
+		t.Fatalf("Cashflow: %v", err)
+	}
+	// The transfer between own accounts is neither income nor spending, the
+	// pending transaction is not counted yet.
+	want := [][3]string{
+		{"0.00", "0.00", "0.00"},
+		{"500.00", "0.00", "500.00"},
+		{"0.00", "200.00", "-200.00"},
+		{"0.00", "0.00", "0.00"},
+	}
+	got := make([][3]string, 0, len(res.Periods))
+	for i, p := range res.Periods {
+		if !p.Start.Equal(from.AddDate(0, 0, i)) {
+			t.Errorf("period %d starts on %v", i, p.Start)
+		}
+		got = append(got, [3]string{p.Income, p.Spending, p.Net})
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got daily cash flow %q, want %q", got, want)
+	}
+	for _, account := range res.Accounts {
+		want := [3]string{"0.00", "0.00", "0.00"}
+		if account.AccountID == "a1" {
+			want = [3]string{"500.00", "200.00", "300.00"}
+		}
+		if got := [3]string{account.Income, account.Spending, account.Net}; got != want {
+			t.Errorf("got %s/%s at %q, want %q", account.Bank, account.AccountID, got, want)
+		}
+	}
+
+	// Periods are months by default, the four days may span two of them.
+	res, err = s.Cashflow(ctx, "c1", from, today, "", "")
+	if err != nil {
+		t.Fatalf("Cashflow: %v", err)
+	}
+	months := 1
+	if from.Month() != today.Month() {
+		months = 2
+	}
+	if res.Period != domain.PeriodMonth || len(res.Periods) != months {
+		t.Fatalf("got %d periods of a %s, want %d months", len(res.Periods), res.Period, months)
+	}
+	income, spending := money.Zero(), money.Zero()
+	for _, p := range res.Periods {
+		if p.Start.Day() != 1 {
+			t.Errorf("month starts on %v", p.Start)
+		}
+		for _, sum := range []struct {
+			total *big.Rat
+			v     string
+		}{{income, p.Income}, {spending, p.Spending}} {
+			amount, err := money.Parse(sum.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sum.total.Add(sum.total, amount)
+		}
+	}
+	if got := [2]string{money.Format(income), money.Format(spending)}; got != [2]string{"500.00", "200.00"} {
+		t.Errorf("got monthly income and spending %q, want 500.00 and 200.00", got)
+	}
+}
+
+func TestAnalyticsRejectInvalidInput(t *testing.T) {
+	s, _ := newService(t)
+	ctx := context.Background()
+	if _, err := s.Cashflow(ctx, "c1", time.Time{}, time.Time{}, "year", ""); !errors.Is(err, analytics.ErrInvalidPeriod) {
+		t.Errorf("Cashflow per year = %v, want %v", err, analytics.ErrInvalidPeriod)
+	}
+	if _, err := s.NetWorth(ctx, "c1", today, today.AddDate(0, 0, -1), ""); !errors.Is(err, analytics.ErrInvalidRange) {
+		t.Errorf("NetWorth from after to = %v, want %v", err, analytics.ErrInvalidRange)
+	}
+}
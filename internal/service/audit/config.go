@@ -0,0 +1,16 @@
+package audit
+
+import "time"
+
+type Config struct {
+	// QueueSize is how many entries may wait to be written. Recording an
+	// entry while the queue is full waits for room.
+	QueueSize int `json:"queue_size" yaml:"queue_size"`
+	// QueueWait is how long recording waits for room in a full queue before
+	// the action to audit is refused.
+	QueueWait time.Duration `json:"queue_wait" yaml:"queue_wait"`
+	BatchSize int           `json:"batch_size" yaml:"batch_size"`
+	// RetryInterval is the delay before writing a batch again after a
+	// failure. A batch is retried until it is written.
+	RetryInterval time.Duration `json:"retry_interval" yaml:"retry_interval"`
+}
@@ -0,0 +1,17 @@
+package audit
+
+import "context"
+
+type requestIDKey struct{}
+
+// WithRequestID returns ctx carrying the ID of the inbound request it serves,
+// so that the entries recorded while serving it can be correlated.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the ID of the inbound request ctx serves, if any.
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
@@ -0,0 +1,42 @@
+package audit
+
+import (
+	"context"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+)
+
+// EventTypes lists the domain events recording actions on consents and plans.
+func (s *Service) EventTypes() []string {
+	return []string{domain.EventTypeConsentCreated, domain.EventTypeConsentStatusChanged, domain.EventTypePlanChanged}
+}
+
+// HandleEvent appends the consent or plan action to the log within the unit
+// of work delivering the event, so that it is recorded exactly when the event is.
+func (s *Service) HandleEvent(ctx context.Context, event *domain.Event) error {
+	entry := &domain.AuditEntry{
+		ClientID:   event.ClientID,
+		Action:     event.Type,
+		Outcome:    domain.AuditOutcomeSuccess,
+		OccurredAt: event.OccurredAt,
+	}
+	switch event.Type {
+	case domain.EventTypeConsentCreated:
+		var payload domain.ConsentCreated
+		if err := event.Decode(&payload); err != nil {
+			return err
+		}
+		entry.ConsentID, entry.Bank = payload.ConsentID, payload.Bank
+	case domain.EventTypeConsentStatusChanged:
+		var payload domain.ConsentStatusChanged
+		if err := event.Decode(&payload); err != nil {
+			return err
+		}
+		entry.ConsentID, entry.Bank = payload.ConsentID, payload.Bank
+	case domain.EventTypePlanChanged:
+	default:
+		return nil
+	}
+	s.stamp(ctx, entry)
+	return s.append(ctx, []*domain.AuditEntry{entry})
+}
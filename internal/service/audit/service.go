@@ -0,0 +1,389 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultQueueSize     = 4096
+	defaultQueueWait     = 2 * time.Second
+	defaultBatchSize     = 100
+	defaultRetryInterval = 5 * time.Second
+	defaultQueryLimit    = 100
+	maxQueryLimit        = 1000
+	writeTimeout         = 30 * time.Second
+)
+
+var (
+	ErrInvalidFilter = errors.New("invalid audit filter")
+	// ErrUnavailable refuses an action that the log cannot take the entry of.
+	ErrUnavailable = errors.New("audit log unavailable")
+)
+
+// Column sizes of the audit log. Longer values are cut to fit before an entry
+// is queued, as one entry that cannot be stored fails its whole batch.
+const (
+	maxClientIDLength  = 255
+	maxActionLength    = 64
+	maxBankLength      = 255
+	maxOutcomeLength   = 16
+	maxRequestIDLength = 255
+)
+
+// Service keeps the append-only audit log. Entries are queued and written in
+// batches by a single writer, which chains each batch onto the last entry of
+// the log while holding it locked against the writers of other instances.
+//
+// No audited action goes unrecorded while the service runs: room for its
+// entry is reserved in the queue before the action, and the action is refused
+// with ErrUnavailable when the queue stays full for QueueWait. The writer
+// retries a batch until the store takes it. Only the entries still unwritten
+// when the shutdown deadline passes are lost.
+type Service struct {
+	cfg   Config
+	store Store
+	uow   UnitOfWork
+	log   *zap.Logger
+
+	// mu keeps the queue from being closed while entries are sent to it.
+	mu     sync.RWMutex
+	closed bool
+	queue  chan *domain.AuditEntry
+	// room holds a token for every entry reserved and not yet taken off the
+	// queue, so that queueing a reserved entry never waits.
+	room chan struct{}
+	// abort is closed when the shutdown deadline passes, to stop waiting on
+	// the queue and on the store.
+	abort chan struct{}
+	done  chan struct{}
+}
+
+type In struct {
+	fx.In
+
+	Config     Config
+	Store      Store
+	UnitOfWork UnitOfWork
+}
+
+func New(log *zap.Logger, lc fx.Lifecycle, params In) *Service {
+	cfg := params.Config
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+	if cfg.QueueWait <= 0 {
+		cfg.QueueWait = defaultQueueWait
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = defaultRetryInterval
+	}
+	s := &Service{
+		cfg:   cfg,
+		store: params.Store,
+		uow:   params.UnitOfWork,
+		log:   log,
+		queue: make(chan *domain.AuditEntry, cfg.QueueSize),
+		room:  make(chan struct{}, cfg.QueueSize),
+		abort: make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			go s.writeLoop()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			go s.close()
+			select {
+			case <-s.done:
+				return nil
+			case <-ctx.Done():
+				close(s.abort)
+				<-s.done
+				return fmt.Errorf("audit entries left unwritten on shutdown: %d", len(s.queue))
+			}
+		},
+	})
+	return s
+}
+
+// Reserve holds room in the queue for the entry of an action about to be
+// taken on behalf of the request served by ctx, and returns the function
+// recording it. While the queue is full it waits for room until ctx is done
+// or QueueWait has passed, failing with ErrUnavailable then, so that callers
+// refuse the action instead of taking it unaudited. The returned function
+// must be called exactly once; it queues the entry without waiting, stamped
+// with the time and the request ID. Once the service has stopped, the entry
+// is written by the caller.
+func (s *Service) Reserve(ctx context.Context) (func(entry *domain.AuditEntry), error) {
+	record := func(entry *domain.AuditEntry) {
+		s.stamp(ctx, entry)
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		if s.closed {
+			if err := s.write([]*domain.AuditEntry{entry}); err != nil {
+				s.unwritten(err, entry)
+			}
+			return
+		}
+		s.queue <- entry
+	}
+	s.mu.RLock()
+	closed := s.closed
+	s.mu.RUnlock()
+	if closed {
+		return record, nil
+	}
+	wait := time.NewTimer(s.cfg.QueueWait)
+	defer wait.Stop()
+	select {
+	case s.room <- struct{}{}:
+		return record, nil
+	case <-wait.C:
+		return nil, fmt.Errorf("%w: queue full for %v", ErrUnavailable, s.cfg.QueueWait)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Record reserves room for entry and queues it, see Reserve.
+func (s *Service) Record(ctx context.Context, entry *domain.AuditEntry) error {
+	record, err := s.Reserve(ctx)
+	if err != nil {
+		return err
+	}
+	record(entry)
+	return nil
+}
+
+// close closes the queue once the entries being recorded are in it, so that
+// the writer stops after writing them.
+func (s *Service) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	close(s.queue)
+}
+
+// unwritten logs entries that will never be written.
+func (s *Service) unwritten(err error, entries ...*domain.AuditEntry) {
+	for _, entry := range entries {
+		s.log.Error("audit entry not written",
+			zap.String("action", entry.Action),
+			zap.String("client_id", entry.ClientID),
+			zap.String("request_id", entry.RequestID),
+			zap.Time("occurred_at", entry.OccurredAt),
+			zap.Error(err))
+	}
+}
+
+func (s *Service) stamp(ctx context.Context, entry *domain.AuditEntry) {
+	if entry.RequestID == "" {
+		entry.RequestID = RequestID(ctx)
+	}
+	if entry.OccurredAt.IsZero() {
+		entry.OccurredAt = time.Now().UTC()
+	}
+	// Stored timestamps keep microseconds, hashes must not see more.
+	entry.OccurredAt = entry.OccurredAt.Truncate(time.Microsecond)
+	entry.ClientID = truncate(entry.ClientID, maxClientIDLength)
+	entry.Action = truncate(entry.Action, maxActionLength)
+	entry.Bank = truncate(entry.Bank, maxBankLength)
+	entry.Outcome = truncate(entry.Outcome, maxOutcomeLength)
+	entry.RequestID = truncate(entry.RequestID, maxRequestIDLength)
+}
+
+// truncate cuts s to at most n characters.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
+
+// Entries returns the entries matching filter in sequence order.
+func (s *Service) Entries(ctx context.Context, filter domain.AuditFilter) ([]*domain.AuditEntry, error) {
+	if filter.Limit < 0 || filter.AfterSequence < 0 {
+		return nil, fmt.Errorf("%w: limit and after must not be negative", ErrInvalidFilter)
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.To.Before(filter.From) {
+		return nil, fmt.Errorf("%w: to is before from", ErrInvalidFilter)
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultQueryLimit
+	}
+	filter.Limit = min(filter.Limit, maxQueryLimit)
+	return s.store.GetAuditEntries(ctx, filter)
+}
+
+// Verify checks up to limit entries of the chain after afterSequence. The
+// first entry checked is trusted to link to the one before it, verify from
+// zero to check the whole log.
+func (s *Service) Verify(ctx context.Context, afterSequence int64, limit int) (*domain.AuditVerification, error) {
+	entries, err := s.Entries(ctx, domain.AuditFilter{AfterSequence: afterSequence, Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+	res := &domain.AuditVerification{Valid: true}
+	for i, entry := range entries {
+		if i == 0 {
+			res.FirstSequence = entry.Sequence
+		}
+		reason := ""
+		switch {
+		case i == 0 && afterSequence == 0 && (entry.Sequence != 1 || entry.PrevHash != ""):
+			reason = "log does not start at the first entry"
+		case i > 0 && entry.Sequence != entries[i-1].Sequence+1:
+			reason = "entries are missing before this one"
+		case i > 0 && entry.PrevHash != entries[i-1].Hash:
+			reason = "entry does not link to the one before it"
+		case entry.Hash != hash(entry):
+			reason = "entry does not match its hash"
+		}
+		if reason != "" {
+			res.Valid = false
+			res.BrokenAt = entry.Sequence
+			res.Reason = reason
+			return res, nil
+		}
+		res.LastSequence = entry.Sequence
+		res.Checked++
+	}
+	return res, nil
+}
+
+// writeLoop writes the queued entries until the queue is closed and empty,
+// or until the service is aborted.
+func (s *Service) writeLoop() {
+	defer close(s.done)
+	for entry := range s.queue {
+		<-s.room
+		if !s.writeBatch(s.collect(entry)) {
+			return
+		}
+	}
+}
+
+// collect adds to entry the entries already queued behind it, up to a batch.
+func (s *Service) collect(entry *domain.AuditEntry) []*domain.AuditEntry {
+	batch := []*domain.AuditEntry{entry}
+	for len(batch) < s.cfg.BatchSize {
+		select {
+		case entry, ok := <-s.queue:
+			if !ok {
+				return batch
+			}
+			<-s.room
+			batch = append(batch, entry)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// writeBatch writes batch, retrying every RetryInterval until the store takes
+// it or the service is aborted. It reports whether batch was written.
+func (s *Service) writeBatch(batch []*domain.AuditEntry) bool {
+	for attempt := 1; ; attempt++ {
+		err := s.write(batch)
+		if err == nil {
+			return true
+		}
+		s.log.Error("failed to write audit entries",
+			zap.Int("count", len(batch)),
+			zap.Int("attempt", attempt),
+			zap.Error(err))
+		select {
+		case <-s.abort:
+			s.unwritten(err, batch...)
+			return false
+		case <-time.After(s.cfg.RetryInterval):
+		}
+	}
+}
+
+func (s *Service) write(batch []*domain.AuditEntry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+	return s.append(ctx, batch)
+}
+
+// append chains entries onto the log within the unit of work of ctx.
+func (s *Service) append(ctx context.Context, entries []*domain.AuditEntry) error {
+	return s.uow.InTx(ctx, func(ctx context.Context) error {
+		last, err := s.store.LastAuditEntry(ctx)
+		if err != nil {
+			return err
+		}
+		var (
+			sequence int64
+			prevHash string
+		)
+		if last != nil {
+			sequence, prevHash = last.Sequence, last.Hash
+		}
+		for _, entry := range entries {
+			sequence++
+			entry.Sequence = sequence
+			entry.PrevHash = prevHash
+			entry.Hash = hash(entry)
+			prevHash = entry.Hash
+		}
+		return s.store.AppendAuditEntries(ctx, entries)
+	})
+}
+
+// hash returns the SHA-256 of the fields of entry and the hash it links to.
+// Fields are length-prefixed, so that no two entries hash the same input.
+func hash(entry *domain.AuditEntry) string {
+	h := sha256.New()
+	for _, field := range []string{
+		entry.PrevHash,
+		strconv.FormatInt(entry.Sequence, 10),
+		entry.OccurredAt.UTC().Format(time.RFC3339Nano),
+		entry.ClientID,
+		entry.Action,
+		entry.ConsentID,
+		entry.Bank,
+		entry.Endpoint,
+		entry.Outcome,
+		strconv.Itoa(entry.StatusCode),
+		entry.Error,
+		entry.RequestID,
+	} {
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(len(field))))
+		h.Write([]byte(field))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type UnitOfWork interface {
+	InTx(ctx context.Context, f func(ctx context.Context) error) error
+}
+
+type Store interface {
+	// LastAuditEntry returns the last entry of the log, nil if it is empty,
+	// and keeps others from appending until the unit of work of ctx ends.
+	LastAuditEntry(ctx context.Context) (*domain.AuditEntry, error)
+	AppendAuditEntries(ctx context.Context, entries []*domain.AuditEntry) error
+	GetAuditEntries(ctx context.Context, filter domain.AuditFilter) ([]*domain.AuditEntry, error)
+}
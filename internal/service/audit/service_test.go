@@ -0,0 +1,148 @@
+package audit_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/internal/infra/memory"
+	"github.com/MichaelSBoop/lima-backend/internal/service/audit"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+// flakyStore is a memory store that fails its first fails appends.
+type flakyStore struct {
+	*memory.Store
+
+	mu    sync.Mutex
+	fails int
+}
+
+func (s *flakyStore) AppendAuditEntries(ctx context.Context, entries []*domain.AuditEntry) error {
+	s.mu.Lock()
+	if s.fails > 0 {
+		s.fails--
+		s.mu.Unlock()
+		return errors.New("store is down")
+	}
+	s.mu.Unlock()
+	return s.Store.AppendAuditEntries(ctx, entries)
+}
+
+func TestRecordKeepsEveryEntry(t *testing.T) {
+	tests := []struct {
+		name  string
+		fails int
+	}{
+		{name: "store up", fails: 0},
+		{name: "store down for a while", fails: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := memory.New(zap.NewNop())
+			store := &flakyStore{Store: mem, fails: tt.fails}
+			lc := fxtest.NewLifecycle(t)
+			s := audit.New(zap.NewNop(), lc, audit.In{
+				Config:     audit.Config{QueueSize: 2, BatchSize: 2, RetryInterval: time.Millisecond},
+				Store:      store,
+				UnitOfWork: mem,
+			})
+			lc.RequireStart()
+
+			const count = 20
+			for range count {
+				if err := s.Record(context.Background(), &domain.AuditEntry{ClientID: "c1", Action: "test", Outcome: domain.AuditOutcomeSuccess}); err != nil {
+					t.Fatalf("Record: %v", err)
+				}
+			}
+			lc.RequireStop()
+
+			res, err := s.Verify(context.Background(), 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !res.Valid || res.Checked != count {
+				t.Fatalf("got %+v, want a valid log of %d entries", res, count)
+			}
+		})
+	}
+}
+
+func TestRecordAfterStopWritesTheEntry(t *testing.T) {
+	store := memory.New(zap.NewNop())
+	lc := fxtest.NewLifecycle(t)
+	s := audit.New(zap.NewNop(), lc, audit.In{Store: store, UnitOfWork: store})
+	lc.RequireStart()
+	lc.RequireStop()
+
+	if err := s.Record(context.Background(), &domain.AuditEntry{ClientID: "c1", Action: "test", Outcome: domain.AuditOutcomeSuccess}); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	entries, err := s.Entries(context.Background(), domain.AuditFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+}
+
+func TestReserveRefusesWhileTheQueueStaysFull(t *testing.T) {
+	const wait = 20 * time.Millisecond
+	cancelled := func() (context.Context, context.CancelFunc) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(wait/4, cancel)
+		return ctx, cancel
+	}
+	tests := []struct {
+		name    string
+		ctx     func() (context.Context, context.CancelFunc)
+		wantErr error
+	}{
+		{name: "queue wait passes", ctx: func() (context.Context, context.CancelFunc) { return context.WithCancel(context.Background()) }, wantErr: audit.ErrUnavailable},
+		{name: "request cancelled", ctx: cancelled, wantErr: context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := memory.New(zap.NewNop())
+			// The store stays down, so the writer holds the first entry and
+			// the queue fills up behind it.
+			store := &flakyStore{Store: mem, fails: math.MaxInt}
+			lc := fxtest.NewLifecycle(t)
+			s := audit.New(zap.NewNop(), lc, audit.In{
+				Config:     audit.Config{QueueSize: 1, BatchSize: 1, QueueWait: wait, RetryInterval: time.Millisecond},
+				Store:      store,
+				UnitOfWork: mem,
+			})
+			lc.RequireStart()
+			defer func() {
+				store.mu.Lock()
+				store.fails = 0
+				store.mu.Unlock()
+				lc.RequireStop()
+			}()
+
+			for i := range 2 {
+				if err := s.Record(context.Background(), &domain.AuditEntry{ClientID: "c1", Action: "test", Outcome: domain.AuditOutcomeSuccess}); err != nil {
+					t.Fatalf("Record %d: %v", i, err)
+				}
+				// Let the writer take the first entry off the queue.
+				time.Sleep(wait / 4)
+			}
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			start := time.Now()
+			if _, err := s.Reserve(ctx); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Reserve = %v, want %v", err, tt.wantErr)
+			}
+			if elapsed := time.Since(start); elapsed > 10*wait {
+				t.Errorf("Reserve returned after %v, want about %v", elapsed, wait)
+			}
+		})
+	}
+}
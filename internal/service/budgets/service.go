@@ -0,0 +1,333 @@
+package budgets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/internal/service/rates"
+	"github.com/MichaelSBoop/lima-backend/pkg/money"
+	"github.com/google/uuid"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// rolloverMonths bounds how far back unspent amounts are carried over.
+const rolloverMonths = 12
+
+// Thresholds are the percentages of a budget that raise an alert when crossed.
+var Thresholds = []int{80, 100}
+
+var ErrInvalidBudget = errors.New("invalid budget")
+
+type Service struct {
+	store     Store
+	uow       UnitOfWork
+	rates     RatesProvider
+	publisher AlertPublisher
+	log       *zap.Logger
+}
+
+type In struct {
+	fx.In
+
+	Store      Store
+	UnitOfWork UnitOfWork
+	Rates      RatesProvider
+	Publisher  AlertPublisher
+}
+
+func New(log *zap.Logger, params In) *Service {
+	return &Service{
+		store:     params.Store,
+		uow:       params.UnitOfWork,
+		rates:     params.Rates,
+		publisher: params.Publisher,
+		log:       log,
+	}
+}
+
+func (s *Service) Create(ctx context.Context, budget *domain.Budget) (*domain.BudgetProgress, error) {
+	if err := s.validate(budget); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	budget.BudgetID = uuid.NewString()
+	budget.CreatedAt, budget.UpdatedAt = now, now
+	if err := s.store.SaveBudget(ctx, budget); err != nil {
+		return nil, err
+	}
+	return s.evaluate(ctx, budget)
+}
+
+// Update replaces the settings of the budget, keeping its identity and creation time.
+func (s *Service) Update(ctx context.Context, budget *domain.Budget) (*domain.BudgetProgress, error) {
+	if err := s.validate(budget); err != nil {
+		return nil, err
+	}
+	current, err := s.store.GetBudget(ctx, budget.ClientID, budget.BudgetID)
+	if err != nil {
+		return nil, err
+	}
+	budget.CreatedAt = current.CreatedAt
+	budget.UpdatedAt = time.Now().UTC()
+	if err = s.store.UpdateBudget(ctx, budget); err != nil {
+		return nil, err
+	}
+	return s.evaluate(ctx, budget)
+}
+
+func (s *Service) Delete(ctx context.Context, clientID, budgetID string) error {
+	return s.store.DeleteBudget(ctx, clientID, budgetID)
+}
+
+func (s *Service) Get(ctx context.Context, clientID, budgetID string) (*domain.BudgetProgress, error) {
+	budget, err := s.store.GetBudget(ctx, clientID, budgetID)
+	if err != nil {
+		return nil, err
+	}
+	return s.progress(ctx, budget, time.Now())
+}
+
+// List returns the progress of every budget of the client in the current month.
+func (s *Service) List(ctx context.Context, clientID string) ([]*domain.BudgetProgress, error) {
+	budgets, err := s.store.GetBudgets(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*domain.BudgetProgress, 0, len(budgets))
+	for _, budget := range budgets {
+		progress, err := s.progress(ctx, budget, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, progress)
+	}
+	return res, nil
+}
+
+func (s *Service) Alerts(ctx context.Context, clientID, budgetID string) ([]*domain.BudgetAlert, error) {
+	if _, err := s.store.GetBudget(ctx, clientID, budgetID); err != nil {
+		return nil, err
+	}
+	return s.store.GetBudgetAlerts(ctx, clientID, budgetID)
+}
+
+// TransactionsSynced recomputes the budgets of the client and raises alerts
+// for newly crossed thresholds.
+func (s *Service) TransactionsSynced(ctx context.Context, clientID string) error {
+	budgets, err := s.store.GetBudgets(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, budget := range budgets {
+		if _, err := s.evaluate(ctx, budget); err != nil {
+			errs = append(errs, fmt.Errorf("budget %s: %w", budget.BudgetID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// evaluate computes the current progress of budget and raises alerts for the
+// thresholds it crossed that were not alerted in this period yet.
+func (s *Service) evaluate(ctx context.Context, budget *domain.Budget) (*domain.BudgetProgress, error) {
+	progress, err := s.progress(ctx, budget, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	alerts := make([]*domain.BudgetAlert, 0)
+	err = s.uow.InTx(ctx, func(ctx context.Context) error {
+		for _, threshold := range Thresholds {
+			if progress.Percent < threshold {
+				continue
+			}
+			alert := &domain.BudgetAlert{
+				AlertID:   uuid.NewString(),
+				BudgetID:  budget.BudgetID,
+				ClientID:  budget.ClientID,
+				Period:    progress.PeriodStart,
+				Threshold: threshold,
+				Spent:     progress.Spent,
+				Available: progress.Available,
+				Currency:  budget.Currency,
+				CreatedAt: time.Now().UTC(),
+			}
+			created, err := s.store.SaveBudgetAlert(ctx, alert)
+			if err != nil {
+				return err
+			}
+			if created {
+				alerts = append(alerts, alert)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, alert := range alerts {
+		if err := s.publisher.PublishBudgetAlert(ctx, budget, alert); err != nil {
+			s.log.Error("failed to publish budget alert", zap.String("alert_id", alert.AlertID), zap.Error(err))
+		}
+	}
+	return progress, nil
+}
+
+// progress computes the spending of budget in the month of at. With rollover
+// the months since the budget was created, up to rolloverMonths, are replayed
+// to find the carryover.
+func (s *Service) progress(ctx context.Context, budget *domain.Budget, at time.Time) (*domain.BudgetProgress, error) {
+	current := monthStart(at)
+	first := current
+	if budget.Rollover {
+		first = monthStart(budget.CreatedAt)
+		if earliest := current.AddDate(0, -rolloverMonths, 0); first.Before(earliest) {
+			first = earliest
+		}
+	}
+	txs, err := s.store.GetTransactions(ctx, domain.TransactionFilter{
+		ClientID: budget.ClientID,
+		Category: budget.Category,
+		From:     first,
+		To:       current.AddDate(0, 1, 0),
+	})
+	if err != nil {
+		return nil, err
+	}
+	table, err := s.rates.Table(ctx, at)
+	if err != nil {
+		return nil, err
+	}
+	spentByMonth := make(map[time.Time]*big.Rat)
+	for _, tx := range txs {
+		if !matches(budget, tx) {
+			continue
+		}
+		amount, err := money.Parse(tx.Amount)
+		if err != nil {
+			return nil, err
+		}
+		converted, err := table.Convert(amount, tx.Currency, budget.Currency)
+		if errors.Is(err, rates.ErrNoRate) {
+			s.log.Warn("transaction left out of budget", zap.String("transaction_id", tx.TransactionID), zap.Error(err))
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		month := monthStart(tx.BookedAt)
+		if _, ok := spentByMonth[month]; !ok {
+			spentByMonth[month] = money.Zero()
+		}
+		// Spending is negative, refunds reduce it.
+		spentByMonth[month].Sub(spentByMonth[month], converted)
+	}
+
+	limit, err := money.Parse(budget.Limit)
+	if err != nil {
+		return nil, err
+	}
+	carryover := money.Zero()
+	for month := first; month.Before(current); month = month.AddDate(0, 1, 0) {
+		available := new(big.Rat).Add(limit, carryover)
+		carryover = available.Sub(available, spent(spentByMonth, month))
+	}
+	available := new(big.Rat).Add(limit, carryover)
+	spentNow := spent(spentByMonth, current)
+	percent := 0
+	if available.Sign() > 0 {
+		ratio := new(big.Rat).Quo(new(big.Rat).Mul(spentNow, big.NewRat(100, 1)), available)
+		percent = int(new(big.Int).Quo(ratio.Num(), ratio.Denom()).Int64())
+	} else if spentNow.Sign() > 0 {
+		percent = 100
+	}
+	return &domain.BudgetProgress{
+		Budget:      budget,
+		PeriodStart: current,
+		PeriodEnd:   current.AddDate(0, 1, 0),
+		Carryover:   money.Format(carryover),
+		Available:   money.Format(available),
+		Spent:       money.Format(spentNow),
+		Remaining:   money.Format(new(big.Rat).Sub(available, spentNow)),
+		Percent:     percent,
+	}, nil
+}
+
+func (s *Service) validate(budget *domain.Budget) error {
+	budget.Category = strings.TrimSpace(budget.Category)
+	budget.Merchant = strings.TrimSpace(budget.Merchant)
+	if (budget.Category == "") == (budget.Merchant == "") {
+		return fmt.Errorf("%w: exactly one of category and merchant is required", ErrInvalidBudget)
+	}
+	if budget.Category != "" && !slices.Contains(domain.Categories, budget.Category) {
+		return fmt.Errorf("%w: unknown category %s", ErrInvalidBudget, budget.Category)
+	}
+	limit, err := money.Parse(budget.Limit)
+	if err != nil || limit.Sign() <= 0 {
+		return fmt.Errorf("%w: limit must be a positive amount", ErrInvalidBudget)
+	}
+	budget.Limit = money.Format(limit)
+	if budget.Currency == "" {
+		budget.Currency = s.rates.DefaultCurrency()
+	}
+	budget.Currency = strings.ToUpper(budget.Currency)
+	if budget.Name == "" {
+		budget.Name = budget.Category + budget.Merchant
+	}
+	return nil
+}
+
+func matches(budget *domain.Budget, tx *domain.Transaction) bool {
+	if tx.Status != domain.TransactionStatusBooked || tx.TransferID != "" {
+		return false
+	}
+	if budget.Category != "" {
+		return tx.Category == budget.Category
+	}
+	return strings.EqualFold(tx.Merchant, budget.Merchant)
+}
+
+func spent(byMonth map[time.Time]*big.Rat, month time.Time) *big.Rat {
+	if v, ok := byMonth[month]; ok && v.Sign() > 0 {
+		return v
+	}
+	return money.Zero()
+}
+
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+type UnitOfWork interface {
+	InTx(ctx context.Context, f func(ctx context.Context) error) error
+}
+
+type RatesProvider interface {
+	Table(ctx context.Context, date time.Time) (*rates.Table, error)
+	DefaultCurrency() string
+}
+
+// AlertPublisher hands budget alerts over to whoever notifies the client.
+type AlertPublisher interface {
+	PublishBudgetAlert(ctx context.Context, budget *domain.Budget, alert *domain.BudgetAlert) error
+}
+
+type Store interface {
+	SaveBudget(ctx context.Context, budget *domain.Budget) error
+	UpdateBudget(ctx context.Context, budget *domain.Budget) error
+	DeleteBudget(ctx context.Context, clientID, budgetID string) error
+	GetBudget(ctx context.Context, clientID, budgetID string) (*domain.Budget, error)
+	GetBudgets(ctx context.Context, clientID string) ([]*domain.Budget, error)
+	// SaveBudgetAlert stores alert unless one exists for the same budget,
+	// period and threshold, and reports whether it was stored.
+	SaveBudgetAlert(ctx context.Context, alert *domain.BudgetAlert) (bool, error)
+	GetBudgetAlerts(ctx context.Context, clientID, budgetID string) ([]*domain.BudgetAlert, error)
+	GetTransactions(ctx context.Context, filter domain.TransactionFilter) ([]*domain.Transaction, error)
+}
@@ -0,0 +1,199 @@
+package budgets_test
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/internal/infra/memory"
+	"github.com/MichaelSBoop/lima-backend/internal/service/budgets"
+	"github.com/MichaelSBoop/lima-backend/internal/service/rates"
+	"go.uber.org/zap"
+)
+
+type fixedRates struct{}
+
+func (fixedRates) Table(context.Context, time.Time) (*rates.Table, error) {
+	return rates.NewTable("RUB", []*domain.ExchangeRate{{Currency: "USD", BaseCurrency: "RUB", Rate: "90"}}), nil
+}
+
+func (fixedRates) DefaultCurrency() string { return "RUB" }
+
+// alerts records the thresholds of the alerts published.
+type alerts struct {
+	thresholds []int
+}
+
+func (a *alerts) PublishBudgetAlert(_ context.Context, _ *domain.Budget, alert *domain.BudgetAlert) error {
+	a.thresholds = append(a.thresholds, alert.Threshold)
+	return nil
+}
+
+type spending struct {
+	amount   string
+	currency string
+	category string
+	status   string
+	transfer string
+}
+
+func TestThresholdAlerts(t *testing.T) {
+	tests := []struct {
+		name        string
+		spent       []spending
+		wantSpent   string
+		wantPercent int
+		wantAlerts  []int
+	}{
+		{
+			name:        "below the first threshold",
+			spent:       []spending{{amount: "-799.99"}},
+			wantSpent:   "799.99",
+			wantPercent: 79,
+		},
+		{
+			name:        "first threshold",
+			spent:       []spending{{amount: "-500.00"}, {amount: "-300.00"}},
+			wantSpent:   "800.00",
+			wantPercent: 80,
+			wantAlerts:  []int{80},
+		},
+		{
+			name:        "both thresholds",
+			spent:       []spending{{amount: "-1200.00"}},
+			wantSpent:   "1200.00",
+			wantPercent: 120,
+			wantAlerts:  []int{80, 100},
+		},
+		{
+			name:        "refunds reduce spending",
+			spent:       []spending{{amount: "-1000.00"}, {amount: "300.00"}},
+			wantSpent:   "700.00",
+			wantPercent: 70,
+		},
+		{
+			name:        "converted into the budget currency",
+			spent:       []spending{{amount: "-10.00", currency: "USD"}},
+			wantSpent:   "900.00",
+			wantPercent: 90,
+			wantAlerts:  []int{80},
+		},
+		{
+			name: "other categories, pending and transfers left out",
+			spent: []spending{
+				{amount: "-900.00", category: domain.CategoryTravel},
+				{amount: "-900.00", status: domain.TransactionStatusPending},
+				{amount: "-900.00", transfer: "t1"},
+			},
+			wantSpent:   "0.00",
+			wantPercent: 0,
+		},
+		{
+			name:        "unpriced currency left out",
+			spent:       []spending{{amount: "-900.00", currency: "EUR"}},
+			wantSpent:   "0.00",
+			wantPercent: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := memory.New(zap.NewNop())
+			published := &alerts{}
+			s := budgets.New(zap.NewNop(), budgets.In{Store: store, UnitOfWork: store, Rates: fixedRates{}, Publisher: published})
+			for i, sp := range tt.spent {
+				tx := &domain.Transaction{
+					ClientID:      "c1",
+					Bank:          "vbank",
+					AccountID:     "a1",
+					TransactionID: "t" + strconv.Itoa(i),
+					Amount:        sp.amount,
+					Currency:      "RUB",
+					Category:      domain.CategoryGroceries,
+					Status:        domain.TransactionStatusBooked,
+					TransferID:    sp.transfer,
+					BookedAt:      time.Now().UTC(),
+				}
+				if sp.currency != "" {
+					tx.Currency = sp.currency
+				}
+				if sp.category != "" {
+					tx.Category = sp.category
+				}
+				if sp.status != "" {
+					tx.Status = sp.status
+				}
+				if err := store.SaveTransaction(ctx, tx); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			progress, err := s.Create(ctx, &domain.Budget{ClientID: "c1", Category: domain.CategoryGroceries, Limit: "1000"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if progress.Spent != tt.wantSpent || progress.Percent != tt.wantPercent {
+				t.Fatalf("got %s spent at %d%%, want %s at %d%%", progress.Spent, progress.Percent, tt.wantSpent, tt.wantPercent)
+			}
+			if !slices.Equal(published.thresholds, tt.wantAlerts) {
+				t.Fatalf("alerted %v, want %v", published.thresholds, tt.wantAlerts)
+			}
+
+			if err = s.TransactionsSynced(ctx, "c1"); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(published.thresholds, tt.wantAlerts) {
+				t.Fatalf("alerted %v after a second evaluation, want %v once", published.thresholds, tt.wantAlerts)
+			}
+			stored, err := s.Alerts(ctx, "c1", progress.Budget.BudgetID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(stored) != len(tt.wantAlerts) {
+				t.Fatalf("stored %d alerts, want %d", len(stored), len(tt.wantAlerts))
+			}
+		})
+	}
+}
+
+func TestThresholdCrossedLater(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New(zap.NewNop())
+	published := &alerts{}
+	s := budgets.New(zap.NewNop(), budgets.In{Store: store, UnitOfWork: store, Rates: fixedRates{}, Publisher: published})
+	if _, err := s.Create(ctx, &domain.Budget{ClientID: "c1", Merchant: "Shop", Limit: "1000"}); err != nil {
+		t.Fatal(err)
+	}
+	for i, step := range []struct {
+		amount     string
+		wantAlerts []int
+	}{
+		{amount: "-500.00", wantAlerts: nil},
+		{amount: "-400.00", wantAlerts: []int{80}},
+		{amount: "-50.00", wantAlerts: []int{80}},
+		{amount: "-100.00", wantAlerts: []int{80, 100}},
+	} {
+		if err := store.SaveTransaction(ctx, &domain.Transaction{
+			ClientID:      "c1",
+			Bank:          "vbank",
+			AccountID:     "a1",
+			TransactionID: "t" + strconv.Itoa(i),
+			Amount:        step.amount,
+			Currency:      "RUB",
+			Merchant:      "SHOP",
+			Status:        domain.TransactionStatusBooked,
+			BookedAt:      time.Now().UTC(),
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.TransactionsSynced(ctx, "c1"); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(published.thresholds, step.wantAlerts) {
+			t.Fatalf("after %s: alerted %v, want %v", step.amount, published.thresholds, step.wantAlerts)
+		}
+	}
+}
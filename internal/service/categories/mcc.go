@@ -0,0 +1,62 @@
+package categories
+
+import (
+	"strconv"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+)
+
+type mccRange struct {
+	from, to int
+	category string
+}
+
+// mccRanges maps ISO 18245 merchant category codes onto categories. The first
+// matching range wins, so narrow ranges go before the broad ones.
+var mccRanges = []mccRange{
+	{5411, 5411, domain.CategoryGroceries},
+	{5422, 5422, domain.CategoryGroceries},
+	{5441, 5462, domain.CategoryGroceries},
+	{5499, 5499, domain.CategoryGroceries},
+	{5811, 5814, domain.CategoryRestaurants},
+	{5815, 5818, domain.CategorySubscriptions},
+	{4899, 4899, domain.CategorySubscriptions},
+	{4111, 4131, domain.CategoryTransport},
+	{4784, 4789, domain.CategoryTransport},
+	{5541, 5542, domain.CategoryTransport},
+	{7523, 7523, domain.CategoryTransport},
+	{3000, 3299, domain.CategoryTravel},
+	{3500, 3999, domain.CategoryTravel},
+	{4411, 4411, domain.CategoryTravel},
+	{4511, 4511, domain.CategoryTravel},
+	{4722, 4722, domain.CategoryTravel},
+	{7011, 7011, domain.CategoryTravel},
+	{5122, 5122, domain.CategoryHealth},
+	{5912, 5912, domain.CategoryHealth},
+	{8011, 8099, domain.CategoryHealth},
+	{4812, 4816, domain.CategoryUtilities},
+	{4900, 4900, domain.CategoryUtilities},
+	{7997, 7997, domain.CategorySport},
+	{7941, 7941, domain.CategorySport},
+	{7832, 7832, domain.CategoryEntertainment},
+	{7922, 7922, domain.CategoryEntertainment},
+	{7991, 7999, domain.CategoryEntertainment},
+	{6010, 6011, domain.CategoryCash},
+	{4829, 4829, domain.CategoryTransfers},
+	{6012, 6012, domain.CategoryTransfers},
+	{6540, 6540, domain.CategoryTransfers},
+	{5200, 5999, domain.CategoryShopping},
+}
+
+func categoryByMCC(mcc string) (string, bool) {
+	code, err := strconv.Atoi(mcc)
+	if err != nil {
+		return "", false
+	}
+	for _, r := range mccRanges {
+		if code >= r.from && code <= r.to {
+			return r.category, true
+		}
+	}
+	return "", false
+}
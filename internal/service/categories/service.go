@@ -0,0 +1,269 @@
+package categories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/google/uuid"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrUnknownCategory   = errors.New("unknown category")
+	ErrUnknownMatchField = errors.New("unknown match field")
+	ErrEmptyPattern      = errors.New("empty rule pattern")
+	// ErrMissingClientID keeps client requests from creating global rules.
+	ErrMissingClientID = errors.New("missing client id")
+	// ErrAmbiguousTransaction is returned when a transaction ID names
+	// transactions of several accounts.
+	ErrAmbiguousTransaction = errors.New("transaction id is ambiguous")
+)
+
+// builtinRules apply after the rules table and before MCC codes, catching
+// transactions banks report without a merchant.
+var builtinRules = []*domain.CategoryRule{
+	{MatchField: domain.MatchFieldDescription, Pattern: "transfer between own accounts", Category: domain.CategoryTransfers},
+	{MatchField: domain.MatchFieldDescription, Pattern: "перевод между своими счетами", Category: domain.CategoryTransfers},
+	{MatchField: domain.MatchFieldDescription, Pattern: "salary", Category: domain.CategorySalary},
+	{MatchField: domain.MatchFieldDescription, Pattern: "зарплата", Category: domain.CategorySalary},
+	{MatchField: domain.MatchFieldDescription, Pattern: "commission", Category: domain.CategoryFees},
+	{MatchField: domain.MatchFieldDescription, Pattern: "комиссия", Category: domain.CategoryFees},
+}
+
+type Service struct {
+	store Store
+	uow   UnitOfWork
+	log   *zap.Logger
+}
+
+type In struct {
+	fx.In
+
+	Store      Store
+	UnitOfWork UnitOfWork
+}
+
+func New(log *zap.Logger, params In) *Service {
+	return &Service{
+		store: params.Store,
+		uow:   params.UnitOfWork,
+		log:   log,
+	}
+}
+
+// Categorize assigns categories to txs in place. Transactions the client
+// recategorised by hand keep their category when stored.
+func (s *Service) Categorize(ctx context.Context, clientID string, txs []*domain.Transaction) error {
+	rules, err := s.store.GetCategoryRules(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	rules = orderRules(rules)
+	for _, tx := range txs {
+		tx.Category, tx.CategorySource = categorize(rules, tx)
+	}
+	return nil
+}
+
+// SetCategory overrides the category of the transaction of the client with
+// the ID of filter, found among its accounts, and learns a rule from its
+// merchant, or its description when there is no merchant, then applies the
+// rules to the client's history. The bank and account of filter only need to
+// be set when several accounts hold a transaction with the ID.
+func (s *Service) SetCategory(ctx context.Context, filter domain.TransactionFilter, category string) (*domain.Transaction, error) {
+	if !slices.Contains(domain.Categories, category) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCategory, category)
+	}
+	clientID := filter.ClientID
+	var tx *domain.Transaction
+	err := s.uow.InTx(ctx, func(ctx context.Context) error {
+		txs, err := s.store.GetTransactions(ctx, domain.TransactionFilter{
+			ClientID:      clientID,
+			Bank:          filter.Bank,
+			AccountID:     filter.AccountID,
+			TransactionID: filter.TransactionID,
+		})
+		if err != nil {
+			return err
+		}
+		switch {
+		case filter.TransactionID == "" || len(txs) == 0:
+			return fmt.Errorf("transaction %s: %w", filter.TransactionID, domain.ErrNotFound)
+		case len(txs) > 1:
+			return fmt.Errorf("%w: %s is held by %d accounts, name the bank and account", ErrAmbiguousTransaction, filter.TransactionID, len(txs))
+		}
+		tx = txs[0]
+		tx.Category, tx.CategorySource = category, domain.CategorySourceOverride
+		if err = s.store.UpdateTransactionCategory(ctx, tx); err != nil {
+			return err
+		}
+		rule := &domain.CategoryRule{
+			ClientID:   clientID,
+			MatchField: domain.MatchFieldMerchant,
+			Pattern:    tx.Merchant,
+			Category:   category,
+		}
+		if rule.Pattern == "" {
+			rule.MatchField, rule.Pattern = domain.MatchFieldDescription, tx.Description
+		}
+		if strings.TrimSpace(rule.Pattern) != "" {
+			if err = s.saveRule(ctx, rule); err != nil {
+				return err
+			}
+		}
+		return s.recategorize(ctx, clientID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (s *Service) Rules(ctx context.Context, clientID string) ([]*domain.CategoryRule, error) {
+	rules, err := s.store.GetCategoryRules(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	return orderRules(rules), nil
+}
+
+// CreateRule stores a rule of the client, replacing the one with the same
+// field and pattern, and applies the rules to the client's history.
+func (s *Service) CreateRule(ctx context.Context, rule *domain.CategoryRule) (*domain.CategoryRule, error) {
+	if !slices.Contains(domain.Categories, rule.Category) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCategory, rule.Category)
+	}
+	if rule.MatchField != domain.MatchFieldMerchant && rule.MatchField != domain.MatchFieldDescription {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMatchField, rule.MatchField)
+	}
+	if strings.TrimSpace(rule.Pattern) == "" {
+		return nil, ErrEmptyPattern
+	}
+	err := s.uow.InTx(ctx, func(ctx context.Context) error {
+		if err := s.saveRule(ctx, rule); err != nil {
+			return err
+		}
+		return s.recategorize(ctx, rule.ClientID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (s *Service) DeleteRule(ctx context.Context, clientID, ruleID string) error {
+	return s.uow.InTx(ctx, func(ctx context.Context) error {
+		if err := s.store.DeleteCategoryRule(ctx, clientID, ruleID); err != nil {
+			return err
+		}
+		return s.recategorize(ctx, clientID)
+	})
+}
+
+func (s *Service) saveRule(ctx context.Context, rule *domain.CategoryRule) error {
+	if rule.ClientID == "" {
+		return ErrMissingClientID
+	}
+	rule.Pattern = strings.TrimSpace(rule.Pattern)
+	rule.RuleID = uuid.NewString()
+	rule.CreatedAt = time.Now().UTC()
+	return s.store.SaveCategoryRule(ctx, rule)
+}
+
+// recategorize applies the current rules to every stored transaction of the
+// client that was not recategorised by hand.
+func (s *Service) recategorize(ctx context.Context, clientID string) error {
+	txs, err := s.store.GetTransactions(ctx, domain.TransactionFilter{ClientID: clientID})
+	if err != nil {
+		return err
+	}
+	rules, err := s.store.GetCategoryRules(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	rules = orderRules(rules)
+	updated := 0
+	for _, tx := range txs {
+		if tx.CategorySource == domain.CategorySourceOverride {
+			continue
+		}
+		category, source := categorize(rules, tx)
+		if category == tx.Category && source == tx.CategorySource {
+			continue
+		}
+		tx.Category, tx.CategorySource = category, source
+		if err = s.store.UpdateTransactionCategory(ctx, tx); err != nil {
+			return err
+		}
+		updated++
+	}
+	s.log.Debug("transactions recategorized", zap.String("client_id", clientID), zap.Int("updated", updated))
+	return nil
+}
+
+// orderRules puts the client's own rules before the global ones and longer
+// patterns before shorter ones, so the most specific rule wins.
+func orderRules(rules []*domain.CategoryRule) []*domain.CategoryRule {
+	slices.SortStableFunc(rules, func(a, b *domain.CategoryRule) int {
+		if (a.ClientID == "") != (b.ClientID == "") {
+			if a.ClientID != "" {
+				return -1
+			}
+			return 1
+		}
+		return len(b.Pattern) - len(a.Pattern)
+	})
+	return rules
+}
+
+func categorize(rules []*domain.CategoryRule, tx *domain.Transaction) (string, string) {
+	if tx.TransferID != "" {
+		return domain.CategoryTransfers, domain.CategorySourceTransfer
+	}
+	if rule, ok := match(rules, tx); ok {
+		return rule.Category, domain.CategorySourceRule
+	}
+	if rule, ok := match(builtinRules, tx); ok {
+		return rule.Category, domain.CategorySourceRule
+	}
+	if category, ok := categoryByMCC(tx.MCC); ok {
+		return category, domain.CategorySourceMCC
+	}
+	if !strings.HasPrefix(tx.Amount, "-") {
+		return domain.CategoryIncome, domain.CategorySourceDefault
+	}
+	return domain.CategoryOther, domain.CategorySourceDefault
+}
+
+func match(rules []*domain.CategoryRule, tx *domain.Transaction) (*domain.CategoryRule, bool) {
+	for _, rule := range rules {
+		value := tx.Description
+		if rule.MatchField == domain.MatchFieldMerchant {
+			value = tx.Merchant
+		}
+		if value != "" && strings.Contains(strings.ToLower(value), strings.ToLower(rule.Pattern)) {
+			return rule, true
+		}
+	}
+	return nil, false
+}
+
+type UnitOfWork interface {
+	InTx(ctx context.Context, f func(ctx context.Context) error) error
+}
+
+type Store interface {
+	// GetCategoryRules returns the rules of the client along with the global ones.
+	GetCategoryRules(ctx context.Context, clientID string) ([]*domain.CategoryRule, error)
+	// SaveCategoryRule replaces the rule of the client with the same field and pattern.
+	SaveCategoryRule(ctx context.Context, rule *domain.CategoryRule) error
+	DeleteCategoryRule(ctx context.Context, clientID, ruleID string) error
+	GetTransactions(ctx context.Context, filter domain.TransactionFilter) ([]*domain.Transaction, error)
+	UpdateTransactionCategory(ctx context.Context, tx *domain.Transaction) error
+}
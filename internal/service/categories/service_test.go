@@ -0,0 +1,204 @@
+package categories_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/internal/infra/memory"
+	"github.com/MichaelSBoop/lima-backend/internal/service/categories"
+	"go.uber.org/zap"
+)
+
+func newService(t *testing.T) (*categories.Service, *memory.Store) {
+	t.Helper()
+	store := memory.New(zap.NewNop())
+	ctx := context.Background()
+	if err := store.SaveCategoryRule(ctx, &domain.CategoryRule{
+		RuleID:     "global-coffee",
+		MatchField: domain.MatchFieldMerchant,
+		Pattern:    "coffee",
+		Category:   domain.CategoryRestaurants,
+		CreatedAt:  time.Now().UTC(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	s := categories.New(zap.NewNop(), categories.In{Store: store, UnitOfWork: store})
+	for _, rule := range []*domain.CategoryRule{
+		{ClientID: "c1", MatchField: domain.MatchFieldMerchant, Pattern: "Coffee House", Category: domain.CategoryEntertainment},
+		{ClientID: "c1", MatchField: domain.MatchFieldMerchant, Pattern: "coffee bean", Category: domain.CategoryGroceries},
+		{ClientID: "c1", MatchField: domain.MatchFieldDescription, Pattern: "gym", Category: domain.CategorySport},
+		{ClientID: "c2", MatchField: domain.MatchFieldMerchant, Pattern: "market", Category: domain.CategoryShopping},
+	} {
+		if _, err := s.CreateRule(ctx, rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s, store
+}
+
+func TestCategorize(t *testing.T) {
+	tests := []struct {
+		name       string
+		tx         domain.Transaction
+		wantCat    string
+		wantSource string
+	}{
+		{
+			name:       "client rule on merchant, case insensitive",
+			tx:         domain.Transaction{Merchant: "COFFEE HOUSE #12", Amount: "-300.00"},
+			wantCat:    domain.CategoryEntertainment,
+			wantSource: domain.CategorySourceRule,
+		},
+		{
+			name:       "client rule wins over a global one",
+			tx:         domain.Transaction{Merchant: "Coffee Bean Store", Amount: "-300.00"},
+			wantCat:    domain.CategoryGroceries,
+			wantSource: domain.CategorySourceRule,
+		},
+		{
+			name:       "global rule",
+			tx:         domain.Transaction{Merchant: "Street Coffee", Amount: "-150.00"},
+			wantCat:    domain.CategoryRestaurants,
+			wantSource: domain.CategorySourceRule,
+		},
+		{
+			name:       "client rule on description",
+			tx:         domain.Transaction{Description: "Monthly GYM fee", Amount: "-2000.00"},
+			wantCat:    domain.CategorySport,
+			wantSource: domain.CategorySourceRule,
+		},
+		{
+			name:       "merchant rule ignores the description",
+			tx:         domain.Transaction{Description: "coffee house", Amount: "-300.00"},
+			wantCat:    domain.CategoryOther,
+			wantSource: domain.CategorySourceDefault,
+		},
+		{
+			name:       "rule of another client",
+			tx:         domain.Transaction{Merchant: "Local Market", Amount: "-300.00", MCC: "5411"},
+			wantCat:    domain.CategoryGroceries,
+			wantSource: domain.CategorySourceMCC,
+		},
+		{
+			name:       "builtin rule",
+			tx:         domain.Transaction{Description: "Зарплата за март", Amount: "90000.00"},
+			wantCat:    domain.CategorySalary,
+			wantSource: domain.CategorySourceRule,
+		},
+		{
+			name:       "rule wins over the MCC",
+			tx:         domain.Transaction{Merchant: "Coffee House", MCC: "5411", Amount: "-300.00"},
+			wantCat:    domain.CategoryEntertainment,
+			wantSource: domain.CategorySourceRule,
+		},
+		{
+			name:       "MCC",
+			tx:         domain.Transaction{Merchant: "Aeroflot", MCC: "4511", Amount: "-12000.00"},
+			wantCat:    domain.CategoryTravel,
+			wantSource: domain.CategorySourceMCC,
+		},
+		{
+			name:       "transfer",
+			tx:         domain.Transaction{Merchant: "Coffee House", TransferID: "t1", Amount: "-300.00"},
+			wantCat:    domain.CategoryTransfers,
+			wantSource: domain.CategorySourceTransfer,
+		},
+		{
+			name:       "unmatched income",
+			tx:         domain.Transaction{Description: "refund", Amount: "300.00"},
+			wantCat:    domain.CategoryIncome,
+			wantSource: domain.CategorySourceDefault,
+		},
+		{
+			name:       "unmatched spending",
+			tx:         domain.Transaction{Description: "something", Amount: "-300.00"},
+			wantCat:    domain.CategoryOther,
+			wantSource: domain.CategorySourceDefault,
+		},
+	}
+	s, _ := newService(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := tt.tx
+			if err := s.Categorize(context.Background(), "c1", []*domain.Transaction{&tx}); err != nil {
+				t.Fatal(err)
+			}
+			if tx.Category != tt.wantCat || tx.CategorySource != tt.wantSource {
+				t.Fatalf("got %s from %s, want %s from %s", tx.Category, tx.CategorySource, tt.wantCat, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestCreateRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    domain.CategoryRule
+		wantErr error
+	}{
+		{name: "valid", rule: domain.CategoryRule{ClientID: "c1", MatchField: domain.MatchFieldMerchant, Pattern: "taxi", Category: domain.CategoryTransport}},
+		{name: "unknown category", rule: domain.CategoryRule{ClientID: "c1", MatchField: domain.MatchFieldMerchant, Pattern: "taxi", Category: "rockets"}, wantErr: categories.ErrUnknownCategory},
+		{name: "unknown field", rule: domain.CategoryRule{ClientID: "c1", MatchField: "amount", Pattern: "taxi", Category: domain.CategoryTransport}, wantErr: categories.ErrUnknownMatchField},
+		{name: "blank pattern", rule: domain.CategoryRule{ClientID: "c1", MatchField: domain.MatchFieldMerchant, Pattern: "  ", Category: domain.CategoryTransport}, wantErr: categories.ErrEmptyPattern},
+		{name: "global", rule: domain.CategoryRule{MatchField: domain.MatchFieldMerchant, Pattern: "taxi", Category: domain.CategoryTransport}, wantErr: categories.ErrMissingClientID},
+	}
+	s, _ := newService(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := tt.rule
+			if _, err := s.CreateRule(context.Background(), &rule); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetCategoryLearnsRule(t *testing.T) {
+	ctx := context.Background()
+	s, store := newService(t)
+	for _, tx := range []*domain.Transaction{
+		{ClientID: "c1", Bank: "vbank", AccountID: "a1", TransactionID: "t1", Merchant: "Pizza Place", Amount: "-500.00"},
+		{ClientID: "c1", Bank: "vbank", AccountID: "a1", TransactionID: "t2", Merchant: "Pizza Place", Amount: "-700.00"},
+		{ClientID: "c1", Bank: "abank", AccountID: "a1", TransactionID: "t1", Merchant: "Pizza Place", Amount: "-900.00"},
+	} {
+		if err := s.Categorize(ctx, "c1", []*domain.Transaction{tx}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.SaveTransaction(ctx, tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := s.SetCategory(ctx, domain.TransactionFilter{ClientID: "c1", TransactionID: "t1"}, domain.CategoryRestaurants); !errors.Is(err, categories.ErrAmbiguousTransaction) {
+		t.Fatalf("transaction id of two accounts: got %v, want ambiguous", err)
+	}
+	tx, err := s.SetCategory(ctx, domain.TransactionFilter{ClientID: "c1", Bank: "vbank", AccountID: "a1", TransactionID: "t1"}, domain.CategoryRestaurants)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Category != domain.CategoryRestaurants || tx.CategorySource != domain.CategorySourceOverride {
+		t.Fatalf("got %s from %s, want an override to restaurants", tx.Category, tx.CategorySource)
+	}
+	txs, err := store.GetTransactions(ctx, domain.TransactionFilter{ClientID: "c1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tx := range txs {
+		if tx.Category != domain.CategoryRestaurants {
+			t.Errorf("%s/%s/%s: got %s, want the learned restaurants", tx.Bank, tx.AccountID, tx.TransactionID, tx.Category)
+		}
+	}
+	if _, err := s.SetCategory(ctx, domain.TransactionFilter{ClientID: "c1", Bank: "sbank", TransactionID: "t1"}, domain.CategoryRestaurants); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("transaction of another bank: got %v, want not found", err)
+	}
+	tx, err = s.SetCategory(ctx, domain.TransactionFilter{ClientID: "c1", TransactionID: "t2"}, domain.CategoryGroceries)
+	if err != nil {
+		t.Fatalf("transaction id of one account: %v", err)
+	}
+	if tx.Bank != "vbank" || tx.Category != domain.CategoryGroceries {
+		t.Fatalf("got %s in %s, want groceries in vbank", tx.Category, tx.Bank)
+	}
+}
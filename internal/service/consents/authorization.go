@@ -0,0 +1,208 @@
+package consents
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultAuthorizationTTL = 15 * time.Minute
+	// errorAccessDenied is the OAuth error of a client declining at its bank.
+	errorAccessDenied = "access_denied"
+	errorServer       = "server_error"
+)
+
+var (
+	ErrAuthorizationDisabled = errors.New("consent authorization is not configured")
+	ErrNotPending            = errors.New("consent is not pending")
+	ErrInvalidState          = errors.New("invalid or expired authorization state")
+	ErrInvalidReturnURL      = errors.New("return url is not allowed")
+)
+
+// Authorize starts the approval of a pending consent of the client at its
+// bank. The client is to open the returned URL, and once done at the bank
+// lands on returnTo, or on the configured deep link when returnTo is empty.
+func (s *Service) Authorize(ctx context.Context, clientID, consentID, returnTo string) (*domain.ConsentAuthorizationLink, error) {
+	if s.cfg.Authorization.CallbackURL == "" {
+		return nil, ErrAuthorizationDisabled
+	}
+	returnTo, err := s.returnURL(returnTo)
+	if err != nil {
+		return nil, err
+	}
+	consent, err := s.consent(ctx, clientID, consentID)
+	if err != nil {
+		return nil, err
+	}
+	if consent.Status != domain.ConsentStatusPending {
+		return nil, fmt.Errorf("%w: consent %s is %s", ErrNotPending, consentID, consent.Status)
+	}
+	state, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	authorizationURL, err := s.authorizer.AuthorizationURL(consent, domain.ConsentAuthorizationRedirect{
+		RedirectURI:   s.cfg.Authorization.CallbackURL,
+		State:         state,
+		CodeChallenge: base64.RawURLEncoding.EncodeToString(challenge[:]),
+	})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	authorization := &domain.ConsentAuthorization{
+		StateHash:    hashState(state),
+		ClientID:     clientID,
+		ConsentID:    consentID,
+		Bank:         consent.ConsentProvider,
+		CodeVerifier: verifier,
+		ReturnTo:     returnTo,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(s.cfg.Authorization.TTL),
+	}
+	if err := s.store.SaveConsentAuthorization(ctx, authorization, now); err != nil {
+		return nil, err
+	}
+	return &domain.ConsentAuthorizationLink{
+		AuthorizationURL: authorizationURL,
+		State:            state,
+		ExpiresAt:        authorization.ExpiresAt,
+	}, nil
+}
+
+// CompleteAuthorization handles the return of the client from its bank with
+// the state of the flow and either an authorisation code or the error of the
+// bank. It updates the consent and returns the deep link to send the client
+// to, telling the app how the flow ended. Only an unknown or expired state
+// fails, as there is then no flow to return to.
+func (s *Service) CompleteAuthorization(ctx context.Context, state, code, bankError string) (string, error) {
+	if state == "" {
+		return "", ErrInvalidState
+	}
+	authorization, err := s.store.TakeConsentAuthorization(ctx, hashState(state), time.Now().UTC())
+	if errors.Is(err, domain.ErrNotFound) {
+		return "", ErrInvalidState
+	}
+	if err != nil {
+		return "", err
+	}
+	result := url.Values{
+		"consent_id": {authorization.ConsentID},
+		"bank":       {authorization.Bank},
+	}
+	status, err := s.complete(ctx, authorization, code, bankError)
+	switch {
+	case err == nil:
+		result.Set("status", status)
+	case bankError != "":
+		result.Set("error", bankError)
+	default:
+		s.log.Warn("failed to complete consent authorization",
+			zap.String("bank", authorization.Bank), zap.Error(err))
+		result.Set("error", errorServer)
+	}
+	return withQuery(authorization.ReturnTo, result)
+}
+
+func (s *Service) complete(ctx context.Context, authorization *domain.ConsentAuthorization, code, bankError string) (string, error) {
+	consent, err := s.consent(ctx, authorization.ClientID, authorization.ConsentID)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case bankError == errorAccessDenied:
+		return domain.ConsentStatusRejected, s.statuses.SetConsentStatus(ctx, consent, domain.ConsentStatusRejected)
+	case bankError != "":
+		return "", fmt.Errorf("bank %s: %s", authorization.Bank, bankError)
+	}
+	updated, err := s.authorizer.CompleteAuthorization(ctx, consent, code, authorization.CodeVerifier, s.cfg.Authorization.CallbackURL)
+	if err != nil {
+		return "", err
+	}
+	consent.ExpiresAt = updated.ExpiresAt
+	if err := s.statuses.SetConsentStatus(ctx, consent, updated.Status); err != nil {
+		return "", err
+	}
+	if consent.Status == domain.ConsentStatusApproved {
+		s.retire(ctx, consent)
+	}
+	return consent.Status, nil
+}
+
+// returnURL picks the deep link the flow ends on.
+func (s *Service) returnURL(requested string) (string, error) {
+	if requested == "" {
+		if s.cfg.Authorization.ReturnURL == "" {
+			return "", fmt.Errorf("%w: no return url configured", ErrAuthorizationDisabled)
+		}
+		return s.cfg.Authorization.ReturnURL, nil
+	}
+	u, err := url.Parse(requested)
+	if err != nil || u.Opaque != "" || u.User != nil || u.Scheme == "" {
+		return "", fmt.Errorf("%w: %s", ErrInvalidReturnURL, requested)
+	}
+	for _, raw := range s.cfg.Authorization.AllowedReturnURLs {
+		allowed, err := url.Parse(raw)
+		if err != nil || raw == "" {
+			continue
+		}
+		if u.Scheme == allowed.Scheme && strings.EqualFold(u.Host, allowed.Host) && underPath(u.Path, allowed.Path) {
+			return requested, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrInvalidReturnURL, requested)
+}
+
+// underPath reports whether p is prefix or below it, by whole segments once
+// dot segments are resolved.
+func underPath(p, prefix string) bool {
+	p = path.Clean("/" + p)
+	prefix = path.Clean("/" + prefix)
+	return prefix == "/" || p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+func withQuery(raw string, values url.Values) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	for key, value := range values {
+		q[key] = value
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// randomToken returns 256 random bits encoded for use in URLs, long enough
+// for a PKCE code verifier.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashState keeps states out of the store, a leaked row cannot be replayed.
+func hashState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,181 @@
+package consents_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/internal/service/consents"
+)
+
+const returnURL = "lima://consents/done"
+
+func authorizationConfig(ttl time.Duration) consents.Config {
+	return consents.Config{Authorization: consents.Authorization{
+		CallbackURL: "https://api.lima.example/api/v1/consents/callback",
+		ReturnURL:   returnURL,
+		TTL:         ttl,
+	}}
+}
+
+func pending(consentID, replaces string) *domain.AccountConsent {
+	return &domain.AccountConsent{
+		ClientID:          "c1",
+		ConsentID:         consentID,
+		ConsentProvider:   "vbank",
+		Status:            domain.ConsentStatusPending,
+		ReplacesConsentID: replaces,
+	}
+}
+
+// query parses the query of the deep link the flow ended on.
+func query(t *testing.T, link string) url.Values {
+	t.Helper()
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("parse %s: %v", link, err)
+	}
+	if u.Scheme+"://"+u.Host+u.Path != returnURL {
+		t.Fatalf("returned to %s, want %s", link, returnURL)
+	}
+	return u.Query()
+}
+
+func TestCompleteAuthorization(t *testing.T) {
+	tests := []struct {
+		name string
+		// code is the code returned by the bank, the state stands for a code
+		// the bank issued.
+		code      func(state string) string
+		bankError string
+		// wantQuery is what the deep link tells the app.
+		wantQuery  url.Values
+		wantStatus string
+		// wantPrevious is the status the consent replaced is left with.
+		wantPrevious string
+	}{
+		{
+			name:         "approved",
+			code:         func(state string) string { return state },
+			wantQuery:    url.Values{"consent_id": {"new"}, "bank": {"vbank"}, "status": {domain.ConsentStatusApproved}},
+			wantStatus:   domain.ConsentStatusApproved,
+			wantPrevious: domain.ConsentStatusRevoked,
+		},
+		{
+			name:         "declined at the bank",
+			code:         func(string) string { return "" },
+			bankError:    "access_denied",
+			wantQuery:    url.Values{"consent_id": {"new"}, "bank": {"vbank"}, "status": {domain.ConsentStatusRejected}},
+			wantStatus:   domain.ConsentStatusRejected,
+			wantPrevious: domain.ConsentStatusApproved,
+		},
+		{
+			name:         "bank failed",
+			code:         func(string) string { return "" },
+			bankError:    "temporarily_unavailable",
+			wantQuery:    url.Values{"consent_id": {"new"}, "bank": {"vbank"}, "error": {"temporarily_unavailable"}},
+			wantStatus:   domain.ConsentStatusPending,
+			wantPrevious: domain.ConsentStatusApproved,
+		},
+		{
+			name:         "code exchange failed",
+			code:         func(string) string { return "code-of-another-flow" },
+			wantQuery:    url.Values{"consent_id": {"new"}, "bank": {"vbank"}, "error": {"server_error"}},
+			wantStatus:   domain.ConsentStatusPending,
+			wantPrevious: domain.ConsentStatusApproved,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t, authorizationConfig(time.Minute), approved("old", time.Now().Add(time.Hour)), pending("new", "old"))
+			ctx := context.Background()
+			link, err := f.s.Authorize(ctx, "c1", "new", "")
+			if err != nil {
+				t.Fatalf("Authorize: %v", err)
+			}
+
+			returnTo, err := f.s.CompleteAuthorization(ctx, link.State, tt.code(link.State), tt.bankError)
+			if err != nil {
+				t.Fatalf("CompleteAuthorization: %v", err)
+			}
+			got := query(t, returnTo)
+			for key := range tt.wantQuery {
+				if got.Get(key) != tt.wantQuery.Get(key) {
+					t.Errorf("returned %s=%q, want %q", key, got.Get(key), tt.wantQuery.Get(key))
+				}
+			}
+			if len(got) != len(tt.wantQuery) {
+				t.Errorf("returned %v, want %v", got, tt.wantQuery)
+			}
+			if status := f.status(t, "new"); status != tt.wantStatus {
+				t.Errorf("consent is %s, want %s", status, tt.wantStatus)
+			}
+			if status := f.status(t, "old"); status != tt.wantPrevious {
+				t.Errorf("replaced consent is %s, want %s", status, tt.wantPrevious)
+			}
+		})
+	}
+}
+
+func TestCompleteAuthorizationState(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		// state returns the state to complete with, given the one issued.
+		state func(issued string) string
+		// wait is how long the client takes at its bank.
+		wait time.Duration
+		// twice completes the flow a second time.
+		twice   bool
+		wantErr error
+	}{
+		{name: "issued state", ttl: time.Minute, state: func(issued string) string { return issued }},
+		{name: "used twice", ttl: time.Minute, state: func(issued string) string { return issued }, twice: true, wantErr: consents.ErrInvalidState},
+		{name: "expired", ttl: 20 * time.Millisecond, state: func(issued string) string { return issued }, wait: 40 * time.Millisecond, wantErr: consents.ErrInvalidState},
+		{name: "unknown", ttl: time.Minute, state: func(string) string { return "forged" }, wantErr: consents.ErrInvalidState},
+		{name: "missing", ttl: time.Minute, state: func(string) string { return "" }, wantErr: consents.ErrInvalidState},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t, authorizationConfig(tt.ttl), pending("new", ""))
+			ctx := context.Background()
+			link, err := f.s.Authorize(ctx, "c1", "new", "")
+			if err != nil {
+				t.Fatalf("Authorize: %v", err)
+			}
+			time.Sleep(tt.wait)
+
+			state := tt.state(link.State)
+			_, err = f.s.CompleteAuthorization(ctx, state, link.State, "")
+			if tt.twice {
+				if err != nil {
+					t.Fatalf("first CompleteAuthorization: %v", err)
+				}
+				_, err = f.s.CompleteAuthorization(ctx, state, link.State, "")
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CompleteAuthorization = %v, want %v", err, tt.wantErr)
+			}
+			wantStatus := domain.ConsentStatusApproved
+			if tt.wantErr != nil && !tt.twice {
+				wantStatus = domain.ConsentStatusPending
+			}
+			if status := f.status(t, "new"); status != wantStatus {
+				t.Errorf("consent is %s, want %s", status, wantStatus)
+			}
+		})
+	}
+}
+
+func TestAuthorizeOnlyPendingConsents(t *testing.T) {
+	f := newFixture(t, authorizationConfig(time.Minute), approved("old", time.Now().Add(time.Hour)))
+	if _, err := f.s.Authorize(context.Background(), "c1", "old", ""); !errors.Is(err, consents.ErrNotPending) {
+		t.Errorf("Authorize approved consent = %v, want ErrNotPending", err)
+	}
+	if _, err := f.s.Authorize(context.Background(), "c1", "missing", ""); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Authorize unknown consent = %v, want not found", err)
+	}
+}
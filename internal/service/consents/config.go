@@ -0,0 +1,29 @@
+package consents
+
+import "time"
+
+type Config struct {
+	// ExpiryInterval is how often consents are checked for expiry. Zero
+	// disables the job.
+	ExpiryInterval time.Duration `json:"expiry_interval" yaml:"expiry_interval"`
+	// ExpiringWithin is how long before its expiry a consent is reported as
+	// expiring soon.
+	ExpiringWithin time.Duration `json:"expiring_within" yaml:"expiring_within"`
+	BatchSize      int           `json:"batch_size" yaml:"batch_size"`
+	Authorization  Authorization `json:"authorization" yaml:"authorization"`
+}
+
+// Authorization configures the redirect approval of pending consents.
+type Authorization struct {
+	// CallbackURL is the public URL of the callback endpoint banks send the
+	// client back to.
+	CallbackURL string `json:"callback_url" yaml:"callback_url"`
+	// ReturnURL is the deep link into the app the client lands on when the
+	// flow ends, unless it asked for another one.
+	ReturnURL string `json:"return_url" yaml:"return_url"`
+	// AllowedReturnURLs are the URLs a requested return URL may lead to: one
+	// with the same scheme and host, and a path under the allowed one.
+	AllowedReturnURLs []string `json:"allowed_return_urls" yaml:"allowed_return_urls"`
+	// TTL is how long the client has to approve the consent at its bank.
+	TTL time.Duration `json:"ttl" yaml:"ttl"`
+}
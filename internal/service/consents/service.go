@@ -0,0 +1,395 @@
+package consents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// ErrInvalidPermissions is returned for a permission set Lima cannot request.
+var ErrInvalidPermissions = errors.New("invalid consent permissions")
+
+const (
+	defaultExpiringWithin = 7 * 24 * time.Hour
+	defaultBatchSize      = 100
+	runTimeout            = 5 * time.Minute
+)
+
+// Service manages the consents of clients over their lifecycle: it lists
+// them, has pending ones approved at their banks, reports the ones that
+// expire soon or have expired, and renews or replaces them on request.
+type Service struct {
+	cfg        Config
+	store      Store
+	uow        UnitOfWork
+	creator    ConsentCreator
+	statuses   StatusSetter
+	authorizer Authorizer
+	revoker    Revoker
+	events     EventPublisher
+	log        *zap.Logger
+}
+
+type In struct {
+	fx.In
+
+	Config     Config
+	Store      Store
+	UnitOfWork UnitOfWork
+	Creator    ConsentCreator
+	Statuses   StatusSetter
+	Authorizer Authorizer
+	Revoker    Revoker
+	Events     EventPublisher
+}
+
+func New(log *zap.Logger, lc fx.Lifecycle, params In) *Service {
+	cfg := params.Config
+	if cfg.ExpiringWithin <= 0 {
+		cfg.ExpiringWithin = defaultExpiringWithin
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.Authorization.TTL <= 0 {
+		cfg.Authorization.TTL = defaultAuthorizationTTL
+	}
+	s := &Service{
+		cfg:        cfg,
+		store:      params.Store,
+		uow:        params.UnitOfWork,
+		creator:    params.Creator,
+		statuses:   params.Statuses,
+		authorizer: params.Authorizer,
+		revoker:    params.Revoker,
+		events:     params.Events,
+		log:        log,
+	}
+	if cfg.ExpiryInterval <= 0 {
+		return s
+	}
+	stop := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			go s.loop(stop)
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			close(stop)
+			return nil
+		},
+	})
+	return s
+}
+
+func (s *Service) loop(stop <-chan struct{}) {
+	ticker := time.NewTicker(s.cfg.ExpiryInterval)
+	defer ticker.Stop()
+	for {
+		s.run()
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) run() {
+	ctx, cancel := context.WithTimeout(context.Background(), runTimeout)
+	defer cancel()
+	n, err := s.CheckExpiry(ctx, time.Now().UTC())
+	if err != nil {
+		s.log.Error("failed to check consent expiry", zap.Int("marked", n), zap.Error(err))
+		return
+	}
+	if n > 0 {
+		s.log.Info("marked expiring consents", zap.Int("marked", n))
+	}
+}
+
+// CheckExpiry marks the approved consents past their expiry at now as
+// expired, and notes the ones expiring within the configured window, once
+// each. Every consent marked publishes an event prompting the client to renew
+// it. It returns how many consents it marked.
+func (s *Service) CheckExpiry(ctx context.Context, now time.Time) (int, error) {
+	total := 0
+	for {
+		var n int
+		err := s.uow.InTx(ctx, func(ctx context.Context) error {
+			consents, err := s.store.GetExpiringConsents(ctx, now, now.Add(s.cfg.ExpiringWithin), s.cfg.BatchSize)
+			if err != nil {
+				return err
+			}
+			for _, consent := range consents {
+				if err := s.mark(ctx, consent, now); err != nil {
+					return err
+				}
+			}
+			n = len(consents)
+			return nil
+		})
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < s.cfg.BatchSize {
+			return total, nil
+		}
+	}
+}
+
+func (s *Service) mark(ctx context.Context, consent *domain.AccountConsent, now time.Time) error {
+	expiry := domain.ConsentExpiry{
+		ConsentID:   consent.ConsentID,
+		Bank:        consent.ConsentProvider,
+		Permissions: consent.Permissions,
+		ExpiresAt:   consent.ExpiresAt,
+	}
+	var events []*domain.Event
+	if now.Before(consent.ExpiresAt) {
+		consent.ExpiryNotifiedAt = now
+		event, err := domain.NewEvent(domain.EventTypeConsentExpiring, consent.ClientID, consent.ConsentID, expiry)
+		if err != nil {
+			return err
+		}
+		events = append(events, event)
+	} else {
+		previous := consent.Status
+		consent.Status = domain.ConsentStatusExpired
+		changed, err := domain.NewEvent(domain.EventTypeConsentStatusChanged, consent.ClientID, consent.ConsentID, domain.ConsentStatusChanged{
+			ConsentID:      consent.ConsentID,
+			Bank:           consent.ConsentProvider,
+			PreviousStatus: previous,
+			Status:         consent.Status,
+		})
+		if err != nil {
+			return err
+		}
+		expired, err := domain.NewEvent(domain.EventTypeConsentExpired, consent.ClientID, consent.ConsentID, expiry)
+		if err != nil {
+			return err
+		}
+		events = append(events, changed, expired)
+	}
+	if err := s.store.UpdateConsent(ctx, consent, consent.ConsentProvider); err != nil {
+		return err
+	}
+	return s.events.Publish(ctx, events...)
+}
+
+// Reconsent asks the bank of the consent of the client for a new consent
+// with the same permissions and returns it. The previous consent is kept as
+// it is.
+func (s *Service) Reconsent(ctx context.Context, clientID, consentID string) (*domain.AccountConsent, error) {
+	previous, err := s.consent(ctx, clientID, consentID)
+	if err != nil {
+		return nil, err
+	}
+	bank := previous.ConsentProvider
+	created, err := s.creator.CreateAccountsConsents(ctx, map[string]*domain.AccountConsent{
+		bank: {
+			ClientID:           previous.ClientID,
+			Permissions:        previous.Permissions,
+			Reason:             previous.Reason,
+			RequestingBank:     previous.RequestingBank,
+			RequestingBankName: previous.RequestingBankName,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created[bank], nil
+}
+
+// List returns the consents of the client across banks matching filter,
+// by bank and newest first, with the accounts the active ones give access to.
+func (s *Service) List(ctx context.Context, clientID string, filter domain.ConsentFilter) ([]*domain.ConsentOverview, error) {
+	consents, err := s.store.GetConsents(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := s.store.ListAccounts(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	byBank := make(map[string][]*domain.Account)
+	for _, account := range accounts {
+		byBank[account.Bank] = append(byBank[account.Bank], account)
+	}
+	now := time.Now()
+	overviews := make([]*domain.ConsentOverview, 0, len(consents))
+	for _, consent := range consents {
+		active := consent.Authorize(now) == nil
+		if !matches(consent, active, filter) {
+			continue
+		}
+		overview := &domain.ConsentOverview{
+			AccountConsent: *consent,
+			Active:         active,
+			Accounts:       make([]*domain.Account, 0),
+		}
+		if active {
+			overview.Accounts = append(overview.Accounts, byBank[consent.ConsentProvider]...)
+		}
+		overviews = append(overviews, overview)
+	}
+	slices.SortStableFunc(overviews, func(a, b *domain.ConsentOverview) int {
+		if c := strings.Compare(a.ConsentProvider, b.ConsentProvider); c != 0 {
+			return c
+		}
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return overviews, nil
+}
+
+func matches(consent *domain.AccountConsent, active bool, filter domain.ConsentFilter) bool {
+	switch {
+	case filter.Bank != "" && consent.ConsentProvider != filter.Bank,
+		filter.Status != "" && consent.Status != filter.Status,
+		filter.Permission != "" && !slices.Contains(consent.Permissions, filter.Permission),
+		filter.Active != nil && active != *filter.Active,
+		!filter.ExpiresBefore.IsZero() && (consent.ExpiresAt.IsZero() || !consent.ExpiresAt.Before(filter.ExpiresBefore)):
+		return false
+	}
+	return true
+}
+
+// Replace changes the permissions of a consent of the client by asking its
+// bank for a new consent with permissions. The previous consent is revoked
+// once the new one is approved, right away for banks that approve on request.
+func (s *Service) Replace(ctx context.Context, clientID, consentID string, permissions []string) (*domain.AccountConsent, error) {
+	permissions, err := validPermissions(permissions)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := s.consent(ctx, clientID, consentID)
+	if err != nil {
+		return nil, err
+	}
+	bank := previous.ConsentProvider
+	created, err := s.creator.CreateAccountsConsents(ctx, map[string]*domain.AccountConsent{
+		bank: {
+			ClientID:           previous.ClientID,
+			Permissions:        permissions,
+			Reason:             previous.Reason,
+			RequestingBank:     previous.RequestingBank,
+			RequestingBankName: previous.RequestingBankName,
+			ReplacesConsentID:  previous.ConsentID,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	replacement := created[bank]
+	if replacement.Status == domain.ConsentStatusApproved {
+		s.retire(ctx, replacement)
+	}
+	return replacement, nil
+}
+
+// retire revokes the consent replaced by an approved one. The replacement is
+// in place either way, so failures are only logged.
+func (s *Service) retire(ctx context.Context, replacement *domain.AccountConsent) {
+	if replacement.ReplacesConsentID == "" {
+		return
+	}
+	previous, err := s.consent(ctx, replacement.ClientID, replacement.ReplacesConsentID)
+	if err != nil {
+		s.log.Warn("failed to find replaced consent", zap.String("bank", replacement.ConsentProvider), zap.Error(err))
+		return
+	}
+	if previous.Status != domain.ConsentStatusApproved && previous.Status != domain.ConsentStatusPending {
+		return
+	}
+	if err := s.revoker.RevokeConsent(ctx, previous); err != nil {
+		s.log.Warn("failed to revoke replaced consent", zap.String("bank", previous.ConsentProvider), zap.Error(err))
+		return
+	}
+	if err := s.statuses.SetConsentStatus(ctx, previous, domain.ConsentStatusRevoked); err != nil {
+		s.log.Warn("failed to record revoked consent", zap.String("bank", previous.ConsentProvider), zap.Error(err))
+	}
+}
+
+func validPermissions(permissions []string) ([]string, error) {
+	if len(permissions) == 0 {
+		return nil, fmt.Errorf("%w: none given", ErrInvalidPermissions)
+	}
+	valid := make([]string, 0, len(permissions))
+	for _, permission := range permissions {
+		if !slices.Contains(domain.Permissions, permission) {
+			return nil, fmt.Errorf("%w: unknown %s", ErrInvalidPermissions, permission)
+		}
+		if !slices.Contains(valid, permission) {
+			valid = append(valid, permission)
+		}
+	}
+	return valid, nil
+}
+
+func (s *Service) consent(ctx context.Context, clientID, consentID string) (*domain.AccountConsent, error) {
+	consents, err := s.store.GetConsents(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	for _, consent := range consents {
+		if consent.ConsentID == consentID {
+			return consent, nil
+		}
+	}
+	return nil, fmt.Errorf("consent %s: %w", consentID, domain.ErrNotFound)
+}
+
+// UnitOfWork groups repository calls made with the ctx passed to f into a single atomic change.
+type UnitOfWork interface {
+	InTx(ctx context.Context, f func(ctx context.Context) error) error
+}
+
+// EventPublisher writes domain events within the unit of work of ctx.
+type EventPublisher interface {
+	Publish(ctx context.Context, events ...*domain.Event) error
+}
+
+// ConsentCreator requests consents from banks and records them.
+type ConsentCreator interface {
+	CreateAccountsConsents(ctx context.Context, consents map[string]*domain.AccountConsent) (map[string]*domain.AccountConsent, error)
+}
+
+// StatusSetter moves a consent to a new status and records the change.
+type StatusSetter interface {
+	SetConsentStatus(ctx context.Context, consent *domain.AccountConsent, status string) error
+}
+
+// Authorizer runs the approval of consents at their banks.
+type Authorizer interface {
+	AuthorizationURL(consent *domain.AccountConsent, redirect domain.ConsentAuthorizationRedirect) (string, error)
+	CompleteAuthorization(ctx context.Context, consent *domain.AccountConsent, code, codeVerifier, redirectURI string) (*domain.AccountConsent, error)
+}
+
+// Revoker withdraws consents at their banks.
+type Revoker interface {
+	RevokeConsent(ctx context.Context, consent *domain.AccountConsent) error
+}
+
+type Store interface {
+	GetConsents(ctx context.Context, clientID string) ([]*domain.AccountConsent, error)
+	ListAccounts(ctx context.Context, clientID string) ([]*domain.Account, error)
+	UpdateConsent(ctx context.Context, consent *domain.AccountConsent, consentProvider string) error
+	// GetExpiringConsents returns up to limit approved consents that expire
+	// before before and either have expired at now or have not been
+	// notified about yet, locked until the unit of work ends.
+	GetExpiringConsents(ctx context.Context, now, before time.Time, limit int) ([]*domain.AccountConsent, error)
+	// SaveConsentAuthorization stores a started authorisation, dropping the
+	// ones expired at now.
+	SaveConsentAuthorization(ctx context.Context, authorization *domain.ConsentAuthorization, now time.Time) error
+	// TakeConsentAuthorization removes and returns the authorisation with
+	// the state hash, domain.ErrNotFound if there is none unexpired at now.
+	TakeConsentAuthorization(ctx context.Context, stateHash string, now time.Time) (*domain.ConsentAuthorization, error)
+}
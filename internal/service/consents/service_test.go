@@ -0,0 +1,279 @@
+package consents_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/internal/infra/memory"
+	"github.com/MichaelSBoop/lima-backend/internal/service/consents"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+// bank creates, approves and revokes consents like a sandbox bank, keeping
+// them in store.
+type bank struct {
+	store *memory.Store
+
+	mu sync.Mutex
+	// autoApprove approves created consents at once.
+	autoApprove bool
+	// challenges are the PKCE code challenges sent to the bank, by state.
+	challenges map[string]string
+	// revokeErr fails revocations.
+	revokeErr error
+	revoked   []string
+	created   int
+}
+
+func (b *bank) CreateAccountsConsents(ctx context.Context, requested map[string]*domain.AccountConsent) (map[string]*domain.AccountConsent, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	res := make(map[string]*domain.AccountConsent, len(requested))
+	for name, consent := range requested {
+		b.created++
+		created := *consent
+		created.ConsentID = fmt.Sprintf("consent-new-%d", b.created)
+		created.ConsentProvider = name
+		created.Status = domain.ConsentStatusPending
+		if b.autoApprove {
+			created.Status = domain.ConsentStatusApproved
+		}
+		if err := b.store.SaveConsent(ctx, &created, name); err != nil {
+			return nil, err
+		}
+		res[name] = &created
+	}
+	return res, nil
+}
+
+func (b *bank) AuthorizationURL(consent *domain.AccountConsent, redirect domain.ConsentAuthorizationRedirect) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.challenges == nil {
+		b.challenges = make(map[string]string)
+	}
+	b.challenges[redirect.State] = redirect.CodeChallenge
+	return "https://" + consent.ConsentProvider + ".example/authorize?state=" + redirect.State, nil
+}
+
+func (b *bank) CompleteAuthorization(_ context.Context, consent *domain.AccountConsent, code, codeVerifier, _ string) (*domain.AccountConsent, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// The code is the state the bank issued it for, so the verifier can be
+	// checked against the challenge of that flow.
+	sum := sha256.Sum256([]byte(codeVerifier))
+	if b.challenges[code] != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		return nil, errors.New("invalid_grant")
+	}
+	approved := *consent
+	approved.Status = domain.ConsentStatusApproved
+	approved.ExpiresAt = time.Now().UTC().Add(90 * 24 * time.Hour)
+	return &approved, nil
+}
+
+func (b *bank) RevokeConsent(_ context.Context, consent *domain.AccountConsent) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.revokeErr != nil {
+		return b.revokeErr
+	}
+	b.revoked = append(b.revoked, consent.ConsentID)
+	return nil
+}
+
+// statuses records status changes in store, as the accounts service does.
+type statuses struct {
+	store *memory.Store
+}
+
+func (s statuses) SetConsentStatus(ctx context.Context, consent *domain.AccountConsent, status string) error {
+	consent.Status = status
+	return s.store.UpdateConsent(ctx, consent, consent.ConsentProvider)
+}
+
+// publisher collects the events published.
+type publisher struct {
+	mu     sync.Mutex
+	events []*domain.Event
+}
+
+func (p *publisher) Publish(_ context.Context, events ...*domain.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, events...)
+	return nil
+}
+
+// take returns the types of the events published since the last call.
+func (p *publisher) take() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	res := make([]string, 0, len(p.events))
+	for _, event := range p.events {
+		res = append(res, event.Type)
+	}
+	p.events = nil
+	return res
+}
+
+type fixture struct {
+	store  *memory.Store
+	bank   *bank
+	events *publisher
+	s      *consents.Service
+}
+
+func newFixture(t *testing.T, cfg consents.Config, saved ...*domain.AccountConsent) *fixture {
+	t.Helper()
+	store := memory.New(zap.NewNop())
+	for _, consent := range saved {
+		if err := store.SaveConsent(context.Background(), consent, consent.ConsentProvider); err != nil {
+			t.Fatalf("SaveConsent: %v", err)
+		}
+	}
+	f := &fixture{store: store, bank: &bank{store: store}, events: &publisher{}}
+	f.s = consents.New(zap.NewNop(), fxtest.NewLifecycle(t), consents.In{
+		Config:     cfg,
+		Store:      store,
+		UnitOfWork: store,
+		Creator:    f.bank,
+		Statuses:   statuses{store: store},
+		Authorizer: f.bank,
+		Revoker:    f.bank,
+		Events:     f.events,
+	})
+	return f
+}
+
+// status returns the stored status of the consent of client c1.
+func (f *fixture) status(t *testing.T, consentID string) string {
+	t.Helper()
+	stored, err := f.store.GetConsents(context.Background(), "c1")
+	if err != nil {
+		t.Fatalf("GetConsents: %v", err)
+	}
+	for _, consent := range stored {
+		if consent.ConsentID == consentID {
+			return consent.Status
+		}
+	}
+	t.Fatalf("consent %s not stored", consentID)
+	return ""
+}
+
+func approved(consentID string, expiresAt time.Time) *domain.AccountConsent {
+	return &domain.AccountConsent{
+		ClientID:        "c1",
+		ConsentID:       consentID,
+		ConsentProvider: "vbank",
+		Status:          domain.ConsentStatusApproved,
+		Permissions:     []string{domain.PermissionReadAccountsDetail},
+		ExpiresAt:       expiresAt,
+	}
+}
+
+func TestCheckExpiryNotifiesOncePerConsent(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	f := newFixture(t, consents.Config{ExpiringWithin: 7 * day, BatchSize: 2},
+		approved("soon-1", now.Add(3*day)),
+		approved("soon-2", now.Add(4*day)),
+		approved("soon-3", now.Add(5*day)),
+		approved("later", now.Add(30*day)),
+		approved("expired", now.Add(-day)),
+		&domain.AccountConsent{ClientID: "c1", ConsentID: "revoked", ConsentProvider: "vbank", Status: domain.ConsentStatusRevoked, ExpiresAt: now.Add(-day)},
+	)
+	expiring, changed, expired := domain.EventTypeConsentExpiring, domain.EventTypeConsentStatusChanged, domain.EventTypeConsentExpired
+
+	steps := []struct {
+		at         time.Time
+		wantMarked int
+		wantEvents []string
+	}{
+		// Marked across batches, each once.
+		{at: now, wantMarked: 4, wantEvents: []string{changed, expired, expiring, expiring, expiring}},
+		{at: now.Add(time.Hour), wantMarked: 0, wantEvents: []string{}},
+		// soon-1 and soon-2 expire after their notice.
+		{at: now.Add(4*day + time.Hour), wantMarked: 2, wantEvents: []string{changed, expired, changed, expired}},
+		// later comes into the window.
+		{at: now.Add(24 * day), wantMarked: 2, wantEvents: []string{changed, expired, expiring}},
+		{at: now.Add(24*day + time.Hour), wantMarked: 0, wantEvents: []string{}},
+	}
+	for i, step := range steps {
+		n, err := f.s.CheckExpiry(context.Background(), step.at)
+		if err != nil {
+			t.Fatalf("step %d: CheckExpiry: %v", i, err)
+		}
+		if n != step.wantMarked {
+			t.Errorf("step %d: marked %d, want %d", i, n, step.wantMarked)
+		}
+		if got := f.events.take(); !slices.Equal(got, step.wantEvents) {
+			t.Errorf("step %d: published %q, want %q", i, got, step.wantEvents)
+		}
+	}
+	for consentID, want := range map[string]string{
+		"soon-1":  domain.ConsentStatusExpired,
+		"soon-3":  domain.ConsentStatusExpired,
+		"later":   domain.ConsentStatusApproved,
+		"expired": domain.ConsentStatusExpired,
+		"revoked": domain.ConsentStatusRevoked,
+	} {
+		if got := f.status(t, consentID); got != want {
+			t.Errorf("consent %s is %s, want %s", consentID, got, want)
+		}
+	}
+}
+
+func TestReplaceRetiresThePreviousConsent(t *testing.T) {
+	permissions := []string{domain.PermissionReadAccountsDetail, domain.PermissionReadBalances}
+	tests := []struct {
+		name        string
+		autoApprove bool
+		revokeErr   error
+		wantStatus  string
+		// wantPrevious is the status the replaced consent is left with.
+		wantPrevious string
+	}{
+		{name: "approved on request", autoApprove: true, wantStatus: domain.ConsentStatusApproved, wantPrevious: domain.ConsentStatusRevoked},
+		{name: "pending approval", wantStatus: domain.ConsentStatusPending, wantPrevious: domain.ConsentStatusApproved},
+		{name: "revocation failed", autoApprove: true, revokeErr: errors.New("bank is down"), wantStatus: domain.ConsentStatusApproved, wantPrevious: domain.ConsentStatusApproved},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t, consents.Config{}, approved("old", time.Now().Add(time.Hour)))
+			f.bank.autoApprove, f.bank.revokeErr = tt.autoApprove, tt.revokeErr
+
+			replacement, err := f.s.Replace(context.Background(), "c1", "old", permissions)
+			if err != nil {
+				t.Fatalf("Replace: %v", err)
+			}
+			if replacement.Status != tt.wantStatus || replacement.ReplacesConsentID != "old" || !slices.Equal(replacement.Permissions, permissions) {
+				t.Errorf("got %+v", replacement)
+			}
+			if got := f.status(t, "old"); got != tt.wantPrevious {
+				t.Errorf("replaced consent is %s, want %s", got, tt.wantPrevious)
+			}
+		})
+	}
+}
+
+func TestReplaceRejectsUnknownPermissions(t *testing.T) {
+	f := newFixture(t, consents.Config{}, approved("old", time.Now().Add(time.Hour)))
+	for _, permissions := range [][]string{nil, {"ReadEverything"}} {
+		if _, err := f.s.Replace(context.Background(), "c1", "old", permissions); !errors.Is(err, consents.ErrInvalidPermissions) {
+			t.Errorf("Replace(%q) = %v, want ErrInvalidPermissions", permissions, err)
+		}
+	}
+	if f.bank.created != 0 {
+		t.Errorf("asked the bank for %d consents", f.bank.created)
+	}
+}
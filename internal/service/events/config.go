@@ -0,0 +1,23 @@
+package events
+
+import "time"
+
+type Config struct {
+	// DispatchInterval is how often the outbox is polled for events committed
+	// since the last dispatch.
+	DispatchInterval time.Duration `json:"dispatch_interval" yaml:"dispatch_interval"`
+	BatchSize        int           `json:"batch_size" yaml:"batch_size"`
+	// MaxAttempts is how many times an event is dispatched before it is set
+	// aside as failed. It still holds back the later events of its aggregate
+	// until it is retried.
+	MaxAttempts int           `json:"max_attempts" yaml:"max_attempts"`
+	Webhook     WebhookConfig `json:"webhook" yaml:"webhook"`
+}
+
+// WebhookConfig configures the webhook sink. The sink is disabled without a URL.
+type WebhookConfig struct {
+	URL     string        `json:"url" yaml:"url"`
+	Timeout time.Duration `json:"timeout" yaml:"timeout"`
+	// SigningSecret signs webhook bodies with HMAC-SHA256 when set.
+	SigningSecret string `json:"signing_secret" yaml:"signing_secret"`
+}
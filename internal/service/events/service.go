@@ -0,0 +1,328 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/google/uuid"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultDispatchInterval = 5 * time.Second
+	defaultBatchSize        = 100
+	defaultMaxAttempts      = 10
+	dispatchTimeout         = 2 * time.Minute
+	// claimLease is how long claimed events are left to their dispatcher. It
+	// outlasts the dispatch that claimed them by claimMargin, so only the
+	// events of a dispatcher that died are claimed again.
+	claimLease  = dispatchTimeout + claimMargin
+	claimMargin = 30 * time.Second
+	// maxRetryBackoff caps the wait before an event that failed is claimed again.
+	maxRetryBackoff    = 10 * time.Minute
+	defaultFailedLimit = 100
+	// subscribersDelivery marks in Event.Delivered that the subscribers
+	// handled the event.
+	subscribersDelivery = "subscribers"
+)
+
+// Subscriber reacts to domain events in process.
+type Subscriber interface {
+	// EventTypes lists the types of the events the subscriber handles.
+	EventTypes() []string
+	HandleEvent(ctx context.Context, event *domain.Event) error
+}
+
+// Sink forwards domain events to a system outside of the process.
+type Sink interface {
+	Name() string
+	Publish(ctx context.Context, event *domain.Event) error
+}
+
+// Service is the domain event bus. Events are published into the outbox
+// within the unit of work of the state change they record, and dispatched to
+// subscribers and sinks once it commits. Delivery is at least once: an event
+// is dispatched again to the subscribers or sinks that failed it, and to the
+// sinks if its dispatcher stops before recording the outcome.
+//
+// The events of an aggregate are delivered one at a time, in the order their
+// units of work committed: only the oldest undelivered event of each
+// aggregate is claimed, and one that keeps failing holds the later ones back,
+// past MaxAttempts as a failed event until an operator retries it. Events of
+// different aggregates do not wait for each other.
+type Service struct {
+	cfg         Config
+	store       Store
+	uow         UnitOfWork
+	subscribers map[string][]Subscriber
+	sinks       []Sink
+	log         *zap.Logger
+
+	// wake asks the dispatcher to look at the outbox without waiting for the next tick.
+	wake chan struct{}
+}
+
+type In struct {
+	fx.In
+
+	Config      Config
+	Store       Store
+	UnitOfWork  UnitOfWork
+	Subscribers []Subscriber `group:"event_subscribers"`
+	Sinks       []Sink       `group:"event_sinks"`
+}
+
+func New(log *zap.Logger, lc fx.Lifecycle, params In) *Service {
+	cfg := params.Config
+	if cfg.DispatchInterval <= 0 {
+		cfg.DispatchInterval = defaultDispatchInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	s := &Service{
+		cfg:         cfg,
+		store:       params.Store,
+		uow:         params.UnitOfWork,
+		subscribers: make(map[string][]Subscriber),
+		sinks:       params.Sinks,
+		log:         log,
+		wake:        make(chan struct{}, 1),
+	}
+	for _, subscriber := range params.Subscribers {
+		for _, eventType := range subscriber.EventTypes() {
+			s.subscribers[eventType] = append(s.subscribers[eventType], subscriber)
+		}
+	}
+	stop := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			go s.dispatchLoop(stop)
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			close(stop)
+			return nil
+		},
+	})
+	return s
+}
+
+// Publish writes events to the outbox. Call it with the ctx of the unit of
+// work that makes the change, so that the events are kept only if it commits.
+func (s *Service) Publish(ctx context.Context, events ...*domain.Event) error {
+	now := time.Now().UTC()
+	for _, event := range events {
+		if event.EventID == "" {
+			event.EventID = uuid.NewString()
+		}
+		if event.OccurredAt.IsZero() {
+			event.OccurredAt = now
+		}
+		event.Status = domain.EventStatusPending
+	}
+	if err := s.store.SaveOutboxEvents(ctx, events); err != nil {
+		return err
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (s *Service) dispatchLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(s.cfg.DispatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+		s.dispatch()
+	}
+}
+
+// dispatch delivers the pending events of the outbox until none are left
+// that can be delivered now.
+func (s *Service) dispatch() {
+	ctx, cancel := context.WithTimeout(context.Background(), dispatchTimeout)
+	defer cancel()
+	for {
+		more, err := s.dispatchBatch(ctx)
+		if err != nil {
+			s.log.Warn("failed to dispatch events", zap.Error(err))
+			return
+		}
+		if !more {
+			return
+		}
+	}
+}
+
+// dispatchBatch delivers the next batch of events at the head of their
+// aggregate. The events are claimed in a unit of work of their own, delivered
+// without any outbox row locked, and each outcome is recorded as it comes. An
+// event that could not be delivered is not claimed again before its backoff
+// ends, and keeps the later events of its aggregate back meanwhile. It
+// reports whether more events may be waiting.
+func (s *Service) dispatchBatch(ctx context.Context) (bool, error) {
+	events, err := s.claim(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, event := range events {
+		err := s.deliver(ctx, event)
+		now := time.Now().UTC()
+		event.Attempts++
+		event.ClaimedUntil = time.Time{}
+		switch {
+		case err == nil:
+			event.Status = domain.EventStatusDispatched
+			event.LastError = ""
+			event.DispatchedAt = now
+		case event.Attempts >= s.cfg.MaxAttempts:
+			event.Status = domain.EventStatusFailed
+			event.LastError = err.Error()
+		default:
+			event.LastError = err.Error()
+			event.ClaimedUntil = now.Add(s.retryBackoff(event.Attempts))
+		}
+		if err != nil {
+			s.log.Warn("failed to dispatch event",
+				zap.String("event_id", event.EventID),
+				zap.String("type", event.Type),
+				zap.String("aggregate_id", event.AggregateID),
+				zap.Int("attempts", event.Attempts),
+				zap.Error(err))
+		}
+		if err := s.store.UpdateOutboxEvent(ctx, event); err != nil {
+			return false, err
+		}
+	}
+	return len(events) > 0, nil
+}
+
+// claim takes up to a batch of events at the head of their aggregate for
+// this dispatcher.
+func (s *Service) claim(ctx context.Context) ([]*domain.Event, error) {
+	var claimed []*domain.Event
+	err := s.uow.InTx(ctx, func(ctx context.Context) error {
+		now := time.Now().UTC()
+		events, err := s.store.HeadOutboxEvents(ctx, now, s.cfg.BatchSize)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			event.ClaimedUntil = now.Add(claimLease)
+			if err := s.store.UpdateOutboxEvent(ctx, event); err != nil {
+				return err
+			}
+		}
+		claimed = events
+		return nil
+	})
+	return claimed, err
+}
+
+// retryBackoff is how long an event waits after its attempts-th failed delivery.
+func (s *Service) retryBackoff(attempts int) time.Duration {
+	return min(s.cfg.DispatchInterval<<min(attempts-1, 16), maxRetryBackoff)
+}
+
+// Failed lists up to limit events set aside after MaxAttempts, oldest first,
+// starting after the sequence after.
+func (s *Service) Failed(ctx context.Context, after int64, limit int) ([]*domain.Event, error) {
+	if limit <= 0 || limit > defaultFailedLimit {
+		limit = defaultFailedLimit
+	}
+	return s.store.FailedOutboxEvents(ctx, after, limit)
+}
+
+// Retry puts a failed event back in the outbox with its attempts reset, to
+// be delivered before the events of its aggregate it held back. It returns
+// domain.ErrNotFound if no failed event has the ID.
+func (s *Service) Retry(ctx context.Context, eventID string) error {
+	if _, err := uuid.Parse(eventID); err != nil {
+		return fmt.Errorf("outbox event %s: %w", eventID, domain.ErrNotFound)
+	}
+	if err := s.store.RetryOutboxEvent(ctx, eventID); err != nil {
+		return err
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// deliver hands event to its subscribers and then to every sink. Changes the
+// subscribers make through ctx are rolled back if any of them fails, and
+// commit together with the record that they handled event. Sinks are called
+// outside of any transaction, and each one that accepts event is recorded so
+// that a later attempt only calls the ones that failed.
+func (s *Service) deliver(ctx context.Context, event *domain.Event) error {
+	if !slices.Contains(event.Delivered, subscribersDelivery) {
+		delivered := event.Delivered
+		err := s.uow.InTx(ctx, func(ctx context.Context) error {
+			for _, subscriber := range s.subscribers[event.Type] {
+				if err := subscriber.HandleEvent(ctx, event); err != nil {
+					return fmt.Errorf("subscriber %T: %w", subscriber, err)
+				}
+			}
+			event.Delivered = append(slices.Clone(delivered), subscribersDelivery)
+			return s.store.UpdateOutboxEvent(ctx, event)
+		})
+		if err != nil {
+			event.Delivered = delivered
+			return err
+		}
+	}
+	var errs []error
+	for _, sink := range s.sinks {
+		if slices.Contains(event.Delivered, sink.Name()) {
+			continue
+		}
+		if err := sink.Publish(ctx, event); err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %w", sink.Name(), err))
+			continue
+		}
+		event.Delivered = append(event.Delivered, sink.Name())
+	}
+	return errors.Join(errs...)
+}
+
+type UnitOfWork interface {
+	InTx(ctx context.Context, f func(ctx context.Context) error) error
+}
+
+type Store interface {
+	// SaveOutboxEvents appends events to the outbox, assigning their sequence.
+	// Units of work saving events of the same client take turns, so that the
+	// events of an aggregate are numbered in the order their units of work
+	// commit.
+	SaveOutboxEvents(ctx context.Context, events []*domain.Event) error
+	// HeadOutboxEvents returns, in sequence order, up to limit events that are
+	// the oldest undispatched event of their aggregate, pending, and not
+	// claimed at now. A failed event is the head of its aggregate until it is
+	// retried. The events are locked until the unit of work of ctx ends, and
+	// the ones locked by other dispatchers are skipped.
+	HeadOutboxEvents(ctx context.Context, now time.Time, limit int) ([]*domain.Event, error)
+	UpdateOutboxEvent(ctx context.Context, event *domain.Event) error
+	// FailedOutboxEvents returns up to limit failed events in sequence order,
+	// starting after the sequence after.
+	FailedOutboxEvents(ctx context.Context, after int64, limit int) ([]*domain.Event, error)
+	// RetryOutboxEvent makes the failed event pending again with no attempts,
+	// domain.ErrNotFound if there is no such failed event.
+	RetryOutboxEvent(ctx context.Context, eventID string) error
+}
@@ -0,0 +1,240 @@
+package events_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/internal/infra/memory"
+	"github.com/MichaelSBoop/lima-backend/internal/service/events"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+const testEventType = "test.happened"
+
+// recorder is a subscriber that records the aggregates and sequences it
+// handled and fails while fail says so.
+type recorder struct {
+	mu      sync.Mutex
+	handled []string
+	fail    func(event *domain.Event) bool
+}
+
+func (r *recorder) EventTypes() []string { return []string{testEventType} }
+
+func (r *recorder) HandleEvent(_ context.Context, event *domain.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail != nil && r.fail(event) {
+		return errors.New("subscriber is down")
+	}
+	r.handled = append(r.handled, event.AggregateID+"/"+event.EventID)
+	return nil
+}
+
+func (r *recorder) setFail(fail func(event *domain.Event) bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fail = fail
+}
+
+func (r *recorder) snapshot() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.handled)
+}
+
+// flakySink is a sink that fails its first fails calls.
+type flakySink struct {
+	mu        sync.Mutex
+	fails     int
+	published int
+}
+
+func (s *flakySink) Name() string { return "flaky" }
+
+func (s *flakySink) Publish(context.Context, *domain.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fails > 0 {
+		s.fails--
+		return errors.New("sink is down")
+	}
+	s.published++
+	return nil
+}
+
+func (s *flakySink) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.published
+}
+
+func newService(t *testing.T, store *memory.Store, cfg events.Config, subscribers ...events.Subscriber) *events.Service {
+	t.Helper()
+	lc := fxtest.NewLifecycle(t)
+	s := events.New(zap.NewNop(), lc, events.In{
+		Config:      cfg,
+		Store:       store,
+		UnitOfWork:  store,
+		Subscribers: subscribers,
+	})
+	lc.RequireStart()
+	t.Cleanup(lc.RequireStop)
+	return s
+}
+
+func publish(t *testing.T, s *events.Service, aggregateID, eventID string) {
+	t.Helper()
+	event, err := domain.NewEvent(testEventType, "c1", aggregateID, struct{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event.EventID = eventID
+	if err = s.Publish(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDispatchOrderPerAggregate(t *testing.T) {
+	store := memory.New(zap.NewNop())
+	rec := &recorder{}
+	rec.setFail(func(event *domain.Event) bool { return event.EventID == "a1" })
+	s := newService(t, store, events.Config{DispatchInterval: 10 * time.Millisecond, MaxAttempts: 100}, rec)
+
+	publish(t, s, "a", "a1")
+	publish(t, s, "a", "a2")
+	publish(t, s, "b", "b1")
+
+	waitFor(t, "b1", func() bool { return slices.Contains(rec.snapshot(), "b/b1") })
+	time.Sleep(50 * time.Millisecond)
+	if got := rec.snapshot(); !slices.Equal(got, []string{"b/b1"}) {
+		t.Fatalf("a2 overtook the failing a1: handled %v", got)
+	}
+
+	rec.setFail(nil)
+	waitFor(t, "a2", func() bool { return len(rec.snapshot()) == 3 })
+	if got, want := rec.snapshot(), []string{"b/b1", "a/a1", "a/a2"}; !slices.Equal(got, want) {
+		t.Fatalf("handled %v, want %v", got, want)
+	}
+}
+
+func TestFailedEventHoldsAggregateUntilRetried(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New(zap.NewNop())
+	rec := &recorder{}
+	rec.setFail(func(event *domain.Event) bool { return event.EventID == "00000000-0000-0000-0000-0000000000a1" })
+	s := newService(t, store, events.Config{DispatchInterval: 10 * time.Millisecond, MaxAttempts: 2}, rec)
+
+	publish(t, s, "a", "00000000-0000-0000-0000-0000000000a1")
+	publish(t, s, "a", "00000000-0000-0000-0000-0000000000a2")
+
+	var failed []*domain.Event
+	waitFor(t, "the failed event", func() bool {
+		var err error
+		failed, err = s.Failed(ctx, 0, 0)
+		return err == nil && len(failed) == 1
+	})
+	if failed[0].Attempts != 2 || failed[0].LastError == "" {
+		t.Fatalf("got %+v, want two attempts and the last error", failed[0])
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := rec.snapshot(); len(got) != 0 {
+		t.Fatalf("events were delivered past the failed one: %v", got)
+	}
+
+	if err := s.Retry(ctx, "00000000-0000-0000-0000-0000000000a2"); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("retry of a pending event: got %v, want not found", err)
+	}
+	if err := s.Retry(ctx, "not-an-id"); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("retry of an invalid id: got %v, want not found", err)
+	}
+	rec.setFail(nil)
+	if err := s.Retry(ctx, failed[0].EventID); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "both events", func() bool { return len(rec.snapshot()) == 2 })
+	want := []string{"a/00000000-0000-0000-0000-0000000000a1", "a/00000000-0000-0000-0000-0000000000a2"}
+	if got := rec.snapshot(); !slices.Equal(got, want) {
+		t.Fatalf("handled %v, want %v", got, want)
+	}
+}
+
+func TestClaimedEventIsLeftToItsDispatcher(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New(zap.NewNop())
+	claimed := &domain.Event{
+		EventID:      "a1",
+		Type:         testEventType,
+		ClientID:     "c1",
+		AggregateID:  "a",
+		Payload:      []byte("{}"),
+		Status:       domain.EventStatusPending,
+		ClaimedUntil: time.Now().Add(time.Hour),
+	}
+	if err := store.SaveOutboxEvents(ctx, []*domain.Event{claimed}); err != nil {
+		t.Fatal(err)
+	}
+	rec := &recorder{}
+	s := newService(t, store, events.Config{DispatchInterval: 10 * time.Millisecond}, rec)
+	publish(t, s, "a", "a2")
+	publish(t, s, "b", "b1")
+
+	waitFor(t, "b1", func() bool { return slices.Contains(rec.snapshot(), "b/b1") })
+	time.Sleep(50 * time.Millisecond)
+	if got := rec.snapshot(); !slices.Equal(got, []string{"b/b1"}) {
+		t.Fatalf("claimed aggregate was dispatched: %v", got)
+	}
+
+	claimed.ClaimedUntil = time.Time{}
+	if err := store.UpdateOutboxEvent(ctx, claimed); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the lapsed claim", func() bool { return len(rec.snapshot()) == 3 })
+	if got, want := rec.snapshot(), []string{"b/b1", "a/a1", "a/a2"}; !slices.Equal(got, want) {
+		t.Fatalf("handled %v, want %v", got, want)
+	}
+}
+
+func TestFailingSinkDoesNotRedeliverToSubscribers(t *testing.T) {
+	store := memory.New(zap.NewNop())
+	rec := &recorder{}
+	flaky := &flakySink{fails: 2}
+	lc := fxtest.NewLifecycle(t)
+	s := events.New(zap.NewNop(), lc, events.In{
+		Config:      events.Config{DispatchInterval: 10 * time.Millisecond, MaxAttempts: 100},
+		Store:       store,
+		UnitOfWork:  store,
+		Subscribers: []events.Subscriber{rec},
+		Sinks:       []events.Sink{flaky},
+	})
+	lc.RequireStart()
+	t.Cleanup(lc.RequireStop)
+
+	publish(t, s, "a", "a1")
+
+	waitFor(t, "the sink", func() bool { return flaky.count() == 1 })
+	time.Sleep(50 * time.Millisecond)
+	if got := rec.snapshot(); !slices.Equal(got, []string{"a/a1"}) {
+		t.Fatalf("subscribers handled %v, want a1 once", got)
+	}
+	if got := flaky.count(); got != 1 {
+		t.Fatalf("sink published %d times, want once", got)
+	}
+}
@@ -0,0 +1,71 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+)
+
+const defaultWebhookTimeout = 10 * time.Second
+
+// WebhookSink posts every event as JSON to the configured URL.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+	secret []byte
+}
+
+func NewWebhookSink(cfg Config) *WebhookSink {
+	timeout := cfg.Webhook.Timeout
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	return &WebhookSink{
+		url:    cfg.Webhook.URL,
+		client: &http.Client{Timeout: timeout},
+		secret: []byte(cfg.Webhook.SigningSecret),
+	}
+}
+
+func (s *WebhookSink) Name() string { return "webhook" }
+
+func (s *WebhookSink) Publish(ctx context.Context, event *domain.Event) error {
+	if s.url == "" {
+		return nil
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Lima-Event", event.Type)
+	req.Header.Set("X-Lima-Event-Id", event.EventID)
+	if len(s.secret) > 0 {
+		mac := hmac.New(sha256.New, s.secret)
+		mac.Write(body)
+		req.Header.Set("X-Lima-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package notifications
+
+import "time"
+
+type Config struct {
+	// MaxAttempts is how many times a delivery is tried before it is given up.
+	MaxAttempts int `json:"max_attempts" yaml:"max_attempts"`
+	// RetryInterval is the delay before the first retry, doubled on each next one.
+	RetryInterval time.Duration `json:"retry_interval" yaml:"retry_interval"`
+	// DispatchInterval is how often due retries are picked up. Zero disables retries.
+	DispatchInterval time.Duration `json:"dispatch_interval" yaml:"dispatch_interval"`
+	Webhook          WebhookConfig `json:"webhook" yaml:"webhook"`
+	SMTP             SMTPConfig    `json:"smtp" yaml:"smtp"`
+}
+
+type WebhookConfig struct {
+	Timeout time.Duration `json:"timeout" yaml:"timeout"`
+	// SigningSecret signs webhook bodies with HMAC-SHA256 when set.
+	SigningSecret string `json:"signing_secret" yaml:"signing_secret"`
+}
+
+// SMTPConfig configures email delivery. Email is disabled without a host.
+type SMTPConfig struct {
+	Host     string `json:"host" yaml:"host"`
+	Port     int    `json:"port" yaml:"port"`
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
+	From     string `json:"from" yaml:"from"`
+	// Timeout bounds a whole delivery, from dialing to the end of the exchange.
+	Timeout time.Duration `json:"timeout" yaml:"timeout"`
+}
@@ -0,0 +1,71 @@
+package notifications
+
+import (
+	"context"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+)
+
+// EventTypes lists the domain events the service turns into notifications.
+func (s *Service) EventTypes() []string {
+	return []string{
+		domain.EventTypeConsentCreated,
+		domain.EventTypeConsentStatusChanged,
+		domain.EventTypeConsentExpiring,
+		domain.EventTypeConsentExpired,
+	}
+}
+
+// HandleEvent notifies the client about the domain event.
+func (s *Service) HandleEvent(ctx context.Context, event *domain.Event) error {
+	var consentID, bank, status string
+	switch event.Type {
+	case domain.EventTypeConsentExpiring, domain.EventTypeConsentExpired:
+		return s.notifyExpiry(ctx, event)
+	case domain.EventTypeConsentCreated:
+		var payload domain.ConsentCreated
+		if err := event.Decode(&payload); err != nil {
+			return err
+		}
+		consentID, bank, status = payload.ConsentID, payload.Bank, payload.Status
+	case domain.EventTypeConsentStatusChanged:
+		var payload domain.ConsentStatusChanged
+		if err := event.Decode(&payload); err != nil {
+			return err
+		}
+		consentID, bank, status = payload.ConsentID, payload.Bank, payload.Status
+	default:
+		return nil
+	}
+	if status != domain.ConsentStatusApproved {
+		return nil
+	}
+	return s.Notify(ctx, &domain.Notification{
+		ClientID:  event.ClientID,
+		Event:     domain.EventConsentApproved,
+		Data:      map[string]string{"bank": bank, "consent_id": consentID},
+		CreatedAt: event.OccurredAt,
+	})
+}
+
+// notifyExpiry prompts the client to renew a consent that expires soon or has expired.
+func (s *Service) notifyExpiry(ctx context.Context, event *domain.Event) error {
+	var payload domain.ConsentExpiry
+	if err := event.Decode(&payload); err != nil {
+		return err
+	}
+	n := &domain.Notification{
+		ClientID:  event.ClientID,
+		Event:     domain.EventConsentExpiring,
+		Data:      map[string]string{"bank": payload.Bank, "consent_id": payload.ConsentID},
+		CreatedAt: event.OccurredAt,
+	}
+	date := payload.ExpiresAt.Format(time.DateOnly)
+	if event.Type == domain.EventTypeConsentExpired {
+		n.Event, n.Data["expired_at"] = domain.EventConsentExpired, date
+	} else {
+		n.Data["expires_at"] = date
+	}
+	return s.Notify(ctx, n)
+}
@@ -0,0 +1,331 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/netip"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultWebhookTimeout = 10 * time.Second
+	defaultSMTPTimeout    = 30 * time.Second
+)
+
+var (
+	ErrChannelDisabled = errors.New("notification channel is not configured")
+	// ErrForbiddenAddress is returned for webhooks resolving to an address
+	// inside our own network.
+	ErrForbiddenAddress = errors.New("webhook address is not public")
+)
+
+// internalPrefixes are the ranges not reachable from the internet, beyond
+// the loopback, private and link-local ones netip reports.
+var internalPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// Sender delivers rendered notifications over a channel.
+type Sender interface {
+	Channel() string
+	Send(ctx context.Context, delivery *domain.NotificationDelivery) error
+}
+
+// WebhookSender posts notifications as JSON to the URL the client registered.
+// Targets are client controlled, so only https URLs on public addresses are
+// posted to, and redirects are not followed.
+type WebhookSender struct {
+	client *http.Client
+	secret []byte
+}
+
+func NewWebhookSender(cfg Config) *WebhookSender {
+	timeout := cfg.Webhook.Timeout
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	dialer := &net.Dialer{Timeout: timeout, Control: publicOnly}
+	return &WebhookSender{
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: timeout,
+				MaxIdleConns:        100,
+				IdleConnTimeout:     90 * time.Second,
+			},
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		secret: []byte(cfg.Webhook.SigningSecret),
+	}
+}
+
+// checkWebhookTarget accepts https URLs without credentials whose host is
+// not a literal internal address. Names are checked once resolved, on dial.
+func checkWebhookTarget(target string) error {
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme != "https" || u.Host == "" || u.User != nil {
+		return errors.New("webhook target must be an https URL")
+	}
+	if ip, err := netip.ParseAddr(strings.Trim(u.Hostname(), "[]")); err == nil && !isPublic(ip) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// publicOnly is the Control hook of the webhook dialer. It runs after DNS
+// resolution, for every address tried, so a name resolving to an internal
+// address is refused as well.
+func publicOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !isPublic(ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, ip)
+	}
+	return nil
+}
+
+func isPublic(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, prefix := range internalPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *WebhookSender) Channel() string { return domain.ChannelWebhook }
+
+type webhookPayload struct {
+	DeliveryID     string            `json:"delivery_id"`
+	NotificationID string            `json:"notification_id"`
+	ClientID       string            `json:"client_id"`
+	Event          string            `json:"event"`
+	Subject        string            `json:"subject"`
+	Body           string            `json:"body"`
+	Data           map[string]string `json:"data"`
+	CreatedAt      time.Time         `json:"created_at"`
+}
+
+func (s *WebhookSender) Send(ctx context.Context, delivery *domain.NotificationDelivery) error {
+	if err := checkWebhookTarget(delivery.Target); err != nil {
+		return err
+	}
+	body, err := json.Marshal(webhookPayload{
+		DeliveryID:     delivery.DeliveryID,
+		NotificationID: delivery.NotificationID,
+		ClientID:       delivery.ClientID,
+		Event:          delivery.Event,
+		Subject:        delivery.Subject,
+		Body:           delivery.Body,
+		Data:           delivery.Data,
+		CreatedAt:      delivery.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Lima-Event", delivery.Event)
+	req.Header.Set("X-Lima-Delivery", delivery.DeliveryID)
+	if len(s.secret) > 0 {
+		mac := hmac.New(sha256.New, s.secret)
+		mac.Write(body)
+		req.Header.Set("X-Lima-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SMTPSender emails notifications through the configured SMTP server.
+type SMTPSender struct {
+	cfg SMTPConfig
+}
+
+func NewSMTPSender(cfg Config) *SMTPSender {
+	return &SMTPSender{cfg: cfg.SMTP}
+}
+
+func (s *SMTPSender) Channel() string { return domain.ChannelEmail }
+
+// Send delivers the email within the deadline of ctx, or the configured
+// timeout without one, so an unresponsive server cannot hold the dispatcher.
+func (s *SMTPSender) Send(ctx context.Context, delivery *domain.NotificationDelivery) error {
+	if s.cfg.Host == "" {
+		return ErrChannelDisabled
+	}
+	from, err := mail.ParseAddress(s.cfg.From)
+	if err != nil {
+		return fmt.Errorf("smtp from address: %w", err)
+	}
+	to, err := mail.ParseAddress(delivery.Target)
+	if err != nil {
+		return fmt.Errorf("recipient address: %w", err)
+	}
+	var msg bytes.Buffer
+	for _, h := range [][2]string{
+		{"From", from.String()},
+		{"To", to.String()},
+		{"Subject", mime.QEncoding.Encode("utf-8", delivery.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", "<" + delivery.DeliveryID + "@lima>"},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=utf-8"},
+		{"Content-Transfer-Encoding", "8bit"},
+	} {
+		msg.WriteString(h[0] + ": " + h[1] + "\r\n")
+	}
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(delivery.Body, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	timeout := s.cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultSMTPTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+	// Cancelling ctx interrupts the exchange at once rather than at the deadline.
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+	return s.send(conn, from.Address, to.Address, msg.Bytes())
+}
+
+// send runs the SMTP exchange of smtp.SendMail over conn.
+func (s *SMTPSender) send(conn net.Conn, from, to string, msg []byte) error {
+	c, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: s.cfg.Host}); err != nil {
+			return err
+		}
+	}
+	if s.cfg.Username != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp server does not support authentication")
+		}
+		if err = c.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(from); err != nil {
+		return err
+	}
+	if err = c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// PushProvider hands messages over to a mobile push service.
+type PushProvider interface {
+	Push(ctx context.Context, deviceToken, title, body string, data map[string]string) error
+}
+
+type PushSender struct {
+	provider PushProvider
+}
+
+func NewPushSender(provider PushProvider) *PushSender {
+	return &PushSender{provider: provider}
+}
+
+func (s *PushSender) Channel() string { return domain.ChannelPush }
+
+func (s *PushSender) Send(ctx context.Context, delivery *domain.NotificationDelivery) error {
+	return s.provider.Push(ctx, delivery.Target, delivery.Subject, delivery.Body, delivery.Data)
+}
+
+// LogPushProvider only logs push messages. It stands in until a push service is integrated.
+type LogPushProvider struct {
+	log *zap.Logger
+}
+
+func NewLogPushProvider(log *zap.Logger) *LogPushProvider {
+	return &LogPushProvider{log: log}
+}
+
+func (p *LogPushProvider) Push(_ context.Context, deviceToken, title, _ string, _ map[string]string) error {
+	p.log.Info("push notification", zap.String("device_token", redactToken(deviceToken)), zap.String("title", title))
+	return nil
+}
+
+// redactToken keeps the last four characters of a device token, enough to
+// tell devices apart in the logs.
+func redactToken(token string) string {
+	if len(token) <= 8 {
+		return "***"
+	}
+	return "***" + token[len(token)-4:]
+}
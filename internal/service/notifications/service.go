@@ -0,0 +1,313 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/google/uuid"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultMaxAttempts      = 5
+	defaultRetryInterval    = time.Minute
+	defaultDispatchInterval = 30 * time.Second
+	// sendTimeout bounds one attempt at a delivery over any channel, and
+	// storeTimeout each call to the store.
+	sendTimeout  = time.Minute
+	storeTimeout = 10 * time.Second
+	// claimTimeout is how long a claimed delivery is hidden from other
+	// dispatchers. Deliveries are claimed one at a time, so the claim only
+	// has to outlast the attempt and the recording of its outcome.
+	claimTimeout = sendTimeout + storeTimeout + 30*time.Second
+	// maxBackoffShift caps the doubling of the retry interval.
+	maxBackoffShift = 10
+)
+
+var ErrInvalidPreference = errors.New("invalid notification preference")
+
+type Service struct {
+	cfg     Config
+	store   Store
+	uow     UnitOfWork
+	senders map[string]Sender
+	log     *zap.Logger
+
+	// wake asks the dispatcher to send new deliveries without waiting for the next tick.
+	wake chan struct{}
+}
+
+type In struct {
+	fx.In
+
+	Config     Config
+	Store      Store
+	UnitOfWork UnitOfWork
+	Senders    []Sender `group:"notification_senders"`
+}
+
+func New(log *zap.Logger, lc fx.Lifecycle, params In) *Service {
+	cfg := params.Config
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = defaultRetryInterval
+	}
+	if cfg.DispatchInterval <= 0 {
+		cfg.DispatchInterval = defaultDispatchInterval
+	}
+	s := &Service{
+		cfg:     cfg,
+		store:   params.Store,
+		uow:     params.UnitOfWork,
+		senders: make(map[string]Sender, len(params.Senders)),
+		log:     log,
+		wake:    make(chan struct{}, 1),
+	}
+	for _, sender := range params.Senders {
+		s.senders[sender.Channel()] = sender
+	}
+	stop := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			go s.dispatchLoop(stop)
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			close(stop)
+			return nil
+		},
+	})
+	return s
+}
+
+// Notify renders n and queues a delivery over every channel the client
+// enabled for its event. Deliveries are sent in the background.
+func (s *Service) Notify(ctx context.Context, n *domain.Notification) error {
+	if n.NotificationID == "" {
+		n.NotificationID = uuid.NewString()
+	}
+	if n.CreatedAt.IsZero() {
+		n.CreatedAt = time.Now().UTC()
+	}
+	subject, body, err := render(n)
+	if err != nil {
+		return err
+	}
+	prefs, err := s.store.GetNotificationPreferences(ctx, n.ClientID)
+	if err != nil {
+		return err
+	}
+	deliveries := make([]*domain.NotificationDelivery, 0, len(prefs))
+	for _, pref := range prefs {
+		if !pref.Enabled || (len(pref.Events) > 0 && !slices.Contains(pref.Events, n.Event)) {
+			continue
+		}
+		deliveries = append(deliveries, &domain.NotificationDelivery{
+			DeliveryID:     uuid.NewString(),
+			NotificationID: n.NotificationID,
+			ClientID:       n.ClientID,
+			Event:          n.Event,
+			Channel:        pref.Channel,
+			Target:         pref.Target,
+			Subject:        subject,
+			Body:           body,
+			Data:           n.Data,
+			Status:         domain.DeliveryStatusPending,
+			NextAttemptAt:  n.CreatedAt,
+			CreatedAt:      n.CreatedAt,
+			UpdatedAt:      n.CreatedAt,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	err = s.uow.InTx(ctx, func(ctx context.Context) error {
+		for _, delivery := range deliveries {
+			if err := s.store.SaveNotificationDelivery(ctx, delivery); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// PublishBudgetAlert notifies the client that budget crossed a threshold.
+func (s *Service) PublishBudgetAlert(ctx context.Context, budget *domain.Budget, alert *domain.BudgetAlert) error {
+	return s.Notify(ctx, &domain.Notification{
+		ClientID: alert.ClientID,
+		Event:    domain.EventBudgetAlert,
+		Data: map[string]string{
+			"budget_id": budget.BudgetID,
+			"budget":    budget.Name,
+			"threshold": strconv.Itoa(alert.Threshold),
+			"spent":     alert.Spent,
+			"available": alert.Available,
+			"currency":  alert.Currency,
+		},
+	})
+}
+
+func (s *Service) Preferences(ctx context.Context, clientID string) ([]*domain.NotificationPreference, error) {
+	return s.store.GetNotificationPreferences(ctx, clientID)
+}
+
+// SetPreference replaces the preference of the client for the channel of pref.
+func (s *Service) SetPreference(ctx context.Context, pref *domain.NotificationPreference) (*domain.NotificationPreference, error) {
+	if err := s.validate(pref); err != nil {
+		return nil, err
+	}
+	pref.UpdatedAt = time.Now().UTC()
+	if err := s.store.SaveNotificationPreference(ctx, pref); err != nil {
+		return nil, err
+	}
+	return pref, nil
+}
+
+func (s *Service) Deliveries(ctx context.Context, clientID string) ([]*domain.NotificationDelivery, error) {
+	return s.store.GetNotificationDeliveries(ctx, clientID)
+}
+
+func (s *Service) validate(pref *domain.NotificationPreference) error {
+	pref.Channel = strings.ToLower(strings.TrimSpace(pref.Channel))
+	pref.Target = strings.TrimSpace(pref.Target)
+	if _, ok := s.senders[pref.Channel]; !ok {
+		return fmt.Errorf("%w: unknown channel %s", ErrInvalidPreference, pref.Channel)
+	}
+	switch pref.Channel {
+	case domain.ChannelWebhook:
+		if err := checkWebhookTarget(pref.Target); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidPreference, err)
+		}
+	case domain.ChannelEmail:
+		addr, err := mail.ParseAddress(pref.Target)
+		if err != nil {
+			return fmt.Errorf("%w: invalid email address", ErrInvalidPreference)
+		}
+		pref.Target = addr.Address
+	default:
+		if pref.Target == "" {
+			return fmt.Errorf("%w: target is required", ErrInvalidPreference)
+		}
+	}
+	for _, event := range pref.Events {
+		if _, ok := templates[event]; !ok {
+			return fmt.Errorf("%w: unknown event %s", ErrInvalidPreference, event)
+		}
+	}
+	if pref.Events == nil {
+		pref.Events = []string{}
+	}
+	return nil
+}
+
+func (s *Service) dispatchLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(s.cfg.DispatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+		s.dispatch()
+	}
+}
+
+// dispatch sends the deliveries that are due, until none are left.
+func (s *Service) dispatch() {
+	for {
+		delivery, err := s.claim()
+		if err != nil {
+			s.log.Warn("failed to claim notification deliveries", zap.Error(err))
+			return
+		}
+		if delivery == nil {
+			return
+		}
+		s.send(delivery)
+	}
+}
+
+// claim claims the delivery due first, nil when none is due.
+func (s *Service) claim() (*domain.NotificationDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	now := time.Now().UTC()
+	deliveries, err := s.store.ClaimNotificationDeliveries(ctx, now, now.Add(claimTimeout), 1)
+	if err != nil || len(deliveries) == 0 {
+		return nil, err
+	}
+	return deliveries[0], nil
+}
+
+// send makes one attempt at delivery and records its outcome, scheduling a
+// retry with exponential backoff until the attempts run out.
+func (s *Service) send(delivery *domain.NotificationDelivery) {
+	err := ErrChannelDisabled
+	if sender, ok := s.senders[delivery.Channel]; ok {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		err = sender.Send(ctx, delivery)
+		cancel()
+	}
+	now := time.Now().UTC()
+	delivery.Attempts++
+	delivery.UpdatedAt = now
+	switch {
+	case err == nil:
+		delivery.Status = domain.DeliveryStatusSent
+		delivery.LastError = ""
+	case delivery.Attempts >= s.cfg.MaxAttempts:
+		delivery.Status = domain.DeliveryStatusFailed
+		delivery.LastError = err.Error()
+	default:
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = now.Add(s.cfg.RetryInterval << min(delivery.Attempts-1, maxBackoffShift))
+	}
+	if err != nil {
+		s.log.Warn("failed to deliver notification",
+			zap.String("delivery_id", delivery.DeliveryID),
+			zap.String("channel", delivery.Channel),
+			zap.Int("attempts", delivery.Attempts),
+			zap.Error(err))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	if err := s.store.UpdateNotificationDelivery(ctx, delivery); err != nil {
+		s.log.Error("failed to update notification delivery", zap.String("delivery_id", delivery.DeliveryID), zap.Error(err))
+	}
+}
+
+type UnitOfWork interface {
+	InTx(ctx context.Context, f func(ctx context.Context) error) error
+}
+
+type Store interface {
+	SaveNotificationPreference(ctx context.Context, pref *domain.NotificationPreference) error
+	GetNotificationPreferences(ctx context.Context, clientID string) ([]*domain.NotificationPreference, error)
+	SaveNotificationDelivery(ctx context.Context, delivery *domain.NotificationDelivery) error
+	UpdateNotificationDelivery(ctx context.Context, delivery *domain.NotificationDelivery) error
+	// ClaimNotificationDeliveries returns up to limit pending deliveries due
+	// at now and postpones them until until, so that no other dispatcher
+	// picks them up meanwhile.
+	ClaimNotificationDeliveries(ctx context.Context, now, until time.Time, limit int) ([]*domain.NotificationDelivery, error)
+	GetNotificationDeliveries(ctx context.Context, clientID string) ([]*domain.NotificationDelivery, error)
+}
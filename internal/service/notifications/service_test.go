@@ -0,0 +1,210 @@
+package notifications_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/internal/infra/memory"
+	"github.com/MichaelSBoop/lima-backend/internal/service/notifications"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// send is a call to pushSender.
+type send struct {
+	start, deadline time.Time
+}
+
+// pushSender fails its first fails sends, and waits for release before each
+// send when it is set.
+type pushSender struct {
+	mu      sync.Mutex
+	fails   int
+	sends   []send
+	release chan struct{}
+}
+
+func (s *pushSender) Channel() string { return domain.ChannelPush }
+
+func (s *pushSender) Send(ctx context.Context, _ *domain.NotificationDelivery) error {
+	deadline, _ := ctx.Deadline()
+	s.mu.Lock()
+	s.sends = append(s.sends, send{start: time.Now(), deadline: deadline})
+	s.mu.Unlock()
+	if s.release != nil {
+		<-s.release
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fails > 0 {
+		s.fails--
+		return errors.New("push service is down")
+	}
+	return nil
+}
+
+func (s *pushSender) calls() []send {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]send(nil), s.sends...)
+}
+
+func newService(t *testing.T, store *memory.Store, cfg notifications.Config, sender *pushSender) *notifications.Service {
+	t.Helper()
+	lc := fxtest.NewLifecycle(t)
+	s := notifications.New(zap.NewNop(), lc, notifications.In{
+		Config:     cfg,
+		Store:      store,
+		UnitOfWork: store,
+		Senders:    []notifications.Sender{sender},
+	})
+	lc.RequireStart()
+	t.Cleanup(lc.RequireStop)
+	return s
+}
+
+// notify enables push notifications for the client and notifies it.
+func notify(t *testing.T, s *notifications.Service, clientID string) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := s.SetPreference(ctx, &domain.NotificationPreference{ClientID: clientID, Channel: domain.ChannelPush, Target: "device-token-of-" + clientID, Enabled: true}); err != nil {
+		t.Fatalf("SetPreference: %v", err)
+	}
+	err := s.Notify(ctx, &domain.Notification{ClientID: clientID, Event: domain.EventSyncFailed, Data: map[string]string{"error": "timeout"}})
+	if err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+}
+
+// waitFor polls the only delivery of the client until done accepts it.
+func waitFor(t *testing.T, s *notifications.Service, clientID string, done func(*domain.NotificationDelivery) bool) *domain.NotificationDelivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries, err := s.Deliveries(context.Background(), clientID)
+		if err != nil {
+			t.Fatalf("Deliveries: %v", err)
+		}
+		if len(deliveries) != 1 {
+			t.Fatalf("got %d deliveries, want 1", len(deliveries))
+		}
+		if done(deliveries[0]) {
+			return deliveries[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("delivery still %s after %d attempts", deliveries[0].Status, deliveries[0].Attempts)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func settled(d *domain.NotificationDelivery) bool {
+	return d.Status != domain.DeliveryStatusPending
+}
+
+func TestDispatchRetriesUntilTheAttemptsRunOut(t *testing.T) {
+	tests := []struct {
+		name         string
+		fails        int
+		wantStatus   string
+		wantAttempts int
+	}{
+		{name: "sent at once", fails: 0, wantStatus: domain.DeliveryStatusSent, wantAttempts: 1},
+		{name: "sent on a retry", fails: 2, wantStatus: domain.DeliveryStatusSent, wantAttempts: 3},
+		{name: "attempts run out", fails: 3, wantStatus: domain.DeliveryStatusFailed, wantAttempts: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &pushSender{fails: tt.fails}
+			s := newService(t, memory.New(zap.NewNop()), notifications.Config{
+				MaxAttempts:      3,
+				RetryInterval:    time.Millisecond,
+				DispatchInterval: 5 * time.Millisecond,
+			}, sender)
+			notify(t, s, "c1")
+
+			delivery := waitFor(t, s, "c1", settled)
+			if delivery.Status != tt.wantStatus || delivery.Attempts != tt.wantAttempts {
+				t.Fatalf("got %s after %d attempts, want %s after %d", delivery.Status, delivery.Attempts, tt.wantStatus, tt.wantAttempts)
+			}
+			if wantError := tt.wantStatus == domain.DeliveryStatusFailed; (delivery.LastError != "") != wantError {
+				t.Errorf("last error %q", delivery.LastError)
+			}
+			if got := len(sender.calls()); got != tt.wantAttempts {
+				t.Errorf("sent %d times, want %d", got, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestDispatchGivesEverySendItsOwnDeadline(t *testing.T) {
+	sender := &pushSender{release: make(chan struct{})}
+	s := newService(t, memory.New(zap.NewNop()), notifications.Config{DispatchInterval: time.Hour}, sender)
+	notify(t, s, "c1")
+	notify(t, s, "c2")
+
+	const hold = 50 * time.Millisecond
+	for range 2 {
+		time.Sleep(hold)
+		sender.release <- struct{}{}
+	}
+	waitFor(t, s, "c1", settled)
+	waitFor(t, s, "c2", settled)
+
+	calls := sender.calls()
+	if len(calls) != 2 {
+		t.Fatalf("sent %d times, want 2", len(calls))
+	}
+	for i, call := range calls {
+		if call.deadline.IsZero() {
+			t.Fatalf("send %d has no deadline", i)
+		}
+	}
+	// The second send starts after the first was held, and is given as long.
+	if got := calls[1].deadline.Sub(calls[0].deadline); got < hold {
+		t.Errorf("second deadline %v after the first, want at least %v", got, hold)
+	}
+}
+
+func TestDispatchHidesClaimedDeliveriesPastTheSendDeadline(t *testing.T) {
+	sender := &pushSender{release: make(chan struct{})}
+	s := newService(t, memory.New(zap.NewNop()), notifications.Config{DispatchInterval: time.Hour}, sender)
+	notify(t, s, "c1")
+
+	for len(sender.calls()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	deliveries, err := s.Deliveries(context.Background(), "c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendDeadline := sender.calls()[0].deadline
+	if claimedUntil := deliveries[0].NextAttemptAt; !claimedUntil.After(sendDeadline) {
+		t.Errorf("claimed until %v, before the send deadline %v", claimedUntil, sendDeadline)
+	}
+	sender.release <- struct{}{}
+	waitFor(t, s, "c1", settled)
+}
+
+func TestLogPushProviderRedactsDeviceTokens(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	provider := notifications.NewLogPushProvider(zap.New(core))
+	const token = "f3a9c2e4b5d6a7e8c9d0e1f2a3b4c5d6"
+	if err := provider.Push(context.Background(), token, "title", "body", nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range logs.All() {
+		for _, field := range entry.Context {
+			if strings.Contains(field.String, token) {
+				t.Errorf("field %s logs the device token: %s", field.Key, field.String)
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package notifications
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+)
+
+// messageTemplate is the subject and body of the message sent for an event,
+// rendered with the notification data.
+type messageTemplate struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+var templates = map[string]messageTemplate{
+	domain.EventConsentApproved: mustTemplate(domain.EventConsentApproved,
+		"{{.bank}} is connected",
+		"Your consent {{.consent_id}} for {{.bank}} was approved. Accounts and transactions from {{.bank}} will now appear in Lima."),
+	domain.EventConsentExpiring: mustTemplate(domain.EventConsentExpiring,
+		"{{.bank}} will be disconnected soon",
+		"Your consent {{.consent_id}} for {{.bank}} expires{{with .expires_at}} on {{.}}{{end}}. Renew it to keep your {{.bank}} data up to date."),
+	domain.EventConsentExpired: mustTemplate(domain.EventConsentExpired,
+		"{{.bank}} needs to be reconnected",
+		"Your consent {{.consent_id}} for {{.bank}} expired{{with .expired_at}} on {{.}}{{end}}. Renew it to keep your {{.bank}} data up to date."),
+	domain.EventSyncFailed: mustTemplate(domain.EventSyncFailed,
+		"We could not update your accounts",
+		"Syncing your accounts failed{{with .bank}} at {{.}}{{end}}: {{.error}}. We will try again later."),
+	domain.EventBudgetAlert: mustTemplate(domain.EventBudgetAlert,
+		"{{.budget}}: {{.threshold}}% of the budget spent",
+		"You have spent {{.spent}} {{.currency}} of {{.available}} {{.currency}} in your {{.budget}} budget this month."),
+}
+
+func mustTemplate(event, subject, body string) messageTemplate {
+	return messageTemplate{
+		subject: template.Must(template.New(event + ".subject").Option("missingkey=zero").Parse(subject)),
+		body:    template.Must(template.New(event + ".body").Option("missingkey=zero").Parse(body)),
+	}
+}
+
+// render produces the subject and body of the message for n.
+func render(n *domain.Notification) (string, string, error) {
+	t, ok := templates[n.Event]
+	if !ok {
+		return "", "", fmt.Errorf("no template for event %s", n.Event)
+	}
+	var subject, body strings.Builder
+	if err := t.subject.Execute(&subject, n.Data); err != nil {
+		return "", "", err
+	}
+	if err := t.body.Execute(&body, n.Data); err != nil {
+		return "", "", err
+	}
+	return subject.String(), body.String(), nil
+}
@@ -9,8 +9,8 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/MichaelSBoop/lima-backend/internal/service/requester/bankapi"
 	"github.com/MichaelSBoop/lima-backend/pkg/cache"
-	"github.com/MichaelSBoop/lima-backend/pkg/httpclient"
 	"go.uber.org/zap"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/clientcredentials"
@@ -19,15 +19,17 @@ import (
 var (
 	ErrDuplicateProvider = errors.New("duplicate providers are not allowed")
 	ErrProviderNotFound  = errors.New("provider not found")
+	ErrEmptyToken        = errors.New("bank returned an empty access token")
 )
 
 type Service struct {
 	clientCfg map[string]clientcredentials.Config
 	log       *zap.Logger
 	cache     cache.Cache
+	client    *http.Client
 }
 
-func New(cfg Config, log *zap.Logger, cache cache.Cache) (*Service, error) {
+func New(cfg Config, log *zap.Logger, cache cache.Cache, client *http.Client) (*Service, error) {
 	configMap := make(map[string]clientcredentials.Config)
 	for _, provider := range cfg.OauthProviders {
 		c := clientcredentials.Config{
@@ -41,6 +43,7 @@ func New(cfg Config, log *zap.Logger, cache cache.Cache) (*Service, error) {
 		clientCfg: configMap,
 		cache:     cache,
 		log:       log,
+		client:    client,
 	}, nil
 }
 
@@ -70,25 +73,29 @@ func (s *Service) Token(ctx context.Context, providerName string) (*oauth2.Token
 	if err != nil {
 		return nil, err
 	}
-	cl := httpclient.Client()
-
-	res, err := cl.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	body, err := io.ReadAll(res.Body)
+	res, err := s.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer func() {
-		if closeErr := res.Body.Close(); err != nil {
+		if closeErr := res.Body.Close(); closeErr != nil {
 			s.log.Error("failed to close response body", zap.Error(closeErr))
 		}
 	}()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, bankapi.NewBankError(providerName, res.StatusCode, res.Header, body)
+	}
 	var t *oauth2.Token
 	if err = json.Unmarshal(body, &t); err != nil {
 		return nil, err
 	}
+	if t == nil || t.AccessToken == "" {
+		return nil, ErrEmptyToken
+	}
 	s.cache.SetWithExpiration(providerName, t, 86400*time.Second)
 	return t, nil
 }
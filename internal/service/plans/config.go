@@ -0,0 +1,11 @@
+package plans
+
+import "github.com/MichaelSBoop/lima-backend/internal/domain"
+
+type Config struct {
+	// Default is the plan of clients that were never moved to another one.
+	Default string `json:"default" yaml:"default"`
+	// Tiers lists the plans clients can subscribe to. Without any, every
+	// client is on an unlimited default plan.
+	Tiers []domain.Plan `json:"tiers" yaml:"tiers"`
+}
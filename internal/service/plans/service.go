@@ -0,0 +1,338 @@
+package plans
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/pkg/money"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// syncReservation is how long a sync holds its slot. A sync that outlives it,
+// or whose instance died, no longer keeps others out.
+const syncReservation = 10 * time.Minute
+
+var (
+	ErrUnknownPlan       = errors.New("unknown plan")
+	ErrSamePlan          = errors.New("client is already on the plan")
+	ErrInvalidPlanChange = errors.New("invalid plan change")
+)
+
+// Service knows the plan of every client and enforces its limits: the
+// number of connected banks, how often banks are synced, access to
+// analytics and exports, and the amount of a single payment.
+type Service struct {
+	cfg    Config
+	tiers  map[string]domain.Plan
+	store  Store
+	uow    UnitOfWork
+	events EventPublisher
+	log    *zap.Logger
+}
+
+type In struct {
+	fx.In
+
+	Config     Config
+	Store      Store
+	UnitOfWork UnitOfWork
+	Events     EventPublisher
+}
+
+func New(log *zap.Logger, params In) (*Service, error) {
+	cfg := params.Config
+	if cfg.Default == "" {
+		cfg.Default = domain.PlanFree
+	}
+	if len(cfg.Tiers) == 0 {
+		cfg.Tiers = []domain.Plan{{Name: cfg.Default, Analytics: true, Export: true}}
+	}
+	tiers := make(map[string]domain.Plan, len(cfg.Tiers))
+	for _, tier := range cfg.Tiers {
+		if tier.Name == "" {
+			return nil, errors.New("plans: tier without a name")
+		}
+		if _, ok := tiers[tier.Name]; ok {
+			return nil, fmt.Errorf("plans: tier %s is defined twice", tier.Name)
+		}
+		if tier.MaxBanks < 0 || tier.SyncInterval < 0 {
+			return nil, fmt.Errorf("plans: tier %s has a negative limit", tier.Name)
+		}
+		if tier.PaymentLimit != "" {
+			if _, err := money.Parse(tier.PaymentLimit); err != nil {
+				return nil, fmt.Errorf("plans: payment limit of tier %s: %w", tier.Name, err)
+			}
+		}
+		tiers[tier.Name] = tier
+	}
+	if _, ok := tiers[cfg.Default]; !ok {
+		return nil, fmt.Errorf("plans: default plan %s is not a tier", cfg.Default)
+	}
+	return &Service{
+		cfg:    cfg,
+		tiers:  tiers,
+		store:  params.Store,
+		uow:    params.UnitOfWork,
+		events: params.Events,
+		log:    log,
+	}, nil
+}
+
+// Tiers lists the plans clients can subscribe to.
+func (s *Service) Tiers() []domain.Plan {
+	return slices.Clone(s.cfg.Tiers)
+}
+
+// Plan returns the plan the client is on.
+func (s *Service) Plan(ctx context.Context, clientID string) (*domain.Plan, error) {
+	current, err := s.current(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	plan := s.tier(current.Plan)
+	return &plan, nil
+}
+
+// Subscription returns the plan of the client with the history of its changes.
+func (s *Service) Subscription(ctx context.Context, clientID string) (*domain.Subscription, error) {
+	current, err := s.current(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	history, err := s.store.GetPlanChanges(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.Subscription{
+		ClientID:  clientID,
+		Plan:      s.tier(current.Plan),
+		ChangedAt: current.ChangedAt,
+		History:   history,
+	}, nil
+}
+
+// ChangePlan moves the client to plan and records who did it and why.
+func (s *Service) ChangePlan(ctx context.Context, clientID, plan, changedBy, reason string) (*domain.Subscription, error) {
+	if clientID == "" {
+		return nil, fmt.Errorf("%w: client_id is required", ErrInvalidPlanChange)
+	}
+	if _, ok := s.tiers[plan]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPlan, plan)
+	}
+	err := s.uow.InTx(ctx, func(ctx context.Context) error {
+		current, err := s.current(ctx, clientID)
+		if err != nil {
+			return err
+		}
+		if current.Plan == plan {
+			return fmt.Errorf("%w: %s", ErrSamePlan, plan)
+		}
+		change := &domain.PlanChange{
+			ClientID:     clientID,
+			PreviousPlan: current.Plan,
+			Plan:         plan,
+			ChangedBy:    changedBy,
+			Reason:       reason,
+			ChangedAt:    time.Now().UTC(),
+		}
+		if err := s.store.SaveClientPlan(ctx, &domain.ClientPlan{
+			ClientID:  clientID,
+			Plan:      plan,
+			ChangedAt: change.ChangedAt,
+		}); err != nil {
+			return err
+		}
+		if err := s.store.SavePlanChange(ctx, change); err != nil {
+			return err
+		}
+		event, err := domain.NewEvent(domain.EventTypePlanChanged, clientID, clientID, domain.PlanChanged{
+			PreviousPlan: change.PreviousPlan,
+			Plan:         change.Plan,
+			ChangedBy:    change.ChangedBy,
+			Reason:       change.Reason,
+		})
+		if err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, event)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Subscription(ctx, clientID)
+}
+
+// Allow checks that the plan of the client includes the on/off feature.
+// Syncs are limited by Sync.
+func (s *Service) Allow(ctx context.Context, clientID, feature string) error {
+	plan, err := s.Plan(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	if !plan.Includes(feature) {
+		return &domain.PlanLimitError{Plan: plan.Name, Feature: feature}
+	}
+	return nil
+}
+
+// CheckBanks checks that connecting banks keeps the client within the bank
+// count of its plan. Banks with an active or pending consent are connected.
+// Call it within the unit of work that saves the consents: the plan of the
+// client stays locked until it ends, so concurrent connections are counted.
+func (s *Service) CheckBanks(ctx context.Context, clientID string, banks []string) error {
+	plan, err := s.Plan(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	if plan.MaxBanks == 0 {
+		return nil
+	}
+	consents, err := s.store.GetConsents(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	connected := make(map[string]struct{}, len(consents)+len(banks))
+	for _, consent := range consents {
+		if consent.Status == domain.ConsentStatusPending || consent.Authorize(now) == nil {
+			connected[consent.ConsentProvider] = struct{}{}
+		}
+	}
+	for _, bank := range banks {
+		connected[bank] = struct{}{}
+	}
+	if len(connected) > plan.MaxBanks {
+		return &domain.PlanLimitError{Plan: plan.Name, Feature: domain.FeatureBanks, Limit: strconv.Itoa(plan.MaxBanks)}
+	}
+	return nil
+}
+
+// CheckPayment checks that the plan of the client allows a single payment of amount.
+func (s *Service) CheckPayment(ctx context.Context, clientID, amount string) error {
+	plan, err := s.Plan(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	if plan.PaymentLimit == "" {
+		return nil
+	}
+	v, err := money.Parse(amount)
+	if err != nil {
+		return err
+	}
+	limit, err := money.Parse(plan.PaymentLimit)
+	if err != nil {
+		return err
+	}
+	if v.Abs(v).Cmp(limit) > 0 {
+		return &domain.PlanLimitError{Plan: plan.Name, Feature: domain.FeaturePayments, Limit: plan.PaymentLimit}
+	}
+	return nil
+}
+
+// Sync runs f, which syncs the client with its banks, unless the client
+// synced within the sync interval of its plan or another sync of the client
+// is running, both refused with a *domain.PlanLimitError. The slot is
+// reserved in the store, so the limit holds across instances and restarts.
+// The interval starts once f succeeds, so failed syncs can be retried at
+// once. Syncs of the client nested in f run as part of it.
+func (s *Service) Sync(ctx context.Context, clientID string, f func(ctx context.Context) error) error {
+	if ctx.Value(syncKey{clientID: clientID}) != nil {
+		return f(ctx)
+	}
+	plan, err := s.Plan(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	ctx = context.WithValue(ctx, syncKey{clientID: clientID}, struct{}{})
+	if plan.SyncInterval == 0 {
+		return f(ctx)
+	}
+
+	// Postgres keeps microseconds, the reservation is matched on its expiry.
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	reservedUntil := now.Add(syncReservation)
+	sync, ok, err := s.store.ReserveSync(ctx, clientID, now, now.Add(-plan.SyncInterval), reservedUntil)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		retryAfter := max(sync.SyncedAt.Add(plan.SyncInterval).Sub(now), sync.ReservedUntil.Sub(now), time.Second)
+		return &domain.PlanLimitError{
+			Plan:       plan.Name,
+			Feature:    domain.FeatureSync,
+			Limit:      plan.SyncInterval.String(),
+			RetryAfter: retryAfter,
+		}
+	}
+	if err = f(ctx); err != nil {
+		if err := s.store.ReleaseSync(context.WithoutCancel(ctx), clientID, reservedUntil); err != nil {
+			s.log.Warn("failed to release the sync of client", zap.String("client_id", clientID), zap.Error(err))
+		}
+		return err
+	}
+	return s.store.CompleteSync(context.WithoutCancel(ctx), clientID, reservedUntil, time.Now().UTC().Truncate(time.Microsecond))
+}
+
+// current returns the plan the client is on, the default one if it was never changed.
+func (s *Service) current(ctx context.Context, clientID string) (*domain.ClientPlan, error) {
+	current, err := s.store.GetClientPlan(ctx, clientID)
+	if errors.Is(err, domain.ErrNotFound) {
+		return &domain.ClientPlan{ClientID: clientID, Plan: s.cfg.Default}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return current, nil
+}
+
+// tier returns the plan named name, falling back to the default plan for
+// clients on a tier that has since been removed.
+func (s *Service) tier(name string) domain.Plan {
+	if plan, ok := s.tiers[name]; ok {
+		return plan
+	}
+	s.log.Warn("client is on an unknown plan, applying the default one", zap.String("plan", name))
+	return s.tiers[s.cfg.Default]
+}
+
+type syncKey struct {
+	clientID string
+}
+
+// UnitOfWork groups repository calls made with the ctx passed to f into a single atomic change.
+type UnitOfWork interface {
+	InTx(ctx context.Context, f func(ctx context.Context) error) error
+}
+
+// EventPublisher writes domain events within the unit of work of ctx.
+type EventPublisher interface {
+	Publish(ctx context.Context, events ...*domain.Event) error
+}
+
+type Store interface {
+	// GetClientPlan returns the plan the client was last moved to,
+	// domain.ErrNotFound if it never was, locked until the unit of work ends.
+	GetClientPlan(ctx context.Context, clientID string) (*domain.ClientPlan, error)
+	SaveClientPlan(ctx context.Context, plan *domain.ClientPlan) error
+	SavePlanChange(ctx context.Context, change *domain.PlanChange) error
+	// GetPlanChanges returns the plan changes of the client, oldest first.
+	GetPlanChanges(ctx context.Context, clientID string) ([]*domain.PlanChange, error)
+	GetConsents(ctx context.Context, clientID string) ([]*domain.AccountConsent, error)
+	// ReserveSync reserves the next sync of the client until reservedUntil,
+	// unless it synced after syncedBefore or a reservation lasts past now.
+	// It returns the sync state of the client and whether it was reserved.
+	ReserveSync(ctx context.Context, clientID string, now, syncedBefore, reservedUntil time.Time) (*domain.ClientSync, bool, error)
+	// CompleteSync records the sync reserved until reservedUntil as done at
+	// syncedAt and ends its reservation.
+	CompleteSync(ctx context.Context, clientID string, reservedUntil, syncedAt time.Time) error
+	// ReleaseSync ends the reservation held until reservedUntil without
+	// recording a sync.
+	ReleaseSync(ctx context.Context, clientID string, reservedUntil time.Time) error
+}
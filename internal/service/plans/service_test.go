@@ -0,0 +1,146 @@
+package plans_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/internal/infra/memory"
+	"github.com/MichaelSBoop/lima-backend/internal/service/plans"
+	"go.uber.org/zap"
+)
+
+type discardEvents struct{}
+
+func (discardEvents) Publish(context.Context, ...*domain.Event) error { return nil }
+
+func newService(t *testing.T, store *memory.Store) *plans.Service {
+	t.Helper()
+	s, err := plans.New(zap.NewNop(), plans.In{
+		Config: plans.Config{
+			Default: domain.PlanFree,
+			Tiers: []domain.Plan{
+				{Name: domain.PlanFree, MaxBanks: 1, SyncInterval: time.Hour, PaymentLimit: "15000"},
+				{Name: domain.PlanPremium},
+			},
+		},
+		Store:      store,
+		UnitOfWork: store,
+		Events:     discardEvents{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	s := newService(t, memory.New(zap.NewNop()))
+	errBank := errors.New("bank is down")
+
+	if err := s.Sync(ctx, "c1", func(context.Context) error { return errBank }); !errors.Is(err, errBank) {
+		t.Fatalf("failed sync: got %v, want %v", err, errBank)
+	}
+
+	runs := 0
+	err := s.Sync(ctx, "c1", func(ctx context.Context) error {
+		runs++
+		if err := s.Sync(ctx, "c1", func(context.Context) error { runs++; return nil }); err != nil {
+			t.Errorf("nested sync: %v", err)
+		}
+		if err := s.Sync(context.Background(), "c1", func(context.Context) error { return nil }); !errors.Is(err, domain.ErrPlanLimit) {
+			t.Errorf("concurrent sync: got %v, want a plan limit", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("sync after a failed one: %v", err)
+	}
+	if runs != 2 {
+		t.Fatalf("got %d runs, want 2", runs)
+	}
+
+	err = s.Sync(ctx, "c1", func(context.Context) error { return nil })
+	var limitErr *domain.PlanLimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("sync within the interval: got %v, want a plan limit", err)
+	}
+	if limitErr.Feature != domain.FeatureSync || limitErr.RetryAfter <= 59*time.Minute || limitErr.RetryAfter > time.Hour {
+		t.Fatalf("got %+v, want a sync limit retried after about an hour", limitErr)
+	}
+
+	if err = s.Sync(ctx, "c2", func(context.Context) error { return nil }); err != nil {
+		t.Fatalf("sync of another client: %v", err)
+	}
+}
+
+func TestSyncUnlimited(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New(zap.NewNop())
+	s := newService(t, store)
+	if _, err := s.ChangePlan(ctx, "c1", domain.PlanPremium, "ops", ""); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 3 {
+		if err := s.Sync(ctx, "c1", func(context.Context) error { return nil }); err != nil {
+			t.Fatalf("sync %d: %v", i, err)
+		}
+	}
+}
+
+func TestCheckBanks(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New(zap.NewNop())
+	s := newService(t, store)
+
+	if err := s.CheckBanks(ctx, "c1", []string{"vbank", "abank"}); !errors.Is(err, domain.ErrPlanLimit) {
+		t.Fatalf("two banks: got %v, want a plan limit", err)
+	}
+	err := store.InTx(ctx, func(ctx context.Context) error {
+		if err := s.CheckBanks(ctx, "c1", []string{"vbank"}); err != nil {
+			return err
+		}
+		return store.SaveConsent(ctx, &domain.AccountConsent{
+			ClientID:  "c1",
+			ConsentID: "consent-1",
+			Status:    domain.ConsentStatusPending,
+		}, "vbank")
+	})
+	if err != nil {
+		t.Fatalf("first bank: %v", err)
+	}
+	if err = s.CheckBanks(ctx, "c1", []string{"vbank"}); err != nil {
+		t.Fatalf("connected bank again: %v", err)
+	}
+	if err = s.CheckBanks(ctx, "c1", []string{"abank"}); !errors.Is(err, domain.ErrPlanLimit) {
+		t.Fatalf("second bank: got %v, want a plan limit", err)
+	}
+}
+
+func TestCheckPayment(t *testing.T) {
+	ctx := context.Background()
+	s := newService(t, memory.New(zap.NewNop()))
+	tests := []struct {
+		name    string
+		amount  string
+		wantErr error
+	}{
+		{name: "below the limit", amount: "14999.99"},
+		{name: "at the limit", amount: "15000"},
+		{name: "above the limit", amount: "15000.01", wantErr: domain.ErrPlanLimit},
+		{name: "negative above the limit", amount: "-20000", wantErr: domain.ErrPlanLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.CheckPayment(ctx, "c1", tt.amount); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+	if err := s.CheckPayment(ctx, "c1", "lots"); err == nil {
+		t.Fatal("got no error for an invalid amount")
+	}
+}
@@ -0,0 +1,23 @@
+package rates
+
+import "time"
+
+const (
+	SourceFile = "file"
+	SourceCBR  = "cbr"
+)
+
+type Config struct {
+	// BaseCurrency is the currency all stored rates are quoted in.
+	BaseCurrency string `json:"base_currency" yaml:"base_currency"`
+	// DefaultCurrency is used for totals when the client does not ask for one.
+	DefaultCurrency string         `json:"default_currency" yaml:"default_currency"`
+	SyncInterval    time.Duration  `json:"sync_interval" yaml:"sync_interval"`
+	Sources         []SourceConfig `json:"sources" yaml:"sources"`
+}
+
+type SourceConfig struct {
+	Type    string `json:"type" yaml:"type"`
+	Path    string `json:"path" yaml:"path"`
+	BaseURL string `json:"base_url" yaml:"base_url"`
+}
@@ -0,0 +1,252 @@
+package rates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/pkg/money"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultBaseCurrency = "RUB"
+	syncTimeout         = time.Minute
+	maxLookbackDays     = 7
+)
+
+var (
+	ErrUnknownSource = errors.New("unknown exchange rate source")
+	ErrNoRate        = errors.New("no exchange rate for currency")
+)
+
+type Service struct {
+	cfg     Config
+	sources []Source
+	store   Store
+	log     *zap.Logger
+
+	mu        sync.Mutex
+	attempted map[time.Time]struct{}
+}
+
+func New(cfg Config, log *zap.Logger, lc fx.Lifecycle, client *http.Client, store Store) (*Service, error) {
+	if cfg.BaseCurrency == "" {
+		cfg.BaseCurrency = defaultBaseCurrency
+	}
+	if cfg.DefaultCurrency == "" {
+		cfg.DefaultCurrency = cfg.BaseCurrency
+	}
+	sources := make([]Source, 0, len(cfg.Sources))
+	for _, sc := range cfg.Sources {
+		switch sc.Type {
+		case SourceFile:
+			sources = append(sources, NewFileSource(sc.Path, cfg.BaseCurrency))
+		case SourceCBR:
+			src, err := NewCBRSource(sc.BaseURL, client)
+			if err != nil {
+				return nil, err
+			}
+			sources = append(sources, src)
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnknownSource, sc.Type)
+		}
+	}
+	s := &Service{
+		cfg:       cfg,
+		sources:   sources,
+		store:     store,
+		log:       log,
+		attempted: make(map[time.Time]struct{}),
+	}
+	if cfg.SyncInterval > 0 {
+		stop := make(chan struct{})
+		lc.Append(fx.Hook{
+			OnStart: func(ctx context.Context) error {
+				go s.syncLoop(stop)
+				return nil
+			},
+			OnStop: func(ctx context.Context) error {
+				close(stop)
+				return nil
+			},
+		})
+	}
+	return s, nil
+}
+
+func (s *Service) DefaultCurrency() string {
+	return s.cfg.DefaultCurrency
+}
+
+// Sync stores the rates of date from the first source that has them.
+func (s *Service) Sync(ctx context.Context, date time.Time) error {
+	date = truncateDay(date)
+	var errs []error
+	for _, src := range s.sources {
+		rates, err := src.Rates(ctx, date)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", src.Name(), err))
+			continue
+		}
+		for _, rate := range rates {
+			if rate.BaseCurrency != s.cfg.BaseCurrency {
+				return fmt.Errorf("%s: rates quoted in %s, expected %s", src.Name(), rate.BaseCurrency, s.cfg.BaseCurrency)
+			}
+		}
+		return s.store.SaveRates(ctx, rates)
+	}
+	if len(errs) == 0 {
+		return ErrNoRates
+	}
+	return errors.Join(errs...)
+}
+
+// Rates returns the latest stored rates on or before date. When nothing newer
+// than the previous day is stored, the missing days are synced on demand, going
+// back at most a week since sources publish nothing on holidays.
+func (s *Service) Rates(ctx context.Context, date time.Time) ([]*domain.ExchangeRate, error) {
+	date = truncateDay(date)
+	rates, err := s.store.GetRates(ctx, date)
+	if err != nil {
+		return nil, err
+	}
+	if fresh(rates, date) {
+		return rates, nil
+	}
+	synced := false
+	for back := 0; back < maxLookbackDays && !synced; back++ {
+		day := date.AddDate(0, 0, -back)
+		if !s.firstAttempt(day) {
+			continue
+		}
+		if err = s.Sync(ctx, day); err != nil {
+			s.log.Debug("no exchange rates synced", zap.Time("date", day), zap.Error(err))
+			continue
+		}
+		synced = true
+	}
+	if !synced {
+		return rates, nil
+	}
+	return s.store.GetRates(ctx, date)
+}
+
+// Table returns a converter over the rates effective on date.
+func (s *Service) Table(ctx context.Context, date time.Time) (*Table, error) {
+	rates, err := s.Rates(ctx, date)
+	if err != nil {
+		return nil, err
+	}
+	return NewTable(s.cfg.BaseCurrency, rates), nil
+}
+
+func (s *Service) firstAttempt(date time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.attempted[date]; ok {
+		return false
+	}
+	s.attempted[date] = struct{}{}
+	return true
+}
+
+func (s *Service) syncLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(s.cfg.SyncInterval)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+		if err := s.Sync(ctx, time.Now()); err != nil {
+			s.log.Warn("failed to sync exchange rates", zap.Error(err))
+		}
+		cancel()
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func fresh(rates []*domain.ExchangeRate, date time.Time) bool {
+	for _, rate := range rates {
+		if !rate.Date.Before(date.AddDate(0, 0, -1)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Table converts amounts between currencies through a common base currency.
+type Table struct {
+	base  string
+	rates map[string]*big.Rat
+	used  map[string]*domain.ExchangeRate
+	all   map[string]*domain.ExchangeRate
+}
+
+func NewTable(base string, rates []*domain.ExchangeRate) *Table {
+	t := &Table{
+		base:  base,
+		rates: map[string]*big.Rat{base: big.NewRat(1, 1)},
+		used:  make(map[string]*domain.ExchangeRate),
+		all:   make(map[string]*domain.ExchangeRate),
+	}
+	for _, rate := range rates {
+		r, err := money.Parse(rate.Rate)
+		if err != nil || r.Sign() <= 0 {
+			continue
+		}
+		code := strings.ToUpper(rate.Currency)
+		t.rates[code] = r
+		t.all[code] = rate
+	}
+	return t
+}
+
+func (t *Table) Convert(amount *big.Rat, from, to string) (*big.Rat, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == to {
+		return new(big.Rat).Set(amount), nil
+	}
+	fromRate, ok := t.rates[from]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoRate, from)
+	}
+	toRate, ok := t.rates[to]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoRate, to)
+	}
+	t.markUsed(from)
+	t.markUsed(to)
+	res := new(big.Rat).Mul(amount, fromRate)
+	return res.Quo(res, toRate), nil
+}
+
+// Used returns the rates that took part in conversions so far.
+func (t *Table) Used() []*domain.ExchangeRate {
+	res := make([]*domain.ExchangeRate, 0, len(t.used))
+	for _, rate := range t.used {
+		res = append(res, rate)
+	}
+	return res
+}
+
+func (t *Table) markUsed(code string) {
+	if rate, ok := t.all[code]; ok {
+		t.used[code] = rate
+	}
+}
+
+type Store interface {
+	SaveRates(ctx context.Context, rates []*domain.ExchangeRate) error
+	// GetRates returns for every currency its latest rate on or before date.
+	GetRates(ctx context.Context, date time.Time) ([]*domain.ExchangeRate, error)
+}
@@ -0,0 +1,188 @@
+package rates
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/pkg/money"
+)
+
+const rateScale = 8
+
+var ErrNoRates = errors.New("no exchange rates for date")
+
+// Source fetches the rates effective on a date.
+type Source interface {
+	Name() string
+	Rates(ctx context.Context, date time.Time) ([]*domain.ExchangeRate, error)
+}
+
+// FileSource reads rates from a CSV file with a date,currency,rate header.
+// For every currency the latest row on or before the requested date is used.
+type FileSource struct {
+	path         string
+	baseCurrency string
+}
+
+func NewFileSource(path, baseCurrency string) *FileSource {
+	return &FileSource{path: path, baseCurrency: baseCurrency}
+}
+
+func (s *FileSource) Name() string {
+	return SourceFile
+}
+
+func (s *FileSource) Rates(_ context.Context, date time.Time) ([]*domain.ExchangeRate, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	cols := make(map[string]int)
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"date", "currency", "rate"} {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("rates file %s: missing column %s", s.path, name)
+		}
+	}
+
+	latest := make(map[string]*domain.ExchangeRate)
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		day, err := time.Parse(time.DateOnly, record[cols["date"]])
+		if err != nil {
+			return nil, err
+		}
+		if day.After(date) {
+			continue
+		}
+		rate, err := money.Parse(record[cols["rate"]])
+		if err != nil {
+			return nil, err
+		}
+		currency := strings.ToUpper(strings.TrimSpace(record[cols["currency"]]))
+		if prev, ok := latest[currency]; ok && prev.Date.After(day) {
+			continue
+		}
+		latest[currency] = &domain.ExchangeRate{
+			Date:         day,
+			Currency:     currency,
+			BaseCurrency: s.baseCurrency,
+			Rate:         money.FormatScale(rate, rateScale),
+			Source:       s.Name(),
+		}
+	}
+	if len(latest) == 0 {
+		return nil, ErrNoRates
+	}
+	res := make([]*domain.ExchangeRate, 0, len(latest))
+	for _, rate := range latest {
+		res = append(res, rate)
+	}
+	return res, nil
+}
+
+// CBRSource reads the daily rates of the Central Bank of Russia in the JSON
+// format of cbr-xml-daily.ru. Rates are quoted in RUB.
+type CBRSource struct {
+	baseURL *url.URL
+	client  *http.Client
+}
+
+func NewCBRSource(baseURL string, client *http.Client) (*CBRSource, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	return &CBRSource{baseURL: u, client: client}, nil
+}
+
+func (s *CBRSource) Name() string {
+	return SourceCBR
+}
+
+func (s *CBRSource) Rates(ctx context.Context, date time.Time) ([]*domain.ExchangeRate, error) {
+	path := "/daily_json.js"
+	if today := truncateDay(time.Now()); date.Before(today) {
+		path = fmt.Sprintf("/archive/%04d/%02d/%02d/daily_json.js", date.Year(), date.Month(), date.Day())
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL.JoinPath(path).String(), http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNoRates
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cbr rates: unexpected status %d", resp.StatusCode)
+	}
+
+	var res struct {
+		Date   time.Time `json:"Date"`
+		Valute map[string]struct {
+			CharCode string      `json:"CharCode"`
+			Nominal  json.Number `json:"Nominal"`
+			Value    json.Number `json:"Value"`
+		} `json:"Valute"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	day := truncateDay(res.Date)
+	rates := make([]*domain.ExchangeRate, 0, len(res.Valute))
+	for code, v := range res.Valute {
+		value, err := money.Parse(v.Value.String())
+		if err != nil {
+			return nil, err
+		}
+		nominal, err := money.Parse(v.Nominal.String())
+		if err != nil || nominal.Sign() == 0 {
+			return nil, fmt.Errorf("cbr rates: invalid nominal of %s", code)
+		}
+		if v.CharCode != "" {
+			code = v.CharCode
+		}
+		rates = append(rates, &domain.ExchangeRate{
+			Date:         day,
+			Currency:     code,
+			BaseCurrency: "RUB",
+			Rate:         money.FormatScale(new(big.Rat).Quo(value, nominal), rateScale),
+			Source:       s.Name(),
+		})
+	}
+	return rates, nil
+}
+
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,267 @@
+package recurring
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/pkg/money"
+	"go.uber.org/zap"
+)
+
+const (
+	// lookback bounds the history scanned for recurring charges.
+	lookback = 400 * 24 * time.Hour
+	// regularShare is the minimal share of intervals, and of amounts, that
+	// must agree with the typical one for a series to count as recurring.
+	regularShare = 0.75
+	// amountTolerance is how far, relative to the typical amount, a charge
+	// may deviate and still belong to the series.
+	amountTolerance = 0.25
+	// priceChangeThreshold is the relative difference between the last two
+	// charges reported as a price change.
+	priceChangeThreshold = 0.01
+)
+
+type frequency struct {
+	name           string
+	days           float64
+	toleranceDays  float64
+	minOccurrences int
+	next           func(time.Time) time.Time
+}
+
+var frequencies = []frequency{
+	{domain.FrequencyWeekly, 7, 1, 3, func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }},
+	{domain.FrequencyBiweekly, 14, 2, 3, func(t time.Time) time.Time { return t.AddDate(0, 0, 14) }},
+	{domain.FrequencyMonthly, 30.4, 4, 3, func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+	{domain.FrequencyQuarterly, 91, 7, 2, func(t time.Time) time.Time { return t.AddDate(0, 3, 0) }},
+	{domain.FrequencyYearly, 365, 15, 2, func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+}
+
+type Service struct {
+	store Store
+	log   *zap.Logger
+}
+
+func New(log *zap.Logger, store Store) *Service {
+	return &Service{
+		store: store,
+		log:   log,
+	}
+}
+
+// Detect scans the stored history of the client across all banks for charges
+// from the same merchant with a similar amount at a regular interval.
+func (s *Service) Detect(ctx context.Context, clientID string) ([]*domain.RecurringPayment, error) {
+	now := time.Now().UTC()
+	txs, err := s.store.GetTransactions(ctx, domain.TransactionFilter{
+		ClientID: clientID,
+		From:     now.Add(-lookback),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	type seriesKey struct{ merchant, currency string }
+	series := make(map[seriesKey][]*charge)
+	keys := make([]seriesKey, 0)
+	for _, tx := range txs {
+		if tx.Status != domain.TransactionStatusBooked || tx.TransferID != "" || tx.Category == domain.CategoryTransfers {
+			continue
+		}
+		amount, err := money.Parse(tx.Amount)
+		if err != nil {
+			return nil, err
+		}
+		if amount.Sign() >= 0 {
+			continue
+		}
+		name := tx.Merchant
+		if name == "" {
+			name = tx.Description
+		}
+		k := seriesKey{merchant: strings.ToLower(strings.TrimSpace(name)), currency: tx.Currency}
+		if k.merchant == "" {
+			continue
+		}
+		if _, ok := series[k]; !ok {
+			keys = append(keys, k)
+		}
+		series[k] = append(series[k], &charge{tx: tx, amount: amount.Neg(amount)})
+	}
+
+	res := make([]*domain.RecurringPayment, 0)
+	for _, k := range keys {
+		charges := series[k]
+		slices.SortFunc(charges, func(a, b *charge) int { return a.tx.BookedAt.Compare(b.tx.BookedAt) })
+		if payment, ok := detect(charges, now); ok {
+			payment.ClientID = clientID
+			res = append(res, payment)
+			continue
+		}
+		// Separate subscriptions at one merchant paid from different
+		// accounts interleave, so retry each account on its own.
+		for _, accountCharges := range byAccount(charges) {
+			if payment, ok := detect(accountCharges, now); ok {
+				payment.ClientID = clientID
+				res = append(res, payment)
+			}
+		}
+	}
+	slices.SortFunc(res, func(a, b *domain.RecurringPayment) int { return a.NextDate.Compare(b.NextDate) })
+	return res, nil
+}
+
+type charge struct {
+	tx     *domain.Transaction
+	amount *big.Rat
+}
+
+// detect tells whether charges, sorted by booking time, form a recurring series.
+func detect(charges []*charge, now time.Time) (*domain.RecurringPayment, bool) {
+	if len(charges) < 2 {
+		return nil, false
+	}
+	intervals := make([]float64, 0, len(charges)-1)
+	for i := 1; i < len(charges); i++ {
+		intervals = append(intervals, charges[i].tx.BookedAt.Sub(charges[i-1].tx.BookedAt).Hours()/24)
+	}
+	typicalInterval := median(intervals)
+	freq, ok := classify(typicalInterval)
+	if !ok || len(charges) < freq.minOccurrences {
+		return nil, false
+	}
+	if share(intervals, func(v float64) bool { return math.Abs(v-freq.days) <= freq.toleranceDays }) < regularShare {
+		return nil, false
+	}
+
+	amounts := make([]float64, 0, len(charges))
+	for _, c := range charges {
+		v, _ := c.amount.Float64()
+		amounts = append(amounts, v)
+	}
+	typicalAmount := median(amounts)
+	if share(amounts, func(v float64) bool { return math.Abs(v-typicalAmount) <= typicalAmount*amountTolerance }) < regularShare {
+		return nil, false
+	}
+
+	last := charges[len(charges)-1]
+	payment := &domain.RecurringPayment{
+		Merchant:    last.tx.Merchant,
+		Category:    last.tx.Category,
+		AccountID:   last.tx.AccountID,
+		Bank:        last.tx.Bank,
+		Frequency:   freq.name,
+		Currency:    last.tx.Currency,
+		Amount:      money.Format(typicalCharge(charges, typicalAmount)),
+		Occurrences: len(charges),
+		LastDate:    last.tx.BookedAt,
+		LastAmount:  money.Format(last.amount),
+		NextDate:    freq.next(last.tx.BookedAt),
+		NextAmount:  money.Format(last.amount),
+		Status:      domain.RecurringStatusActive,
+	}
+	if payment.Merchant == "" {
+		payment.Merchant = last.tx.Description
+	}
+	for _, c := range charges {
+		payment.TransactionIDs = append(payment.TransactionIDs, c.tx.TransactionID)
+	}
+	prev := charges[len(charges)-2]
+	if diff := relativeDiff(prev.amount, last.amount); diff > priceChangeThreshold {
+		payment.PriceChange = &domain.PriceChange{
+			Date:     last.tx.BookedAt,
+			Previous: money.Format(prev.amount),
+			Current:  money.Format(last.amount),
+		}
+	}
+	grace := time.Duration(freq.toleranceDays * float64(24*time.Hour))
+	if now.After(payment.NextDate.Add(grace)) {
+		payment.Status = domain.RecurringStatusMissed
+	}
+	return payment, true
+}
+
+// byAccount splits charges by the bank and ID of their account, keeping their order.
+func byAccount(charges []*charge) [][]*charge {
+	if len(charges) == 0 {
+		return nil
+	}
+	index := make(map[[2]string]int)
+	res := make([][]*charge, 0)
+	for _, c := range charges {
+		k := [2]string{c.tx.Bank, c.tx.AccountID}
+		i, ok := index[k]
+		if !ok {
+			i = len(res)
+			index[k] = i
+			res = append(res, nil)
+		}
+		res[i] = append(res[i], c)
+	}
+	if len(res) == 1 {
+		return nil
+	}
+	return res
+}
+
+func classify(days float64) (frequency, bool) {
+	for _, f := range frequencies {
+		if math.Abs(days-f.days) <= f.toleranceDays {
+			return f, true
+		}
+	}
+	return frequency{}, false
+}
+
+// typicalCharge returns the charge amount closest to the typical one, keeping
+// the exact decimal value instead of its float approximation.
+func typicalCharge(charges []*charge, typical float64) *big.Rat {
+	best := charges[0].amount
+	bestDiff := math.Inf(1)
+	for _, c := range charges {
+		v, _ := c.amount.Float64()
+		if d := math.Abs(v - typical); d < bestDiff {
+			best, bestDiff = c.amount, d
+		}
+	}
+	return best
+}
+
+func relativeDiff(a, b *big.Rat) float64 {
+	fa, _ := a.Float64()
+	fb, _ := b.Float64()
+	if fa == 0 {
+		return math.Inf(1)
+	}
+	return math.Abs(fb-fa) / fa
+}
+
+func median(values []float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+func share(values []float64, ok func(float64) bool) float64 {
+	n := 0
+	for _, v := range values {
+		if ok(v) {
+			n++
+		}
+	}
+	return float64(n) / float64(len(values))
+}
+
+type Store interface {
+	GetTransactions(ctx context.Context, filter domain.TransactionFilter) ([]*domain.Transaction, error)
+}
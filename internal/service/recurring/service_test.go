@@ -0,0 +1,152 @@
+package recurring_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/internal/infra/memory"
+	"github.com/MichaelSBoop/lima-backend/internal/service/recurring"
+	"go.uber.org/zap"
+)
+
+// charge is a transaction booked daysAgo days before now.
+type charge struct {
+	bank     string
+	merchant string
+	amount   string
+	daysAgo  int
+	transfer bool
+}
+
+// every returns n charges of amount at merchant, one every days days, the
+// last one lastDaysAgo days before now.
+func every(days, n, lastDaysAgo int, merchant, amount string) []charge {
+	charges := make([]charge, 0, n)
+	for i := n - 1; i >= 0; i-- {
+		charges = append(charges, charge{merchant: merchant, amount: amount, daysAgo: lastDaysAgo + i*days})
+	}
+	return charges
+}
+
+type want struct {
+	merchant    string
+	bank        string
+	frequency   string
+	amount      string
+	occurrences int
+	status      string
+	priceChange bool
+}
+
+func TestDetect(t *testing.T) {
+	priceRise := every(30, 4, 5, "Streamly", "-299.00")
+	priceRise[3].amount = "-349.00"
+	irregular := every(30, 4, 5, "Gym", "-1500.00")
+	irregular[1].daysAgo += 12
+	varying := every(30, 4, 5, "Grocer", "-1000.00")
+	varying[0].amount, varying[2].amount = "-3000.00", "-200.00"
+	transfers := every(30, 4, 5, "Savings", "-5000.00")
+	for i := range transfers {
+		transfers[i].transfer = true
+	}
+	vbank := every(30, 4, 5, "Cloud", "-199.00")
+	abank := every(30, 4, 15, "Cloud", "-199.00")
+	for i := range vbank {
+		vbank[i].bank, abank[i].bank = "vbank", "abank"
+	}
+
+	tests := []struct {
+		name    string
+		charges []charge
+		want    []want
+	}{
+		{
+			name:    "monthly",
+			charges: every(30, 4, 5, "Streamly", "-299.00"),
+			want:    []want{{merchant: "Streamly", frequency: domain.FrequencyMonthly, amount: "299.00", occurrences: 4, status: domain.RecurringStatusActive}},
+		},
+		{
+			name:    "weekly",
+			charges: every(7, 5, 2, "Car Wash", "-500.00"),
+			want:    []want{{merchant: "Car Wash", frequency: domain.FrequencyWeekly, amount: "500.00", occurrences: 5, status: domain.RecurringStatusActive}},
+		},
+		{
+			name:    "yearly",
+			charges: every(365, 2, 30, "Antivirus", "-1990.00"),
+			want:    []want{{merchant: "Antivirus", frequency: domain.FrequencyYearly, amount: "1990.00", occurrences: 2, status: domain.RecurringStatusActive}},
+		},
+		{
+			name:    "price change",
+			charges: priceRise,
+			want:    []want{{merchant: "Streamly", frequency: domain.FrequencyMonthly, amount: "299.00", occurrences: 4, status: domain.RecurringStatusActive, priceChange: true}},
+		},
+		{
+			name:    "missed",
+			charges: every(30, 4, 60, "Streamly", "-299.00"),
+			want:    []want{{merchant: "Streamly", frequency: domain.FrequencyMonthly, amount: "299.00", occurrences: 4, status: domain.RecurringStatusMissed}},
+		},
+		{
+			name:    "accounts at different banks",
+			charges: append(vbank, abank...),
+			want: []want{
+				{merchant: "Cloud", bank: "abank", frequency: domain.FrequencyMonthly, amount: "199.00", occurrences: 4, status: domain.RecurringStatusActive},
+				{merchant: "Cloud", bank: "vbank", frequency: domain.FrequencyMonthly, amount: "199.00", occurrences: 4, status: domain.RecurringStatusActive},
+			},
+		},
+		{name: "too few charges", charges: every(30, 2, 5, "Streamly", "-299.00")},
+		{name: "irregular intervals", charges: irregular},
+		{name: "varying amounts", charges: varying},
+		{name: "income", charges: every(30, 4, 5, "Employer", "90000.00")},
+		{name: "transfers", charges: transfers},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := memory.New(zap.NewNop())
+			now := time.Now().UTC()
+			for i, c := range tt.charges {
+				tx := &domain.Transaction{
+					ClientID:      "c1",
+					Bank:          "vbank",
+					AccountID:     "a1",
+					TransactionID: "t" + strconv.Itoa(i),
+					Merchant:      c.merchant,
+					Amount:        c.amount,
+					Currency:      "RUB",
+					Status:        domain.TransactionStatusBooked,
+					BookedAt:      now.AddDate(0, 0, -c.daysAgo),
+				}
+				if c.bank != "" {
+					tx.Bank = c.bank
+				}
+				if c.transfer {
+					tx.TransferID = "tr" + strconv.Itoa(i)
+				}
+				if err := store.SaveTransaction(ctx, tx); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := recurring.New(zap.NewNop(), store).Detect(ctx, "c1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("detected %d payments, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, w := range tt.want {
+				p := got[i]
+				if w.bank != "" && p.Bank != w.bank {
+					t.Errorf("payment %d: bank %s, want %s", i, p.Bank, w.bank)
+				}
+				if p.Merchant != w.merchant || p.Frequency != w.frequency || p.Amount != w.amount ||
+					p.Occurrences != w.occurrences || p.Status != w.status || (p.PriceChange != nil) != w.priceChange {
+					t.Errorf("payment %d: got %+v, want %+v", i, p, w)
+				}
+			}
+		})
+	}
+}
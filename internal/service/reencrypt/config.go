@@ -0,0 +1,10 @@
+package reencrypt
+
+import "time"
+
+type Config struct {
+	// Interval is how often the store is scanned for values to seal again.
+	// Zero disables the job.
+	Interval  time.Duration `json:"interval" yaml:"interval"`
+	BatchSize int           `json:"batch_size" yaml:"batch_size"`
+}
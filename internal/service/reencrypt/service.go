@@ -0,0 +1,117 @@
+package reencrypt
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultBatchSize = 500
+	runTimeout       = 10 * time.Minute
+)
+
+// Service seals again the sensitive values still stored in plaintext or
+// sealed with a retired key, so that a rotated key can be dropped once the
+// job has caught up.
+type Service struct {
+	cfg   Config
+	store Store
+	uow   UnitOfWork
+	log   *zap.Logger
+}
+
+type In struct {
+	fx.In
+
+	Config     Config
+	Store      Store
+	UnitOfWork UnitOfWork
+}
+
+func New(log *zap.Logger, lc fx.Lifecycle, params In) *Service {
+	cfg := params.Config
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	s := &Service{
+		cfg:   cfg,
+		store: params.Store,
+		uow:   params.UnitOfWork,
+		log:   log,
+	}
+	if cfg.Interval <= 0 {
+		return s
+	}
+	stop := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			go s.loop(stop)
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			close(stop)
+			return nil
+		},
+	})
+	return s
+}
+
+func (s *Service) loop(stop <-chan struct{}) {
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		s.run()
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) run() {
+	ctx, cancel := context.WithTimeout(context.Background(), runTimeout)
+	defer cancel()
+	n, err := s.Reencrypt(ctx)
+	if err != nil {
+		s.log.Error("failed to re-encrypt fields", zap.Int("rewritten", n), zap.Error(err))
+		return
+	}
+	if n > 0 {
+		s.log.Info("re-encrypted fields", zap.Int("rewritten", n))
+	}
+}
+
+// Reencrypt rewrites stale rows batch by batch until none are left, and
+// returns how many it rewrote.
+func (s *Service) Reencrypt(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		var n int
+		err := s.uow.InTx(ctx, func(ctx context.Context) error {
+			var err error
+			n, err = s.store.ReencryptFields(ctx, s.cfg.BatchSize)
+			return err
+		})
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n == 0 {
+			return total, nil
+		}
+	}
+}
+
+type UnitOfWork interface {
+	InTx(ctx context.Context, f func(ctx context.Context) error) error
+}
+
+type Store interface {
+	// ReencryptFields seals again up to limit stale rows of each table and
+	// returns how many it rewrote.
+	ReencryptFields(ctx context.Context, limit int) (int, error)
+}
@@ -0,0 +1,81 @@
+package reencrypt_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/MichaelSBoop/lima-backend/internal/service/reencrypt"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+// store has stale rows left to rewrite, fails the batch failAt if it is set,
+// and counts the units of work it is called in.
+type store struct {
+	stale  int
+	failAt int
+
+	batches int
+	inTx    bool
+	txs     int
+}
+
+func (s *store) InTx(ctx context.Context, f func(ctx context.Context) error) error {
+	s.txs++
+	s.inTx = true
+	defer func() { s.inTx = false }()
+	return f(ctx)
+}
+
+func (s *store) ReencryptFields(_ context.Context, limit int) (int, error) {
+	if !s.inTx {
+		return 0, errors.New("called outside of a unit of work")
+	}
+	s.batches++
+	if s.batches == s.failAt {
+		return 0, errors.New("store is down")
+	}
+	n := min(s.stale, limit)
+	s.stale -= n
+	return n, nil
+}
+
+func TestReencrypt(t *testing.T) {
+	tests := []struct {
+		name        string
+		stale       int
+		batchSize   int
+		failAt      int
+		want        int
+		wantBatches int
+		wantErr     bool
+	}{
+		{name: "nothing stale", stale: 0, batchSize: 10, want: 0, wantBatches: 1},
+		{name: "one batch", stale: 7, batchSize: 10, want: 7, wantBatches: 2},
+		{name: "exact batches", stale: 20, batchSize: 10, want: 20, wantBatches: 3},
+		{name: "partial last batch", stale: 25, batchSize: 10, want: 25, wantBatches: 4},
+		{name: "default batch size", stale: 501, batchSize: 0, want: 501, wantBatches: 3},
+		{name: "failing batch", stale: 25, batchSize: 10, failAt: 2, want: 10, wantBatches: 2, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &store{stale: tt.stale, failAt: tt.failAt}
+			s := reencrypt.New(zap.NewNop(), fxtest.NewLifecycle(t), reencrypt.In{
+				Config:     reencrypt.Config{BatchSize: tt.batchSize},
+				Store:      st,
+				UnitOfWork: st,
+			})
+			n, err := s.Reencrypt(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if n != tt.want {
+				t.Fatalf("rewrote %d rows, want %d", n, tt.want)
+			}
+			if st.batches != tt.wantBatches || st.txs != tt.wantBatches {
+				t.Fatalf("ran %d batches in %d units of work, want %d each", st.batches, st.txs, tt.wantBatches)
+			}
+		})
+	}
+}
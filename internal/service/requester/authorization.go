@@ -0,0 +1,116 @@
+package requester
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/internal/service/requester/bankapi"
+)
+
+// ErrAuthorizationUnsupported is returned for banks without a consent approval page.
+var ErrAuthorizationUnsupported = errors.New("bank does not support consent authorization")
+
+// AuthorizationURL returns the page of the bank the client approves consent
+// on, sending it back to redirect.RedirectURI with the state and binding the
+// authorisation code to the PKCE challenge.
+func (s *Service) AuthorizationURL(consent *domain.AccountConsent, redirect domain.ConsentAuthorizationRedirect) (string, error) {
+	authorization := s.authorizations[consent.ConsentProvider]
+	if authorization.URL == "" {
+		return "", fmt.Errorf("%w: %s", ErrAuthorizationUnsupported, consent.ConsentProvider)
+	}
+	destURL, err := s.authorizationURL(consent.ConsentProvider, authorization.URL)
+	if err != nil {
+		return "", err
+	}
+	q := destURL.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", consent.RequestingBank)
+	q.Set("consent_id", consent.ConsentID)
+	q.Set("redirect_uri", redirect.RedirectURI)
+	q.Set("state", redirect.State)
+	q.Set("code_challenge", redirect.CodeChallenge)
+	q.Set("code_challenge_method", "S256")
+	destURL.RawQuery = q.Encode()
+	return destURL.String(), nil
+}
+
+// CompleteAuthorization finishes the approval of consent once the bank sent
+// the client back with code. Banks with a token URL exchange the code and the
+// PKCE verifier for the consent, others are asked for its current state. The
+// consent is returned with the status and expiry the bank reports.
+func (s *Service) CompleteAuthorization(ctx context.Context, consent *domain.AccountConsent, code, codeVerifier, redirectURI string) (*domain.AccountConsent, error) {
+	token, err := s.token.Token(ctx, consent.ConsentProvider)
+	if err != nil {
+		return nil, err
+	}
+	adapter, err := s.adapter(consent.ConsentProvider)
+	if err != nil {
+		return nil, err
+	}
+	authorization := s.authorizations[consent.ConsentProvider]
+
+	var req *http.Request
+	decode := adapter.DecodeConsentStatus
+	if authorization.TokenURL != "" {
+		destURL, err := s.authorizationURL(consent.ConsentProvider, authorization.TokenURL)
+		if err != nil {
+			return nil, err
+		}
+		form := url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"code_verifier": {codeVerifier},
+			"redirect_uri":  {redirectURI},
+			"consent_id":    {consent.ConsentID},
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, destURL.String(), strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		decode = adapter.DecodeConsent
+	} else {
+		destURL := s.bankURL(consent.ConsentProvider, "/account-consents/"+url.PathEscape(consent.ConsentID))
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, destURL.String(), http.NoBody)
+		if err != nil {
+			return nil, err
+		}
+	}
+	req.Header.Add("Authorization", "Bearer "+token.AccessToken)
+	req.Header.Add("X-Requesting-Bank", consent.RequestingBank)
+	bodyBytes, err := s.do(req, consent.ClientID, consent.ConsentProvider, consent.ConsentID)
+	if err != nil {
+		return nil, err
+	}
+	respData, err := decode(bodyBytes)
+	if err != nil {
+		return nil, err
+	}
+	if respData.ConsentID != consent.ConsentID {
+		return nil, fmt.Errorf("%w: consent %s instead of %s", bankapi.ErrUnexpectedPayload, respData.ConsentID, consent.ConsentID)
+	}
+	updated := *consent
+	updated.Status = respData.Status
+	if !respData.ExpiresAt.IsZero() {
+		updated.ExpiresAt = respData.ExpiresAt
+	}
+	return &updated, nil
+}
+
+// authorizationURL resolves an approval endpoint of the bank, absolute or
+// relative to its base URL.
+func (s *Service) authorizationURL(providerName, raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if u.IsAbs() {
+		return u, nil
+	}
+	return s.bankURL(providerName, u.Path), nil
+}
@@ -0,0 +1,138 @@
+// Package bankapi maps raw bank API payloads into domain types. Every bank API
+// flavour gets its own Adapter, selected per bank in the requester config.
+package bankapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"go.uber.org/zap"
+)
+
+const DefaultAPI = OBRv1
+
+var (
+	ErrUnknownAPI        = errors.New("unknown bank api")
+	ErrUnexpectedPayload = errors.New("unexpected bank payload")
+)
+
+type Adapter interface {
+	DecodeConsent(body []byte) (*ConsentResponse, error)
+	// DecodeConsentStatus decodes the consent as read back from the bank.
+	DecodeConsentStatus(body []byte) (*ConsentResponse, error)
+	DecodeAccounts(body []byte) ([]*domain.Account, error)
+	DecodeBalances(body []byte) ([]*domain.Balance, error)
+	DecodeTransactions(body []byte) ([]*domain.Transaction, error)
+}
+
+type ConsentResponse struct {
+	Status       string
+	ConsentID    string
+	AutoApproved bool
+	// ExpiresAt and CreatedAt are zero when the bank did not say.
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+type constructor func(bank string, log *zap.Logger) Adapter
+
+var adapters = map[string]constructor{
+	OBRv1: newOBR,
+}
+
+// New returns the adapter of the given API for bank. An empty api selects DefaultAPI.
+func New(api, bank string, log *zap.Logger) (Adapter, error) {
+	if api == "" {
+		api = DefaultAPI
+	}
+	c, ok := adapters[api]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAPI, api)
+	}
+	return c(bank, log.With(zap.String("bank", bank), zap.String("api", api))), nil
+}
+
+// decodeTolerant decodes data into v, failing with ErrUnexpectedPayload only
+// on malformed JSON or mistyped fields. Fields v does not know are logged and
+// tolerated rather than rejected: banks add fields to their payloads without
+// notice, and a new field must not take aggregation down while it still shows
+// in the logs. Each decoder checks the fields it requires after decoding, with
+// missing.
+func decodeTolerant(log *zap.Logger, data []byte, v any) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %w", ErrUnexpectedPayload, err)
+	}
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("%w: %w", ErrUnexpectedPayload, err)
+	}
+	for _, field := range unknownFields(raw, reflect.TypeOf(v), "", nil) {
+		log.Warn("unknown field in bank payload", zap.String("field", field))
+	}
+	return nil
+}
+
+// unknownFields walks the decoded JSON value alongside type t and returns the
+// dotted paths of the object keys no field of t decodes.
+func unknownFields(value any, t reflect.Type, path string, found []string) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch val := value.(type) {
+	case map[string]any:
+		if t.Kind() != reflect.Struct {
+			return found
+		}
+		fields := jsonFields(t)
+		for _, key := range slices.Sorted(maps.Keys(val)) {
+			field, ok := fields[strings.ToLower(key)]
+			if !ok {
+				found = append(found, path+key)
+				continue
+			}
+			found = unknownFields(val[key], field, path+key+".", found)
+		}
+	case []any:
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return found
+		}
+		for _, item := range val {
+			found = unknownFields(item, t.Elem(), path, found)
+		}
+	}
+	return found
+}
+
+// jsonFields maps the lower-cased JSON names of the fields of struct t to their
+// types, the way encoding/json matches object keys, including the fields
+// promoted from embedded structs.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for _, field := range reflect.VisibleFields(t) {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch {
+		case name == "-":
+			continue
+		case field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct:
+			continue
+		case !field.IsExported():
+			continue
+		case name == "":
+			name = field.Name
+		}
+		fields[strings.ToLower(name)] = field.Type
+	}
+	return fields
+}
+
+// missing reports a required field absent from a bank payload.
+func missing(field string) error {
+	return fmt.Errorf("%w: missing %s", ErrUnexpectedPayload, field)
+}
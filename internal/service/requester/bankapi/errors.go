@@ -0,0 +1,84 @@
+package bankapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+)
+
+const InteractionIDHeader = "X-Fapi-Interaction-Id"
+
+const maxErrorMessageLength = 512
+
+// NewBankError builds a BankError from a non-successful bank response.
+func NewBankError(bank string, statusCode int, header http.Header, body []byte) *domain.BankError {
+	code, message := ParseError(body)
+	return &domain.BankError{
+		Bank:          bank,
+		StatusCode:    statusCode,
+		Code:          code,
+		Message:       message,
+		InteractionID: header.Get(InteractionIDHeader),
+	}
+}
+
+// ParseError extracts the error code and message from the error body formats
+// seen across bank APIs: OBR errors, OAuth2 errors and FastAPI details.
+func ParseError(body []byte) (string, string) {
+	var res struct {
+		Code             string          `json:"code"`
+		ErrorCode        string          `json:"errorCode"`
+		Message          string          `json:"message"`
+		Error            string          `json:"error"`
+		ErrorDescription string          `json:"error_description"`
+		Detail           json.RawMessage `json:"detail"`
+		Errors           []struct {
+			ErrorCode string `json:"errorCode"`
+			Code      string `json:"code"`
+			Message   string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return "", truncate(strings.TrimSpace(string(body)))
+	}
+
+	code := firstNonEmpty(res.Code, res.ErrorCode, res.Error)
+	message := firstNonEmpty(res.Message, res.ErrorDescription)
+	if len(res.Errors) > 0 {
+		code = firstNonEmpty(code, res.Errors[0].ErrorCode, res.Errors[0].Code)
+		message = firstNonEmpty(message, res.Errors[0].Message)
+	}
+	if message == "" && len(res.Detail) > 0 {
+		var detail string
+		if err := json.Unmarshal(res.Detail, &detail); err != nil {
+			detail = string(res.Detail)
+		}
+		message = detail
+	}
+	return code, truncate(message)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// truncate cuts s to at most maxErrorMessageLength bytes without splitting
+// a UTF-8 sequence.
+func truncate(s string) string {
+	if len(s) <= maxErrorMessageLength {
+		return s
+	}
+	n := maxErrorMessageLength
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,136 @@
+package bankapi
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+)
+
+func TestParseError(t *testing.T) {
+	long := strings.Repeat("a", maxErrorMessageLength+10)
+	// Two-byte letters put a letter across the cut.
+	cyrillic := "x" + strings.Repeat("ж", maxErrorMessageLength/2)
+
+	tests := []struct {
+		name        string
+		body        string
+		wantCode    string
+		wantMessage string
+	}{
+		{
+			name:        "OBR error",
+			body:        `{"code":"UK.OBIE.Field.Invalid","message":"Invalid consent id"}`,
+			wantCode:    "UK.OBIE.Field.Invalid",
+			wantMessage: "Invalid consent id",
+		},
+		{
+			name:        "errorCode",
+			body:        `{"errorCode":"CONSENT_EXPIRED","message":"Consent expired"}`,
+			wantCode:    "CONSENT_EXPIRED",
+			wantMessage: "Consent expired",
+		},
+		{
+			name:        "OBR error list",
+			body:        `{"errors":[{"errorCode":"UK.OBIE.Field.Missing","message":"accountId is required"},{"errorCode":"UK.OBIE.Field.Invalid","message":"other"}]}`,
+			wantCode:    "UK.OBIE.Field.Missing",
+			wantMessage: "accountId is required",
+		},
+		{
+			name:        "OBR envelope over an error list",
+			body:        `{"code":"400 BadRequest","message":"","errors":[{"code":"UK.OBIE.Field.Missing","message":"accountId is required"}]}`,
+			wantCode:    "400 BadRequest",
+			wantMessage: "accountId is required",
+		},
+		{
+			name:        "OAuth2 error",
+			body:        `{"error":"invalid_grant","error_description":"Authorization code expired"}`,
+			wantCode:    "invalid_grant",
+			wantMessage: "Authorization code expired",
+		},
+		{
+			name:        "FastAPI detail",
+			body:        `{"detail":"Consent not found"}`,
+			wantMessage: "Consent not found",
+		},
+		{
+			name:        "FastAPI validation detail",
+			body:        `{"detail":[{"loc":["query","client_id"],"msg":"field required"}]}`,
+			wantMessage: `[{"loc":["query","client_id"],"msg":"field required"}]`,
+		},
+		{
+			name:        "message over detail",
+			body:        `{"message":"Rate limit exceeded","detail":"ignored"}`,
+			wantMessage: "Rate limit exceeded",
+		},
+		{
+			name:        "not JSON",
+			body:        "  <html><body>502 Bad Gateway</body></html>\n",
+			wantMessage: "<html><body>502 Bad Gateway</body></html>",
+		},
+		{
+			name:        "JSON that is not an object",
+			body:        `"Service unavailable"`,
+			wantMessage: `"Service unavailable"`,
+		},
+		{
+			name: "empty body",
+		},
+		{
+			name:        "long message",
+			body:        `{"message":"` + long + `"}`,
+			wantMessage: long[:maxErrorMessageLength],
+		},
+		{
+			name:        "long body",
+			body:        long,
+			wantMessage: long[:maxErrorMessageLength],
+		},
+		{
+			name:        "long message cut between letters",
+			body:        `{"message":"` + cyrillic + `"}`,
+			wantMessage: cyrillic[:maxErrorMessageLength-1],
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, message := ParseError([]byte(tt.body))
+			if code != tt.wantCode {
+				t.Errorf("code %q, want %q", code, tt.wantCode)
+			}
+			if message != tt.wantMessage {
+				t.Errorf("message %q, want %q", message, tt.wantMessage)
+			}
+			if !utf8.ValidString(message) {
+				t.Errorf("message %q is not valid UTF-8", message)
+			}
+		})
+	}
+}
+
+func TestNewBankError(t *testing.T) {
+	header := http.Header{}
+	header.Set(InteractionIDHeader, "4b1c7a0e-93f2-4d1e-a1d8-2f1c3b9e5a77")
+	err := NewBankError("vbank", http.StatusForbidden, header, []byte(`{"code":"CONSENT_REQUIRED","message":"Consent required"}`))
+
+	want := domain.BankError{
+		Bank:          "vbank",
+		StatusCode:    http.StatusForbidden,
+		Code:          "CONSENT_REQUIRED",
+		Message:       "Consent required",
+		InteractionID: "4b1c7a0e-93f2-4d1e-a1d8-2f1c3b9e5a77",
+	}
+	if *err != want {
+		t.Fatalf("got %+v, want %+v", *err, want)
+	}
+	if got, want := err.Error(), "bank vbank responded 403 CONSENT_REQUIRED: Consent required"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+
+	err = NewBankError("abank", http.StatusBadGateway, http.Header{}, nil)
+	if got, want := err.Error(), "bank abank responded 502: Bad Gateway"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,351 @@
+package bankapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/pkg/money"
+	"go.uber.org/zap"
+)
+
+// OBRv1 is the Open Banking Russia flavoured API of the bankingapi.ru sandbox
+// served by vbank, sbank and abank.
+const OBRv1 = "obr/v1"
+
+type obr struct {
+	bank string
+	log  *zap.Logger
+}
+
+func newOBR(bank string, log *zap.Logger) Adapter {
+	return &obr{bank: bank, log: log}
+}
+
+type obrConsent struct {
+	RequestID    string  `json:"request_id"`
+	ConsentID    *string `json:"consent_id"`
+	Status       *string `json:"status"`
+	AutoApproved bool    `json:"auto_approved"`
+	Message      string  `json:"message"`
+	CreatedAt    string  `json:"created_at"`
+	ExpiresAt    string  `json:"expires_at"`
+}
+
+func (a *obr) DecodeConsent(body []byte) (*ConsentResponse, error) {
+	var res obrConsent
+	if err := decodeTolerant(a.log, body, &res); err != nil {
+		return nil, err
+	}
+	if res.ConsentID == nil || *res.ConsentID == "" {
+		return nil, missing("consent_id")
+	}
+	if res.Status == nil {
+		return nil, missing("status")
+	}
+	expiresAt, err := parseDateTime(res.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	createdAt, err := parseDateTime(res.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &ConsentResponse{
+		Status:       *res.Status,
+		ConsentID:    *res.ConsentID,
+		AutoApproved: res.AutoApproved,
+		ExpiresAt:    expiresAt,
+		CreatedAt:    createdAt,
+	}, nil
+}
+
+type obrConsentData struct {
+	ConsentID          *string         `json:"consentId"`
+	ClientID           string          `json:"clientId"`
+	Status             *string         `json:"status"`
+	Permissions        []string        `json:"permissions"`
+	Reason             string          `json:"reason"`
+	RequestingBank     string          `json:"requestingBank"`
+	CreationDateTime   string          `json:"creationDateTime"`
+	StatusUpdateTime   string          `json:"statusUpdateDateTime"`
+	ExpirationDateTime string          `json:"expirationDateTime"`
+	Links              json.RawMessage `json:"links"`
+}
+
+func (a *obr) DecodeConsentStatus(body []byte) (*ConsentResponse, error) {
+	var res struct {
+		Data  *obrConsentData `json:"data"`
+		Links json.RawMessage `json:"links"`
+		Meta  json.RawMessage `json:"meta"`
+	}
+	if err := decodeTolerant(a.log, body, &res); err != nil {
+		return nil, err
+	}
+	if res.Data == nil {
+		return nil, missing("data")
+	}
+	if res.Data.ConsentID == nil || *res.Data.ConsentID == "" {
+		return nil, missing("data.consentId")
+	}
+	if res.Data.Status == nil {
+		return nil, missing("data.status")
+	}
+	expiresAt, err := parseDateTime(res.Data.ExpirationDateTime)
+	if err != nil {
+		return nil, err
+	}
+	createdAt, err := parseDateTime(res.Data.CreationDateTime)
+	if err != nil {
+		return nil, err
+	}
+	return &ConsentResponse{
+		Status:    *res.Data.Status,
+		ConsentID: *res.Data.ConsentID,
+		ExpiresAt: expiresAt,
+		CreatedAt: createdAt,
+	}, nil
+}
+
+type obrIdentification struct {
+	SchemeName     string `json:"schemeName"`
+	Identification string `json:"identification"`
+	Name           string `json:"name"`
+}
+
+type obrAccount struct {
+	AccountID      string              `json:"accountId"`
+	Status         string              `json:"status"`
+	StatusUpdate   string              `json:"statusUpdateDateTime"`
+	Currency       string              `json:"currency"`
+	AccountType    string              `json:"accountType"`
+	AccountSubType string              `json:"accountSubType"`
+	Description    string              `json:"description"`
+	Nickname       string              `json:"nickname"`
+	OpeningDate    string              `json:"openingDate"`
+	Servicer       json.RawMessage     `json:"servicer"`
+	Account        []obrIdentification `json:"account"`
+}
+
+func (a *obr) DecodeAccounts(body []byte) ([]*domain.Account, error) {
+	var res struct {
+		Data *struct {
+			Account *[]obrAccount `json:"account"`
+		} `json:"data"`
+		Links json.RawMessage `json:"links"`
+		Meta  json.RawMessage `json:"meta"`
+	}
+	if err := decodeTolerant(a.log, body, &res); err != nil {
+		return nil, err
+	}
+	if res.Data == nil {
+		return nil, missing("data")
+	}
+	if res.Data.Account == nil {
+		return nil, missing("data.account")
+	}
+	accounts := make([]*domain.Account, 0, len(*res.Data.Account))
+	for _, acc := range *res.Data.Account {
+		if acc.AccountID == "" {
+			return nil, missing("data.account.accountId")
+		}
+		account := &domain.Account{
+			AccountID:   acc.AccountID,
+			Currency:    acc.Currency,
+			AccountType: acc.AccountType,
+			Nickname:    acc.Nickname,
+			Servicer:    a.servicer(acc.Servicer),
+		}
+		if len(acc.Account) > 0 {
+			account.Identification = acc.Account[0].Identification
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, nil
+}
+
+type obrAmount struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+type obrBalance struct {
+	AccountID            string          `json:"accountId"`
+	Type                 string          `json:"type"`
+	DateTime             string          `json:"dateTime"`
+	Amount               *obrAmount      `json:"amount"`
+	CreditDebitIndicator string          `json:"creditDebitIndicator"`
+	CreditLine           json.RawMessage `json:"creditLine"`
+}
+
+func (a *obr) DecodeBalances(body []byte) ([]*domain.Balance, error) {
+	var res struct {
+		Data *struct {
+			Balance *[]obrBalance `json:"balance"`
+		} `json:"data"`
+		Links json.RawMessage `json:"links"`
+		Meta  json.RawMessage `json:"meta"`
+	}
+	if err := decodeTolerant(a.log, body, &res); err != nil {
+		return nil, err
+	}
+	if res.Data == nil {
+		return nil, missing("data")
+	}
+	if res.Data.Balance == nil {
+		return nil, missing("data.balance")
+	}
+	balances := make([]*domain.Balance, 0, len(*res.Data.Balance))
+	for _, b := range *res.Data.Balance {
+		if b.Amount == nil {
+			return nil, missing("data.balance.amount")
+		}
+		amount, err := signedAmount(b.Amount.Amount, b.CreditDebitIndicator)
+		if err != nil {
+			return nil, err
+		}
+		asOf, err := parseDateTime(b.DateTime)
+		if err != nil {
+			return nil, err
+		}
+		balances = append(balances, &domain.Balance{
+			AccountID: b.AccountID,
+			Type:      b.Type,
+			Amount:    amount,
+			Currency:  b.Amount.Currency,
+			AsOf:      asOf,
+		})
+	}
+	return balances, nil
+}
+
+type obrMerchant struct {
+	Name                 string `json:"name"`
+	MerchantCategoryCode string `json:"merchantCategoryCode"`
+}
+
+type obrTransaction struct {
+	AccountID              string             `json:"accountId"`
+	TransactionID          string             `json:"transactionId"`
+	TransactionReference   string             `json:"transactionReference"`
+	CreditDebitIndicator   string             `json:"creditDebitIndicator"`
+	Status                 string             `json:"status"`
+	BookingDateTime        string             `json:"bookingDateTime"`
+	ValueDateTime          string             `json:"valueDateTime"`
+	Amount                 *obrAmount         `json:"amount"`
+	TransactionInformation string             `json:"transactionInformation"`
+	BankTransactionCode    json.RawMessage    `json:"bankTransactionCode"`
+	Merchant               *obrMerchant       `json:"merchant"`
+	CreditorAccount        *obrIdentification `json:"creditorAccount"`
+	DebtorAccount          *obrIdentification `json:"debtorAccount"`
+}
+
+func (a *obr) DecodeTransactions(body []byte) ([]*domain.Transaction, error) {
+	var res struct {
+		Data *struct {
+			Transaction *[]obrTransaction `json:"transaction"`
+		} `json:"data"`
+		Links json.RawMessage `json:"links"`
+		Meta  json.RawMessage `json:"meta"`
+	}
+	if err := decodeTolerant(a.log, body, &res); err != nil {
+		return nil, err
+	}
+	if res.Data == nil {
+		return nil, missing("data")
+	}
+	if res.Data.Transaction == nil {
+		return nil, missing("data.transaction")
+	}
+	txs := make([]*domain.Transaction, 0, len(*res.Data.Transaction))
+	for _, t := range *res.Data.Transaction {
+		if t.TransactionID == "" {
+			return nil, missing("data.transaction.transactionId")
+		}
+		if t.Amount == nil {
+			return nil, missing("data.transaction.amount")
+		}
+		amount, err := signedAmount(t.Amount.Amount, t.CreditDebitIndicator)
+		if err != nil {
+			return nil, err
+		}
+		bookedAt, err := parseDateTime(t.BookingDateTime)
+		if err != nil {
+			return nil, err
+		}
+		valueAt, err := parseDateTime(t.ValueDateTime)
+		if err != nil {
+			return nil, err
+		}
+		tx := &domain.Transaction{
+			TransactionID: t.TransactionID,
+			AccountID:     t.AccountID,
+			Amount:        amount,
+			Currency:      t.Amount.Currency,
+			Status:        t.Status,
+			BookedAt:      bookedAt,
+			ValueAt:       valueAt,
+			Description:   t.TransactionInformation,
+		}
+		if t.Merchant != nil {
+			tx.Merchant = t.Merchant.Name
+			tx.MCC = t.Merchant.MerchantCategoryCode
+		}
+		// The counterparty is the creditor of a debit and the debtor of a credit.
+		counterparty := t.CreditorAccount
+		if strings.EqualFold(t.CreditDebitIndicator, domain.CreditDebitCredit) {
+			counterparty = t.DebtorAccount
+		}
+		if counterparty != nil {
+			tx.Counterparty = counterparty.Identification
+			tx.CounterpartyName = counterparty.Name
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+func signedAmount(amount, indicator string) (string, error) {
+	v, err := money.Parse(amount)
+	if err != nil {
+		return "", fmt.Errorf("%w: amount %q", ErrUnexpectedPayload, amount)
+	}
+	if strings.EqualFold(indicator, domain.CreditDebitDebit) && v.Sign() > 0 {
+		v.Neg(v)
+	}
+	return money.Format(v), nil
+}
+
+func parseDateTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", time.DateOnly} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: date time %q", ErrUnexpectedPayload, s)
+}
+
+// servicer accepts both the plain string and the identification object form.
+func (a *obr) servicer(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var name string
+	if err := json.Unmarshal(raw, &name); err == nil {
+		return name
+	}
+	var id obrIdentification
+	if err := json.Unmarshal(raw, &id); err == nil {
+		if id.Name != "" {
+			return id.Name
+		}
+		return id.Identification
+	}
+	a.log.Warn("unexpected servicer format", zap.ByteString("servicer", raw))
+	return ""
+}
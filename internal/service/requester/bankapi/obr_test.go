@@ -0,0 +1,481 @@
+package bankapi
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// contract is what Lima reads from the fixture payloads of a bank.
+type contract struct {
+	consent       *ConsentResponse
+	consentStatus *ConsentResponse
+	accounts      []*domain.Account
+	balances      []*domain.Balance
+	transactions  []*domain.Transaction
+}
+
+var contracts = map[string]contract{
+	"vbank": {
+		consent: &ConsentResponse{
+			Status:       domain.ConsentStatusApproved,
+			ConsentID:    "consent-671ed526-d2d7-43ba-b956-ed1364ba9c40",
+			AutoApproved: true,
+			ExpiresAt:    at("2026-04-19T11:17:57Z"),
+			CreatedAt:    at("2026-01-19T11:17:57Z"),
+		},
+		consentStatus: &ConsentResponse{
+			Status:    domain.ConsentStatusApproved,
+			ConsentID: "consent-671ed526-d2d7-43ba-b956-ed1364ba9c40",
+			ExpiresAt: at("2026-04-19T11:17:57Z"),
+			CreatedAt: at("2026-01-19T11:17:57Z"),
+		},
+		accounts: []*domain.Account{
+			{
+				AccountID:      "vbank-team-1-acc-1",
+				Currency:       "RUB",
+				AccountType:    "Personal",
+				Nickname:       "vbank current",
+				Servicer:       "vbank",
+				Identification: "40817810262944067166",
+			},
+			{
+				AccountID:      "vbank-team-1-acc-2",
+				Currency:       "EUR",
+				AccountType:    "Personal",
+				Nickname:       "vbank savings",
+				Servicer:       "vbank",
+				Identification: "40817810262944067167",
+			},
+		},
+		balances: []*domain.Balance{
+			{
+				AccountID: "vbank-team-1-acc-1",
+				Type:      "InterimAvailable",
+				Amount:    "413836.00",
+				Currency:  "RUB",
+				AsOf:      at("2026-01-19T00:00:00Z"),
+			},
+		},
+		transactions: []*domain.Transaction{
+			{
+				TransactionID: "vbank-team-1-acc-1-tx-1",
+				AccountID:     "vbank-team-1-acc-1",
+				Amount:        "-317.00",
+				Currency:      "RUB",
+				Status:        "Booked",
+				BookedAt:      at("2026-01-12T16:12:00Z"),
+				ValueAt:       at("2026-01-12T16:12:00Z"),
+				Description:   "Coffee House",
+				Merchant:      "Coffee House",
+				MCC:           "5814",
+			},
+			{
+				TransactionID:    "vbank-team-1-acc-1-tx-2",
+				AccountID:        "vbank-team-1-acc-1",
+				Amount:           "-15000.00",
+				Currency:         "RUB",
+				Status:           "Booked",
+				BookedAt:         at("2026-01-13T09:00:00Z"),
+				ValueAt:          at("2026-01-13T09:00:00Z"),
+				Description:      "Transfer to savings",
+				Counterparty:     "40817810262944067167",
+				CounterpartyName: "Ivan Petrov",
+			},
+		},
+	},
+	"sbank": {
+		consent: &ConsentResponse{
+			Status:    domain.ConsentStatusPending,
+			ConsentID: "consent-8b38a239-28f6-45e0-8655-3f0313184dd0",
+			CreatedAt: at("2026-01-19T11:17:57Z"),
+		},
+		consentStatus: &ConsentResponse{
+			Status:    domain.ConsentStatusApproved,
+			ConsentID: "consent-8b38a239-28f6-45e0-8655-3f0313184dd0",
+			ExpiresAt: at("2026-07-19T11:17:57Z"),
+			CreatedAt: at("2026-01-19T11:17:57Z"),
+		},
+		accounts: []*domain.Account{
+			{
+				AccountID:      "sbank-team-1-acc-1",
+				Currency:       "RUB",
+				AccountType:    "Personal",
+				Nickname:       "sbank current",
+				Servicer:       "SBank",
+				Identification: "40817810997054152297",
+			},
+		},
+		balances: []*domain.Balance{
+			{
+				AccountID: "sbank-team-1-acc-1",
+				Type:      "InterimAvailable",
+				Amount:    "-112120.00",
+				Currency:  "RUB",
+				AsOf:      at("2026-01-19T00:00:00Z"),
+			},
+			{
+				AccountID: "sbank-team-1-acc-1",
+				Type:      "ClosingBooked",
+				Amount:    "-110500.50",
+				Currency:  "RUB",
+				AsOf:      at("2026-01-18T00:00:00Z"),
+			},
+		},
+		transactions: []*domain.Transaction{
+			{
+				TransactionID:    "sbank-team-1-acc-1-tx-1",
+				AccountID:        "sbank-team-1-acc-1",
+				Amount:           "85000.00",
+				Currency:         "RUB",
+				Status:           "Booked",
+				BookedAt:         at("2026-01-10T10:28:00Z"),
+				ValueAt:          at("2026-01-10T10:28:00Z"),
+				Description:      "Salary",
+				Counterparty:     "40702810100000000001",
+				CounterpartyName: "OOO Romashka",
+			},
+			{
+				TransactionID: "sbank-team-1-acc-1-tx-2",
+				AccountID:     "sbank-team-1-acc-1",
+				Amount:        "-3188.00",
+				Currency:      "RUB",
+				Status:        "Pending",
+				BookedAt:      at("2026-01-11T21:54:00Z"),
+				Description:   "Perekrestok",
+				Merchant:      "Perekrestok",
+				MCC:           "5411",
+			},
+		},
+	},
+	"abank": {
+		consent: &ConsentResponse{
+			Status:       domain.ConsentStatusApproved,
+			ConsentID:    "consent-341da3da-586c-4a43-a701-b979525b31d4",
+			AutoApproved: true,
+			ExpiresAt:    at("2026-04-19T00:00:00Z"),
+			CreatedAt:    at("2026-01-19T00:00:00Z"),
+		},
+		consentStatus: &ConsentResponse{
+			Status:    domain.ConsentStatusRevoked,
+			ConsentID: "consent-341da3da-586c-4a43-a701-b979525b31d4",
+			ExpiresAt: at("2026-04-19T00:00:00Z"),
+			CreatedAt: at("2026-01-19T00:00:00Z"),
+		},
+		accounts: []*domain.Account{
+			{
+				AccountID:   "abank-team-1-acc-1",
+				Currency:    "RUB",
+				AccountType: "Business",
+				Nickname:    "abank credit card",
+				Servicer:    "abank",
+			},
+		},
+		balances: []*domain.Balance{
+			{
+				AccountID: "abank-team-1-acc-1",
+				Type:      "InterimAvailable",
+				Amount:    "-157658.00",
+				Currency:  "RUB",
+				AsOf:      at("2026-01-19T00:00:00Z"),
+			},
+		},
+		transactions: []*domain.Transaction{
+			{
+				TransactionID: "abank-team-1-acc-1-tx-1",
+				AccountID:     "abank-team-1-acc-1",
+				Amount:        "-62.00",
+				Currency:      "RUB",
+				Status:        "Booked",
+				BookedAt:      at("2026-01-09T00:00:00Z"),
+				ValueAt:       at("2026-01-09T00:00:00Z"),
+				Description:   "Moscow Metro",
+				Merchant:      "Moscow Metro",
+				MCC:           "4111",
+			},
+		},
+	},
+}
+
+func TestOBRContract(t *testing.T) {
+	for bank, want := range contracts {
+		t.Run(bank, func(t *testing.T) {
+			a, logs := newTestAdapter(t, bank)
+
+			consent, err := a.DecodeConsent(fixture(t, bank, "consent"))
+			check(t, "consent", consent, want.consent, err)
+			consentStatus, err := a.DecodeConsentStatus(fixture(t, bank, "consent_status"))
+			check(t, "consent status", consentStatus, want.consentStatus, err)
+			accounts, err := a.DecodeAccounts(fixture(t, bank, "accounts"))
+			check(t, "accounts", accounts, want.accounts, err)
+			balances, err := a.DecodeBalances(fixture(t, bank, "balances"))
+			check(t, "balances", balances, want.balances, err)
+			transactions, err := a.DecodeTransactions(fixture(t, bank, "transactions"))
+			check(t, "transactions", transactions, want.transactions, err)
+
+			for _, entry := range logs.All() {
+				t.Errorf("unexpected log %q %v", entry.Message, entry.ContextMap())
+			}
+		})
+	}
+}
+
+func TestOBRUnknownFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		decode func(Adapter, []byte) error
+		body   string
+		fields []string
+	}{
+		{
+			name:   "consent",
+			decode: func(a Adapter, body []byte) error { _, err := a.DecodeConsent(body); return err },
+			body:   `{"consent_id":"c-1","status":"approved","scope":"accounts","ttl":90}`,
+			fields: []string{"scope", "ttl"},
+		},
+		{
+			name:   "consent status",
+			decode: func(a Adapter, body []byte) error { _, err := a.DecodeConsentStatus(body); return err },
+			body:   `{"data":{"consentId":"c-1","status":"approved","riskScore":3}}`,
+			fields: []string{"data.riskScore"},
+		},
+		{
+			name:   "accounts",
+			decode: func(a Adapter, body []byte) error { _, err := a.DecodeAccounts(body); return err },
+			body:   `{"data":{"account":[{"accountId":"acc-1","account":[{"identification":"4081","secondaryIdentification":"x"}],"isPrimary":true}]},"total":1}`,
+			fields: []string{"data.account.account.secondaryIdentification", "data.account.isPrimary", "total"},
+		},
+		{
+			name:   "balances",
+			decode: func(a Adapter, body []byte) error { _, err := a.DecodeBalances(body); return err },
+			body:   `{"data":{"balance":[{"accountId":"acc-1","amount":{"amount":"1.00","currency":"RUB","precision":2}}]}}`,
+			fields: []string{"data.balance.amount.precision"},
+		},
+		{
+			name:   "transactions",
+			decode: func(a Adapter, body []byte) error { _, err := a.DecodeTransactions(body); return err },
+			body:   `{"data":{"transaction":[{"transactionId":"tx-1","amount":{"amount":"1.00","currency":"RUB"},"merchant":{"name":"Shop","city":"Moscow"},"cashback":"0.10"}]}}`,
+			fields: []string{"data.transaction.cashback", "data.transaction.merchant.city"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, logs := newTestAdapter(t, "vbank")
+			if err := tt.decode(a, []byte(tt.body)); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			var fields []string
+			for _, entry := range logs.FilterMessage("unknown field in bank payload").All() {
+				fields = append(fields, entry.ContextMap()["field"].(string))
+			}
+			slices.Sort(fields)
+			if !slices.Equal(fields, tt.fields) {
+				t.Errorf("logged unknown fields %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestOBRMissingFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		decode  func(Adapter, []byte) error
+		body    string
+		missing string
+	}{
+		{
+			name:    "consent id",
+			decode:  func(a Adapter, body []byte) error { _, err := a.DecodeConsent(body); return err },
+			body:    `{"status":"approved"}`,
+			missing: "consent_id",
+		},
+		{
+			name:    "empty consent id",
+			decode:  func(a Adapter, body []byte) error { _, err := a.DecodeConsent(body); return err },
+			body:    `{"consent_id":"","status":"approved"}`,
+			missing: "consent_id",
+		},
+		{
+			name:    "consent status",
+			decode:  func(a Adapter, body []byte) error { _, err := a.DecodeConsent(body); return err },
+			body:    `{"consent_id":"c-1"}`,
+			missing: "status",
+		},
+		{
+			name:    "consent status data",
+			decode:  func(a Adapter, body []byte) error { _, err := a.DecodeConsentStatus(body); return err },
+			body:    `{"links":{}}`,
+			missing: "data",
+		},
+		{
+			name:    "consent status id",
+			decode:  func(a Adapter, body []byte) error { _, err := a.DecodeConsentStatus(body); return err },
+			body:    `{"data":{"status":"approved"}}`,
+			missing: "data.consentId",
+		},
+		{
+			name:    "empty consent status id",
+			decode:  func(a Adapter, body []byte) error { _, err := a.DecodeConsentStatus(body); return err },
+			body:    `{"data":{"consentId":"","status":"approved"}}`,
+			missing: "data.consentId",
+		},
+		{
+			name:    "accounts data",
+			decode:  func(a Adapter, body []byte) error { _, err := a.DecodeAccounts(body); return err },
+			body:    `{"accounts":[]}`,
+			missing: "data",
+		},
+		{
+			name:    "accounts list",
+			decode:  func(a Adapter, body []byte) error { _, err := a.DecodeAccounts(body); return err },
+			body:    `{"data":{}}`,
+			missing: "data.account",
+		},
+		{
+			name:    "account id",
+			decode:  func(a Adapter, body []byte) error { _, err := a.DecodeAccounts(body); return err },
+			body:    `{"data":{"account":[{"currency":"RUB"}]}}`,
+			missing: "data.account.accountId",
+		},
+		{
+			name:    "balances list",
+			decode:  func(a Adapter, body []byte) error { _, err := a.DecodeBalances(body); return err },
+			body:    `{"data":{}}`,
+			missing: "data.balance",
+		},
+		{
+			name:    "balance amount",
+			decode:  func(a Adapter, body []byte) error { _, err := a.DecodeBalances(body); return err },
+			body:    `{"data":{"balance":[{"accountId":"acc-1"}]}}`,
+			missing: "data.balance.amount",
+		},
+		{
+			name:    "transactions list",
+			decode:  func(a Adapter, body []byte) error { _, err := a.DecodeTransactions(body); return err },
+			body:    `{"data":{}}`,
+			missing: "data.transaction",
+		},
+		{
+			name:    "transaction id",
+			decode:  func(a Adapter, body []byte) error { _, err := a.DecodeTransactions(body); return err },
+			body:    `{"data":{"transaction":[{"amount":{"amount":"1.00","currency":"RUB"}}]}}`,
+			missing: "data.transaction.transactionId",
+		},
+		{
+			name:    "transaction amount",
+			decode:  func(a Adapter, body []byte) error { _, err := a.DecodeTransactions(body); return err },
+			body:    `{"data":{"transaction":[{"transactionId":"tx-1"}]}}`,
+			missing: "data.transaction.amount",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _ := newTestAdapter(t, "vbank")
+			err := tt.decode(a, []byte(tt.body))
+			if !errors.Is(err, ErrUnexpectedPayload) {
+				t.Fatalf("decode error %v, want %v", err, ErrUnexpectedPayload)
+			}
+			if want := "missing " + tt.missing; !strings.HasSuffix(err.Error(), want) {
+				t.Errorf("decode error %q, want it to end with %q", err, want)
+			}
+		})
+	}
+}
+
+func TestOBRMalformedPayloads(t *testing.T) {
+	tests := []struct {
+		name   string
+		decode func(Adapter, []byte) error
+		body   string
+	}{
+		{
+			name:   "not json",
+			decode: func(a Adapter, body []byte) error { _, err := a.DecodeAccounts(body); return err },
+			body:   `<html>Bad Gateway</html>`,
+		},
+		{
+			name:   "wrong type",
+			decode: func(a Adapter, body []byte) error { _, err := a.DecodeAccounts(body); return err },
+			body:   `{"data":{"account":{"accountId":"acc-1"}}}`,
+		},
+		{
+			name:   "invalid amount",
+			decode: func(a Adapter, body []byte) error { _, err := a.DecodeBalances(body); return err },
+			body:   `{"data":{"balance":[{"accountId":"acc-1","amount":{"amount":"1,00","currency":"RUB"}}]}}`,
+		},
+		{
+			name:   "invalid date time",
+			decode: func(a Adapter, body []byte) error { _, err := a.DecodeTransactions(body); return err },
+			body:   `{"data":{"transaction":[{"transactionId":"tx-1","amount":{"amount":"1.00","currency":"RUB"},"bookingDateTime":"19.01.2026"}]}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _ := newTestAdapter(t, "vbank")
+			if err := tt.decode(a, []byte(tt.body)); !errors.Is(err, ErrUnexpectedPayload) {
+				t.Errorf("decode error %v, want %v", err, ErrUnexpectedPayload)
+			}
+		})
+	}
+}
+
+func newTestAdapter(t *testing.T, bank string) (Adapter, *observer.ObservedLogs) {
+	t.Helper()
+	core, logs := observer.New(zap.DebugLevel)
+	a, err := New(OBRv1, bank, zap.New(core))
+	if err != nil {
+		t.Fatalf("new adapter: %v", err)
+	}
+	return a, logs
+}
+
+func fixture(t *testing.T, bank, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", bank, name+".json"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	return data
+}
+
+func check[T any](t *testing.T, what string, got, want T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Errorf("decode %s: %v", what, err)
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decode %s:\ngot  %s\nwant %s", what, dump(got), dump(want))
+	}
+}
+
+// dump prints the values behind the pointers of v.
+func dump(v any) string {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return fmt.Sprintf("%+v", reflect.Indirect(rv).Interface())
+	}
+	items := make([]string, rv.Len())
+	for i := range items {
+		items[i] = fmt.Sprintf("%+v", rv.Index(i).Elem().Interface())
+	}
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+func at(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
@@ -0,0 +1,38 @@
+package requester
+
+import (
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/pkg/ratelimit"
+)
+
+type Config struct {
+	Banks []Bank `json:"banks" yaml:"banks"`
+	// QuotaWait is how long a call may wait for the quota of its bank before
+	// it fails with ErrQuotaExceeded.
+	QuotaWait time.Duration `json:"quota_wait" yaml:"quota_wait"`
+}
+
+type Bank struct {
+	Name    string `json:"name" yaml:"name"`
+	BaseURL string `json:"base_url" yaml:"base_url"`
+	// API selects the payload adapter of the bank, see bankapi.
+	API string `json:"api" yaml:"api"`
+	// Quota keeps calls within the limits the bank publishes.
+	Quota ratelimit.Config `json:"quota" yaml:"quota"`
+	// Authorization sets up the redirect approval of consents the bank does
+	// not approve on request.
+	Authorization Authorization `json:"authorization" yaml:"authorization"`
+}
+
+// Authorization locates the consent approval endpoints of a bank. URLs are
+// either absolute or relative to the base URL of the bank.
+type Authorization struct {
+	// URL is the page the client approves consents on. Banks without one
+	// cannot approve pending consents through Lima.
+	URL string `json:"url" yaml:"url"`
+	// TokenURL exchanges the authorisation code for the approved consent.
+	// Without one the bank is taken to approve the consent on redirect and
+	// its status is read back.
+	TokenURL string `json:"token_url" yaml:"token_url"`
+}
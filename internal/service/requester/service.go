@@ -4,28 +4,99 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"net/url"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/MichaelSBoop/lima-backend/internal/domain"
-	"github.com/MichaelSBoop/lima-backend/pkg/httpclient"
+	"github.com/MichaelSBoop/lima-backend/internal/service/requester/bankapi"
+	"github.com/MichaelSBoop/lima-backend/pkg/ratelimit"
 	"go.uber.org/zap"
 	"golang.org/x/oauth2"
+	"golang.org/x/sync/errgroup"
 )
 
+const defaultQuotaWait = 5 * time.Second
+
+// ErrQuotaExceeded is returned instead of calling a bank over its quota.
+var ErrQuotaExceeded = errors.New("bank request quota exceeded")
+
 type Service struct {
 	log              *zap.Logger
 	token            TokenProvider
 	consentsProvider ConsentsProvider
+	baseURLs         map[string]*url.URL
+	adapters         map[string]bankapi.Adapter
+	quotas           map[string]*ratelimit.Limiter
+	authorizations   map[string]Authorization
+	quotaWait        time.Duration
+	client           *http.Client
+	feed             Feed
+	auditor          Auditor
 }
 
-func New(log *zap.Logger, token TokenProvider, consentsProvider ConsentsProvider) *Service {
+func New(cfg Config, log *zap.Logger, client *http.Client, token TokenProvider, consentsProvider ConsentsProvider, feed Feed, auditor Auditor) (*Service, error) {
+	baseURLs := make(map[string]*url.URL)
+	adapters := make(map[string]bankapi.Adapter)
+	quotas := make(map[string]*ratelimit.Limiter)
+	authorizations := make(map[string]Authorization)
+	for _, bank := range cfg.Banks {
+		u, err := url.Parse(bank.BaseURL)
+		if err != nil {
+			return nil, err
+		}
+		baseURLs[bank.Name] = u
+		adapter, err := bankapi.New(bank.API, bank.Name, log)
+		if err != nil {
+			return nil, err
+		}
+		adapters[bank.Name] = adapter
+		quotas[bank.Name] = ratelimit.New(bank.Quota)
+		authorizations[bank.Name] = bank.Authorization
+	}
+	quotaWait := cfg.QuotaWait
+	if quotaWait <= 0 {
+		quotaWait = defaultQuotaWait
+	}
 	return &Service{
 		log:              log,
 		token:            token,
 		consentsProvider: consentsProvider,
+		baseURLs:         baseURLs,
+		adapters:         adapters,
+		quotas:           quotas,
+		authorizations:   authorizations,
+		quotaWait:        quotaWait,
+		client:           client,
+		feed:             feed,
+		auditor:          auditor,
+	}, nil
+}
+
+// bankURL resolves path against the configured base URL of the bank,
+// falling back to the public sandbox host.
+func (s *Service) bankURL(providerName, path string) *url.URL {
+	base, ok := s.baseURLs[providerName]
+	if !ok {
+		base = &url.URL{
+			Scheme: "https",
+			Host:   providerName + ".open.bankingapi.ru",
+		}
+	}
+	return base.JoinPath(path)
+}
+
+func (s *Service) adapter(providerName string) (bankapi.Adapter, error) {
+	if adapter, ok := s.adapters[providerName]; ok {
+		return adapter, nil
 	}
+	return bankapi.New(bankapi.DefaultAPI, providerName, s.log)
 }
 
 func (s *Service) PostConsent(ctx context.Context, consent domain.AccountConsent, providerName string) (*domain.AccountConsent, error) {
@@ -50,11 +121,7 @@ func (s *Service) PostConsent(ctx context.Context, consent domain.AccountConsent
 	if err != nil {
 		return nil, err
 	}
-	destURL := url.URL{
-		Scheme: "https",
-		Host:   providerName + ".open.bankingapi.ru",
-		Path:   "/account-consents/request",
-	}
+	destURL := s.bankURL(providerName, "/account-consents/request")
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, destURL.String(), bytes.NewBuffer(data))
 	if err != nil {
 		return nil, err
@@ -63,104 +130,423 @@ func (s *Service) PostConsent(ctx context.Context, consent domain.AccountConsent
 	headers.Add("Authorization", "Bearer "+token.AccessToken)
 	headers.Add("X-Requesting-Bank", consent.RequestingBank)
 	req.Header = *headers
-	cl := httpclient.Client()
-	s.log.Debug("making request to app", zap.String("provider", providerName))
-	resp, err := cl.Do(req)
+	bodyBytes, err := s.do(req, consent.ClientID, providerName, "")
 	if err != nil {
 		return nil, err
 	}
-	bodyBytes, err := io.ReadAll(resp.Body)
+
+	adapter, err := s.adapter(providerName)
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		if closeErr := resp.Body.Close(); err != nil {
-			s.log.Error("failed to close response body", zap.Error(closeErr))
-		}
-	}()
-
-	var respData struct {
-		Status       string `json:"status" yaml:"status"`
-		ConsentID    string `json:"consent_id" yaml:"consent_id"`
-		AutoApproved bool   `json:"auto_approved" yaml:"auto_approved"`
-	}
-	if err := json.Unmarshal(bodyBytes, &respData); err != nil {
+	respData, err := adapter.DecodeConsent(bodyBytes)
+	if err != nil {
 		return nil, err
 	}
 	consent.Status = respData.Status
 	consent.ConsentID = respData.ConsentID
 	consent.AutoApproved = respData.AutoApproved
 	consent.ConsentProvider = providerName
+	consent.ExpiresAt = respData.ExpiresAt
+	consent.CreatedAt = respData.CreatedAt
+	if consent.CreatedAt.IsZero() {
+		consent.CreatedAt = time.Now().UTC()
+	}
 	return &consent, nil
 }
 
+// RevokeConsent withdraws consent at its bank.
+func (s *Service) RevokeConsent(ctx context.Context, consent *domain.AccountConsent) error {
+	token, err := s.token.Token(ctx, consent.ConsentProvider)
+	if err != nil {
+		return err
+	}
+	destURL := s.bankURL(consent.ConsentProvider, "/account-consents/"+url.PathEscape(consent.ConsentID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, destURL.String(), http.NoBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Authorization", "Bearer "+token.AccessToken)
+	req.Header.Add("X-Requesting-Bank", consent.RequestingBank)
+	_, err = s.do(req, consent.ClientID, consent.ConsentProvider, consent.ConsentID)
+	return err
+}
+
+// GetAccounts fetches the accounts of the client from every bank it has a
+// non-pending consent with. Banks are queried concurrently and the progress
+// of each is pushed to the live feed of the client. A bank whose consents do
+// not allow reading accounts fails the call with a *domain.ConsentError.
 func (s *Service) GetAccounts(ctx context.Context, clientID string) ([]*domain.Account, error) {
-	consents, err := s.consentsProvider.GetConsents(ctx, clientID)
+	byBank, err := s.consentsByBank(ctx, clientID, domain.PermissionReadAccountsDetail)
 	if err != nil {
 		return nil, err
 	}
+	banks := slices.Sorted(maps.Keys(byBank))
+	perBank := make([][]*domain.Account, len(banks))
+	eg, egCtx := errgroup.WithContext(ctx)
+	for i, bank := range banks {
+		eg.Go(func() error {
+			s.feed.Push(clientID, domain.StreamEventSyncProgress, domain.SyncProgress{
+				Bank:   bank,
+				Status: domain.SyncStatusStarted,
+			})
+			var accounts []*domain.Account
+			consent, err := byBank[bank].authorized()
+			if err == nil {
+				accounts, err = s.getBankAccounts(egCtx, clientID, consent)
+			}
+			if err == nil {
+				s.markUsed(egCtx, consent)
+			}
+			progress := domain.SyncProgress{
+				Bank:     bank,
+				Status:   domain.SyncStatusCompleted,
+				Accounts: len(accounts),
+			}
+			if err != nil {
+				progress.Status, progress.Error = domain.SyncStatusFailed, err.Error()
+			}
+			s.feed.Push(clientID, domain.StreamEventSyncProgress, progress)
+			perBank[i] = accounts
+			return err
+		})
+	}
+	if err = eg.Wait(); err != nil {
+		return nil, err
+	}
 	totalAccounts := make([]*domain.Account, 0)
-	for _, consent := range consents {
-		if consent.Status == "pending" {
+	for _, accounts := range perBank {
+		totalAccounts = append(totalAccounts, accounts...)
+	}
+	return totalAccounts, nil
+}
+
+func (s *Service) getBankAccounts(ctx context.Context, clientID string, consent *domain.AccountConsent) ([]*domain.Account, error) {
+	token, err := s.token.Token(ctx, consent.ConsentProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	destURL := s.bankURL(consent.ConsentProvider, "/accounts")
+
+	q := destURL.Query()
+	q.Add("client_id", clientID)
+	destURL.RawQuery = q.Encode()
+
+	body := http.NoBody
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, destURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	headers := &http.Header{}
+	headers.Add("Authorization", "Bearer "+token.AccessToken)
+	headers.Add("X-Requesting-Bank", consent.RequestingBank)
+	headers.Add("X-Consent-Id", consent.ConsentID)
+	req.Header = *headers
+	bodyBytes, err := s.do(req, clientID, consent.ConsentProvider, consent.ConsentID)
+	if err != nil {
+		return nil, err
+	}
+	adapter, err := s.adapter(consent.ConsentProvider)
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := adapter.DecodeAccounts(bodyBytes)
+	if err != nil {
+		return nil, err
+	}
+	for _, account := range accounts {
+		account.ClientID = clientID
+		account.Bank = consent.ConsentProvider
+	}
+	return accounts, nil
+}
+
+// GetBalances fetches the balances of accounts under the consents of their
+// client. It fails with a *domain.ConsentError before calling a bank whose
+// consents do not allow reading balances.
+func (s *Service) GetBalances(ctx context.Context, clientID string, accounts []*domain.Account) ([]*domain.Balance, error) {
+	byBank, err := s.consentsByBank(ctx, clientID, domain.PermissionReadBalances)
+	if err != nil {
+		return nil, err
+	}
+
+	balances := make([]*domain.Balance, 0, len(accounts))
+	used := make(map[string]*domain.AccountConsent)
+	for _, account := range accounts {
+		bankConsent, ok := byBank[account.Bank]
+		if !ok {
 			continue
 		}
+		consent, err := bankConsent.authorized()
+		if err != nil {
+			return nil, err
+		}
+		used[consent.ConsentProvider] = consent
 		token, err := s.token.Token(ctx, consent.ConsentProvider)
 		if err != nil {
 			return nil, err
 		}
-
-		destURL := &url.URL{
-			Scheme: "https",
-			Host:   consent.ConsentProvider + ".open.bankingapi.ru",
-			Path:   "/accounts",
+		destURL := s.bankURL(consent.ConsentProvider, "/accounts/"+url.PathEscape(account.AccountID)+"/balances")
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, destURL.String(), http.NoBody)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("Authorization", "Bearer "+token.AccessToken)
+		req.Header.Add("X-Requesting-Bank", consent.RequestingBank)
+		req.Header.Add("X-Consent-Id", consent.ConsentID)
+		bodyBytes, err := s.do(req, clientID, consent.ConsentProvider, consent.ConsentID)
+		if err != nil {
+			return nil, err
+		}
+		adapter, err := s.adapter(consent.ConsentProvider)
+		if err != nil {
+			return nil, err
+		}
+		accountBalances, err := adapter.DecodeBalances(bodyBytes)
+		if err != nil {
+			return nil, err
+		}
+		for _, balance := range accountBalances {
+			if balance.AccountID == "" {
+				balance.AccountID = account.AccountID
+			}
+			balance.ClientID = clientID
+			balance.Bank = account.Bank
 		}
+		balances = append(balances, accountBalances...)
+	}
+	s.markUsed(ctx, slices.Collect(maps.Values(used))...)
+	return balances, nil
+}
 
+// GetTransactions fetches the transactions of accounts booked within [from, to].
+// A zero bound leaves that side of the period open. It fails with a
+// *domain.ConsentError before calling a bank whose consents do not allow
+// reading transaction details.
+func (s *Service) GetTransactions(ctx context.Context, clientID string, accounts []*domain.Account, from, to time.Time) ([]*domain.Transaction, error) {
+	byBank, err := s.consentsByBank(ctx, clientID, domain.PermissionReadTransactionsDetail)
+	if err != nil {
+		return nil, err
+	}
+
+	txs := make([]*domain.Transaction, 0)
+	used := make(map[string]*domain.AccountConsent)
+	for _, account := range accounts {
+		bankConsent, ok := byBank[account.Bank]
+		if !ok {
+			continue
+		}
+		consent, err := bankConsent.authorized()
+		if err != nil {
+			return nil, err
+		}
+		used[consent.ConsentProvider] = consent
+		token, err := s.token.Token(ctx, consent.ConsentProvider)
+		if err != nil {
+			return nil, err
+		}
+		destURL := s.bankURL(consent.ConsentProvider, "/accounts/"+url.PathEscape(account.AccountID)+"/transactions")
 		q := destURL.Query()
-		q.Add("client_id", clientID)
+		if !from.IsZero() {
+			q.Add("from_booking_date_time", from.UTC().Format(time.RFC3339))
+		}
+		if !to.IsZero() {
+			q.Add("to_booking_date_time", to.UTC().Format(time.RFC3339))
+		}
 		destURL.RawQuery = q.Encode()
-
-		body := http.NoBody
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, destURL.String(), body)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, destURL.String(), http.NoBody)
 		if err != nil {
 			return nil, err
 		}
-		headers := &http.Header{}
-		headers.Add("Authorization", "Bearer "+token.AccessToken)
-		headers.Add("X-Requesting-Bank", consent.RequestingBank)
-		headers.Add("X-Consent-Id", consent.ConsentID)
-		req.Header = *headers
-		cl := httpclient.Client()
-		s.log.Debug("making request to app", zap.String("provider", consent.ConsentProvider))
-		resp, err := cl.Do(req)
+		req.Header.Add("Authorization", "Bearer "+token.AccessToken)
+		req.Header.Add("X-Requesting-Bank", consent.RequestingBank)
+		req.Header.Add("X-Consent-Id", consent.ConsentID)
+		bodyBytes, err := s.do(req, clientID, consent.ConsentProvider, consent.ConsentID)
 		if err != nil {
 			return nil, err
 		}
-		bodyBytes, err := io.ReadAll(resp.Body)
+		adapter, err := s.adapter(consent.ConsentProvider)
 		if err != nil {
 			return nil, err
 		}
-		defer func() {
-			if closeErr := resp.Body.Close(); err != nil {
-				s.log.Error("failed to close response body", zap.Error(closeErr))
+		accountTxs, err := adapter.DecodeTransactions(bodyBytes)
+		if err != nil {
+			return nil, err
+		}
+		for _, tx := range accountTxs {
+			if tx.AccountID == "" {
+				tx.AccountID = account.AccountID
 			}
-		}()
-		var res struct {
-			Data struct {
-				Account []*domain.Account `json:"account" yaml:"account"`
-			} `json:"data" yaml:"data"`
+			tx.ClientID = clientID
+			tx.Bank = account.Bank
 		}
-		if err := json.Unmarshal(bodyBytes, &res); err != nil {
-			return nil, err
+		txs = append(txs, accountTxs...)
+	}
+	s.markUsed(ctx, slices.Collect(maps.Values(used))...)
+	return txs, nil
+}
+
+// bankConsent is the consent of the client with a bank allowing a call, or
+// the reason none of its consents does.
+type bankConsent struct {
+	consent *domain.AccountConsent
+	err     error
+}
+
+func (c bankConsent) authorized() (*domain.AccountConsent, error) {
+	return c.consent, c.err
+}
+
+// consentsByBank picks, for every bank the client has a non-pending consent
+// with, a consent granting permissions. When none does it keeps the error of
+// the one closest to it: an approved consent lacking permissions before an
+// expired one, before one in another status.
+func (s *Service) consentsByBank(ctx context.Context, clientID string, permissions ...string) (map[string]bankConsent, error) {
+	consents, err := s.consentsProvider.GetConsents(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	byBank := make(map[string]bankConsent)
+	for _, consent := range consents {
+		if consent.Status == domain.ConsentStatusPending {
+			continue
 		}
-		totalAccounts = append(totalAccounts, res.Data.Account...)
+		if current, ok := byBank[consent.ConsentProvider]; ok && current.err == nil {
+			continue
+		}
+		err := consent.Authorize(now, permissions...)
+		if err != nil {
+			if current, ok := byBank[consent.ConsentProvider]; ok && consentRank(current.err) >= consentRank(err) {
+				continue
+			}
+		}
+		byBank[consent.ConsentProvider] = bankConsent{consent: consent, err: err}
 	}
-	return totalAccounts, nil
+	return byBank, nil
+}
+
+// markUsed records the consents as used now. Failing to is only logged, the
+// calls made under them have succeeded.
+func (s *Service) markUsed(ctx context.Context, consents ...*domain.AccountConsent) {
+	now := time.Now().UTC()
+	for _, consent := range consents {
+		if err := s.consentsProvider.MarkConsentUsed(ctx, consent.ConsentID, now); err != nil {
+			s.log.Warn("failed to record consent use", zap.String("bank", consent.ConsentProvider), zap.Error(err))
+		}
+	}
+}
+
+// consentRank orders the reasons a consent is insufficient by how close the
+// consent is to allowing the call.
+func consentRank(err error) int {
+	var consentErr *domain.ConsentError
+	if !errors.As(err, &consentErr) {
+		return 0
+	}
+	switch consentErr.Reason {
+	case domain.ConsentReasonPermissions:
+		return 3
+	case domain.ConsentReasonExpired:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// do performs req within the quota of the bank on behalf of the client and
+// returns the response body, turning any non-2xx response into a
+// *domain.BankError. Every call is audited with its outcome, calls the audit
+// log has no room for are not made.
+func (s *Service) do(req *http.Request, clientID, providerName, consentID string) (body []byte, err error) {
+	record, err := s.auditor.Reserve(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	entry := &domain.AuditEntry{
+		ClientID:  clientID,
+		Action:    domain.AuditActionBankRequest,
+		ConsentID: consentID,
+		Bank:      providerName,
+		Endpoint:  req.Method + " " + redactPath(req.URL.Path),
+		Outcome:   domain.AuditOutcomeSuccess,
+	}
+	defer func() {
+		if err != nil {
+			entry.Outcome = domain.AuditOutcomeFailure
+			entry.Error = err.Error()
+		}
+		record(entry)
+	}()
+	if err := s.quotas[providerName].Wait(req.Context(), providerName, s.quotaWait); err != nil {
+		if errors.Is(err, ratelimit.ErrLimited) {
+			return nil, fmt.Errorf("%w: %s", ErrQuotaExceeded, providerName)
+		}
+		return nil, err
+	}
+	s.log.Debug("making request to app", zap.String("provider", providerName), zap.String("path", redactPath(req.URL.Path)))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			s.log.Error("failed to close response body", zap.Error(closeErr))
+		}
+	}()
+	entry.StatusCode = resp.StatusCode
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		bankErr := bankapi.NewBankError(providerName, resp.StatusCode, resp.Header, body)
+		s.log.Warn("bank request failed", zap.Error(bankErr), zap.String("interaction_id", bankErr.InteractionID))
+		return nil, bankErr
+	}
+	return body, nil
+}
+
+// pathParams names the path segments that follow a collection of the bank
+// API and identify one of its resources.
+var pathParams = map[string]string{
+	"account-consents": "{consent_id}",
+	"accounts":         "{account_id}",
+}
+
+// redactPath replaces the IDs of consents and accounts in path with
+// the names of their parameters, so that the audit log and the logs do not
+// hold them in plaintext.
+func redactPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i := 1; i < len(segments); i++ {
+		param, ok := pathParams[segments[i-1]]
+		if !ok || segments[i] == "" || segments[i] == "request" {
+			continue
+		}
+		segments[i] = param
+	}
+	return strings.Join(segments, "/")
 }
 
 type TokenProvider interface {
 	Token(ctx context.Context, providerName string) (*oauth2.Token, error)
 }
 
+// Feed pushes live updates to the connected clients.
+type Feed interface {
+	Push(clientID, eventType string, data any)
+}
+
+// Auditor records the calls made to banks.
+type Auditor interface {
+	// Reserve holds room for the entry of a call and returns the function
+	// recording it, or fails when the call cannot be audited.
+	Reserve(ctx context.Context) (func(entry *domain.AuditEntry), error)
+}
+
 type ConsentsProvider interface {
 	GetConsents(ctx context.Context, clientID string) ([]*domain.AccountConsent, error)
+	MarkConsentUsed(ctx context.Context, consentID string, at time.Time) error
 }
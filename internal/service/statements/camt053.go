@@ -0,0 +1,224 @@
+package statements
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/pkg/money"
+)
+
+const camt053Namespace = "urn:iso:std:iso:20022:tech:xsd:camt.053.001.08"
+
+const (
+	camtCredit = "CRDT"
+	camtDebit  = "DBIT"
+)
+
+// Length limits of the text types of the schema.
+const (
+	camtIDLength          = 35
+	camtAccountIDLength   = 34
+	camtNameLength        = 140
+	camtAccountNameLength = 70
+	camtRemittanceLength  = 140
+)
+
+type camtAmount struct {
+	Currency string `xml:"Ccy,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type camtDate struct {
+	Date     string `xml:"Dt,omitempty"`
+	DateTime string `xml:"DtTm,omitempty"`
+}
+
+type camtBalance struct {
+	Code        string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amount      camtAmount `xml:"Amt"`
+	CreditDebit string     `xml:"CdtDbtInd"`
+	Date        camtDate   `xml:"Dt"`
+}
+
+type camtParty struct {
+	Name string `xml:"Pty>Nm,omitempty"`
+}
+
+type camtTransactionDetails struct {
+	Reference    string     `xml:"Refs>AcctSvcrRef"`
+	Creditor     *camtParty `xml:"RltdPties>Cdtr,omitempty"`
+	CreditorAcct *string    `xml:"RltdPties>CdtrAcct>Id>Othr>Id,omitempty"`
+	Debtor       *camtParty `xml:"RltdPties>Dbtr,omitempty"`
+	DebtorAcct   *string    `xml:"RltdPties>DbtrAcct>Id>Othr>Id,omitempty"`
+	Remittance   string     `xml:"RmtInf>Ustrd,omitempty"`
+}
+
+type camtEntry struct {
+	Reference   string                 `xml:"NtryRef"`
+	Amount      camtAmount             `xml:"Amt"`
+	CreditDebit string                 `xml:"CdtDbtInd"`
+	Status      string                 `xml:"Sts>Cd"`
+	BookingDate camtDate               `xml:"BookgDt"`
+	ValueDate   camtDate               `xml:"ValDt"`
+	ServicerRef string                 `xml:"AcctSvcrRef"`
+	BankCode    string                 `xml:"BkTxCd>Prtry>Cd"`
+	Details     camtTransactionDetails `xml:"NtryDtls>TxDtls"`
+}
+
+type camtStatement struct {
+	ID      string `xml:"Id"`
+	Created string `xml:"CreDtTm"`
+	Period  struct {
+		From string `xml:"FrDtTm"`
+		To   string `xml:"ToDtTm"`
+	} `xml:"FrToDt"`
+	Account struct {
+		ID       string `xml:"Id>Othr>Id"`
+		Currency string `xml:"Ccy"`
+		Name     string `xml:"Nm,omitempty"`
+		Servicer string `xml:"Svcr>FinInstnId>Nm,omitempty"`
+	} `xml:"Acct"`
+	Balances []camtBalance `xml:"Bal"`
+	Summary  struct {
+		Entries int    `xml:"TtlNtries>NbOfNtries"`
+		Sum     string `xml:"TtlNtries>Sum"`
+		Net     string `xml:"TtlNtries>TtlNetNtry>Amt"`
+		NetSign string `xml:"TtlNtries>TtlNetNtry>CdtDbtInd"`
+	} `xml:"TxsSummry"`
+	Entries []camtEntry `xml:"Ntry"`
+}
+
+type camtDocument struct {
+	XMLName   xml.Name `xml:"Document"`
+	Namespace string   `xml:"xmlns,attr"`
+	Header    struct {
+		MessageID string `xml:"MsgId"`
+		Created   string `xml:"CreDtTm"`
+	} `xml:"BkToCstmrStmt>GrpHdr"`
+	Statement camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+// writeCamt053 writes an ISO 20022 camt.053.001.08 bank to customer statement
+// with the opening (OPBD) and closing (CLBD) booked balances.
+func writeCamt053(w io.Writer, statement *domain.Statement) error {
+	entries, err := entries(statement)
+	if err != nil {
+		return err
+	}
+	created := statement.GeneratedAt.UTC().Format(time.RFC3339)
+	id := camtID(statement.Account.AccountID + "-" + statement.From.Format("20060102") + "-" + statement.To.Format("20060102"))
+
+	doc := camtDocument{Namespace: camt053Namespace}
+	doc.Header.MessageID = id
+	doc.Header.Created = created
+	st := &doc.Statement
+	st.ID = id
+	st.Created = created
+	st.Period.From = statement.From.Format(time.RFC3339)
+	st.Period.To = statement.To.AddDate(0, 0, 1).Add(-time.Second).Format(time.RFC3339)
+	st.Account.ID = truncate(accountNumber(statement.Account), camtAccountIDLength)
+	st.Account.Currency = statement.Currency
+	st.Account.Name = truncate(statement.Account.Nickname, camtAccountNameLength)
+	st.Account.Servicer = truncate(statement.Account.Servicer, camtNameLength)
+
+	opening, err := camtBalanceOf("OPBD", statement.OpeningBalance, statement.Currency, statement.From)
+	if err != nil {
+		return err
+	}
+	closing, err := camtBalanceOf("CLBD", statement.ClosingBalance, statement.Currency, statement.To)
+	if err != nil {
+		return err
+	}
+	st.Balances = []camtBalance{opening, closing}
+
+	sum, net := money.Zero(), money.Zero()
+	st.Entries = make([]camtEntry, 0, len(entries))
+	for _, e := range entries {
+		sum.Add(sum, new(big.Rat).Abs(e.amount))
+		net.Add(net, e.amount)
+		ref := camtID(e.tx.TransactionID)
+		entry := camtEntry{
+			Reference:   ref,
+			Amount:      camtAmount{Currency: e.tx.Currency, Value: abs(e.amount)},
+			CreditDebit: creditDebit(e.amount),
+			Status:      "BOOK",
+			BookingDate: camtDate{DateTime: e.tx.BookedAt.UTC().Format(time.RFC3339)},
+			ServicerRef: ref,
+			BankCode:    "NOTPROVIDED",
+			Details: camtTransactionDetails{
+				Reference:  ref,
+				Remittance: truncate(e.tx.Description, camtRemittanceLength),
+			},
+		}
+		if !e.tx.ValueAt.IsZero() {
+			entry.ValueDate = camtDate{DateTime: e.tx.ValueAt.UTC().Format(time.RFC3339)}
+		} else {
+			entry.ValueDate = entry.BookingDate
+		}
+		// The counterparty is the creditor of a debit and the debtor of a credit.
+		name := truncate(payee(e.tx), camtNameLength)
+		if account := truncate(e.tx.Counterparty, camtAccountIDLength); name != "" || account != "" {
+			party := &camtParty{Name: name}
+			var acct *string
+			if account != "" {
+				acct = &account
+			}
+			if e.amount.Sign() < 0 {
+				entry.Details.Creditor, entry.Details.CreditorAcct = party, acct
+			} else {
+				entry.Details.Debtor, entry.Details.DebtorAcct = party, acct
+			}
+		}
+		st.Entries = append(st.Entries, entry)
+	}
+	st.Summary.Entries = len(entries)
+	st.Summary.Sum = money.Format(sum)
+	st.Summary.Net = abs(net)
+	st.Summary.NetSign = creditDebit(net)
+
+	if _, err = io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err = enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// camtID keeps s as an identifier of the schema, replacing one too long with
+// a digest of it so that identifiers stay distinct.
+func camtID(s string) string {
+	if len(s) <= camtIDLength {
+		return s
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:camtIDLength]
+}
+
+func camtBalanceOf(code, amount, currency string, date time.Time) (camtBalance, error) {
+	v, err := money.Parse(amount)
+	if err != nil {
+		return camtBalance{}, err
+	}
+	return camtBalance{
+		Code:        code,
+		Amount:      camtAmount{Currency: currency, Value: abs(v)},
+		CreditDebit: creditDebit(v),
+		Date:        camtDate{Date: date.Format(time.DateOnly)},
+	}, nil
+}
+
+// creditDebit tells the side of amount, zero counting as credit.
+func creditDebit(amount *big.Rat) string {
+	if amount.Sign() < 0 {
+		return camtDebit
+	}
+	return camtCredit
+}
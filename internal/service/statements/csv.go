@@ -0,0 +1,71 @@
+package statements
+
+import (
+	"encoding/csv"
+	"io"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/pkg/money"
+)
+
+// utf8BOM lets spreadsheet applications detect the encoding of non-ASCII text.
+const utf8BOM = "\xef\xbb\xbf"
+
+var csvHeader = []string{
+	"booking_date",
+	"value_date",
+	"transaction_id",
+	"description",
+	"merchant",
+	"counterparty",
+	"counterparty_name",
+	"category",
+	"amount",
+	"currency",
+	"balance",
+}
+
+// writeCSV writes a row per transaction with the running balance, framed by
+// rows with the opening and closing balances.
+func writeCSV(w io.Writer, statement *domain.Statement) error {
+	entries, err := entries(statement)
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(w, utf8BOM); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	balanceRow := func(date time.Time, description, balance string) []string {
+		return []string{date.Format(time.DateOnly), "", "", description, "", "", "", "", "", statement.Currency, balance}
+	}
+	if err = cw.Write(csvHeader); err != nil {
+		return err
+	}
+	if err = cw.Write(balanceRow(statement.From, "Opening balance", statement.OpeningBalance)); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err = cw.Write([]string{
+			e.tx.BookedAt.Format(time.DateOnly),
+			e.tx.ValueAt.Format(time.DateOnly),
+			e.tx.TransactionID,
+			e.tx.Description,
+			e.tx.Merchant,
+			e.tx.Counterparty,
+			e.tx.CounterpartyName,
+			e.tx.Category,
+			e.tx.Amount,
+			e.tx.Currency,
+			money.Format(e.balance),
+		}); err != nil {
+			return err
+		}
+	}
+	if err = cw.Write(balanceRow(statement.To, "Closing balance", statement.ClosingBalance)); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,128 @@
+package statements
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/pkg/money"
+)
+
+const (
+	FormatCSV     = "csv"
+	FormatOFX     = "ofx"
+	FormatCamt053 = "camt053"
+)
+
+// Format encodes statements into one of the supported file formats.
+type Format struct {
+	Name        string
+	ContentType string
+	Extension   string
+	write       func(w io.Writer, statement *domain.Statement) error
+}
+
+var formats = map[string]Format{
+	FormatCSV:     {Name: FormatCSV, ContentType: "text/csv; charset=utf-8", Extension: "csv", write: writeCSV},
+	FormatOFX:     {Name: FormatOFX, ContentType: "application/x-ofx; charset=utf-8", Extension: "ofx", write: writeOFX},
+	FormatCamt053: {Name: FormatCamt053, ContentType: "application/xml; charset=utf-8", Extension: "xml", write: writeCamt053},
+}
+
+// LookupFormat returns the format by name, CSV when name is empty.
+func LookupFormat(name string) (Format, error) {
+	if name == "" {
+		name = FormatCSV
+	}
+	f, ok := formats[strings.ToLower(name)]
+	if !ok {
+		return Format{}, fmt.Errorf("%w: %s", ErrUnknownFormat, name)
+	}
+	return f, nil
+}
+
+func (f Format) Write(w io.Writer, statement *domain.Statement) error {
+	return f.write(w, statement)
+}
+
+// FileName names the file of statement, such as vbank-acc-1_2025-01-01_2025-01-31.csv.
+func (f Format) FileName(statement *domain.Statement) string {
+	name := statement.Account.AccountID
+	if bank := statement.Account.Bank; bank != "" && !strings.HasPrefix(name, bank) {
+		name = bank + "-" + name
+	}
+	return fmt.Sprintf("%s_%s_%s.%s", name,
+		statement.From.Format(time.DateOnly), statement.To.Format(time.DateOnly), f.Extension)
+}
+
+// WriteArchive writes statements as a zip archive with a file per account.
+func (f Format) WriteArchive(w io.Writer, statements []*domain.Statement) error {
+	archive := zip.NewWriter(w)
+	for _, statement := range statements {
+		file, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     f.FileName(statement),
+			Method:   zip.Deflate,
+			Modified: statement.GeneratedAt,
+		})
+		if err != nil {
+			return err
+		}
+		if err = f.Write(file, statement); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// entry is a statement transaction with its amount parsed.
+type entry struct {
+	tx     *domain.Transaction
+	amount *big.Rat
+	// balance is the balance of the account after the transaction.
+	balance *big.Rat
+}
+
+func entries(statement *domain.Statement) ([]entry, error) {
+	balance, err := money.Parse(statement.OpeningBalance)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]entry, 0, len(statement.Transactions))
+	for _, tx := range statement.Transactions {
+		amount, err := money.Parse(tx.Amount)
+		if err != nil {
+			return nil, err
+		}
+		balance = new(big.Rat).Add(balance, amount)
+		res = append(res, entry{tx: tx, amount: amount, balance: balance})
+	}
+	return res, nil
+}
+
+// abs formats the absolute value of amount.
+func abs(amount *big.Rat) string {
+	return money.Format(new(big.Rat).Abs(amount))
+}
+
+// truncate cuts s to at most n characters, keeping multibyte ones whole.
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
+
+func payee(tx *domain.Transaction) string {
+	switch {
+	case tx.Merchant != "":
+		return tx.Merchant
+	case tx.CounterpartyName != "":
+		return tx.CounterpartyName
+	default:
+		return tx.Description
+	}
+}
@@ -0,0 +1,532 @@
+package statements_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/internal/service/statements"
+)
+
+var (
+	from = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	to   = time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)
+)
+
+// statementOf returns a January 2025 statement of a sandbox account opening
+// at 1000.00 RUB with txs.
+func statementOf(account *domain.Account, closing string, txs ...*domain.Transaction) *domain.Statement {
+	return &domain.Statement{
+		Account:        account,
+		From:           from,
+		To:             to,
+		Currency:       "RUB",
+		OpeningBalance: "1000.00",
+		ClosingBalance: closing,
+		Transactions:   txs,
+		GeneratedAt:    time.Date(2025, 2, 1, 9, 30, 0, 0, time.UTC),
+	}
+}
+
+func tx(id, amount string, day int) *domain.Transaction {
+	return &domain.Transaction{
+		TransactionID: id,
+		Bank:          "vbank",
+		AccountID:     "vbank-team-1-acc-1",
+		Amount:        amount,
+		Currency:      "RUB",
+		BookedAt:      time.Date(2025, 1, day, 12, 0, 0, 0, time.UTC),
+		ValueAt:       time.Date(2025, 1, day, 0, 0, 0, 0, time.UTC),
+		Description:   "Payment",
+	}
+}
+
+func testStatements() map[string]*domain.Statement {
+	account := &domain.Account{Bank: "vbank", AccountID: "vbank-team-1-acc-1", Nickname: "Main", Servicer: "VBank"}
+	long := &domain.Account{
+		Bank:           "sandbox-bank-long",
+		AccountID:      "sandbox-bank-long-team-200-acc-12345",
+		Identification: "RU4040817810099910004312000000000000000",
+		Nickname:       strings.Repeat("Счёт ", 20),
+		Servicer:       strings.Repeat("Sandbox Bank ", 20),
+	}
+
+	purchase := tx("vbank-team-1-acc-1-tx-1", "-250.50", 3)
+	purchase.Merchant = `Coffee "Bean", Ltd`
+	purchase.Description = "Card purchase, Moscow"
+	salary := tx("vbank-team-1-acc-1-tx-2", "5000.00", 10)
+	salary.Counterparty = "40702810900000001234"
+	salary.CounterpartyName = "ООО Работодатель"
+	salary.Description = "Зарплата за январь"
+	transfer := tx("vbank-team-1-acc-1-tx-3", "-1000.00", 20)
+	transfer.Counterparty = "vbank-team-1-acc-2"
+
+	verbose := tx("sandbox-bank-long-team-200-acc-12345-tx-1", "-0.01", 5)
+	verbose.Merchant = strings.Repeat("Очень длинное название магазина ", 10)
+	verbose.Counterparty = strings.Repeat("4", 50)
+	verbose.Description = strings.Repeat("Оплата по договору № 17 ", 20)
+	sibling := tx("sandbox-bank-long-team-200-acc-12345-tx-2", "12.00", 6)
+	sibling.CounterpartyName = "Refund"
+
+	return map[string]*domain.Statement{
+		"transactions": statementOf(account, "4749.50", purchase, salary, transfer),
+		"empty":        statementOf(account, "1000.00"),
+		"overdrawn":    statementOf(account, "-500.00", tx("vbank-team-1-acc-1-tx-4", "-1500.00", 15)),
+		"long values":  statementOf(long, "1011.99", verbose, sibling),
+	}
+}
+
+func write(t *testing.T, format string, statement *domain.Statement) []byte {
+	t.Helper()
+	f, err := statements.LookupFormat(format)
+	if err != nil {
+		t.Fatalf("LookupFormat(%q): %v", format, err)
+	}
+	var buf bytes.Buffer
+	if err = f.Write(&buf, statement); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestCSV(t *testing.T) {
+	statement := testStatements()["transactions"]
+	data := write(t, statements.FormatCSV, statement)
+	if !bytes.HasPrefix(data, []byte("\xef\xbb\xbf")) {
+		t.Fatal("no UTF-8 byte order mark")
+	}
+	rows, err := csv.NewReader(bytes.NewReader(data[3:])).ReadAll()
+	if err != nil {
+		t.Fatalf("read CSV: %v", err)
+	}
+	want := [][]string{
+		{"booking_date", "value_date", "transaction_id", "description", "merchant", "counterparty", "counterparty_name", "category", "amount", "currency", "balance"},
+		{"2025-01-01", "", "", "Opening balance", "", "", "", "", "", "RUB", "1000.00"},
+		{"2025-01-03", "2025-01-03", "vbank-team-1-acc-1-tx-1", "Card purchase, Moscow", `Coffee "Bean", Ltd`, "", "", "", "-250.50", "RUB", "749.50"},
+		{"2025-01-10", "2025-01-10", "vbank-team-1-acc-1-tx-2", "Зарплата за январь", "", "40702810900000001234", "ООО Работодатель", "", "5000.00", "RUB", "5749.50"},
+		{"2025-01-20", "2025-01-20", "vbank-team-1-acc-1-tx-3", "Payment", "", "vbank-team-1-acc-2", "", "", "-1000.00", "RUB", "4749.50"},
+		{"2025-01-31", "", "", "Closing balance", "", "", "", "", "", "RUB", "4749.50"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(rows), len(want))
+	}
+	for i := range want {
+		if strings.Join(rows[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("row %d = %q, want %q", i, rows[i], want[i])
+		}
+	}
+}
+
+func TestOFX(t *testing.T) {
+	for name, statement := range testStatements() {
+		t.Run(name, func(t *testing.T) {
+			data := write(t, statements.FormatOFX, statement)
+			if !bytes.Contains(data, []byte(`<?OFX OFXHEADER="200" VERSION="220"`)) {
+				t.Fatal("no OFX 2.2 header")
+			}
+			root := parseXML(t, data)
+			validate(t, root, ofxSchema, "")
+
+			list := root.find("BANKMSGSRSV1", "STMTTRNRS", "STMTRS", "BANKTRANLIST")
+			if got := len(list.all("STMTTRN")); got != len(statement.Transactions) {
+				t.Errorf("got %d transactions, want %d", got, len(statement.Transactions))
+			}
+			ledger := root.find("BANKMSGSRSV1", "STMTTRNRS", "STMTRS", "LEDGERBAL", "BALAMT")
+			if ledger.text != statement.ClosingBalance {
+				t.Errorf("ledger balance = %s, want %s", ledger.text, statement.ClosingBalance)
+			}
+		})
+	}
+}
+
+func TestCamt053(t *testing.T) {
+	for name, statement := range testStatements() {
+		t.Run(name, func(t *testing.T) {
+			root := parseXML(t, write(t, statements.FormatCamt053, statement))
+			validate(t, root, camtSchema, camtNamespace)
+
+			stmt := root.find("BkToCstmrStmt", "Stmt")
+			entries := stmt.all("Ntry")
+			if got := len(entries); got != len(statement.Transactions) {
+				t.Fatalf("got %d entries, want %d", got, len(statement.Transactions))
+			}
+			if got := stmt.find("TxsSummry", "TtlNtries", "NbOfNtries").text; got != strconv.Itoa(len(entries)) {
+				t.Errorf("NbOfNtries = %s, want %d", got, len(entries))
+			}
+			refs := make(map[string]bool, len(entries))
+			for _, e := range entries {
+				ref := e.find("NtryRef").text
+				if refs[ref] {
+					t.Errorf("entry reference %s is not unique", ref)
+				}
+				refs[ref] = true
+			}
+
+			balances := stmt.all("Bal")
+			if len(balances) != 2 {
+				t.Fatalf("got %d balances, want 2", len(balances))
+			}
+			for i, want := range []struct{ code, amount string }{
+				{"OPBD", statement.OpeningBalance},
+				{"CLBD", statement.ClosingBalance},
+			} {
+				b := balances[i]
+				if code := b.find("Tp", "CdOrPrtry", "Cd").text; code != want.code {
+					t.Errorf("balance %d code = %s, want %s", i, code, want.code)
+				}
+				amount := b.find("Amt").text
+				if b.find("CdtDbtInd").text == "DBIT" {
+					amount = "-" + amount
+				}
+				if amount != want.amount {
+					t.Errorf("%s = %s, want %s", want.code, amount, want.amount)
+				}
+			}
+		})
+	}
+}
+
+// node is an element of a parsed XML document.
+type node struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	text     string
+	children []*node
+}
+
+func parseXML(t *testing.T, data []byte) *node {
+	t.Helper()
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var stack []*node
+	var root *node
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("parse XML: %v", err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			n := &node{name: tok.Name, attrs: tok.Attr}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			} else {
+				root = n
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			n := stack[len(stack)-1]
+			n.text = strings.TrimSpace(n.text)
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(tok)
+			}
+		}
+	}
+	if root == nil {
+		t.Fatal("empty document")
+	}
+	return root
+}
+
+// find returns the first descendant along path, an empty node if none.
+func (n *node) find(path ...string) *node {
+	for _, name := range path {
+		next := &node{}
+		for _, c := range n.children {
+			if c.name.Local == name {
+				next = c
+				break
+			}
+		}
+		n = next
+	}
+	return n
+}
+
+func (n *node) all(name string) []*node {
+	var res []*node
+	for _, c := range n.children {
+		if c.name.Local == name {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// xsdType is the part of a schema type the writers use: a sequence or choice
+// of elements, or a simple type with its facets.
+type xsdType struct {
+	elems  []xsdElem
+	choice bool
+	text   func(string) error
+	// attrs are the required attributes.
+	attrs map[string]func(string) error
+}
+
+type xsdElem struct {
+	name     string
+	typ      *xsdType
+	optional bool
+	repeated bool
+}
+
+func seq(elems ...xsdElem) *xsdType    { return &xsdType{elems: elems} }
+func choice(elems ...xsdElem) *xsdType { return &xsdType{elems: elems, choice: true} }
+func simple(check func(string) error) *xsdType {
+	return &xsdType{text: check}
+}
+
+func req(name string, typ *xsdType) xsdElem { return xsdElem{name: name, typ: typ} }
+func opt(name string, typ *xsdType) xsdElem { return xsdElem{name: name, typ: typ, optional: true} }
+func many(name string, typ *xsdType) xsdElem {
+	return xsdElem{name: name, typ: typ, optional: true, repeated: true}
+}
+
+// validate checks n against typ, every element being in namespace.
+func validate(t *testing.T, n *node, typ *xsdType, namespace string) {
+	t.Helper()
+	validateAt(t, n.name.Local, n, typ, namespace)
+}
+
+func validateAt(t *testing.T, path string, n *node, typ *xsdType, namespace string) {
+	t.Helper()
+	if n.name.Space != namespace {
+		t.Errorf("%s: namespace %q, want %q", path, n.name.Space, namespace)
+	}
+	for _, a := range n.attrs {
+		if a.Name.Space == "xmlns" || a.Name.Local == "xmlns" {
+			continue
+		}
+		check, ok := typ.attrs[a.Name.Local]
+		if !ok {
+			t.Errorf("%s: unexpected attribute %s", path, a.Name.Local)
+		} else if err := check(a.Value); err != nil {
+			t.Errorf("%s/@%s: %v", path, a.Name.Local, err)
+		}
+	}
+	for name := range typ.attrs {
+		if !hasAttr(n, name) {
+			t.Errorf("%s: no attribute %s", path, name)
+		}
+	}
+	if typ.text != nil {
+		if len(n.children) > 0 {
+			t.Errorf("%s: simple element has children", path)
+		}
+		if err := typ.text(n.text); err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+		return
+	}
+	if n.text != "" {
+		t.Errorf("%s: complex element has text %q", path, n.text)
+	}
+	if typ.choice && len(n.children) != 1 {
+		t.Errorf("%s: got %d elements of a choice, want 1", path, len(n.children))
+	}
+	seen := make(map[string]bool, len(typ.elems))
+	last := -1
+	for _, c := range n.children {
+		i := indexOf(typ.elems, c.name.Local)
+		childPath := path + "/" + c.name.Local
+		switch {
+		case i < 0:
+			t.Errorf("%s: unexpected element", childPath)
+			continue
+		case i < last:
+			t.Errorf("%s: out of order", childPath)
+		case i == last && !typ.elems[i].repeated:
+			t.Errorf("%s: repeated", childPath)
+		}
+		last = i
+		seen[c.name.Local] = true
+		validateAt(t, childPath, c, typ.elems[i].typ, namespace)
+	}
+	if !typ.choice {
+		for _, e := range typ.elems {
+			if !e.optional && !seen[e.name] {
+				t.Errorf("%s: no %s", path, e.name)
+			}
+		}
+	}
+}
+
+func indexOf(elems []xsdElem, name string) int {
+	for i, e := range elems {
+		if e.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func hasAttr(n *node, name string) bool {
+	for _, a := range n.attrs {
+		if a.Name.Local == name {
+			return true
+		}
+	}
+	return false
+}
+
+func maxText(n int) func(string) error {
+	return func(s string) error {
+		if l := utf8.RuneCountInString(s); l < 1 || l > n {
+			return fmt.Errorf("length %d of %q is not within 1..%d", l, s, n)
+		}
+		return nil
+	}
+}
+
+func pattern(expr string) func(string) error {
+	re := regexp.MustCompile("^(?:" + expr + ")$")
+	return func(s string) error {
+		if !re.MatchString(s) {
+			return fmt.Errorf("%q does not match %s", s, expr)
+		}
+		return nil
+	}
+}
+
+func enum(values ...string) func(string) error {
+	return func(s string) error {
+		for _, v := range values {
+			if s == v {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q is not one of %v", s, values)
+	}
+}
+
+func layout(layout string) func(string) error {
+	return func(s string) error {
+		_, err := time.Parse(layout, s)
+		return err
+	}
+}
+
+// The elements of camt.053.001.08 the writer produces, in schema order.
+const camtNamespace = "urn:iso:std:iso:20022:tech:xsd:camt.053.001.08"
+
+var camtSchema = func() *xsdType {
+	max35 := simple(maxText(35))
+	max34 := simple(maxText(34))
+	max70 := simple(maxText(70))
+	max140 := simple(maxText(140))
+	dateTime := simple(layout(time.RFC3339))
+	dateChoice := choice(opt("Dt", simple(layout(time.DateOnly))), opt("DtTm", dateTime))
+	decimal := simple(pattern(`\d{1,13}(\.\d{1,5})?`))
+	amount := &xsdType{text: decimal.text, attrs: map[string]func(string) error{"Ccy": pattern(`[A-Z]{3}`)}}
+	creditDebit := simple(enum("CRDT", "DBIT"))
+	other := seq(req("Othr", seq(req("Id", max34))))
+	party := seq(req("Pty", seq(opt("Nm", max140))))
+	partyAccount := seq(req("Id", other))
+
+	entry := seq(
+		opt("NtryRef", max35),
+		req("Amt", amount),
+		req("CdtDbtInd", creditDebit),
+		req("Sts", choice(opt("Cd", simple(enum("BOOK", "PDNG", "INFO"))))),
+		opt("BookgDt", dateChoice),
+		opt("ValDt", dateChoice),
+		opt("AcctSvcrRef", max35),
+		req("BkTxCd", seq(opt("Prtry", seq(req("Cd", max35))))),
+		opt("NtryDtls", seq(many("TxDtls", seq(
+			opt("Refs", seq(opt("AcctSvcrRef", max35))),
+			opt("RltdPties", seq(
+				opt("Dbtr", party),
+				opt("DbtrAcct", partyAccount),
+				opt("Cdtr", party),
+				opt("CdtrAcct", partyAccount),
+			)),
+			opt("RmtInf", seq(many("Ustrd", max140))),
+		)))),
+	)
+	statement := seq(
+		req("Id", max35),
+		opt("CreDtTm", dateTime),
+		opt("FrToDt", seq(req("FrDtTm", dateTime), req("ToDtTm", dateTime))),
+		req("Acct", seq(
+			req("Id", other),
+			opt("Ccy", simple(pattern(`[A-Z]{3}`))),
+			opt("Nm", max70),
+			opt("Svcr", seq(req("FinInstnId", seq(opt("Nm", max140))))),
+		)),
+		many("Bal", seq(
+			req("Tp", seq(req("CdOrPrtry", choice(opt("Cd", simple(enum("OPBD", "CLBD"))))))),
+			req("Amt", amount),
+			req("CdtDbtInd", creditDebit),
+			req("Dt", dateChoice),
+		)),
+		opt("TxsSummry", seq(opt("TtlNtries", seq(
+			opt("NbOfNtries", simple(pattern(`\d{1,15}`))),
+			opt("Sum", decimal),
+			opt("TtlNetNtry", seq(req("Amt", decimal), req("CdtDbtInd", creditDebit))),
+		)))),
+		many("Ntry", entry),
+	)
+	return seq(req("BkToCstmrStmt", seq(
+		req("GrpHdr", seq(req("MsgId", max35), req("CreDtTm", dateTime))),
+		many("Stmt", statement),
+	)))
+}()
+
+// The elements of an OFX 2.2 bank statement response the writer produces,
+// in specification order.
+var ofxSchema = func() *xsdType {
+	dateTime := simple(layout("20060102150405"))
+	amount := simple(pattern(`-?\d+(\.\d+)?`))
+	status := seq(
+		req("CODE", simple(pattern(`\d{1,6}`))),
+		req("SEVERITY", simple(enum("INFO", "WARN", "ERROR"))),
+	)
+	transaction := seq(
+		req("TRNTYPE", simple(enum("CREDIT", "DEBIT", "INT", "DIV", "FEE", "SRVCHG", "DEP", "ATM", "POS", "XFER", "CHECK", "PAYMENT", "CASH", "DIRECTDEP", "DIRECTDEBIT", "REPEATPMT", "OTHER"))),
+		req("DTPOSTED", dateTime),
+		opt("DTUSER", dateTime),
+		req("TRNAMT", amount),
+		req("FITID", simple(maxText(255))),
+		opt("NAME", simple(maxText(32))),
+		opt("MEMO", simple(maxText(255))),
+	)
+	return seq(
+		req("SIGNONMSGSRSV1", seq(req("SONRS", seq(
+			req("STATUS", status),
+			req("DTSERVER", dateTime),
+			opt("LANGUAGE", simple(pattern(`[A-Z]{3}`))),
+		)))),
+		opt("BANKMSGSRSV1", seq(many("STMTTRNRS", seq(
+			req("TRNUID", simple(maxText(36))),
+			req("STATUS", status),
+			opt("STMTRS", seq(
+				req("CURDEF", simple(pattern(`[A-Z]{3}`))),
+				req("BANKACCTFROM", seq(
+					req("BANKID", simple(maxText(9))),
+					req("ACCTID", simple(maxText(22))),
+					req("ACCTTYPE", simple(enum("CHECKING", "SAVINGS", "MONEYMRKT", "CREDITLINE", "CD"))),
+				)),
+				opt("BANKTRANLIST", seq(
+					req("DTSTART", dateTime),
+					req("DTEND", dateTime),
+					many("STMTTRN", transaction),
+				)),
+				req("LEDGERBAL", seq(req("BALAMT", amount), req("DTASOF", dateTime))),
+			)),
+		)))),
+	)
+}()
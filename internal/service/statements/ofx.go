@@ -0,0 +1,132 @@
+package statements
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+)
+
+const (
+	ofxHeader = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>` + "\n" +
+		`<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>` + "\n"
+	ofxDateTime = "20060102150405"
+	// Length limits of the elements of the specification.
+	ofxNameLength      = 32
+	ofxMemoLength      = 255
+	ofxBankIDLength    = 9
+	ofxAccountIDLength = 22
+	ofxFITIDLength     = 255
+)
+
+type ofxStatus struct {
+	Code     int    `xml:"CODE"`
+	Severity string `xml:"SEVERITY"`
+}
+
+type ofxTransaction struct {
+	Type   string `xml:"TRNTYPE"`
+	Posted string `xml:"DTPOSTED"`
+	User   string `xml:"DTUSER,omitempty"`
+	Amount string `xml:"TRNAMT"`
+	FITID  string `xml:"FITID"`
+	Name   string `xml:"NAME,omitempty"`
+	Memo   string `xml:"MEMO,omitempty"`
+}
+
+type ofxBalance struct {
+	Amount string `xml:"BALAMT"`
+	AsOf   string `xml:"DTASOF"`
+}
+
+type ofxDocument struct {
+	XMLName xml.Name `xml:"OFX"`
+	SignOn  struct {
+		Response struct {
+			Status   ofxStatus `xml:"STATUS"`
+			Server   string    `xml:"DTSERVER"`
+			Language string    `xml:"LANGUAGE"`
+		} `xml:"SONRS"`
+	} `xml:"SIGNONMSGSRSV1"`
+	Bank struct {
+		Transaction struct {
+			UID       string    `xml:"TRNUID"`
+			Status    ofxStatus `xml:"STATUS"`
+			Statement struct {
+				Currency string `xml:"CURDEF"`
+				Account  struct {
+					BankID    string `xml:"BANKID"`
+					AccountID string `xml:"ACCTID"`
+					Type      string `xml:"ACCTTYPE"`
+				} `xml:"BANKACCTFROM"`
+				List struct {
+					Start        string           `xml:"DTSTART"`
+					End          string           `xml:"DTEND"`
+					Transactions []ofxTransaction `xml:"STMTTRN"`
+				} `xml:"BANKTRANLIST"`
+				Ledger ofxBalance `xml:"LEDGERBAL"`
+			} `xml:"STMTRS"`
+		} `xml:"STMTTRNRS"`
+	} `xml:"BANKMSGSRSV1"`
+}
+
+// writeOFX writes an OFX 2.2 bank statement. OFX carries only the closing
+// balance, as the ledger balance at the end of the period.
+func writeOFX(w io.Writer, statement *domain.Statement) error {
+	entries, err := entries(statement)
+	if err != nil {
+		return err
+	}
+	end := statement.To.AddDate(0, 0, 1).Add(-time.Second)
+	var doc ofxDocument
+	doc.SignOn.Response.Status = ofxStatus{Code: 0, Severity: "INFO"}
+	doc.SignOn.Response.Server = statement.GeneratedAt.UTC().Format(ofxDateTime)
+	doc.SignOn.Response.Language = "ENG"
+	trn := &doc.Bank.Transaction
+	trn.UID = "0"
+	trn.Status = ofxStatus{Code: 0, Severity: "INFO"}
+	trn.Statement.Currency = statement.Currency
+	trn.Statement.Account.BankID = truncate(statement.Account.Bank, ofxBankIDLength)
+	trn.Statement.Account.AccountID = truncate(accountNumber(statement.Account), ofxAccountIDLength)
+	trn.Statement.Account.Type = "CHECKING"
+	trn.Statement.List.Start = statement.From.Format(ofxDateTime)
+	trn.Statement.List.End = end.Format(ofxDateTime)
+	trn.Statement.List.Transactions = make([]ofxTransaction, 0, len(entries))
+	for _, e := range entries {
+		t := ofxTransaction{
+			Type:   "CREDIT",
+			Posted: e.tx.BookedAt.UTC().Format(ofxDateTime),
+			Amount: e.tx.Amount,
+			FITID:  truncate(e.tx.TransactionID, ofxFITIDLength),
+			Name:   truncate(payee(e.tx), ofxNameLength),
+			Memo:   truncate(e.tx.Description, ofxMemoLength),
+		}
+		if e.amount.Sign() < 0 {
+			t.Type = "DEBIT"
+		}
+		if !e.tx.ValueAt.IsZero() {
+			t.User = e.tx.ValueAt.UTC().Format(ofxDateTime)
+		}
+		trn.Statement.List.Transactions = append(trn.Statement.List.Transactions, t)
+	}
+	trn.Statement.Ledger = ofxBalance{Amount: statement.ClosingBalance, AsOf: end.Format(ofxDateTime)}
+
+	if _, err = io.WriteString(w, ofxHeader); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err = enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// accountNumber prefers the number of the account at its bank to its API ID.
+func accountNumber(account *domain.Account) string {
+	if account.Identification != "" {
+		return account.Identification
+	}
+	return account.AccountID
+}
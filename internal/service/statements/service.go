@@ -0,0 +1,193 @@
+package statements
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/pkg/money"
+	"go.uber.org/zap"
+)
+
+// defaultRangeDays is the length of a statement requested without a period.
+const defaultRangeDays = 30
+
+var (
+	ErrUnknownFormat = errors.New("unknown statement format")
+	ErrInvalidRange  = errors.New("invalid date range")
+	// ErrAmbiguousAccount is returned when an account ID names accounts at
+	// several banks and the bank is left out.
+	ErrAmbiguousAccount = errors.New("account id is ambiguous")
+)
+
+type Service struct {
+	store Store
+	log   *zap.Logger
+}
+
+func New(log *zap.Logger, store Store) *Service {
+	return &Service{
+		store: store,
+		log:   log,
+	}
+}
+
+// Statement builds the statement of the account of the client for the days
+// from through to inclusive. The bank may be left out when only one bank
+// holds an account with the ID.
+func (s *Service) Statement(ctx context.Context, clientID, bank, accountID string, from, to time.Time) (*domain.Statement, error) {
+	from, to, err := normalizeRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := s.store.ListAccounts(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	var account *domain.Account
+	for _, a := range accounts {
+		if a.AccountID != accountID || bank != "" && a.Bank != bank {
+			continue
+		}
+		if account != nil {
+			return nil, fmt.Errorf("%w: %s is held by %s and %s, name the bank", ErrAmbiguousAccount, accountID, account.Bank, a.Bank)
+		}
+		account = a
+	}
+	if account == nil {
+		return nil, fmt.Errorf("account %s: %w", accountID, domain.ErrNotFound)
+	}
+	return s.statement(ctx, account, from, to)
+}
+
+// Statements builds the statements of every account of the client.
+func (s *Service) Statements(ctx context.Context, clientID string, from, to time.Time) ([]*domain.Statement, error) {
+	from, to, err := normalizeRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := s.store.ListAccounts(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*domain.Statement, 0, len(accounts))
+	for _, account := range accounts {
+		statement, err := s.statement(ctx, account, from, to)
+		if errors.Is(err, domain.ErrNotFound) {
+			s.log.Warn("account left out of statements", zap.String("account_id", account.AccountID), zap.Error(err))
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, statement)
+	}
+	return res, nil
+}
+
+// statement moves the stored balance of account from the time it was
+// reported to the end of the period over the transactions booked in between,
+// then back over the period to find the opening balance.
+func (s *Service) statement(ctx context.Context, account *domain.Account, from, to time.Time) (*domain.Statement, error) {
+	balance, err := s.store.GetBalance(ctx, account.ClientID, account.Bank, account.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	closing, err := money.Parse(balance.Amount)
+	if err != nil {
+		return nil, err
+	}
+	end := to.AddDate(0, 0, 1)
+	asOf := balance.AsOf
+	if asOf.IsZero() {
+		asOf = time.Now().UTC()
+	}
+	since := from
+	if asOf.Before(since) {
+		since = asOf
+	}
+	txs, err := s.store.GetTransactions(ctx, domain.TransactionFilter{
+		ClientID:  account.ClientID,
+		Bank:      account.Bank,
+		AccountID: account.AccountID,
+		From:      since,
+	})
+	if err != nil {
+		return nil, err
+	}
+	period := make([]*domain.Transaction, 0, len(txs))
+	net := money.Zero()
+	for _, tx := range txs {
+		if tx.Status != domain.TransactionStatusBooked {
+			continue
+		}
+		amount, err := money.Parse(tx.Amount)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case tx.BookedAt.Before(end) && tx.BookedAt.After(asOf):
+			closing.Add(closing, amount)
+		case !tx.BookedAt.Before(end) && !tx.BookedAt.After(asOf):
+			closing.Sub(closing, amount)
+		}
+		if tx.BookedAt.Before(from) || !tx.BookedAt.Before(end) {
+			continue
+		}
+		net.Add(net, amount)
+		period = append(period, tx)
+	}
+	slices.SortStableFunc(period, func(a, b *domain.Transaction) int {
+		if c := a.BookedAt.Compare(b.BookedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.TransactionID, b.TransactionID)
+	})
+	currency := balance.Currency
+	if currency == "" {
+		currency = account.Currency
+	}
+	return &domain.Statement{
+		Account:        account,
+		From:           from,
+		To:             to,
+		Currency:       currency,
+		OpeningBalance: money.Format(new(big.Rat).Sub(closing, net)),
+		ClosingBalance: money.Format(closing),
+		Transactions:   period,
+		GeneratedAt:    time.Now().UTC(),
+	}, nil
+}
+
+// normalizeRange defaults to the last defaultRangeDays days up to today.
+func normalizeRange(from, to time.Time) (time.Time, time.Time, error) {
+	if to.IsZero() {
+		to = time.Now().UTC()
+	}
+	to = truncateDay(to)
+	if from.IsZero() {
+		from = to.AddDate(0, 0, -(defaultRangeDays - 1))
+	}
+	from = truncateDay(from)
+	if from.After(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: from is after to", ErrInvalidRange)
+	}
+	return from, to, nil
+}
+
+func truncateDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+type Store interface {
+	ListAccounts(ctx context.Context, clientID string) ([]*domain.Account, error)
+	// GetBalance returns the balance of the account of the most preferred type.
+	GetBalance(ctx context.Context, clientID, bank, accountID string) (*domain.Balance, error)
+	GetTransactions(ctx context.Context, filter domain.TransactionFilter) ([]*domain.Transaction, error)
+}
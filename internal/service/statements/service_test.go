@@ -0,0 +1,60 @@
+package statements_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/internal/infra/memory"
+	"github.com/MichaelSBoop/lima-backend/internal/service/statements"
+	"go.uber.org/zap"
+)
+
+func TestStatementResolvesTheBank(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New(zap.NewNop())
+	for _, account := range []*domain.Account{
+		{ClientID: "c1", Bank: "vbank", AccountID: "acc-1", Currency: "RUB"},
+		{ClientID: "c1", Bank: "vbank", AccountID: "acc-2", Currency: "RUB"},
+		{ClientID: "c1", Bank: "abank", AccountID: "acc-2", Currency: "RUB"},
+		{ClientID: "c2", Bank: "abank", AccountID: "acc-1", Currency: "RUB"},
+	} {
+		if err := store.SaveAccount(ctx, account); err != nil {
+			t.Fatalf("SaveAccount: %v", err)
+		}
+		balance := &domain.Balance{ClientID: account.ClientID, Bank: account.Bank, AccountID: account.AccountID, Amount: "1000.00", Currency: "RUB", AsOf: to}
+		if err := store.SaveBalance(ctx, balance); err != nil {
+			t.Fatalf("SaveBalance: %v", err)
+		}
+	}
+	s := statements.New(zap.NewNop(), store)
+
+	tests := []struct {
+		name      string
+		bank      string
+		accountID string
+		wantBank  string
+		wantErr   error
+	}{
+		{name: "held by one bank", accountID: "acc-1", wantBank: "vbank"},
+		{name: "held by several banks", accountID: "acc-2", wantErr: statements.ErrAmbiguousAccount},
+		{name: "bank named", bank: "abank", accountID: "acc-2", wantBank: "abank"},
+		{name: "other bank named", bank: "abank", accountID: "acc-1", wantErr: domain.ErrNotFound},
+		{name: "unknown account", accountID: "acc-3", wantErr: domain.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statement, err := s.Statement(ctx, "c1", tt.bank, tt.accountID, from, to)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Statement = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if statement.Account.Bank != tt.wantBank || statement.Account.AccountID != tt.accountID {
+				t.Errorf("got the statement of %s at %s, want %s at %s", statement.Account.AccountID, statement.Account.Bank, tt.accountID, tt.wantBank)
+			}
+		})
+	}
+}
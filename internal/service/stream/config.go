@@ -0,0 +1,12 @@
+package stream
+
+import "time"
+
+type Config struct {
+	// HistorySize is how many recent events are kept per client for resuming.
+	HistorySize int `json:"history_size" yaml:"history_size"`
+	// HistoryTTL is how long events are kept for resuming.
+	HistoryTTL time.Duration `json:"history_ttl" yaml:"history_ttl"`
+	// KeepAlive is how often an idle stream is pinged.
+	KeepAlive time.Duration `json:"keep_alive" yaml:"keep_alive"`
+}
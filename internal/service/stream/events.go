@@ -0,0 +1,24 @@
+package stream
+
+import (
+	"context"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+)
+
+// EventTypes lists the domain events forwarded to the streams of their client.
+func (s *Service) EventTypes() []string {
+	return []string{
+		domain.EventTypeConsentCreated,
+		domain.EventTypeConsentStatusChanged,
+		domain.EventTypeConsentExpiring,
+		domain.EventTypeConsentExpired,
+		domain.EventTypeAccountDiscovered,
+	}
+}
+
+// HandleEvent pushes the payload of the domain event under its type.
+func (s *Service) HandleEvent(_ context.Context, event *domain.Event) error {
+	s.Push(event.ClientID, event.Type, event.Payload)
+	return nil
+}
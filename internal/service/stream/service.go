@@ -0,0 +1,199 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultHistorySize = 256
+	defaultHistoryTTL  = 15 * time.Minute
+	defaultKeepAlive   = 30 * time.Second
+	// subscriberBuffer is how many events a subscriber may fall behind before
+	// it is dropped. A dropped client reconnects and resumes from history.
+	subscriberBuffer = 64
+)
+
+// Service fans live updates out to the open streams of each client and keeps
+// a short history of them for clients resuming with Last-Event-ID. Event IDs
+// are local to the process, a client resuming against another instance or
+// after a restart is told to reset.
+type Service struct {
+	cfg Config
+	log *zap.Logger
+
+	mu      sync.Mutex
+	lastID  uint64
+	clients map[string]*client
+}
+
+type client struct {
+	history []*domain.StreamEvent
+	// evicted is the ID of the newest event of the client that can no longer
+	// be replayed: dropped from history to bound its size or for its age, or
+	// pushed before the client was tracked.
+	evicted     uint64
+	subscribers map[chan *domain.StreamEvent]struct{}
+}
+
+func New(cfg Config, log *zap.Logger, lc fx.Lifecycle) *Service {
+	if cfg.HistorySize <= 0 {
+		cfg.HistorySize = defaultHistorySize
+	}
+	if cfg.HistoryTTL <= 0 {
+		cfg.HistoryTTL = defaultHistoryTTL
+	}
+	if cfg.KeepAlive <= 0 {
+		cfg.KeepAlive = defaultKeepAlive
+	}
+	s := &Service{
+		cfg:     cfg,
+		log:     log,
+		clients: make(map[string]*client),
+	}
+	stop := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			go s.pruneLoop(stop)
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			close(stop)
+			return nil
+		},
+	})
+	return s
+}
+
+// KeepAlive is how often idle streams should be pinged.
+func (s *Service) KeepAlive() time.Duration {
+	return s.cfg.KeepAlive
+}
+
+// Push sends an event of eventType with data encoded as JSON to every open
+// stream of the client.
+func (s *Service) Push(clientID, eventType string, data any) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		s.log.Error("failed to encode stream event", zap.String("type", eventType), zap.Error(err))
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	event := &domain.StreamEvent{
+		ID:        s.lastID,
+		ClientID:  clientID,
+		Type:      eventType,
+		Data:      payload,
+		CreatedAt: time.Now().UTC(),
+	}
+	c := s.client(clientID)
+	c.history = append(c.history, event)
+	if n := len(c.history) - s.cfg.HistorySize; n > 0 {
+		c.evicted = c.history[n-1].ID
+		c.history = c.history[n:]
+	}
+	for ch := range c.subscribers {
+		select {
+		case ch <- event:
+		default:
+			s.log.Warn("dropping slow stream subscriber", zap.String("client_id", clientID))
+			delete(c.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe opens a stream of the events of the client. The events after
+// lastEventID still in history are returned to be sent first, preceded by a
+// reset event if some were already dropped. An empty lastEventID starts a
+// fresh stream. The returned channel is closed when cancel is called or when
+// the subscriber falls too far behind.
+func (s *Service) Subscribe(clientID, lastEventID string) ([]*domain.StreamEvent, <-chan *domain.StreamEvent, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.client(clientID)
+	var replay []*domain.StreamEvent
+	if lastEventID != "" {
+		replay = s.replay(c, clientID, lastEventID)
+	}
+	ch := make(chan *domain.StreamEvent, subscriberBuffer)
+	c.subscribers[ch] = struct{}{}
+	cancel := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := c.subscribers[ch]; ok {
+			delete(c.subscribers, ch)
+			close(ch)
+		}
+	}
+	return replay, ch, cancel
+}
+
+func (s *Service) replay(c *client, clientID, lastEventID string) []*domain.StreamEvent {
+	lastID, err := strconv.ParseUint(lastEventID, 10, 64)
+	if err != nil || lastID > s.lastID || lastID < c.evicted {
+		return []*domain.StreamEvent{{
+			ID:        s.lastID,
+			ClientID:  clientID,
+			Type:      domain.StreamEventReset,
+			Data:      json.RawMessage(`{}`),
+			CreatedAt: time.Now().UTC(),
+		}}
+	}
+	replay := make([]*domain.StreamEvent, 0)
+	for _, event := range c.history {
+		if event.ID > lastID {
+			replay = append(replay, event)
+		}
+	}
+	return replay
+}
+
+func (s *Service) client(clientID string) *client {
+	c, ok := s.clients[clientID]
+	if !ok {
+		// The events of a client forgotten by prune are gone as well.
+		c = &client{evicted: s.lastID, subscribers: make(map[chan *domain.StreamEvent]struct{})}
+		s.clients[clientID] = c
+	}
+	return c
+}
+
+func (s *Service) pruneLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(s.cfg.HistoryTTL / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.prune(time.Now().UTC().Add(-s.cfg.HistoryTTL))
+		}
+	}
+}
+
+// prune forgets events pushed before cutoff and clients with nothing left.
+func (s *Service) prune(cutoff time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for clientID, c := range s.clients {
+		i := 0
+		for i < len(c.history) && c.history[i].CreatedAt.Before(cutoff) {
+			c.evicted = max(c.evicted, c.history[i].ID)
+			i++
+		}
+		c.history = c.history[i:]
+		if len(c.history) == 0 && len(c.subscribers) == 0 {
+			delete(s.clients, clientID)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package stream
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+func newService(t *testing.T, cfg Config) *Service {
+	t.Helper()
+	// The lifecycle is not started, the tests prune history themselves.
+	return New(cfg, zap.NewNop(), fxtest.NewLifecycle(t))
+}
+
+// push pushes an event of eventType to the client and returns its ID.
+func push(s *Service, clientID, eventType string) string {
+	s.Push(clientID, eventType, map[string]string{})
+	return strconv.FormatUint(s.lastID, 10)
+}
+
+// backdate makes the events in history an hour old.
+func backdate(s *Service) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.clients {
+		for _, event := range c.history {
+			event.CreatedAt = event.CreatedAt.Add(-time.Hour)
+		}
+	}
+}
+
+// types lists the types of the events.
+func types(events []*domain.StreamEvent) []string {
+	res := make([]string, 0, len(events))
+	for _, event := range events {
+		res = append(res, event.Type)
+	}
+	return res
+}
+
+func TestSubscribeReplays(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		// setup pushes events and returns the Last-Event-ID to resume from.
+		setup func(s *Service) string
+		want  []string
+	}{
+		{
+			name: "fresh stream",
+			setup: func(s *Service) string {
+				push(s, "c1", "a")
+				return ""
+			},
+			want: []string{},
+		},
+		{
+			name: "events after the last one seen",
+			setup: func(s *Service) string {
+				last := push(s, "c1", "a")
+				push(s, "c2", "other client")
+				push(s, "c1", "b")
+				push(s, "c1", "c")
+				return last
+			},
+			want: []string{"b", "c"},
+		},
+		{
+			name: "nothing missed",
+			setup: func(s *Service) string {
+				push(s, "c1", "a")
+				return push(s, "c1", "b")
+			},
+			want: []string{},
+		},
+		{
+			name: "malformed id",
+			setup: func(s *Service) string {
+				push(s, "c1", "a")
+				return "abc"
+			},
+			want: []string{domain.StreamEventReset},
+		},
+		{
+			name: "id of another process",
+			setup: func(s *Service) string {
+				push(s, "c1", "a")
+				return "1000"
+			},
+			want: []string{domain.StreamEventReset},
+		},
+		{
+			name: "missed events dropped for size",
+			cfg:  Config{HistorySize: 2},
+			setup: func(s *Service) string {
+				last := push(s, "c1", "a")
+				push(s, "c1", "b")
+				push(s, "c1", "c")
+				push(s, "c1", "d")
+				return last
+			},
+			want: []string{domain.StreamEventReset},
+		},
+		{
+			name: "seen events dropped for size",
+			cfg:  Config{HistorySize: 2},
+			setup: func(s *Service) string {
+				push(s, "c1", "a")
+				last := push(s, "c1", "b")
+				push(s, "c1", "c")
+				push(s, "c1", "d")
+				return last
+			},
+			want: []string{"c", "d"},
+		},
+		{
+			name: "missed events expired",
+			setup: func(s *Service) string {
+				last := push(s, "c1", "a")
+				push(s, "c1", "b")
+				backdate(s)
+				push(s, "c1", "c")
+				s.prune(time.Now().UTC().Add(-time.Minute))
+				return last
+			},
+			want: []string{domain.StreamEventReset},
+		},
+		{
+			name: "seen events expired",
+			setup: func(s *Service) string {
+				push(s, "c1", "a")
+				last := push(s, "c1", "b")
+				backdate(s)
+				push(s, "c1", "c")
+				s.prune(time.Now().UTC().Add(-time.Minute))
+				return last
+			},
+			want: []string{"c"},
+		},
+		{
+			name: "events of another client expired",
+			setup: func(s *Service) string {
+				last := push(s, "c1", "a")
+				push(s, "c2", "other client")
+				backdate(s)
+				push(s, "c1", "b")
+				s.prune(time.Now().UTC().Add(-time.Minute))
+				return last
+			},
+			want: []string{"b"},
+		},
+		{
+			name: "client forgotten with its history",
+			setup: func(s *Service) string {
+				last := push(s, "c1", "a")
+				push(s, "c1", "b")
+				backdate(s)
+				s.prune(time.Now().UTC().Add(-time.Minute))
+				push(s, "c1", "c")
+				return last
+			},
+			want: []string{domain.StreamEventReset},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newService(t, tt.cfg)
+			lastEventID := tt.setup(s)
+
+			replay, events, cancel := s.Subscribe("c1", lastEventID)
+			defer cancel()
+			if got := types(replay); !slices.Equal(got, tt.want) {
+				t.Fatalf("replayed %q, want %q", got, tt.want)
+			}
+			if len(replay) > 0 && replay[0].Type == domain.StreamEventReset && replay[0].ID != s.lastID {
+				t.Errorf("reset has ID %d, want the last ID %d to resume from", replay[0].ID, s.lastID)
+			}
+
+			// The stream goes on live after the replay.
+			push(s, "c1", "live")
+			if event := <-events; event.Type != "live" {
+				t.Errorf("got live event %q", event.Type)
+			}
+		})
+	}
+}
+
+func TestSubscribeResumesAfterReset(t *testing.T) {
+	s := newService(t, Config{HistorySize: 1})
+	push(s, "c1", "a")
+	push(s, "c1", "b")
+
+	replay, _, cancel := s.Subscribe("c1", "0")
+	cancel()
+	if got := types(replay); !slices.Equal(got, []string{domain.StreamEventReset}) {
+		t.Fatalf("replayed %q, want a reset", got)
+	}
+	push(s, "c1", "c")
+	replay, _, cancel = s.Subscribe("c1", strconv.FormatUint(replay[0].ID, 10))
+	cancel()
+	if got := types(replay); !slices.Equal(got, []string{"c"}) {
+		t.Fatalf("replayed %q after the reset, want %q", got, []string{"c"})
+	}
+}
+
+func TestPushDropsSlowSubscribers(t *testing.T) {
+	s := newService(t, Config{})
+	_, events, cancel := s.Subscribe("c1", "")
+	defer cancel()
+	for range subscriberBuffer + 1 {
+		push(s, "c1", "a")
+	}
+	n := 0
+	for range events {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Fatalf("received %d events before the stream closed, want %d", n, subscriberBuffer)
+	}
+}
@@ -0,0 +1,168 @@
+package transactions
+
+import (
+	"context"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+type Service struct {
+	getter      TransactionsGetter
+	store       Store
+	categorizer Categorizer
+	matcher     TransferMatcher
+	listener    SyncListener
+	events      EventPublisher
+	feed        Feed
+	uow         UnitOfWork
+	plans       SyncLimiter
+	log         *zap.Logger
+}
+
+type In struct {
+	fx.In
+
+	TransactionsGetter TransactionsGetter
+	Store              Store
+	Categorizer        Categorizer
+	Matcher            TransferMatcher
+	Listener           SyncListener
+	Events             EventPublisher
+	Feed               Feed
+	UnitOfWork         UnitOfWork
+	Plans              SyncLimiter
+}
+
+func New(log *zap.Logger, params In) *Service {
+	return &Service{
+		getter:      params.TransactionsGetter,
+		store:       params.Store,
+		categorizer: params.Categorizer,
+		matcher:     params.Matcher,
+		listener:    params.Listener,
+		events:      params.Events,
+		feed:        params.Feed,
+		uow:         params.UnitOfWork,
+		plans:       params.Plans,
+		log:         log,
+	}
+}
+
+// Sync fetches the transactions of accounts booked since from, categorises
+// and stores them. The ones seen for the first time are pushed to the live
+// feed of the client. It counts as a sync against the plan of the client.
+func (s *Service) Sync(ctx context.Context, clientID string, accounts []*domain.Account, from time.Time) ([]*domain.Transaction, error) {
+	var txs []*domain.Transaction
+	err := s.plans.Sync(ctx, clientID, func(ctx context.Context) error {
+		var err error
+		txs, err = s.getter.GetTransactions(ctx, clientID, accounts, from, time.Time{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = s.categorizer.Categorize(ctx, clientID, txs); err != nil {
+		return nil, err
+	}
+	var newTxs []*domain.Transaction
+	err = s.uow.InTx(ctx, func(ctx context.Context) error {
+		known, err := s.store.GetTransactions(ctx, domain.TransactionFilter{ClientID: clientID, From: from})
+		if err != nil {
+			return err
+		}
+		knownKeys := make(map[[3]string]struct{}, len(known))
+		for _, tx := range known {
+			knownKeys[[3]string{tx.Bank, tx.AccountID, tx.TransactionID}] = struct{}{}
+		}
+		newTxs = make([]*domain.Transaction, 0)
+		for _, tx := range txs {
+			if _, ok := knownKeys[[3]string{tx.Bank, tx.AccountID, tx.TransactionID}]; !ok {
+				newTxs = append(newTxs, tx)
+			}
+			if err := s.store.SaveTransaction(ctx, tx); err != nil {
+				return err
+			}
+		}
+		refs := make([]domain.AccountRef, 0, len(accounts))
+		for _, account := range accounts {
+			refs = append(refs, domain.AccountRef{Bank: account.Bank, AccountID: account.AccountID})
+		}
+		event, err := domain.NewEvent(domain.EventTypeTransactionsSynced, clientID, clientID, domain.TransactionsSynced{
+			Accounts: refs,
+			From:     from,
+			Count:    len(txs),
+			New:      len(newTxs),
+		})
+		if err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, event)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.log.Debug("transactions synced", zap.String("client_id", clientID), zap.Int("count", len(txs)), zap.Int("new", len(newTxs)))
+	if len(newTxs) > 0 {
+		s.feed.Push(clientID, domain.StreamEventNewTransactions, newTxs)
+	}
+	// Transfers are paired before the listener runs, so that it does not see
+	// them as spending.
+	if err = s.matcher.Match(ctx, clientID); err != nil {
+		s.log.Warn("failed to match transfers", zap.String("client_id", clientID), zap.Error(err))
+	}
+	if err = s.listener.TransactionsSynced(ctx, clientID); err != nil {
+		s.log.Warn("failed to process synced transactions", zap.String("client_id", clientID), zap.Error(err))
+	}
+	return txs, nil
+}
+
+func (s *Service) List(ctx context.Context, filter domain.TransactionFilter) ([]*domain.Transaction, error) {
+	return s.store.GetTransactions(ctx, filter)
+}
+
+type UnitOfWork interface {
+	InTx(ctx context.Context, f func(ctx context.Context) error) error
+}
+
+// EventPublisher writes domain events within the unit of work of ctx.
+type EventPublisher interface {
+	Publish(ctx context.Context, events ...*domain.Event) error
+}
+
+// SyncLimiter runs syncs with the banks as often as the plan of the client allows.
+type SyncLimiter interface {
+	Sync(ctx context.Context, clientID string, f func(ctx context.Context) error) error
+}
+
+// Feed pushes live updates to the connected clients.
+type Feed interface {
+	Push(clientID, eventType string, data any)
+}
+
+type TransactionsGetter interface {
+	GetTransactions(ctx context.Context, clientID string, accounts []*domain.Account, from, to time.Time) ([]*domain.Transaction, error)
+}
+
+type Categorizer interface {
+	Categorize(ctx context.Context, clientID string, txs []*domain.Transaction) error
+}
+
+// TransferMatcher links the legs of transfers between the client's own accounts.
+type TransferMatcher interface {
+	Match(ctx context.Context, clientID string) error
+}
+
+// SyncListener reacts to freshly stored transactions of a client.
+type SyncListener interface {
+	TransactionsSynced(ctx context.Context, clientID string) error
+}
+
+type Store interface {
+	// SaveTransaction upserts tx, keeping the category the client chose by
+	// hand and the link to a transfer pair.
+	SaveTransaction(ctx context.Context, tx *domain.Transaction) error
+	GetTransactions(ctx context.Context, filter domain.TransactionFilter) ([]*domain.Transaction, error)
+}
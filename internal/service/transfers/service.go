@@ -0,0 +1,237 @@
+package transfers
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/pkg/money"
+	"github.com/google/uuid"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	// lookback bounds the history searched for unpaired transfer legs.
+	lookback = 90 * 24 * time.Hour
+	// window is how far apart the two legs of a transfer may be booked, as
+	// interbank transfers may settle on the next business days.
+	window = 3 * 24 * time.Hour
+)
+
+type Service struct {
+	store Store
+	uow   UnitOfWork
+	log   *zap.Logger
+}
+
+type In struct {
+	fx.In
+
+	Store      Store
+	UnitOfWork UnitOfWork
+}
+
+func New(log *zap.Logger, params In) *Service {
+	return &Service{
+		store: params.Store,
+		uow:   params.UnitOfWork,
+		log:   log,
+	}
+}
+
+func (s *Service) List(ctx context.Context, clientID string, from, to time.Time) ([]*domain.TransferPair, error) {
+	return s.store.GetTransferPairs(ctx, clientID, from, to)
+}
+
+// Match pairs the unpaired debits of the client with credits of the same
+// amount and currency booked on another of the client's accounts within the
+// window. A counterparty naming the other account is the strongest evidence;
+// without it both legs must look like transfers and the match must be unique.
+func (s *Service) Match(ctx context.Context, clientID string) error {
+	accounts, err := s.store.ListAccounts(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	if len(accounts) < 2 {
+		return nil
+	}
+	identifications := make(map[[2]string]string, len(accounts))
+	for _, account := range accounts {
+		if account.Identification != "" {
+			identifications[[2]string{account.Bank, account.AccountID}] = account.Identification
+		}
+	}
+
+	txs, err := s.store.GetTransactions(ctx, domain.TransactionFilter{
+		ClientID: clientID,
+		From:     time.Now().UTC().Add(-lookback),
+	})
+	if err != nil {
+		return err
+	}
+	debits := make([]*leg, 0)
+	credits := make([]*leg, 0)
+	for _, tx := range txs {
+		if tx.TransferID != "" || tx.Status != domain.TransactionStatusBooked {
+			continue
+		}
+		amount, err := money.Parse(tx.Amount)
+		if err != nil {
+			return err
+		}
+		sign := amount.Sign()
+		l := &leg{tx: tx, amount: money.Format(amount.Abs(amount))}
+		switch sign {
+		case -1:
+			debits = append(debits, l)
+		case 1:
+			credits = append(credits, l)
+		}
+	}
+	slices.SortFunc(debits, func(a, b *leg) int { return a.tx.BookedAt.Compare(b.tx.BookedAt) })
+
+	pairs := make([]*domain.TransferPair, 0)
+	for _, debit := range debits {
+		candidates := make([]candidate, 0)
+		for _, credit := range credits {
+			if credit.paired || !sameTransfer(debit, credit) {
+				continue
+			}
+			if score := score(debit.tx, credit.tx, identifications); score > 0 {
+				candidates = append(candidates, candidate{credit: credit, score: score})
+			}
+		}
+		best, ok := pick(debit, candidates)
+		if !ok {
+			continue
+		}
+		best.credit.paired = true
+		matchedBy := domain.TransferMatchCategory
+		if best.score >= counterpartyScore {
+			matchedBy = domain.TransferMatchCounterparty
+		}
+		pairs = append(pairs, &domain.TransferPair{
+			TransferID:          uuid.NewString(),
+			ClientID:            clientID,
+			DebitBank:           debit.tx.Bank,
+			DebitAccountID:      debit.tx.AccountID,
+			DebitTransactionID:  debit.tx.TransactionID,
+			CreditBank:          best.credit.tx.Bank,
+			CreditAccountID:     best.credit.tx.AccountID,
+			CreditTransactionID: best.credit.tx.TransactionID,
+			Amount:              debit.amount,
+			Currency:            debit.tx.Currency,
+			DebitBookedAt:       debit.tx.BookedAt,
+			CreditBookedAt:      best.credit.tx.BookedAt,
+			MatchedBy:           matchedBy,
+			CreatedAt:           time.Now().UTC(),
+		})
+	}
+	if len(pairs) == 0 {
+		return nil
+	}
+	err = s.uow.InTx(ctx, func(ctx context.Context) error {
+		for _, pair := range pairs {
+			if err := s.store.SaveTransferPair(ctx, pair); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.log.Debug("transfers matched", zap.String("client_id", clientID), zap.Int("count", len(pairs)))
+	return nil
+}
+
+const (
+	counterpartyScore = 2
+	categoryScore     = 1
+)
+
+type leg struct {
+	tx     *domain.Transaction
+	amount string
+	paired bool
+}
+
+type candidate struct {
+	credit *leg
+	score  int
+}
+
+func sameTransfer(debit, credit *leg) bool {
+	if debit.tx.Bank == credit.tx.Bank && debit.tx.AccountID == credit.tx.AccountID ||
+		debit.tx.Currency != credit.tx.Currency ||
+		debit.amount != credit.amount {
+		return false
+	}
+	return absDuration(credit.tx.BookedAt.Sub(debit.tx.BookedAt)) <= window
+}
+
+// score weighs the evidence that debit and credit are legs of one transfer.
+// identifications are keyed by the bank and ID of the account.
+func score(debit, credit *domain.Transaction, identifications map[[2]string]string) int {
+	res := 0
+	if id, ok := identifications[[2]string{credit.Bank, credit.AccountID}]; ok && sameIdentification(debit.Counterparty, id) {
+		res += counterpartyScore
+	}
+	if id, ok := identifications[[2]string{debit.Bank, debit.AccountID}]; ok && sameIdentification(credit.Counterparty, id) {
+		res += counterpartyScore
+	}
+	if debit.Category == domain.CategoryTransfers && credit.Category == domain.CategoryTransfers {
+		res += categoryScore
+	}
+	return res
+}
+
+// pick chooses the candidate with the highest score, preferring the credit
+// booked closest to the debit. A match on category alone is accepted only
+// when it is the only one.
+func pick(debit *leg, candidates []candidate) (candidate, bool) {
+	if len(candidates) == 0 {
+		return candidate{}, false
+	}
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		if a.score != b.score {
+			return b.score - a.score
+		}
+		da := absDuration(a.credit.tx.BookedAt.Sub(debit.tx.BookedAt))
+		db := absDuration(b.credit.tx.BookedAt.Sub(debit.tx.BookedAt))
+		return cmp.Compare(da, db)
+	})
+	best := candidates[0]
+	if best.score < counterpartyScore && len(candidates) > 1 {
+		return candidate{}, false
+	}
+	return best, true
+}
+
+func sameIdentification(a, b string) bool {
+	normalize := func(s string) string { return strings.ToUpper(strings.ReplaceAll(s, " ", "")) }
+	return a != "" && normalize(a) == normalize(b)
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+type UnitOfWork interface {
+	InTx(ctx context.Context, f func(ctx context.Context) error) error
+}
+
+type Store interface {
+	ListAccounts(ctx context.Context, clientID string) ([]*domain.Account, error)
+	GetTransactions(ctx context.Context, filter domain.TransactionFilter) ([]*domain.Transaction, error)
+	// SaveTransferPair stores pair and links both of its transactions to it.
+	SaveTransferPair(ctx context.Context, pair *domain.TransferPair) error
+	GetTransferPairs(ctx context.Context, clientID string, from, to time.Time) ([]*domain.TransferPair, error)
+}
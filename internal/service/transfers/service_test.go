@@ -0,0 +1,260 @@
+package transfers_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/internal/infra/memory"
+	"github.com/MichaelSBoop/lima-backend/internal/service/transfers"
+	"go.uber.org/zap"
+)
+
+// Identifications of the accounts of the client.
+const (
+	vbankIdentification = "40817810000000000001"
+	abankIdentification = "40817810000000000002"
+	sbankIdentification = "40817810000000000003"
+)
+
+// booked is ten days ago, well within the history Match searches.
+var booked = time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -10).Add(12 * time.Hour)
+
+// leg is a booked transaction of account a1 at bank, days after booked.
+func leg(id, bank, amount string, days float64) *domain.Transaction {
+	return &domain.Transaction{
+		TransactionID: id,
+		ClientID:      "c1",
+		Bank:          bank,
+		AccountID:     "a1",
+		Amount:        amount,
+		Currency:      "RUB",
+		Status:        domain.TransactionStatusBooked,
+		BookedAt:      booked.Add(time.Duration(days * float64(24*time.Hour))),
+	}
+}
+
+// with sets fields of tx by set.
+func with(tx *domain.Transaction, set func(tx *domain.Transaction)) *domain.Transaction {
+	set(tx)
+	return tx
+}
+
+func toAccount(identification string) func(tx *domain.Transaction) {
+	return func(tx *domain.Transaction) { tx.Counterparty = identification }
+}
+
+func transfer(tx *domain.Transaction) { tx.Category = domain.CategoryTransfers }
+
+// pair names a pair by the banks and IDs of its legs.
+type pair struct {
+	debit, credit string
+	matchedBy     string
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name string
+		txs  []*domain.Transaction
+		want []pair
+	}{
+		{
+			name: "cross-bank by counterparty",
+			txs: []*domain.Transaction{
+				with(leg("d1", "vbank", "-500.00", 0), toAccount(abankIdentification)),
+				leg("c1", "abank", "500.00", 1),
+			},
+			want: []pair{{debit: "vbank/d1", credit: "abank/c1", matchedBy: domain.TransferMatchCounterparty}},
+		},
+		{
+			name: "counterparty on the credit",
+			txs: []*domain.Transaction{
+				leg("d1", "vbank", "-500.00", 0),
+				with(leg("c1", "abank", "500.00", 1), toAccount("4081 7810 0000 0000 0001")),
+			},
+			want: []pair{{debit: "vbank/d1", credit: "abank/c1", matchedBy: domain.TransferMatchCounterparty}},
+		},
+		{
+			name: "category alone, unique",
+			txs: []*domain.Transaction{
+				with(leg("d1", "vbank", "-500.00", 0), transfer),
+				with(leg("c1", "abank", "500.00", 0), transfer),
+			},
+			want: []pair{{debit: "vbank/d1", credit: "abank/c1", matchedBy: domain.TransferMatchCategory}},
+		},
+		{
+			name: "category alone, ambiguous",
+			txs: []*domain.Transaction{
+				with(leg("d1", "vbank", "-500.00", 0), transfer),
+				with(leg("c1", "abank", "500.00", 0), transfer),
+				with(leg("c2", "sbank", "500.00", 1), transfer),
+			},
+		},
+		{
+			name: "counterparty settles an ambiguous match",
+			txs: []*domain.Transaction{
+				with(leg("d1", "vbank", "-500.00", 0), func(tx *domain.Transaction) { transfer(tx); toAccount(sbankIdentification)(tx) }),
+				with(leg("c1", "abank", "500.00", 0), transfer),
+				with(leg("c2", "sbank", "500.00", 1), transfer),
+			},
+			want: []pair{{debit: "vbank/d1", credit: "sbank/c2", matchedBy: domain.TransferMatchCounterparty}},
+		},
+		{
+			name: "closest of equal candidates",
+			txs: []*domain.Transaction{
+				with(leg("d1", "vbank", "-500.00", 0), toAccount(abankIdentification)),
+				leg("c1", "abank", "500.00", 2),
+				leg("c2", "abank", "500.00", 0.5),
+			},
+			want: []pair{{debit: "vbank/d1", credit: "abank/c2", matchedBy: domain.TransferMatchCounterparty}},
+		},
+		{
+			name: "amounts written differently",
+			txs: []*domain.Transaction{
+				with(leg("d1", "vbank", "-500", 0), toAccount(abankIdentification)),
+				leg("c1", "abank", "500.00", 1),
+			},
+			want: []pair{{debit: "vbank/d1", credit: "abank/c1", matchedBy: domain.TransferMatchCounterparty}},
+		},
+		{
+			name: "amounts a kopeck apart",
+			txs: []*domain.Transaction{
+				with(leg("d1", "vbank", "-500.00", 0), toAccount(abankIdentification)),
+				leg("c1", "abank", "500.01", 1),
+			},
+		},
+		{
+			name: "other currency",
+			txs: []*domain.Transaction{
+				with(leg("d1", "vbank", "-500.00", 0), toAccount(abankIdentification)),
+				with(leg("c1", "abank", "500.00", 1), func(tx *domain.Transaction) { tx.Currency = "USD" }),
+			},
+		},
+		{
+			name: "credit booked at the end of the window",
+			txs: []*domain.Transaction{
+				with(leg("d1", "vbank", "-500.00", 0), toAccount(abankIdentification)),
+				leg("c1", "abank", "500.00", 3),
+			},
+			want: []pair{{debit: "vbank/d1", credit: "abank/c1", matchedBy: domain.TransferMatchCounterparty}},
+		},
+		{
+			name: "credit booked before the debit",
+			txs: []*domain.Transaction{
+				with(leg("d1", "vbank", "-500.00", 0), toAccount(abankIdentification)),
+				leg("c1", "abank", "500.00", -2),
+			},
+			want: []pair{{debit: "vbank/d1", credit: "abank/c1", matchedBy: domain.TransferMatchCounterparty}},
+		},
+		{
+			name: "credit booked past the window",
+			txs: []*domain.Transaction{
+				with(leg("d1", "vbank", "-500.00", 0), toAccount(abankIdentification)),
+				leg("c1", "abank", "500.00", 3.5),
+			},
+		},
+		{
+			name: "same account",
+			txs: []*domain.Transaction{
+				with(leg("d1", "vbank", "-500.00", 0), transfer),
+				with(leg("c1", "vbank", "500.00", 0), transfer),
+			},
+		},
+		{
+			name: "pending credit",
+			txs: []*domain.Transaction{
+				with(leg("d1", "vbank", "-500.00", 0), toAccount(abankIdentification)),
+				with(leg("c1", "abank", "500.00", 1), func(tx *domain.Transaction) { tx.Status = domain.TransactionStatusPending }),
+			},
+		},
+		{
+			name: "credit already paired",
+			txs: []*domain.Transaction{
+				with(leg("d1", "vbank", "-500.00", 0), toAccount(abankIdentification)),
+				with(leg("c1", "abank", "500.00", 1), func(tx *domain.Transaction) { tx.TransferID = "earlier" }),
+			},
+		},
+		{
+			name: "credit taken by the earlier debit",
+			txs: []*domain.Transaction{
+				with(leg("d2", "sbank", "-500.00", 1), toAccount(abankIdentification)),
+				with(leg("d1", "vbank", "-500.00", 0), toAccount(abankIdentification)),
+				leg("c1", "abank", "500.00", 2),
+			},
+			want: []pair{{debit: "vbank/d1", credit: "abank/c1", matchedBy: domain.TransferMatchCounterparty}},
+		},
+		{
+			name: "debits of one amount pair with their own credits",
+			txs: []*domain.Transaction{
+				with(leg("d1", "vbank", "-500.00", 0), toAccount(abankIdentification)),
+				with(leg("d2", "vbank", "-500.00", 0.1), toAccount(sbankIdentification)),
+				leg("c1", "sbank", "500.00", 0.2),
+				leg("c2", "abank", "500.00", 0.3),
+			},
+			want: []pair{
+				{debit: "vbank/d1", credit: "abank/c2", matchedBy: domain.TransferMatchCounterparty},
+				{debit: "vbank/d2", credit: "sbank/c1", matchedBy: domain.TransferMatchCounterparty},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := memory.New(zap.NewNop())
+			for bank, identification := range map[string]string{"vbank": vbankIdentification, "abank": abankIdentification, "sbank": sbankIdentification} {
+				account := &domain.Account{ClientID: "c1", Bank: bank, AccountID: "a1", Currency: "RUB", Identification: identification}
+				if err := store.SaveAccount(ctx, account); err != nil {
+					t.Fatalf("SaveAccount: %v", err)
+				}
+			}
+			for _, tx := range tt.txs {
+				if err := store.SaveTransaction(ctx, tx); err != nil {
+					t.Fatalf("SaveTransaction: %v", err)
+				}
+			}
+			s := transfers.New(zap.NewNop(), transfers.In{Store: store, UnitOfWork: store})
+
+			// A second run finds nothing left to pair.
+			for range 2 {
+				if err := s.Match(ctx, "c1"); err != nil {
+					t.Fatalf("Match: %v", err)
+				}
+			}
+			pairs, err := s.List(ctx, "c1", time.Time{}, time.Time{})
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			got := make([]pair, 0, len(pairs))
+			for _, p := range pairs {
+				got = append(got, pair{
+					debit:     p.DebitBank + "/" + p.DebitTransactionID,
+					credit:    p.CreditBank + "/" + p.CreditTransactionID,
+					matchedBy: p.MatchedBy,
+				})
+				if p.Amount != "500.00" {
+					t.Errorf("pair %s: amount %s, want 500.00", p.DebitTransactionID, p.Amount)
+				}
+			}
+			slices.SortFunc(got, func(a, b pair) int { return strings.Compare(a.debit, b.debit) })
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("got pairs %v, want %v", got, tt.want)
+			}
+
+			txs, err := store.GetTransactions(ctx, domain.TransactionFilter{ClientID: "c1"})
+			if err != nil {
+				t.Fatalf("GetTransactions: %v", err)
+			}
+			for _, tx := range txs {
+				paired := slices.ContainsFunc(pairs, func(p *domain.TransferPair) bool {
+					return tx.TransferID == p.TransferID
+				})
+				if paired && tx.Category != domain.CategoryTransfers {
+					t.Errorf("paired transaction %s categorized as %q", tx.TransactionID, tx.Category)
+				}
+			}
+		})
+	}
+}
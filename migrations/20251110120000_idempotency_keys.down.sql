@@ -0,0 +1 @@
+DROP TABLE IF EXISTS lima.idempotency_keys;
\ No newline at end of file
@@ -0,0 +1,16 @@
+CREATE TABLE lima.idempotency_keys (
+    idempotency_key VARCHAR(255) NOT NULL,
+    client_id VARCHAR(255) NOT NULL DEFAULT '',
+    method VARCHAR(16) NOT NULL,
+    path TEXT NOT NULL,
+    fingerprint VARCHAR(64) NOT NULL,
+    completed BOOLEAN NOT NULL DEFAULT FALSE,
+    status_code INTEGER,
+    content_type VARCHAR(255),
+    response_body BYTEA,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (idempotency_key, client_id)
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON lima.idempotency_keys (expires_at);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS lima.exchange_rates;
+DROP TABLE IF EXISTS lima.account_balances;
+ALTER TABLE lima.accounts
+    DROP CONSTRAINT IF EXISTS accounts_client_id_bank_account_id_key,
+    DROP COLUMN IF EXISTS bank,
+    DROP COLUMN IF EXISTS client_id,
+    ADD CONSTRAINT accounts_account_id_key UNIQUE (account_id);
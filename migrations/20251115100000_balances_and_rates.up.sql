@@ -0,0 +1,31 @@
+-- Account IDs are unique within a bank only, accounts are keyed by the client
+-- and bank they belong to.
+ALTER TABLE lima.accounts
+    ADD COLUMN client_id VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN bank VARCHAR(255) NOT NULL DEFAULT '';
+
+ALTER TABLE lima.accounts
+    ALTER COLUMN client_id DROP DEFAULT,
+    ALTER COLUMN bank DROP DEFAULT,
+    DROP CONSTRAINT accounts_account_id_key,
+    ADD CONSTRAINT accounts_client_id_bank_account_id_key UNIQUE (client_id, bank, account_id);
+
+CREATE TABLE lima.account_balances (
+    client_id VARCHAR(255) NOT NULL,
+    bank VARCHAR(255) NOT NULL,
+    account_id VARCHAR(255) NOT NULL,
+    balance_type VARCHAR(64) NOT NULL,
+    amount NUMERIC(20, 2) NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    as_of TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (client_id, bank, account_id, balance_type)
+);
+
+CREATE TABLE lima.exchange_rates (
+    rate_date DATE NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    base_currency VARCHAR(3) NOT NULL,
+    rate NUMERIC(20, 8) NOT NULL,
+    source VARCHAR(64) NOT NULL,
+    PRIMARY KEY (rate_date, currency, base_currency)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS lima.account_daily_snapshots;
+DROP TABLE IF EXISTS lima.transactions;
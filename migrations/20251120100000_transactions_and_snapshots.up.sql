@@ -0,0 +1,33 @@
+CREATE TABLE lima.transactions (
+    account_id VARCHAR(255) NOT NULL,
+    transaction_id VARCHAR(255) NOT NULL,
+    client_id VARCHAR(255) NOT NULL,
+    bank VARCHAR(255) NOT NULL,
+    amount NUMERIC(20, 2) NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    status VARCHAR(32) NOT NULL,
+    booked_at TIMESTAMPTZ NOT NULL,
+    value_at TIMESTAMPTZ,
+    description TEXT,
+    merchant VARCHAR(255),
+    mcc VARCHAR(4),
+    counterparty VARCHAR(255),
+    counterparty_name VARCHAR(255),
+    PRIMARY KEY (client_id, bank, account_id, transaction_id)
+);
+
+CREATE INDEX transactions_client_id_booked_at_idx ON lima.transactions (client_id, booked_at);
+
+CREATE TABLE lima.account_daily_snapshots (
+    client_id VARCHAR(255) NOT NULL,
+    account_id VARCHAR(255) NOT NULL,
+    bank VARCHAR(255) NOT NULL,
+    snapshot_date DATE NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    balance NUMERIC(20, 2) NOT NULL,
+    income NUMERIC(20, 2) NOT NULL,
+    spending NUMERIC(20, 2) NOT NULL,
+    PRIMARY KEY (client_id, bank, account_id, snapshot_date)
+);
+
+CREATE INDEX account_daily_snapshots_client_id_date_idx ON lima.account_daily_snapshots (client_id, snapshot_date);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS lima.category_rules;
+DROP INDEX IF EXISTS lima.transactions_client_id_category_idx;
+ALTER TABLE lima.transactions
+    DROP COLUMN IF EXISTS category_source,
+    DROP COLUMN IF EXISTS category;
@@ -0,0 +1,18 @@
+ALTER TABLE lima.transactions
+    ADD COLUMN category VARCHAR(64) NOT NULL DEFAULT 'other',
+    ADD COLUMN category_source VARCHAR(16) NOT NULL DEFAULT 'default';
+
+CREATE INDEX transactions_client_id_category_idx ON lima.transactions (client_id, category);
+
+CREATE TABLE lima.category_rules (
+    rule_id UUID PRIMARY KEY,
+    -- NULL client_id marks a rule applying to every client.
+    client_id VARCHAR(255),
+    match_field VARCHAR(32) NOT NULL,
+    pattern VARCHAR(255) NOT NULL,
+    category VARCHAR(64) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX category_rules_client_id_match_idx
+    ON lima.category_rules (COALESCE(client_id, ''), match_field, lower(pattern));
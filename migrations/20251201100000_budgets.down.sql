@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS lima.budget_alerts;
+DROP TABLE IF EXISTS lima.budgets;
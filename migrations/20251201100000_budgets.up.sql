@@ -0,0 +1,27 @@
+CREATE TABLE lima.budgets (
+    budget_id UUID PRIMARY KEY,
+    client_id VARCHAR(255) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    category VARCHAR(64),
+    merchant VARCHAR(255),
+    limit_amount NUMERIC(20, 2) NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    rollover BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX budgets_client_id_idx ON lima.budgets (client_id);
+
+CREATE TABLE lima.budget_alerts (
+    alert_id UUID PRIMARY KEY,
+    budget_id UUID NOT NULL REFERENCES lima.budgets (budget_id) ON DELETE CASCADE,
+    client_id VARCHAR(255) NOT NULL,
+    period DATE NOT NULL,
+    threshold INTEGER NOT NULL,
+    spent NUMERIC(20, 2) NOT NULL,
+    available NUMERIC(20, 2) NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    UNIQUE (budget_id, period, threshold)
+);
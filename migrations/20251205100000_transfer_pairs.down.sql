@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS lima.transfer_pairs;
+ALTER TABLE lima.transactions
+    DROP COLUMN IF EXISTS transfer_id;
+ALTER TABLE lima.accounts
+    DROP COLUMN IF EXISTS identification;
@@ -0,0 +1,26 @@
+ALTER TABLE lima.accounts
+    ADD COLUMN identification VARCHAR(255);
+
+ALTER TABLE lima.transactions
+    ADD COLUMN transfer_id UUID;
+
+CREATE TABLE lima.transfer_pairs (
+    transfer_id UUID PRIMARY KEY,
+    client_id VARCHAR(255) NOT NULL,
+    debit_bank VARCHAR(255) NOT NULL,
+    debit_account_id VARCHAR(255) NOT NULL,
+    debit_transaction_id VARCHAR(255) NOT NULL,
+    credit_bank VARCHAR(255) NOT NULL,
+    credit_account_id VARCHAR(255) NOT NULL,
+    credit_transaction_id VARCHAR(255) NOT NULL,
+    amount NUMERIC(20, 2) NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    debit_booked_at TIMESTAMPTZ NOT NULL,
+    credit_booked_at TIMESTAMPTZ NOT NULL,
+    matched_by VARCHAR(32) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    CONSTRAINT transfer_pairs_debit_key UNIQUE (client_id, debit_bank, debit_account_id, debit_transaction_id),
+    CONSTRAINT transfer_pairs_credit_key UNIQUE (client_id, credit_bank, credit_account_id, credit_transaction_id)
+);
+
+CREATE INDEX transfer_pairs_client_id_idx ON lima.transfer_pairs (client_id, debit_booked_at);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS lima.notification_deliveries;
+DROP TABLE IF EXISTS lima.notification_preferences;
@@ -0,0 +1,31 @@
+CREATE TABLE lima.notification_preferences (
+    client_id VARCHAR(255) NOT NULL,
+    channel VARCHAR(16) NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    target TEXT NOT NULL,
+    events TEXT[] NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (client_id, channel)
+);
+
+CREATE TABLE lima.notification_deliveries (
+    delivery_id UUID PRIMARY KEY,
+    notification_id UUID NOT NULL,
+    client_id VARCHAR(255) NOT NULL,
+    event VARCHAR(64) NOT NULL,
+    channel VARCHAR(16) NOT NULL,
+    target TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    body TEXT NOT NULL,
+    data JSONB NOT NULL DEFAULT '{}',
+    status VARCHAR(16) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX notification_deliveries_client_id_idx ON lima.notification_deliveries (client_id, created_at);
+CREATE INDEX notification_deliveries_due_idx ON lima.notification_deliveries (next_attempt_at)
+    WHERE status = 'pending';
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS lima.outbox_events;
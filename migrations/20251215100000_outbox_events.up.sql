@@ -0,0 +1,27 @@
+CREATE TABLE lima.outbox_events (
+    sequence BIGSERIAL PRIMARY KEY,
+    event_id UUID NOT NULL UNIQUE,
+    event_type VARCHAR(64) NOT NULL,
+    client_id VARCHAR(255) NOT NULL,
+    -- aggregate_id and payload are sealed once encryption is enabled, events
+    -- of an aggregate are told apart by the blind index of its ID then.
+    aggregate_id TEXT NOT NULL,
+    aggregate_id_bidx VARCHAR(64),
+    payload TEXT NOT NULL,
+    occurred_at TIMESTAMPTZ NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    dispatched_at TIMESTAMPTZ,
+    -- claimed_until leaves the event to the dispatcher that claimed it, or
+    -- holds it back after a failed delivery.
+    claimed_until TIMESTAMPTZ,
+    -- delivered names the subscribers and sinks that accepted the event.
+    delivered TEXT[] NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX outbox_events_pending_idx ON lima.outbox_events (sequence)
+    WHERE status = 'pending';
+
+CREATE INDEX outbox_events_aggregate_idx ON lima.outbox_events (client_id, (COALESCE(aggregate_id_bidx, aggregate_id)), sequence)
+    WHERE status <> 'dispatched';
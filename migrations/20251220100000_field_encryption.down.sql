@@ -0,0 +1,44 @@
+DROP INDEX IF EXISTS lima.transfer_pairs_credit_key_idx;
+DROP INDEX IF EXISTS lima.transfer_pairs_debit_key_idx;
+ALTER TABLE lima.transfer_pairs
+    DROP COLUMN IF EXISTS credit_account_id_bidx,
+    DROP COLUMN IF EXISTS debit_account_id_bidx,
+    ALTER COLUMN credit_account_id TYPE VARCHAR(255),
+    ALTER COLUMN debit_account_id TYPE VARCHAR(255),
+    ADD CONSTRAINT transfer_pairs_debit_key UNIQUE (client_id, debit_bank, debit_account_id, debit_transaction_id),
+    ADD CONSTRAINT transfer_pairs_credit_key UNIQUE (client_id, credit_bank, credit_account_id, credit_transaction_id);
+DROP INDEX IF EXISTS lima.account_daily_snapshots_account_key_idx;
+ALTER TABLE lima.account_daily_snapshots
+    DROP COLUMN IF EXISTS account_id_bidx,
+    ALTER COLUMN account_id TYPE VARCHAR(255),
+    ADD PRIMARY KEY (client_id, bank, account_id, snapshot_date);
+DROP INDEX IF EXISTS lima.transactions_account_key_idx;
+ALTER TABLE lima.transactions
+    DROP COLUMN IF EXISTS account_id_bidx,
+    ALTER COLUMN account_id TYPE VARCHAR(255),
+    ADD PRIMARY KEY (client_id, bank, account_id, transaction_id);
+DROP INDEX IF EXISTS lima.account_balances_account_key_idx;
+ALTER TABLE lima.account_balances
+    DROP COLUMN IF EXISTS account_id_bidx,
+    ALTER COLUMN account_id TYPE VARCHAR(255),
+    ADD PRIMARY KEY (client_id, bank, account_id, balance_type);
+DROP INDEX IF EXISTS lima.accounts_account_key_idx;
+ALTER TABLE lima.accounts
+    DROP COLUMN IF EXISTS account_id_bidx,
+    ALTER COLUMN account_id TYPE VARCHAR(255),
+    ADD CONSTRAINT accounts_client_id_bank_account_id_key UNIQUE (client_id, bank, account_id);
+DROP INDEX IF EXISTS lima.account_consents_consent_id_bidx_idx;
+ALTER TABLE lima.account_consents
+    DROP COLUMN IF EXISTS consent_id_bidx,
+    ALTER COLUMN consent_id TYPE VARCHAR(255);
+ALTER TABLE lima.accounts
+    ALTER COLUMN identification TYPE VARCHAR(255);
+ALTER TABLE lima.transactions
+    ALTER COLUMN counterparty TYPE VARCHAR(255),
+    ALTER COLUMN counterparty_name TYPE VARCHAR(255);
+DROP INDEX IF EXISTS lima.category_rules_client_id_match_idx;
+ALTER TABLE lima.category_rules
+    DROP COLUMN IF EXISTS pattern_bidx,
+    ALTER COLUMN pattern TYPE VARCHAR(255);
+CREATE UNIQUE INDEX category_rules_client_id_match_idx
+    ON lima.category_rules (COALESCE(client_id, ''), match_field, lower(pattern));
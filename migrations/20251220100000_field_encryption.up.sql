@@ -0,0 +1,69 @@
+ALTER TABLE lima.account_consents
+    ALTER COLUMN consent_id TYPE TEXT,
+    ADD COLUMN consent_id_bidx VARCHAR(64);
+
+CREATE INDEX account_consents_consent_id_bidx_idx ON lima.account_consents (consent_id_bidx);
+
+ALTER TABLE lima.accounts
+    ALTER COLUMN identification TYPE TEXT;
+
+ALTER TABLE lima.transactions
+    ALTER COLUMN counterparty TYPE TEXT,
+    ALTER COLUMN counterparty_name TYPE TEXT;
+
+-- Sealed patterns differ on every write, rules of clients are told apart by
+-- the blind index of their pattern once encryption is enabled.
+ALTER TABLE lima.category_rules
+    ALTER COLUMN pattern TYPE TEXT,
+    ADD COLUMN pattern_bidx VARCHAR(64);
+
+DROP INDEX lima.category_rules_client_id_match_idx;
+CREATE UNIQUE INDEX category_rules_client_id_match_idx
+    ON lima.category_rules (COALESCE(client_id, ''), match_field, COALESCE(pattern_bidx, lower(pattern)));
+
+-- Sealed account ids differ on every write, rows of an account are keyed and
+-- joined by the blind index of its id once encryption is enabled.
+ALTER TABLE lima.accounts
+    DROP CONSTRAINT accounts_client_id_bank_account_id_key,
+    ALTER COLUMN account_id TYPE TEXT,
+    ADD COLUMN account_id_bidx VARCHAR(64);
+
+CREATE UNIQUE INDEX accounts_account_key_idx
+    ON lima.accounts (client_id, bank, (COALESCE(account_id_bidx, account_id)));
+
+ALTER TABLE lima.account_balances
+    DROP CONSTRAINT account_balances_pkey,
+    ALTER COLUMN account_id TYPE TEXT,
+    ADD COLUMN account_id_bidx VARCHAR(64);
+
+CREATE UNIQUE INDEX account_balances_account_key_idx
+    ON lima.account_balances (client_id, bank, (COALESCE(account_id_bidx, account_id)), balance_type);
+
+ALTER TABLE lima.transactions
+    DROP CONSTRAINT transactions_pkey,
+    ALTER COLUMN account_id TYPE TEXT,
+    ADD COLUMN account_id_bidx VARCHAR(64);
+
+CREATE UNIQUE INDEX transactions_account_key_idx
+    ON lima.transactions (client_id, bank, (COALESCE(account_id_bidx, account_id)), transaction_id);
+
+ALTER TABLE lima.account_daily_snapshots
+    DROP CONSTRAINT account_daily_snapshots_pkey,
+    ALTER COLUMN account_id TYPE TEXT,
+    ADD COLUMN account_id_bidx VARCHAR(64);
+
+CREATE UNIQUE INDEX account_daily_snapshots_account_key_idx
+    ON lima.account_daily_snapshots (client_id, bank, (COALESCE(account_id_bidx, account_id)), snapshot_date);
+
+ALTER TABLE lima.transfer_pairs
+    DROP CONSTRAINT transfer_pairs_debit_key,
+    DROP CONSTRAINT transfer_pairs_credit_key,
+    ALTER COLUMN debit_account_id TYPE TEXT,
+    ALTER COLUMN credit_account_id TYPE TEXT,
+    ADD COLUMN debit_account_id_bidx VARCHAR(64),
+    ADD COLUMN credit_account_id_bidx VARCHAR(64);
+
+CREATE UNIQUE INDEX transfer_pairs_debit_key_idx
+    ON lima.transfer_pairs (client_id, debit_bank, (COALESCE(debit_account_id_bidx, debit_account_id)), debit_transaction_id);
+CREATE UNIQUE INDEX transfer_pairs_credit_key_idx
+    ON lima.transfer_pairs (client_id, credit_bank, (COALESCE(credit_account_id_bidx, credit_account_id)), credit_transaction_id);
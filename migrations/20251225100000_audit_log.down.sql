@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS lima.audit_log;
+DROP FUNCTION IF EXISTS lima.audit_log_append_only();
@@ -0,0 +1,35 @@
+CREATE TABLE lima.audit_log (
+    sequence BIGINT PRIMARY KEY,
+    client_id VARCHAR(255) NOT NULL,
+    action VARCHAR(64) NOT NULL,
+    consent_id TEXT,
+    consent_id_bidx VARCHAR(64),
+    bank VARCHAR(255),
+    endpoint TEXT,
+    outcome VARCHAR(16) NOT NULL,
+    status_code INTEGER,
+    error TEXT,
+    request_id VARCHAR(255),
+    occurred_at TIMESTAMPTZ NOT NULL,
+    prev_hash VARCHAR(64) NOT NULL,
+    hash VARCHAR(64) NOT NULL
+);
+
+CREATE INDEX audit_log_client_id_idx ON lima.audit_log (client_id, sequence);
+CREATE INDEX audit_log_consent_id_bidx_idx ON lima.audit_log (consent_id_bidx);
+CREATE INDEX audit_log_request_id_idx ON lima.audit_log (request_id);
+CREATE INDEX audit_log_occurred_at_idx ON lima.audit_log (occurred_at);
+
+CREATE FUNCTION lima.audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON lima.audit_log
+    FOR EACH ROW EXECUTE FUNCTION lima.audit_log_append_only();
+
+CREATE TRIGGER audit_log_no_truncate
+    BEFORE TRUNCATE ON lima.audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION lima.audit_log_append_only();
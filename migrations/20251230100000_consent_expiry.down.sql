@@ -0,0 +1 @@
+ALTER TABLE lima.account_consents DROP COLUMN IF EXISTS expires_at;
@@ -0,0 +1 @@
+ALTER TABLE lima.account_consents ADD COLUMN expires_at TIMESTAMPTZ;
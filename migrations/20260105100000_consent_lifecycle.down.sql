@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS lima.account_consents_status_expires_at_idx;
+ALTER TABLE lima.account_consents
+    DROP COLUMN IF EXISTS created_at,
+    DROP COLUMN IF EXISTS last_used_at,
+    DROP COLUMN IF EXISTS expiry_notified_at;
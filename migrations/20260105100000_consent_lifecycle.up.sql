@@ -0,0 +1,6 @@
+ALTER TABLE lima.account_consents
+    ADD COLUMN created_at TIMESTAMPTZ,
+    ADD COLUMN last_used_at TIMESTAMPTZ,
+    ADD COLUMN expiry_notified_at TIMESTAMPTZ;
+
+CREATE INDEX account_consents_status_expires_at_idx ON lima.account_consents (status, expires_at);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS lima.consent_authorizations;
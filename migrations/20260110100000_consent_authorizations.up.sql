@@ -0,0 +1,12 @@
+CREATE TABLE lima.consent_authorizations (
+    state_hash VARCHAR(64) PRIMARY KEY,
+    client_id VARCHAR(255) NOT NULL,
+    consent_id TEXT NOT NULL,
+    bank VARCHAR(255) NOT NULL,
+    code_verifier TEXT NOT NULL,
+    return_to TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX consent_authorizations_expires_at_idx ON lima.consent_authorizations (expires_at);
@@ -0,0 +1 @@
+ALTER TABLE lima.account_consents ADD COLUMN replaces_consent_id TEXT;
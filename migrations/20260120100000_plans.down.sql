@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS lima.client_syncs;
+DROP TABLE IF EXISTS lima.plan_changes;
+DROP TABLE IF EXISTS lima.client_plans;
@@ -0,0 +1,25 @@
+CREATE TABLE lima.client_plans (
+    client_id VARCHAR(255) PRIMARY KEY,
+    plan VARCHAR(64) NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE lima.plan_changes (
+    id BIGSERIAL PRIMARY KEY,
+    client_id VARCHAR(255) NOT NULL,
+    previous_plan VARCHAR(64) NOT NULL,
+    plan VARCHAR(64) NOT NULL,
+    changed_by TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX plan_changes_client_id_idx ON lima.plan_changes (client_id, changed_at);
+
+-- client_syncs counts the syncs of a client against the interval of the plan.
+-- A sync reserves its slot until reserved_until and takes it once it succeeds.
+CREATE TABLE lima.client_syncs (
+    client_id VARCHAR(255) PRIMARY KEY,
+    synced_at TIMESTAMPTZ,
+    reserved_until TIMESTAMPTZ
+);
@@ -0,0 +1,7 @@
+package fieldcrypt
+
+// Config locates the keys of the local key file provider.
+type Config struct {
+	// KeyFile is the path of the key file. Encryption is disabled when empty.
+	KeyFile string `json:"key_file" yaml:"key_file"`
+}
@@ -0,0 +1,203 @@
+// Package fieldcrypt implements envelope encryption of single values, such as
+// database columns, and blind indexes for looking them up.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const (
+	prefix    = "enc:v"
+	nonceSize = 12
+	tagSize   = 16
+	// wrappedSize is the size of a data key sealed with a key encryption key.
+	wrappedSize = nonceSize + keySize + tagSize
+)
+
+var (
+	// ErrMalformed is returned for a sealed value that cannot be parsed or opened.
+	ErrMalformed = errors.New("malformed encrypted value")
+	// ErrDisabled is returned when a sealed value is opened without keys.
+	ErrDisabled = errors.New("encryption is not configured")
+)
+
+// Cipher seals every value with a fresh data key, itself sealed with the
+// current key encryption key. Sealed values carry the version of that key
+// and are bound to the field they were sealed for, so a value copied into
+// another column does not open.
+//
+// A nil *Cipher stores values in plaintext.
+type Cipher struct {
+	keys KeyProvider
+}
+
+// New returns a cipher over the local key file of cfg, or nil if cfg
+// does not name one.
+func New(cfg Config, log *zap.Logger) (*Cipher, error) {
+	if cfg.KeyFile == "" {
+		log.Warn("field encryption is disabled, sensitive data is stored in plaintext")
+		return nil, nil
+	}
+	keys, err := NewKeyFile(cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return NewCipher(keys), nil
+}
+
+func NewCipher(keys KeyProvider) *Cipher {
+	return &Cipher{keys: keys}
+}
+
+// Encrypt seals plaintext for field. Empty values are kept empty.
+func (c *Cipher) Encrypt(plaintext, field string) (string, error) {
+	if c == nil || plaintext == "" {
+		return plaintext, nil
+	}
+	key, err := c.keys.CurrentKey()
+	if err != nil {
+		return "", err
+	}
+	dek := make([]byte, keySize)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+	wrapped, err := seal(key.Material, dek, field)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(dek, []byte(plaintext), field)
+	if err != nil {
+		return "", err
+	}
+	return prefix + strconv.FormatUint(uint64(key.Version), 10) + ":" +
+		base64.RawStdEncoding.EncodeToString(append(wrapped, sealed...)), nil
+}
+
+// Decrypt opens a value sealed for field. Values that were never sealed,
+// such as those written before encryption was enabled, are returned as is.
+func (c *Cipher) Decrypt(value, field string) (string, error) {
+	version, data, ok, err := parse(value)
+	if err != nil || !ok {
+		return value, err
+	}
+	if c == nil {
+		return "", ErrDisabled
+	}
+	key, err := c.keys.Key(version)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < wrappedSize+nonceSize+tagSize {
+		return "", ErrMalformed
+	}
+	dek, err := open(key.Material, data[:wrappedSize], field)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dek, data[wrappedSize:], field)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// CurrentPrefix returns the prefix of the values sealed with the current key,
+// for finding stale values without opening them.
+func (c *Cipher) CurrentPrefix() (string, error) {
+	if c == nil {
+		return "", ErrDisabled
+	}
+	key, err := c.keys.CurrentKey()
+	if err != nil {
+		return "", err
+	}
+	return prefix + strconv.FormatUint(uint64(key.Version), 10) + ":", nil
+}
+
+// BlindIndex returns a keyed hash of value for field, so that a sealed field
+// can be looked up by equality. It is empty when value is empty or when
+// encryption is disabled.
+func (c *Cipher) BlindIndex(value, field string) (string, error) {
+	if c == nil || value == "" {
+		return "", nil
+	}
+	key, err := c.keys.IndexKey()
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(field))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// parse splits a sealed value into the version of its key and its data.
+// ok is false for values that were not sealed.
+func parse(value string) (version uint32, data []byte, ok bool, err error) {
+	rest, found := strings.CutPrefix(value, prefix)
+	if !found {
+		return 0, nil, false, nil
+	}
+	v, encoded, found := strings.Cut(rest, ":")
+	if !found {
+		return 0, nil, false, ErrMalformed
+	}
+	parsed, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		return 0, nil, false, ErrMalformed
+	}
+	data, err = base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return 0, nil, false, ErrMalformed
+	}
+	return uint32(parsed), data, true, nil
+}
+
+func seal(key, plaintext []byte, field string) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, nonceSize, nonceSize+len(plaintext)+tagSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, []byte(field)), nil
+}
+
+func open(key, sealed []byte, field string) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < nonceSize+tagSize {
+		return nil, ErrMalformed
+	}
+	plaintext, err := aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(field))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,207 @@
+package fieldcrypt_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MichaelSBoop/lima-backend/pkg/fieldcrypt"
+)
+
+func key(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+// newCipher writes a key file with the keys of versions, current among them,
+// and returns a cipher over it.
+func newCipher(t *testing.T, current uint32, versions ...uint32) *fieldcrypt.Cipher {
+	t.Helper()
+	var b strings.Builder
+	fmt.Fprintf(&b, "current: %d\nindex_key: %s\nkeys:\n", current, key(0xff))
+	for _, v := range versions {
+		fmt.Fprintf(&b, "  - version: %d\n    key: %s\n", v, key(byte(v)))
+	}
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	if err := os.WriteFile(path, []byte(b.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := fieldcrypt.NewKeyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fieldcrypt.NewCipher(keys)
+}
+
+func TestRoundTrip(t *testing.T) {
+	c := newCipher(t, 1, 1)
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "empty", value: ""},
+		{name: "ascii", value: "consent-0001"},
+		{name: "unicode", value: "ООО «Ромашка»"},
+		{name: "long", value: strings.Repeat("x", 4096)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed, err := c.Encrypt(tt.value, "table.column")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.value != "" && (sealed == tt.value || !strings.HasPrefix(sealed, "enc:v1:")) {
+				t.Fatalf("value was not sealed: %q", sealed)
+			}
+			opened, err := c.Decrypt(sealed, "table.column")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opened != tt.value {
+				t.Fatalf("got %q, want %q", opened, tt.value)
+			}
+		})
+	}
+}
+
+func TestSealingIsRandomised(t *testing.T) {
+	c := newCipher(t, 1, 1)
+	a, err := c.Encrypt("value", "table.column")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := c.Encrypt("value", "table.column")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Fatal("the same value was sealed the same twice")
+	}
+}
+
+func TestDecryptRejects(t *testing.T) {
+	c := newCipher(t, 1, 1)
+	sealed, err := c.Encrypt("secret", "table.column")
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, data, _ := strings.Cut(strings.TrimPrefix(sealed, "enc:v"), ":")
+	raw, err := base64.RawStdEncoding.DecodeString(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tamper := func(i int) string {
+		b := bytes.Clone(raw)
+		b[i] ^= 1
+		return "enc:v" + version + ":" + base64.RawStdEncoding.EncodeToString(b)
+	}
+	tests := []struct {
+		name    string
+		value   string
+		field   string
+		wantErr error
+	}{
+		{name: "wrong field", value: sealed, field: "table.other", wantErr: fieldcrypt.ErrMalformed},
+		{name: "tampered data key", value: tamper(20), field: "table.column", wantErr: fieldcrypt.ErrMalformed},
+		{name: "tampered ciphertext", value: tamper(len(raw) - 20), field: "table.column", wantErr: fieldcrypt.ErrMalformed},
+		{name: "tampered tag", value: tamper(len(raw) - 1), field: "table.column", wantErr: fieldcrypt.ErrMalformed},
+		{name: "truncated", value: sealed[:len(sealed)-8], field: "table.column", wantErr: fieldcrypt.ErrMalformed},
+		{name: "bad base64", value: "enc:v1:!!!", field: "table.column", wantErr: fieldcrypt.ErrMalformed},
+		{name: "no version", value: "enc:vx", field: "table.column", wantErr: fieldcrypt.ErrMalformed},
+		{name: "unknown key", value: "enc:v9:" + data, field: "table.column", wantErr: fieldcrypt.ErrUnknownKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := c.Decrypt(tt.value, tt.field); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRotation(t *testing.T) {
+	before := newCipher(t, 1, 1)
+	sealed, err := before.Encrypt("secret", "table.column")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after := newCipher(t, 2, 1, 2)
+	opened, err := after.Decrypt(sealed, "table.column")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened != "secret" {
+		t.Fatalf("got %q, want %q", opened, "secret")
+	}
+	prefix, err := after.CurrentPrefix()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prefix != "enc:v2:" || strings.HasPrefix(sealed, prefix) {
+		t.Fatalf("got prefix %q for a value sealed as %q", prefix, sealed)
+	}
+	resealed, err := after.Encrypt(opened, "table.column")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(resealed, prefix) {
+		t.Fatalf("value sealed after rotation as %q, want prefix %q", resealed, prefix)
+	}
+
+	retired := newCipher(t, 2, 2)
+	if _, err := retired.Decrypt(sealed, "table.column"); !errors.Is(err, fieldcrypt.ErrUnknownKey) {
+		t.Fatalf("got %v, want %v once the key is dropped", err, fieldcrypt.ErrUnknownKey)
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	c := newCipher(t, 1, 1)
+	rotated := newCipher(t, 2, 1, 2)
+	index := func(c *fieldcrypt.Cipher, value, field string) string {
+		t.Helper()
+		idx, err := c.BlindIndex(value, field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return idx
+	}
+
+	a := index(c, "consent-1", "table.column")
+	if a == "" || a != index(c, "consent-1", "table.column") {
+		t.Fatal("index is not deterministic")
+	}
+	if a != index(rotated, "consent-1", "table.column") {
+		t.Fatal("index changed with the key encryption key")
+	}
+	if a == index(c, "consent-2", "table.column") {
+		t.Fatal("different values share an index")
+	}
+	if a == index(c, "consent-1", "table.other") {
+		t.Fatal("different fields share an index")
+	}
+	if got := index(c, "", "table.column"); got != "" {
+		t.Fatalf("got %q for an empty value, want empty", got)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	var c *fieldcrypt.Cipher
+	sealed, err := c.Encrypt("plain", "table.column")
+	if err != nil || sealed != "plain" {
+		t.Fatalf("got %q, %v, want the value in plaintext", sealed, err)
+	}
+	if opened, err := c.Decrypt("plain", "table.column"); err != nil || opened != "plain" {
+		t.Fatalf("got %q, %v, want the value as is", opened, err)
+	}
+	if _, err := c.Decrypt("enc:v1:AAAA", "table.column"); !errors.Is(err, fieldcrypt.ErrDisabled) {
+		t.Fatalf("got %v, want %v", err, fieldcrypt.ErrDisabled)
+	}
+	if idx, err := c.BlindIndex("plain", "table.column"); err != nil || idx != "" {
+		t.Fatalf("got %q, %v, want no index", idx, err)
+	}
+}
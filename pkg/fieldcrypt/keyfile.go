@@ -0,0 +1,123 @@
+package fieldcrypt
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.yaml.in/yaml/v3"
+)
+
+const keySize = 32
+
+// ErrUnknownKey is returned for a key version the provider does not hold.
+var ErrUnknownKey = errors.New("unknown encryption key version")
+
+// Key is a key encryption key. Versions are assigned by the operator and
+// never reused, so that a value sealed with a key can always name it.
+type Key struct {
+	Version  uint32
+	Material []byte
+}
+
+// KeyProvider holds the key encryption keys and the blind index key.
+type KeyProvider interface {
+	// CurrentKey returns the key new values are sealed with.
+	CurrentKey() (Key, error)
+	// Key returns the key of version, which may be retired but still
+	// needed to open values sealed before a rotation.
+	Key(version uint32) (Key, error)
+	// IndexKey returns the key blind indexes are computed with. It is not
+	// rotated, as indexes can only be recomputed from the plaintext.
+	IndexKey() ([]byte, error)
+}
+
+// KeyFile is a KeyProvider reading its keys from a local YAML file:
+//
+//	current: 2
+//	index_key: <base64 of 32 bytes>
+//	keys:
+//	  - version: 1
+//	    key: <base64 of 32 bytes>
+//	  - version: 2
+//	    key: <base64 of 32 bytes>
+//
+// Keys are rotated by adding a version, making it current and restarting;
+// retired versions must stay in the file until nothing is sealed with them.
+type KeyFile struct {
+	current  uint32
+	keys     map[uint32][]byte
+	indexKey []byte
+}
+
+type keyFile struct {
+	Current  uint32 `yaml:"current"`
+	IndexKey string `yaml:"index_key"`
+	Keys     []struct {
+		Version uint32 `yaml:"version"`
+		Key     string `yaml:"key"`
+	} `yaml:"keys"`
+}
+
+func NewKeyFile(path string) (*KeyFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file keyFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("key file %s: %w", path, err)
+	}
+	kf := &KeyFile{
+		current: file.Current,
+		keys:    make(map[uint32][]byte, len(file.Keys)),
+	}
+	if kf.indexKey, err = decodeKey(file.IndexKey); err != nil {
+		return nil, fmt.Errorf("key file %s: index key: %w", path, err)
+	}
+	for _, key := range file.Keys {
+		if key.Version == 0 {
+			return nil, fmt.Errorf("key file %s: key version must be positive", path)
+		}
+		if _, ok := kf.keys[key.Version]; ok {
+			return nil, fmt.Errorf("key file %s: duplicate key version %d", path, key.Version)
+		}
+		material, err := decodeKey(key.Key)
+		if err != nil {
+			return nil, fmt.Errorf("key file %s: key version %d: %w", path, key.Version, err)
+		}
+		kf.keys[key.Version] = material
+	}
+	if _, ok := kf.keys[kf.current]; !ok {
+		return nil, fmt.Errorf("key file %s: current key version %d: %w", path, kf.current, ErrUnknownKey)
+	}
+	return kf, nil
+}
+
+func (kf *KeyFile) CurrentKey() (Key, error) {
+	return kf.Key(kf.current)
+}
+
+func (kf *KeyFile) Key(version uint32) (Key, error) {
+	material, ok := kf.keys[version]
+	if !ok {
+		return Key{}, fmt.Errorf("key version %d: %w", version, ErrUnknownKey)
+	}
+	return Key{Version: version, Material: material}, nil
+}
+
+func (kf *KeyFile) IndexKey() ([]byte, error) {
+	return kf.indexKey, nil
+}
+
+func decodeKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", keySize, len(key))
+	}
+	return key, nil
+}
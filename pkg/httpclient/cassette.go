@@ -0,0 +1,283 @@
+package httpclient
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const redacted = "REDACTED"
+
+var (
+	defaultRedactedHeaders     = []string{"Authorization", "Cookie", "Set-Cookie", "X-Consent-Id"}
+	defaultRedactedQueryParams = []string{"client_secret", "access_token", "client_id"}
+	defaultRedactedJSONFields  = []string{
+		"access_token", "refresh_token", "id_token", "client_secret",
+		"client_id", "clientId", "identification", "name",
+		"transactionInformation", "creditorAccount", "debtorAccount",
+	}
+	// defaultRedactedPathParams are path segments followed by an identifier,
+	// as in /accounts/{account_id}.
+	defaultRedactedPathParams = []string{"account-consents", "accounts", "payments"}
+	// defaultPathEndpoints follow path params without being identifiers, as in
+	// /account-consents/request.
+	defaultPathEndpoints = []string{"request"}
+	// defaultPseudonymizedJSONFields hold the identifiers that also appear in
+	// paths, so they are replaced the same way.
+	defaultPseudonymizedJSONFields = []string{"consentId", "accountId", "paymentId"}
+	// defaultIgnoredQueryParams change from one run to the next, such as the
+	// booking dates computed from the current time.
+	defaultIgnoredQueryParams = []string{"from_booking_date_time", "to_booking_date_time"}
+)
+
+// Cassette is a recorded sequence of bank API interactions.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+func loadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err = json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (c *Cassette) save(path string) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(c); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// redactor strips tokens and personal data before anything reaches a cassette.
+// Requests are redacted the same way on replay so they can be matched.
+// Identifiers are replaced by pseudonyms rather than blanked, so that requests
+// for different accounts stay apart and an identifier read from a replayed
+// body leads to the recorded requests for it.
+type redactor struct {
+	headers       map[string]struct{}
+	queryParams   map[string]struct{}
+	jsonFields    map[string]struct{}
+	pathParams    map[string]struct{}
+	pathEndpoints map[string]struct{}
+	idFields      map[string]struct{}
+}
+
+func newRedactor(cfg Redact) *redactor {
+	r := &redactor{
+		headers:       make(map[string]struct{}),
+		queryParams:   make(map[string]struct{}),
+		jsonFields:    make(map[string]struct{}),
+		pathParams:    make(map[string]struct{}),
+		pathEndpoints: make(map[string]struct{}),
+		idFields:      make(map[string]struct{}),
+	}
+	for _, h := range append(defaultRedactedHeaders, cfg.Headers...) {
+		r.headers[http.CanonicalHeaderKey(h)] = struct{}{}
+	}
+	for _, q := range append(defaultRedactedQueryParams, cfg.QueryParams...) {
+		r.queryParams[q] = struct{}{}
+	}
+	for _, f := range append(defaultRedactedJSONFields, cfg.JSONFields...) {
+		r.jsonFields[strings.ToLower(f)] = struct{}{}
+	}
+	for _, p := range append(defaultRedactedPathParams, cfg.PathParams...) {
+		r.pathParams[p] = struct{}{}
+	}
+	for _, e := range defaultPathEndpoints {
+		r.pathEndpoints[e] = struct{}{}
+	}
+	for _, f := range append(defaultPseudonymizedJSONFields, cfg.IDFields...) {
+		r.idFields[strings.ToLower(f)] = struct{}{}
+	}
+	return r
+}
+
+func (r *redactor) request(req *http.Request, body []byte) RecordedRequest {
+	return RecordedRequest{
+		Method:  req.Method,
+		URL:     r.url(req.URL),
+		Headers: r.header(req.Header),
+		Body:    r.body(body),
+	}
+}
+
+func (r *redactor) url(u *url.URL) string {
+	cp := *u
+	q := cp.Query()
+	for name := range q {
+		if _, ok := r.queryParams[name]; ok {
+			q.Set(name, redacted)
+		}
+	}
+	cp.RawQuery = q.Encode()
+	cp.Path = r.path(cp.Path)
+	cp.RawPath = ""
+	return cp.String()
+}
+
+// path replaces the identifiers following path params.
+func (r *redactor) path(p string) string {
+	segments := strings.Split(p, "/")
+	for i := 1; i < len(segments); i++ {
+		if _, ok := r.pathParams[segments[i-1]]; !ok {
+			continue
+		}
+		if _, ok := r.pathEndpoints[segments[i]]; ok || segments[i] == "" {
+			continue
+		}
+		segments[i] = pseudonym(segments[i])
+	}
+	return strings.Join(segments, "/")
+}
+
+// pseudonym replaces id with a digest of it. Pseudonyms are kept as they are,
+// so that redacting a replayed identifier again gives the recorded one.
+func pseudonym(id string) string {
+	if strings.HasPrefix(id, redacted+"-") {
+		return id
+	}
+	sum := sha256.Sum256([]byte(id))
+	return redacted + "-" + hex.EncodeToString(sum[:8])
+}
+
+func (r *redactor) header(h http.Header) http.Header {
+	if len(h) == 0 {
+		return nil
+	}
+	res := h.Clone()
+	for name := range res {
+		if _, ok := r.headers[name]; ok {
+			res.Set(name, redacted)
+		}
+	}
+	return res
+}
+
+func (r *redactor) body(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	// Numbers are kept as written, amounts such as 1234.50 would not survive
+	// a float64.
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return string(body)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(r.json(v)); err != nil {
+		return string(body)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func (r *redactor) json(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, field := range val {
+			if _, ok := r.jsonFields[strings.ToLower(k)]; ok {
+				val[k] = redactAll(field)
+				continue
+			}
+			if id, ok := field.(string); ok && id != "" {
+				if _, ok = r.idFields[strings.ToLower(k)]; ok {
+					val[k] = pseudonym(id)
+					continue
+				}
+			}
+			val[k] = r.json(field)
+		}
+		return val
+	case []any:
+		for i, item := range val {
+			val[i] = r.json(item)
+		}
+		return val
+	case string:
+		// Links such as /accounts/{account_id}/balances carry identifiers too.
+		if strings.HasPrefix(val, "/") {
+			return r.path(val)
+		}
+		return val
+	default:
+		return v
+	}
+}
+
+// redactAll replaces every string within v, keeping objects and arrays in
+// place so that replayed payloads still decode.
+func redactAll(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, field := range val {
+			val[k] = redactAll(field)
+		}
+		return val
+	case []any:
+		for i, item := range val {
+			val[i] = redactAll(item)
+		}
+		return val
+	case string:
+		return redacted
+	default:
+		return v
+	}
+}
+
+func readBody(body io.ReadCloser) ([]byte, io.ReadCloser, error) {
+	if body == nil || body == http.NoBody {
+		return nil, http.NoBody, nil
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, io.NopCloser(bytes.NewReader(data)), nil
+}
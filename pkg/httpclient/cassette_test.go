@@ -0,0 +1,108 @@
+package httpclient_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MichaelSBoop/lima-backend/pkg/httpclient"
+)
+
+// bank answers like the sandbox, echoing the account id of the path.
+func bank(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /accounts", func(w http.ResponseWriter, _ *http.Request) {
+		io.WriteString(w, `{"data":{"account":[{"accountId":"vbank-team-1-acc-1"},{"accountId":"vbank-team-1-acc-2"}]},"links":{"self":"/accounts"}}`)
+	})
+	mux.HandleFunc("GET /accounts/{id}/balances", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		amount := map[string]string{"vbank-team-1-acc-1": "1234.50", "vbank-team-1-acc-2": "12345678901234567.10"}[id]
+		io.WriteString(w, `{"data":{"balance":[{"accountId":"`+id+`","amount":{"amount":`+amount+`,"currency":"RUB"}}]},"links":{"self":"/accounts/`+id+`/balances"}}`)
+	})
+	mux.HandleFunc("GET /account-consents/{id}", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data":{"consentId":"`+r.PathValue("id")+`","status":"Authorised"}}`)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func get(t *testing.T, client *http.Client, url string) string {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read %s: %v", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: status %d", url, resp.StatusCode)
+	}
+	return string(body)
+}
+
+func TestRecordRedactsIdentifiers(t *testing.T) {
+	srv := bank(t)
+	cassette := filepath.Join(t.TempDir(), "cassette.json")
+	recorder, err := httpclient.New(httpclient.Config{Mode: httpclient.ModeRecord, Cassette: cassette})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	get(t, recorder, srv.URL+"/accounts")
+	get(t, recorder, srv.URL+"/accounts/vbank-team-1-acc-1/balances")
+	get(t, recorder, srv.URL+"/accounts/vbank-team-1-acc-2/balances")
+	get(t, recorder, srv.URL+"/account-consents/consent-671ed526")
+
+	data, err := os.ReadFile(cassette)
+	if err != nil {
+		t.Fatalf("read cassette: %v", err)
+	}
+	for _, id := range []string{"vbank-team-1-acc-1", "vbank-team-1-acc-2", "consent-671ed526"} {
+		if strings.Contains(string(data), id) {
+			t.Errorf("cassette contains %s", id)
+		}
+	}
+	for _, amount := range []string{"1234.50", "12345678901234567.10"} {
+		if !strings.Contains(string(data), amount) {
+			t.Errorf("cassette lost amount %s", amount)
+		}
+	}
+
+	replayer, err := httpclient.New(httpclient.Config{Mode: httpclient.ModeReplay, Cassette: cassette})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	var accounts struct {
+		Data struct {
+			Account []struct {
+				AccountID string `json:"accountId"`
+			} `json:"account"`
+		} `json:"data"`
+	}
+	if err = json.Unmarshal([]byte(get(t, replayer, srv.URL+"/accounts")), &accounts); err != nil {
+		t.Fatalf("decode accounts: %v", err)
+	}
+	if len(accounts.Data.Account) != 2 {
+		t.Fatalf("got %d accounts, want 2", len(accounts.Data.Account))
+	}
+	// The replayed ids lead to the balances recorded for the real ones.
+	for i, want := range []string{"1234.50", "12345678901234567.10"} {
+		id := accounts.Data.Account[i].AccountID
+		body := get(t, replayer, srv.URL+"/accounts/"+id+"/balances")
+		if !strings.Contains(body, `"amount":`+want) {
+			t.Errorf("balances of account %d = %s, want amount %s", i, body, want)
+		}
+		if !strings.Contains(body, `"self":"/accounts/`+id+`/balances"`) {
+			t.Errorf("balances of account %d link to another account: %s", i, body)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package httpclient
+
+import "time"
+
+const (
+	ModeLive   = "live"
+	ModeRecord = "record"
+	ModeReplay = "replay"
+)
+
+type Config struct {
+	Timeout time.Duration `json:"timeout" yaml:"timeout"`
+	// Mode is live, record or replay. Record and replay read and write Cassette.
+	Mode     string `json:"mode" yaml:"mode"`
+	Cassette string `json:"cassette" yaml:"cassette"`
+	Redact   Redact `json:"redact" yaml:"redact"`
+	// IgnoreQueryParams are left out when matching replayed requests to the
+	// cassette, in addition to the booking dates.
+	IgnoreQueryParams []string `json:"ignore_query_params" yaml:"ignore_query_params"`
+}
+
+// Redact lists values stripped from recorded interactions in addition to the defaults.
+type Redact struct {
+	Headers     []string `json:"headers" yaml:"headers"`
+	QueryParams []string `json:"query_params" yaml:"query_params"`
+	JSONFields  []string `json:"json_fields" yaml:"json_fields"`
+	// PathParams are path segments followed by an identifier, such as
+	// accounts in /accounts/{account_id}. The identifiers are replaced by
+	// pseudonyms, as are the values of IDFields.
+	PathParams []string `json:"path_params" yaml:"path_params"`
+	IDFields   []string `json:"id_fields" yaml:"id_fields"`
+}
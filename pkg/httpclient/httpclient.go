@@ -1,9 +1,33 @@
 package httpclient
 
 import (
+	"errors"
 	"net/http"
 )
 
-func Client() *http.Client {
-	return http.DefaultClient
+var ErrUnknownMode = errors.New("unknown http client mode")
+
+func New(cfg Config) (*http.Client, error) {
+	cl := &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: http.DefaultTransport,
+	}
+	switch cfg.Mode {
+	case "", ModeLive:
+	case ModeRecord:
+		recorder, err := newRecorder(cfg.Cassette, newRedactor(cfg.Redact), http.DefaultTransport)
+		if err != nil {
+			return nil, err
+		}
+		cl.Transport = recorder
+	case ModeReplay:
+		replayer, err := newReplayer(cfg.Cassette, newRedactor(cfg.Redact), cfg.IgnoreQueryParams)
+		if err != nil {
+			return nil, err
+		}
+		cl.Transport = replayer
+	default:
+		return nil, ErrUnknownMode
+	}
+	return cl, nil
 }
@@ -0,0 +1,161 @@
+package httpclient
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+var ErrInteractionNotFound = errors.New("no recorded interaction matches request")
+
+// recorder is a transport that performs requests with next and appends
+// every redacted interaction to the cassette file.
+type recorder struct {
+	mu       sync.Mutex
+	path     string
+	cassette *Cassette
+	redactor *redactor
+	next     http.RoundTripper
+}
+
+// newRecorder appends to the cassette at path, starting a new one if there is
+// none yet. A cassette that cannot be loaded is an error rather than being
+// overwritten.
+func newRecorder(path string, redactor *redactor, next http.RoundTripper) (*recorder, error) {
+	cassette, err := loadCassette(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		cassette, err = &Cassette{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load cassette: %w", err)
+	}
+	return &recorder{
+		path:     path,
+		cassette: cassette,
+		redactor: redactor,
+		next:     next,
+	}, nil
+}
+
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, body, err := readBody(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.Body = body
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, body, err := readBody(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = body
+
+	interaction := Interaction{
+		Request: r.redactor.request(req, reqBody),
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Headers:    r.redactor.header(resp.Header),
+			Body:       r.redactor.body(respBody),
+		},
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	if err = r.cassette.save(r.path); err != nil {
+		return nil, fmt.Errorf("save cassette: %w", err)
+	}
+	return resp, nil
+}
+
+// replayer is a transport that answers requests from a cassette without
+// touching the network. Identical requests are answered in recorded order,
+// the last answer is repeated once they run out. Ignored query parameters do
+// not take part in telling requests apart.
+type replayer struct {
+	mu       sync.Mutex
+	redactor *redactor
+	ignored  map[string]struct{}
+	queues   map[string][]RecordedResponse
+	last     map[string]RecordedResponse
+}
+
+func newReplayer(path string, redactor *redactor, ignoreQueryParams []string) (*replayer, error) {
+	cassette, err := loadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &replayer{
+		redactor: redactor,
+		ignored:  make(map[string]struct{}),
+		queues:   make(map[string][]RecordedResponse),
+		last:     make(map[string]RecordedResponse),
+	}
+	for _, name := range append(defaultIgnoredQueryParams, ignoreQueryParams...) {
+		r.ignored[name] = struct{}{}
+	}
+	for _, interaction := range cassette.Interactions {
+		key := r.key(interaction.Request)
+		r.queues[key] = append(r.queues[key], interaction.Response)
+	}
+	return r, nil
+}
+
+func (r *replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, _, err := readBody(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	recorded := r.redactor.request(req, reqBody)
+	key := r.key(recorded)
+
+	r.mu.Lock()
+	resp, ok := r.last[key]
+	if queue := r.queues[key]; len(queue) > 0 {
+		resp, ok = queue[0], true
+		r.queues[key] = queue[1:]
+		r.last[key] = resp
+	}
+	r.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s %s", ErrInteractionNotFound, recorded.Method, recorded.URL)
+	}
+
+	header := resp.Headers.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode)),
+		StatusCode:    resp.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewBufferString(resp.Body)),
+		ContentLength: int64(len(resp.Body)),
+		Request:       req,
+	}, nil
+}
+
+// key identifies the request by method, URL without the ignored query
+// parameters, and body.
+func (r *replayer) key(req RecordedRequest) string {
+	target := req.URL
+	if u, err := url.Parse(req.URL); err == nil {
+		q := u.Query()
+		for name := range r.ignored {
+			q.Del(name)
+		}
+		u.RawQuery = q.Encode()
+		target = u.String()
+	}
+	return req.Method + " " + target + "\n" + req.Body
+}
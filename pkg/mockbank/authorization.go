@@ -0,0 +1,101 @@
+package mockbank
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+
+	"github.com/google/uuid"
+)
+
+// authCode is an authorisation code issued on the approval page, bound to
+// the PKCE challenge and redirect URI it was requested with.
+type authCode struct {
+	bank          string
+	consentID     string
+	redirectURI   string
+	codeChallenge string
+}
+
+// handleAuthorize stands in for the approval page of the bank. The client is
+// assumed to approve unless decision=deny; either way the browser is sent
+// back to redirect_uri with the state.
+func (s *Server) handleAuthorize(bank string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		redirectURI, err := url.Parse(q.Get("redirect_uri"))
+		if err != nil || !redirectURI.IsAbs() {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "absolute redirect_uri is required")
+			return
+		}
+		if q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256" {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "S256 code_challenge is required")
+			return
+		}
+		c, ok := s.consent(bank, q.Get("consent_id"))
+		if !ok {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "consent not found")
+			return
+		}
+		back := redirectURI.Query()
+		back.Set("state", q.Get("state"))
+		switch {
+		case c.Status != "pending":
+			back.Set("error", "invalid_request")
+		case q.Get("decision") == "deny":
+			s.SetConsentStatus(c.ConsentID, "rejected")
+			back.Set("error", "access_denied")
+		default:
+			code := uuid.NewString()
+			s.mu.Lock()
+			s.codes[code] = authCode{
+				bank:          bank,
+				consentID:     c.ConsentID,
+				redirectURI:   redirectURI.String(),
+				codeChallenge: q.Get("code_challenge"),
+			}
+			s.mu.Unlock()
+			back.Set("code", code)
+		}
+		redirectURI.RawQuery = back.Encode()
+		http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+	}
+}
+
+// handleConsentToken exchanges an authorisation code and its PKCE verifier
+// for the approved consent. A code can be used once.
+func (s *Server) handleConsentToken(bank string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+			return
+		}
+		if r.PostForm.Get("grant_type") != "authorization_code" {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "unsupported grant_type")
+			return
+		}
+		s.mu.Lock()
+		code, ok := s.codes[r.PostForm.Get("code")]
+		delete(s.codes, r.PostForm.Get("code"))
+		s.mu.Unlock()
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || code.bank != bank ||
+			code.redirectURI != r.PostForm.Get("redirect_uri") ||
+			code.codeChallenge != base64.RawURLEncoding.EncodeToString(sum[:]) {
+			writeError(w, http.StatusBadRequest, "INVALID_GRANT", "invalid authorization code")
+			return
+		}
+		s.SetConsentStatus(code.consentID, "approved")
+		c, _ := s.consent(bank, code.consentID)
+		writeJSON(w, http.StatusOK, map[string]any{
+			"request_id":    uuid.NewString(),
+			"consent_id":    c.ConsentID,
+			"status":        c.Status,
+			"auto_approved": false,
+			"message":       "consent " + c.Status,
+			"created_at":    c.CreationDateTime,
+			"expires_at":    c.ExpirationDateTime,
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package mockbank
+
+import "time"
+
+const (
+	ConsentModeApprove = "approve"
+	ConsentModePending = "pending"
+	ConsentModeReject  = "reject"
+)
+
+type Config struct {
+	// Banks served by the mock, each under its own path prefix, e.g. /vbank.
+	Banks []string `json:"banks" yaml:"banks"`
+	// ConsentMode decides the status of newly requested account consents.
+	ConsentMode string `json:"consent_mode" yaml:"consent_mode"`
+	// ConsentTTL is how long new account consents stay valid.
+	ConsentTTL time.Duration `json:"consent_ttl" yaml:"consent_ttl"`
+	// Seed makes generated fixture data reproducible.
+	Seed  uint64 `json:"seed" yaml:"seed"`
+	Fault Fault  `json:"fault" yaml:"fault"`
+}
+
+// Fault configures injected failures. Rates are probabilities in [0, 1].
+type Fault struct {
+	Latency       time.Duration `json:"latency" yaml:"latency"`
+	ErrorRate     float64       `json:"error_rate" yaml:"error_rate"`
+	RateLimitRate float64       `json:"rate_limit_rate" yaml:"rate_limit_rate"`
+	MalformedRate float64       `json:"malformed_rate" yaml:"malformed_rate"`
+}
+
+const defaultConsentTTL = 90 * 24 * time.Hour
+
+func DefaultConfig() Config {
+	return Config{
+		Banks:       []string{"vbank", "sbank", "abank"},
+		ConsentMode: ConsentModeApprove,
+		ConsentTTL:  defaultConsentTTL,
+		Seed:        1,
+	}
+}
@@ -0,0 +1,266 @@
+package mockbank
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"time"
+)
+
+const historyDays = 120
+
+type amount struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+type accountIdentification struct {
+	SchemeName     string `json:"schemeName"`
+	Identification string `json:"identification"`
+	Name           string `json:"name,omitempty"`
+}
+
+type account struct {
+	AccountID      string                  `json:"accountId"`
+	Status         string                  `json:"status"`
+	Currency       string                  `json:"currency"`
+	AccountType    string                  `json:"accountType"`
+	AccountSubType string                  `json:"accountSubType"`
+	Nickname       string                  `json:"nickname"`
+	OpeningDate    string                  `json:"openingDate"`
+	Servicer       string                  `json:"servicer"`
+	Account        []accountIdentification `json:"account"`
+}
+
+type balance struct {
+	AccountID            string `json:"accountId"`
+	Type                 string `json:"type"`
+	DateTime             string `json:"dateTime"`
+	Amount               amount `json:"amount"`
+	CreditDebitIndicator string `json:"creditDebitIndicator"`
+}
+
+type merchant struct {
+	Name                 string `json:"name"`
+	MerchantCategoryCode string `json:"merchantCategoryCode"`
+}
+
+type transaction struct {
+	AccountID              string                 `json:"accountId"`
+	TransactionID          string                 `json:"transactionId"`
+	CreditDebitIndicator   string                 `json:"creditDebitIndicator"`
+	Status                 string                 `json:"status"`
+	BookingDateTime        string                 `json:"bookingDateTime"`
+	ValueDateTime          string                 `json:"valueDateTime"`
+	Amount                 amount                 `json:"amount"`
+	TransactionInformation string                 `json:"transactionInformation"`
+	Merchant               *merchant              `json:"merchant,omitempty"`
+	CreditorAccount        *accountIdentification `json:"creditorAccount,omitempty"`
+	DebtorAccount          *accountIdentification `json:"debtorAccount,omitempty"`
+
+	booked time.Time
+	minor  int64
+}
+
+// clientData is the generated, immutable history of one client at one bank.
+type clientData struct {
+	accounts     []account
+	balances     map[string]balance
+	transactions map[string][]transaction
+}
+
+type spend struct {
+	merchant merchant
+	min, max int64
+	perMonth int
+}
+
+var everydaySpends = []spend{
+	{merchant{"Pyaterochka", "5411"}, 300, 3500, 8},
+	{merchant{"Perekrestok", "5411"}, 500, 6000, 4},
+	{merchant{"Yandex Taxi", "4121"}, 250, 1500, 5},
+	{merchant{"Moscow Metro", "4111"}, 62, 62, 20},
+	{merchant{"Coffee House", "5814"}, 180, 650, 6},
+	{merchant{"Ozon", "5399"}, 400, 12000, 2},
+	{merchant{"Rigla Pharmacy", "5912"}, 200, 2500, 1},
+}
+
+type subscription struct {
+	merchant merchant
+	minor    int64
+	day      int
+}
+
+var subscriptions = []subscription{
+	{merchant{"Netflix", "4899"}, 79900, 3},
+	{merchant{"Yandex Plus", "4899"}, 29900, 12},
+	{merchant{"MTS Mobile", "4814"}, 65000, 20},
+	{merchant{"World Class Fitness", "7997"}, 450000, 1},
+}
+
+// generate builds deterministic fixture data for a client at a bank.
+// Transfers between the client's own accounts are mirrored across banks, so
+// the debit at one bank has a matching credit at the next one.
+func generate(seed uint64, banks []string, bank, clientID string, now time.Time) *clientData {
+	rnd := rand.New(rand.NewPCG(seed, hash(bank, clientID)))
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	start := today.AddDate(0, 0, -historyDays)
+
+	data := &clientData{
+		balances:     make(map[string]balance),
+		transactions: make(map[string][]transaction),
+	}
+
+	current := account{
+		AccountID:      accountID(bank, clientID, 0),
+		Status:         "Enabled",
+		Currency:       "RUB",
+		AccountType:    "Personal",
+		AccountSubType: "CurrentAccount",
+		Nickname:       bank + " current",
+		OpeningDate:    start.AddDate(-2, 0, 0).Format(time.DateOnly),
+		Servicer:       bank,
+		Account: []accountIdentification{{
+			SchemeName:     "RU.CBR.PAN",
+			Identification: pan(bank, clientID, 0),
+			Name:           clientID,
+		}},
+	}
+	savings := account{
+		AccountID:      accountID(bank, clientID, 1),
+		Status:         "Enabled",
+		Currency:       []string{"RUB", "USD", "EUR"}[rnd.IntN(3)],
+		AccountType:    "Personal",
+		AccountSubType: "Savings",
+		Nickname:       bank + " savings",
+		OpeningDate:    start.AddDate(-1, 0, 0).Format(time.DateOnly),
+		Servicer:       bank,
+		Account: []accountIdentification{{
+			SchemeName:     "RU.CBR.PAN",
+			Identification: pan(bank, clientID, 1),
+			Name:           clientID,
+		}},
+	}
+	data.accounts = []account{current, savings}
+
+	var txs []transaction
+	add := func(acc account, booked time.Time, minor int64, credit bool, info string, m *merchant, counterparty *accountIdentification) {
+		tx := transaction{
+			AccountID:              acc.AccountID,
+			TransactionID:          fmt.Sprintf("%s-tx-%d", acc.AccountID, len(txs)+1),
+			CreditDebitIndicator:   "Debit",
+			Status:                 "Booked",
+			BookingDateTime:        booked.Format(time.RFC3339),
+			ValueDateTime:          booked.Format(time.RFC3339),
+			Amount:                 amount{Amount: formatMinor(minor), Currency: acc.Currency},
+			TransactionInformation: info,
+			Merchant:               m,
+			booked:                 booked,
+			minor:                  minor,
+		}
+		if credit {
+			tx.CreditDebitIndicator = "Credit"
+			tx.DebtorAccount = counterparty
+		} else {
+			tx.CreditorAccount = counterparty
+		}
+		txs = append(txs, tx)
+	}
+
+	for day := start; day.Before(today); day = day.AddDate(0, 0, 1) {
+		at := func() time.Time {
+			return day.Add(time.Duration(8+rnd.IntN(14))*time.Hour + time.Duration(rnd.IntN(60))*time.Minute)
+		}
+		if day.Day() == 5 && bank == banks[0] {
+			employer := &accountIdentification{SchemeName: "RU.CBR.PAN", Identification: "40702810900000012345", Name: "OOO Romashka"}
+			add(current, at(), 15000000, true, "Salary", nil, employer)
+		}
+		for _, sub := range subscriptions {
+			if day.Day() == sub.day && hash(bank, sub.merchant.Name)%uint64(len(banks)) == hash(clientID)%uint64(len(banks)) {
+				m := sub.merchant
+				add(current, at(), sub.minor, false, m.Name, &m, nil)
+			}
+		}
+		for _, sp := range everydaySpends {
+			if rnd.IntN(30) >= sp.perMonth {
+				continue
+			}
+			m := sp.merchant
+			minor := (sp.min + rnd.Int64N(sp.max-sp.min+1)) * 100
+			add(current, at(), minor, false, m.Name, &m, nil)
+		}
+		if day.Day() == 10 && len(banks) > 1 {
+			idx := slices.Index(banks, bank)
+			next := banks[(idx+1)%len(banks)]
+			prev := banks[(idx+len(banks)-1)%len(banks)]
+			transfer := 2000000 + int64(hash(clientID, day.Format(time.DateOnly))%10)*100000
+			if idx >= 0 {
+				to := &accountIdentification{SchemeName: "RU.CBR.PAN", Identification: pan(next, clientID, 0), Name: clientID}
+				add(current, day.Add(11*time.Hour), transfer, false, "Transfer between own accounts", nil, to)
+				from := &accountIdentification{SchemeName: "RU.CBR.PAN", Identification: pan(prev, clientID, 0), Name: clientID}
+				add(current, day.Add(11*time.Hour+2*time.Minute), transfer, true, "Transfer between own accounts", nil, from)
+			}
+		}
+		if day.Day() == 25 && savings.Currency == "RUB" {
+			add(savings, day.Add(9*time.Hour), 500000+rnd.Int64N(10)*100000, true, "Savings top-up", nil, nil)
+		}
+	}
+
+	sort.SliceStable(txs, func(i, j int) bool { return txs[i].booked.Before(txs[j].booked) })
+
+	opening := map[string]int64{
+		current.AccountID: 5000000 + rnd.Int64N(100)*10000,
+		savings.AccountID: 10000000 + rnd.Int64N(100)*100000,
+	}
+	closing := map[string]int64{}
+	for id, v := range opening {
+		closing[id] = v
+	}
+	for _, tx := range txs {
+		if tx.CreditDebitIndicator == "Credit" {
+			closing[tx.AccountID] += tx.minor
+		} else {
+			closing[tx.AccountID] -= tx.minor
+		}
+		data.transactions[tx.AccountID] = append(data.transactions[tx.AccountID], tx)
+	}
+	for _, acc := range data.accounts {
+		indicator := "Credit"
+		v := closing[acc.AccountID]
+		if v < 0 {
+			indicator = "Debit"
+			v = -v
+		}
+		data.balances[acc.AccountID] = balance{
+			AccountID:            acc.AccountID,
+			Type:                 "InterimAvailable",
+			DateTime:             today.Format(time.RFC3339),
+			Amount:               amount{Amount: formatMinor(v), Currency: acc.Currency},
+			CreditDebitIndicator: indicator,
+		}
+	}
+	return data
+}
+
+func accountID(bank, clientID string, idx int) string {
+	return fmt.Sprintf("%s-%s-acc-%d", bank, clientID, idx+1)
+}
+
+func pan(bank, clientID string, idx int) string {
+	return fmt.Sprintf("40817810%012d", (hash(bank, clientID)+uint64(idx))%1_000_000_000_000)
+}
+
+func formatMinor(v int64) string {
+	return fmt.Sprintf("%d.%02d", v/100, v%100)
+}
+
+func hash(parts ...string) uint64 {
+	h := fnv.New64a()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
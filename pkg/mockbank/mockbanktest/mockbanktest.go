@@ -0,0 +1,60 @@
+// Package mockbanktest runs the mock open banking server in-process for tests.
+package mockbanktest
+
+import (
+	"net/http/httptest"
+
+	"github.com/MichaelSBoop/lima-backend/internal/service/oauth"
+	"github.com/MichaelSBoop/lima-backend/internal/service/requester"
+	"github.com/MichaelSBoop/lima-backend/pkg/mockbank"
+)
+
+type Server struct {
+	*httptest.Server
+	Bank *mockbank.Server
+	cfg  mockbank.Config
+}
+
+// NewServer starts a mock bank server. Callers must Close it.
+func NewServer(cfg mockbank.Config) *Server {
+	if len(cfg.Banks) == 0 {
+		cfg.Banks = mockbank.DefaultConfig().Banks
+	}
+	bank := mockbank.New(cfg)
+	return &Server{
+		Server: httptest.NewServer(bank),
+		Bank:   bank,
+		cfg:    cfg,
+	}
+}
+
+// BaseURL returns the base URL of the given bank.
+func (s *Server) BaseURL(bank string) string {
+	return s.URL + "/" + bank
+}
+
+// RequesterConfig points the requester at every mocked bank.
+func (s *Server) RequesterConfig() requester.Config {
+	var cfg requester.Config
+	for _, bank := range s.cfg.Banks {
+		cfg.Banks = append(cfg.Banks, requester.Bank{Name: bank, BaseURL: s.BaseURL(bank)})
+	}
+	return cfg
+}
+
+// CBRBaseURL returns the base URL of the stubbed CBR daily rates.
+func (s *Server) CBRBaseURL() string {
+	return s.URL + "/cbr"
+}
+
+// OauthConfig points token requests at every mocked bank.
+func (s *Server) OauthConfig(clientID, clientSecret string) oauth.Config {
+	cfg := oauth.Config{ClientID: clientID, ClientSecret: clientSecret}
+	for _, bank := range s.cfg.Banks {
+		cfg.OauthProviders = append(cfg.OauthProviders, oauth.OauthProvider{
+			Name:    bank,
+			BaseURL: s.BaseURL(bank) + "/auth/bank-token",
+		})
+	}
+	return cfg
+}
@@ -0,0 +1,76 @@
+package mockbank
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type cbrValute struct {
+	ID       string  `json:"ID"`
+	NumCode  string  `json:"NumCode"`
+	CharCode string  `json:"CharCode"`
+	Nominal  int     `json:"Nominal"`
+	Name     string  `json:"Name"`
+	Value    float64 `json:"Value"`
+	Previous float64 `json:"Previous"`
+}
+
+var cbrCurrencies = []struct {
+	id, numCode, charCode, name string
+	nominal                     int
+	base                        float64
+}{
+	{"R01235", "840", "USD", "US Dollar", 1, 81.5},
+	{"R01239", "978", "EUR", "Euro", 1, 94.2},
+	{"R01375", "156", "CNY", "Chinese Yuan", 1, 11.4},
+	{"R01035", "826", "GBP", "British Pound", 1, 107.3},
+	{"R01820", "392", "JPY", "Japanese Yen", 100, 53.1},
+}
+
+// handleCBRDaily stubs the CBR daily rates in the cbr-xml-daily.ru format with
+// rates that drift deterministically from day to day.
+func (s *Server) handleCBRDaily() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		day := s.now().UTC()
+		if vars := mux.Vars(r); vars["year"] != "" {
+			t, err := time.Parse(time.DateOnly, vars["year"]+"-"+vars["month"]+"-"+vars["day"])
+			if err != nil {
+				writeError(w, http.StatusNotFound, "NOT_FOUND", "no rates for date")
+				return
+			}
+			day = t
+		}
+		if day.Weekday() == time.Sunday || day.Weekday() == time.Monday {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "no rates for date")
+			return
+		}
+		msk := time.FixedZone("MSK", 3*60*60)
+		date := time.Date(day.Year(), day.Month(), day.Day(), 11, 30, 0, 0, msk)
+		valute := make(map[string]cbrValute, len(cbrCurrencies))
+		for _, c := range cbrCurrencies {
+			valute[c.charCode] = cbrValute{
+				ID:       c.id,
+				NumCode:  c.numCode,
+				CharCode: c.charCode,
+				Nominal:  c.nominal,
+				Name:     c.name,
+				Value:    drift(c.base, date),
+				Previous: drift(c.base, date.AddDate(0, 0, -1)),
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"Date":         date.Format(time.RFC3339),
+			"PreviousDate": date.AddDate(0, 0, -1).Format(time.RFC3339),
+			"Timestamp":    date.Add(-4 * time.Hour).Format(time.RFC3339),
+			"Valute":       valute,
+		})
+	}
+}
+
+func drift(base float64, day time.Time) float64 {
+	d := float64(day.Unix()/86400) / 7
+	return math.Round(base*(1+0.03*math.Sin(d))*10000) / 10000
+}
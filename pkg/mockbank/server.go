@@ -0,0 +1,490 @@
+package mockbank
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// FaultHeader lets a single request force a fault regardless of configured rates.
+	FaultHeader = "X-Mock-Fault"
+
+	FaultError     = "error"
+	FaultRateLimit = "rate_limit"
+	FaultMalformed = "malformed"
+
+	interactionIDHeader = "X-Fapi-Interaction-Id"
+)
+
+// Server emulates the open banking sandbox of several banks. Each bank is
+// served under its own path prefix, so the base URL of vbank is <addr>/vbank.
+// CBR style daily exchange rates are served under /cbr.
+type Server struct {
+	cfg    Config
+	router *mux.Router
+	now    func() time.Time
+
+	mu       sync.Mutex
+	rnd      *rand.Rand
+	tokens   map[string]string
+	consents map[string]*consent
+	payments map[string]*payment
+	codes    map[string]authCode
+	data     map[string]*clientData
+}
+
+type consent struct {
+	ConsentID          string   `json:"consentId"`
+	Bank               string   `json:"-"`
+	ClientID           string   `json:"clientId"`
+	Status             string   `json:"status"`
+	Permissions        []string `json:"permissions"`
+	Reason             string   `json:"reason"`
+	RequestingBank     string   `json:"requestingBank"`
+	CreationDateTime   string   `json:"creationDateTime"`
+	StatusUpdateTime   string   `json:"statusUpdateDateTime"`
+	ExpirationDateTime string   `json:"expirationDateTime"`
+}
+
+type payment struct {
+	PaymentID        string          `json:"paymentId"`
+	Bank             string          `json:"-"`
+	Status           string          `json:"status"`
+	CreationDateTime string          `json:"creationDateTime"`
+	Initiation       json.RawMessage `json:"initiation"`
+}
+
+func New(cfg Config) *Server {
+	if len(cfg.Banks) == 0 {
+		cfg.Banks = DefaultConfig().Banks
+	}
+	if cfg.ConsentMode == "" {
+		cfg.ConsentMode = ConsentModeApprove
+	}
+	if cfg.ConsentTTL <= 0 {
+		cfg.ConsentTTL = defaultConsentTTL
+	}
+	s := &Server{
+		cfg:      cfg,
+		now:      time.Now,
+		rnd:      rand.New(rand.NewPCG(cfg.Seed, cfg.Seed)),
+		tokens:   make(map[string]string),
+		consents: make(map[string]*consent),
+		payments: make(map[string]*payment),
+		codes:    make(map[string]authCode),
+		data:     make(map[string]*clientData),
+	}
+	s.router = s.newRouter()
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
+
+// SetConsentStatus changes the status of an existing consent, e.g. to approve
+// a pending one from a test.
+func (s *Server) SetConsentStatus(consentID, status string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.consents[consentID]
+	if !ok {
+		return false
+	}
+	c.Status = status
+	c.StatusUpdateTime = s.now().UTC().Format(time.RFC3339)
+	return true
+}
+
+func (s *Server) newRouter() *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/cbr/daily_json.js", s.handleCBRDaily()).Methods(http.MethodGet)
+	r.HandleFunc("/cbr/archive/{year}/{month}/{day}/daily_json.js", s.handleCBRDaily()).Methods(http.MethodGet)
+	for _, bank := range s.cfg.Banks {
+		b := r.PathPrefix("/" + bank).Subrouter()
+		b.Use(s.faults)
+		b.HandleFunc("/auth/bank-token", s.handleToken(bank)).Methods(http.MethodPost)
+		b.HandleFunc("/oauth/authorize", s.handleAuthorize(bank)).Methods(http.MethodGet)
+
+		authed := b.NewRoute().Subrouter()
+		authed.Use(s.authorize(bank))
+		authed.HandleFunc("/account-consents/request", s.handleCreateConsent(bank)).Methods(http.MethodPost)
+		authed.HandleFunc("/account-consents/{consent_id}", s.handleGetConsent(bank)).Methods(http.MethodGet)
+		authed.HandleFunc("/oauth/consent-token", s.handleConsentToken(bank)).Methods(http.MethodPost)
+		authed.HandleFunc("/account-consents/{consent_id}", s.handleRevokeConsent(bank)).Methods(http.MethodDelete)
+		authed.HandleFunc("/accounts", s.handleAccounts(bank)).Methods(http.MethodGet)
+		authed.HandleFunc("/accounts/{account_id}", s.handleAccount(bank)).Methods(http.MethodGet)
+		authed.HandleFunc("/accounts/{account_id}/balances", s.handleBalances(bank)).Methods(http.MethodGet)
+		authed.HandleFunc("/accounts/{account_id}/transactions", s.handleTransactions(bank)).Methods(http.MethodGet)
+		authed.HandleFunc("/payments", s.handleCreatePayment(bank)).Methods(http.MethodPost)
+		authed.HandleFunc("/payments/{payment_id}", s.handleGetPayment(bank)).Methods(http.MethodGet)
+	}
+	return r
+}
+
+// faults injects latency and failures before the request reaches the handler.
+func (s *Server) faults(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		interactionID := r.Header.Get(interactionIDHeader)
+		if interactionID == "" {
+			interactionID = uuid.NewString()
+		}
+		w.Header().Set(interactionIDHeader, interactionID)
+
+		if s.cfg.Fault.Latency > 0 {
+			select {
+			case <-time.After(s.cfg.Fault.Latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		fault := r.Header.Get(FaultHeader)
+		if fault == "" {
+			fault = s.randomFault()
+		}
+		switch fault {
+		case FaultError:
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "injected server error")
+		case FaultRateLimit:
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusTooManyRequests, "TOO_MANY_REQUESTS", "injected rate limit")
+		case FaultMalformed:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`{"data": {"account": [{"accountId": `))
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+func (s *Server) randomFault() string {
+	f := s.cfg.Fault
+	if f.ErrorRate == 0 && f.RateLimitRate == 0 && f.MalformedRate == 0 {
+		return ""
+	}
+	s.mu.Lock()
+	p := s.rnd.Float64()
+	s.mu.Unlock()
+	switch {
+	case p < f.ErrorRate:
+		return FaultError
+	case p < f.ErrorRate+f.RateLimitRate:
+		return FaultRateLimit
+	case p < f.ErrorRate+f.RateLimitRate+f.MalformedRate:
+		return FaultMalformed
+	}
+	return ""
+}
+
+func (s *Server) authorize(bank string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			s.mu.Lock()
+			tokenBank, known := s.tokens[token]
+			s.mu.Unlock()
+			if !ok || !known || tokenBank != bank {
+				writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid or missing bank token")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (s *Server) handleToken(bank string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("client_id") == "" || q.Get("client_secret") == "" {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{
+				"error":             "invalid_client",
+				"error_description": "client_id and client_secret are required",
+			})
+			return
+		}
+		token := uuid.NewString()
+		s.mu.Lock()
+		s.tokens[token] = bank
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]any{
+			"access_token": token,
+			"token_type":   "bearer",
+			"expires_in":   86400,
+			"client_id":    q.Get("client_id"),
+		})
+	}
+}
+
+func (s *Server) handleCreateConsent(bank string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ClientID       string   `json:"client_id"`
+			Permissions    []string `json:"permissions"`
+			Reason         string   `json:"reason"`
+			RequestingBank string   `json:"requesting_bank"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+			return
+		}
+		if req.ClientID == "" {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "client_id is required")
+			return
+		}
+		status := "approved"
+		switch s.cfg.ConsentMode {
+		case ConsentModePending:
+			status = "pending"
+		case ConsentModeReject:
+			status = "rejected"
+		}
+		now := s.now().UTC()
+		c := &consent{
+			ConsentID:          "consent-" + uuid.NewString(),
+			Bank:               bank,
+			ClientID:           req.ClientID,
+			Status:             status,
+			Permissions:        req.Permissions,
+			Reason:             req.Reason,
+			RequestingBank:     req.RequestingBank,
+			CreationDateTime:   now.Format(time.RFC3339),
+			StatusUpdateTime:   now.Format(time.RFC3339),
+			ExpirationDateTime: now.Add(s.cfg.ConsentTTL).Format(time.RFC3339),
+		}
+		s.mu.Lock()
+		s.consents[c.ConsentID] = c
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]any{
+			"request_id":    uuid.NewString(),
+			"consent_id":    c.ConsentID,
+			"status":        c.Status,
+			"auto_approved": c.Status == "approved",
+			"message":       "consent " + c.Status,
+			"created_at":    c.CreationDateTime,
+			"expires_at":    c.ExpirationDateTime,
+		})
+	}
+}
+
+func (s *Server) handleGetConsent(bank string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, ok := s.consent(bank, mux.Vars(r)["consent_id"])
+		if !ok {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "consent not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"data": c})
+	}
+}
+
+func (s *Server) handleRevokeConsent(bank string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["consent_id"]
+		if _, ok := s.consent(bank, id); !ok {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "consent not found")
+			return
+		}
+		s.SetConsentStatus(id, "revoked")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) handleAccounts(bank string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, ok := s.clientData(w, r, bank)
+		if !ok {
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"data": map[string]any{"account": data.accounts},
+		})
+	}
+}
+
+func (s *Server) handleAccount(bank string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, ok := s.clientData(w, r, bank)
+		if !ok {
+			return
+		}
+		id := mux.Vars(r)["account_id"]
+		for _, acc := range data.accounts {
+			if acc.AccountID == id {
+				writeJSON(w, http.StatusOK, map[string]any{
+					"data": map[string]any{"account": []account{acc}},
+				})
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "account not found")
+	}
+}
+
+func (s *Server) handleBalances(bank string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, ok := s.clientData(w, r, bank)
+		if !ok {
+			return
+		}
+		b, ok := data.balances[mux.Vars(r)["account_id"]]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "account not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"data": map[string]any{"balance": []balance{b}},
+		})
+	}
+}
+
+func (s *Server) handleTransactions(bank string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, ok := s.clientData(w, r, bank)
+		if !ok {
+			return
+		}
+		id := mux.Vars(r)["account_id"]
+		txs, ok := data.transactions[id]
+		if !ok {
+			if _, exists := data.balances[id]; !exists {
+				writeError(w, http.StatusNotFound, "NOT_FOUND", "account not found")
+				return
+			}
+		}
+		from, to, err := parsePeriod(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+			return
+		}
+		res := make([]transaction, 0, len(txs))
+		for _, tx := range txs {
+			if (!from.IsZero() && tx.booked.Before(from)) || (!to.IsZero() && tx.booked.After(to)) {
+				continue
+			}
+			res = append(res, tx)
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"data": map[string]any{"transaction": res},
+		})
+	}
+}
+
+func (s *Server) handleCreatePayment(bank string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Data struct {
+				Initiation json.RawMessage `json:"initiation"`
+			} `json:"data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+			return
+		}
+		if len(req.Data.Initiation) == 0 {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "data.initiation is required")
+			return
+		}
+		p := &payment{
+			PaymentID:        "payment-" + uuid.NewString(),
+			Bank:             bank,
+			Status:           "AcceptedSettlementCompleted",
+			CreationDateTime: s.now().UTC().Format(time.RFC3339),
+			Initiation:       req.Data.Initiation,
+		}
+		s.mu.Lock()
+		s.payments[p.PaymentID] = p
+		s.mu.Unlock()
+		writeJSON(w, http.StatusCreated, map[string]any{"data": p})
+	}
+}
+
+func (s *Server) handleGetPayment(bank string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		p, ok := s.payments[mux.Vars(r)["payment_id"]]
+		s.mu.Unlock()
+		if !ok || p.Bank != bank {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "payment not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"data": p})
+	}
+}
+
+func (s *Server) consent(bank, consentID string) (consent, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.consents[consentID]
+	if !ok || c.Bank != bank {
+		return consent{}, false
+	}
+	return *c, true
+}
+
+// clientData checks the consent of the request and returns the fixtures of its client.
+func (s *Server) clientData(w http.ResponseWriter, r *http.Request, bank string) (*clientData, bool) {
+	c, ok := s.consent(bank, r.Header.Get("X-Consent-Id"))
+	if !ok {
+		writeError(w, http.StatusForbidden, "CONSENT_REQUIRED", "valid X-Consent-Id header is required")
+		return nil, false
+	}
+	if c.Status != "approved" {
+		writeError(w, http.StatusForbidden, "CONSENT_NOT_APPROVED", "consent status is "+c.Status)
+		return nil, false
+	}
+	if clientID := r.URL.Query().Get("client_id"); clientID != "" && clientID != c.ClientID {
+		writeError(w, http.StatusForbidden, "CONSENT_MISMATCH", "consent was issued for another client")
+		return nil, false
+	}
+
+	key := bank + "/" + c.ClientID
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.data[key]
+	if !ok {
+		data = generate(s.cfg.Seed, s.cfg.Banks, bank, c.ClientID, s.now())
+		s.data[key] = data
+	}
+	return data, true
+}
+
+func parsePeriod(r *http.Request) (time.Time, time.Time, error) {
+	var from, to time.Time
+	q := r.URL.Query()
+	for name, dst := range map[string]*time.Time{"from_booking_date_time": &from, "to_booking_date_time": &to} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			if t, err = time.Parse(time.DateOnly, v); err != nil {
+				return time.Time{}, time.Time{}, err
+			}
+		}
+		*dst = t
+	}
+	return from, to, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]string{
+		"code":    code,
+		"message": message,
+	})
+}
@@ -0,0 +1,394 @@
+package mockbank_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/internal/domain"
+	"github.com/MichaelSBoop/lima-backend/internal/service/requester/bankapi"
+	"github.com/MichaelSBoop/lima-backend/pkg/mockbank"
+	"github.com/MichaelSBoop/lima-backend/pkg/mockbank/mockbanktest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+const clientID = "team-1-1"
+
+// bankClient calls one bank of the mock server as Lima does.
+type bankClient struct {
+	t       *testing.T
+	srv     *mockbanktest.Server
+	bank    string
+	token   string
+	consent string
+	adapter bankapi.Adapter
+	// logs holds what the adapter logs, such as unknown payload fields.
+	logs *observer.ObservedLogs
+}
+
+func newBankClient(t *testing.T, srv *mockbanktest.Server, bank string) *bankClient {
+	t.Helper()
+	core, logs := observer.New(zapcore.WarnLevel)
+	adapter, err := bankapi.New("", bank, zap.New(core))
+	if err != nil {
+		t.Fatalf("bankapi.New: %v", err)
+	}
+	c := &bankClient{t: t, srv: srv, bank: bank, adapter: adapter, logs: logs}
+	status, body := c.do(http.MethodPost, "/auth/bank-token?client_id=team-1&client_secret=secret", nil, nil)
+	if status != http.StatusOK {
+		t.Fatalf("token: status %d: %s", status, body)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err = json.Unmarshal(body, &token); err != nil || token.AccessToken == "" {
+		t.Fatalf("token: %s", body)
+	}
+	c.token = token.AccessToken
+	return c
+}
+
+// do calls path of the bank with the token and consent of c, and header.
+func (c *bankClient) do(method, path string, body any, header http.Header) (int, []byte) {
+	c.t.Helper()
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.srv.BaseURL(c.bank)+path, reqBody)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.consent != "" {
+		req.Header.Set("X-Consent-Id", c.consent)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	resp, err := c.srv.Client().Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatalf("read %s: %v", path, err)
+	}
+	return resp.StatusCode, data
+}
+
+// get calls path and fails the test unless it succeeds.
+func (c *bankClient) get(path string) []byte {
+	c.t.Helper()
+	status, body := c.do(http.MethodGet, path, nil, nil)
+	if status != http.StatusOK {
+		c.t.Fatalf("GET %s: status %d: %s", path, status, body)
+	}
+	return body
+}
+
+// requestConsent asks for a consent and uses it for the following calls.
+func (c *bankClient) requestConsent() *bankapi.ConsentResponse {
+	c.t.Helper()
+	status, body := c.do(http.MethodPost, "/account-consents/request", map[string]any{
+		"client_id":       clientID,
+		"permissions":     []string{domain.PermissionReadAccountsDetail, domain.PermissionReadBalances, domain.PermissionReadTransactionsDetail},
+		"reason":          "Aggregation",
+		"requesting_bank": "team-1",
+	}, nil)
+	if status != http.StatusOK {
+		c.t.Fatalf("request consent: status %d: %s", status, body)
+	}
+	consent, err := c.adapter.DecodeConsent(body)
+	if err != nil {
+		c.t.Fatalf("DecodeConsent: %v", err)
+	}
+	c.consent = consent.ConsentID
+	return consent
+}
+
+func (c *bankClient) checkNoUnknownFields() {
+	c.t.Helper()
+	for _, entry := range c.logs.All() {
+		c.t.Errorf("%s: %s %v", c.bank, entry.Message, entry.ContextMap())
+	}
+}
+
+func TestConsentModes(t *testing.T) {
+	tests := []struct {
+		mode             string
+		wantStatus       string
+		wantAutoApproved bool
+	}{
+		{mode: mockbank.ConsentModeApprove, wantStatus: domain.ConsentStatusApproved, wantAutoApproved: true},
+		{mode: mockbank.ConsentModePending, wantStatus: domain.ConsentStatusPending},
+		{mode: mockbank.ConsentModeReject, wantStatus: domain.ConsentStatusRejected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			srv := mockbanktest.NewServer(mockbank.Config{ConsentMode: tt.mode, ConsentTTL: 30 * 24 * time.Hour})
+			defer srv.Close()
+			c := newBankClient(t, srv, "vbank")
+
+			consent := c.requestConsent()
+			if consent.Status != tt.wantStatus || consent.AutoApproved != tt.wantAutoApproved {
+				t.Errorf("got %s, auto approved %v, want %s, %v", consent.Status, consent.AutoApproved, tt.wantStatus, tt.wantAutoApproved)
+			}
+			if ttl := consent.ExpiresAt.Sub(consent.CreatedAt); ttl != 30*24*time.Hour {
+				t.Errorf("consent valid for %v, want 30 days", ttl)
+			}
+			read, err := c.adapter.DecodeConsentStatus(c.get("/account-consents/" + consent.ConsentID))
+			if err != nil {
+				t.Fatalf("DecodeConsentStatus: %v", err)
+			}
+			if read.ConsentID != consent.ConsentID || read.Status != tt.wantStatus {
+				t.Errorf("read back %+v, want %s %s", read, consent.ConsentID, tt.wantStatus)
+			}
+
+			status, body := c.do(http.MethodGet, "/accounts", nil, nil)
+			if wantOK := tt.wantStatus == domain.ConsentStatusApproved; (status == http.StatusOK) != wantOK {
+				t.Errorf("accounts under a %s consent: status %d: %s", tt.wantStatus, status, body)
+			}
+			c.checkNoUnknownFields()
+		})
+	}
+}
+
+func TestAccountData(t *testing.T) {
+	srv := mockbanktest.NewServer(mockbank.DefaultConfig())
+	defer srv.Close()
+
+	// transfers are the own-account transfers booked at each bank.
+	transfers := make(map[string][]*domain.Transaction)
+	identifications := make(map[string]string)
+	for _, bank := range mockbank.DefaultConfig().Banks {
+		c := newBankClient(t, srv, bank)
+		c.requestConsent()
+		accounts, err := c.adapter.DecodeAccounts(c.get("/accounts"))
+		if err != nil {
+			t.Fatalf("%s: DecodeAccounts: %v", bank, err)
+		}
+		if len(accounts) != 2 {
+			t.Fatalf("%s: got %d accounts, want 2", bank, len(accounts))
+		}
+		identifications[bank] = accounts[0].Identification
+
+		for _, account := range accounts {
+			balances, err := c.adapter.DecodeBalances(c.get("/accounts/" + account.AccountID + "/balances"))
+			if err != nil {
+				t.Fatalf("%s: DecodeBalances: %v", bank, err)
+			}
+			if len(balances) != 1 || balances[0].AccountID != account.AccountID || balances[0].Currency != account.Currency {
+				t.Errorf("%s: balances of %s: %+v", bank, account.AccountID, balances)
+			}
+
+			all, err := c.adapter.DecodeTransactions(c.get("/accounts/" + account.AccountID + "/transactions"))
+			if err != nil {
+				t.Fatalf("%s: DecodeTransactions: %v", bank, err)
+			}
+			from := time.Now().UTC().AddDate(0, 0, -30).Truncate(24 * time.Hour)
+			recent, err := c.adapter.DecodeTransactions(c.get("/accounts/" + account.AccountID + "/transactions?from_booking_date_time=" + from.Format(time.RFC3339)))
+			if err != nil {
+				t.Fatalf("%s: DecodeTransactions: %v", bank, err)
+			}
+			// The current account has spending every few days, savings may
+			// have none.
+			if account.AccountID == accounts[0].AccountID && (len(recent) == 0 || len(recent) >= len(all)) {
+				t.Errorf("%s: %d transactions since %s of %d", bank, len(recent), from.Format(time.DateOnly), len(all))
+			}
+			for _, tx := range recent {
+				if tx.BookedAt.Before(from) {
+					t.Errorf("%s: transaction %s booked %v, before %v", bank, tx.TransactionID, tx.BookedAt, from)
+				}
+			}
+			for _, tx := range all {
+				if tx.AccountID != account.AccountID || tx.Currency != account.Currency {
+					t.Errorf("%s: transaction %+v of account %s", bank, tx, account.AccountID)
+				}
+				if strings.HasPrefix(tx.Description, "Transfer between own accounts") {
+					transfers[bank] = append(transfers[bank], tx)
+				}
+			}
+		}
+		c.checkNoUnknownFields()
+	}
+
+	// Every transfer out of a bank arrives at the next one.
+	banks := mockbank.DefaultConfig().Banks
+	for i, bank := range banks {
+		next := banks[(i+1)%len(banks)]
+		if len(transfers[bank]) == 0 {
+			t.Errorf("%s: no transfers between own accounts", bank)
+		}
+		for _, debit := range transfers[bank] {
+			if !strings.HasPrefix(debit.Amount, "-") {
+				continue
+			}
+			if debit.Counterparty != identifications[next] {
+				t.Errorf("%s: transfer %s to %s, want the account at %s", bank, debit.TransactionID, debit.Counterparty, next)
+			}
+			found := false
+			for _, credit := range transfers[next] {
+				found = found || credit.Amount == debit.Amount[1:] && credit.Counterparty == identifications[bank] &&
+					credit.BookedAt.Sub(debit.BookedAt).Abs() < time.Hour
+			}
+			if !found {
+				t.Errorf("%s: transfer %s of %s has no credit at %s", bank, debit.TransactionID, debit.Amount, next)
+			}
+		}
+	}
+}
+
+func TestAccessChecks(t *testing.T) {
+	srv := mockbanktest.NewServer(mockbank.Config{ConsentMode: mockbank.ConsentModePending})
+	defer srv.Close()
+	c := newBankClient(t, srv, "vbank")
+	other := newBankClient(t, srv, "sbank")
+	consent := c.requestConsent()
+
+	check := func(name string, c *bankClient, path string, wantStatus int, wantCode string) {
+		t.Helper()
+		status, body := c.do(http.MethodGet, path, nil, nil)
+		if status != wantStatus {
+			t.Errorf("%s: status %d, want %d: %s", name, status, wantStatus, body)
+			return
+		}
+		if wantCode == "" {
+			return
+		}
+		if code, _ := bankapi.ParseError(body); code != wantCode {
+			t.Errorf("%s: code %q, want %q", name, code, wantCode)
+		}
+	}
+
+	check("pending consent", c, "/accounts", http.StatusForbidden, "CONSENT_NOT_APPROVED")
+	if !srv.Bank.SetConsentStatus(consent.ConsentID, domain.ConsentStatusApproved) {
+		t.Fatal("SetConsentStatus: consent not found")
+	}
+	check("approved consent", c, "/accounts", http.StatusOK, "")
+	check("consent of another client", c, "/accounts?client_id=team-1-2", http.StatusForbidden, "CONSENT_MISMATCH")
+	check("unknown account", c, "/accounts/vbank-other-acc-1/balances", http.StatusNotFound, "NOT_FOUND")
+
+	other.consent = consent.ConsentID
+	check("consent of another bank", other, "/accounts", http.StatusForbidden, "CONSENT_REQUIRED")
+	token := c.token
+	c.token = other.token
+	check("token of another bank", c, "/accounts", http.StatusUnauthorized, "UNAUTHORIZED")
+	c.token = ""
+	check("no token", c, "/accounts", http.StatusUnauthorized, "UNAUTHORIZED")
+	c.token = token
+
+	if status, body := c.do(http.MethodDelete, "/account-consents/"+consent.ConsentID, nil, nil); status != http.StatusNoContent {
+		t.Fatalf("revoke: status %d: %s", status, body)
+	}
+	check("revoked consent", c, "/accounts", http.StatusForbidden, "CONSENT_NOT_APPROVED")
+}
+
+func TestFaults(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   mockbank.Config
+		fault string
+		// wantStatus is the status of the accounts call, wantCode the error
+		// code of its body, if any.
+		wantStatus int
+		wantCode   string
+		// wantMalformed tells the body does not decode.
+		wantMalformed bool
+	}{
+		{name: "none", wantStatus: http.StatusOK},
+		{name: "server error", fault: mockbank.FaultError, wantStatus: http.StatusInternalServerError, wantCode: "INTERNAL_ERROR"},
+		{name: "rate limit", fault: mockbank.FaultRateLimit, wantStatus: http.StatusTooManyRequests, wantCode: "TOO_MANY_REQUESTS"},
+		{name: "malformed", fault: mockbank.FaultMalformed, wantStatus: http.StatusOK, wantMalformed: true},
+		{name: "error rate", cfg: mockbank.Config{Fault: mockbank.Fault{ErrorRate: 1}}, wantStatus: http.StatusInternalServerError, wantCode: "INTERNAL_ERROR"},
+		{name: "rate limit rate", cfg: mockbank.Config{Fault: mockbank.Fault{RateLimitRate: 1}}, wantStatus: http.StatusTooManyRequests, wantCode: "TOO_MANY_REQUESTS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := mockbanktest.NewServer(tt.cfg)
+			defer srv.Close()
+			// With fault rates set, only the forced fault of the header gets
+			// the token and consent through.
+			c := &bankClient{t: t, srv: srv, bank: "vbank"}
+			status, body := c.do(http.MethodPost, "/auth/bank-token?client_id=team-1&client_secret=secret", nil, http.Header{mockbank.FaultHeader: {"none"}})
+			if status != http.StatusOK {
+				t.Fatalf("token: status %d: %s", status, body)
+			}
+			var token struct {
+				AccessToken string `json:"access_token"`
+			}
+			if err := json.Unmarshal(body, &token); err != nil {
+				t.Fatal(err)
+			}
+			c.token = token.AccessToken
+			status, body = c.do(http.MethodPost, "/account-consents/request", map[string]string{"client_id": clientID}, http.Header{mockbank.FaultHeader: {"none"}})
+			if status != http.StatusOK {
+				t.Fatalf("request consent: status %d: %s", status, body)
+			}
+			var consent struct {
+				ConsentID string `json:"consent_id"`
+			}
+			if err := json.Unmarshal(body, &consent); err != nil {
+				t.Fatal(err)
+			}
+			c.consent = consent.ConsentID
+
+			header := http.Header{"X-Fapi-Interaction-Id": {"interaction-1"}}
+			if tt.fault != "" {
+				header.Set(mockbank.FaultHeader, tt.fault)
+			}
+			status, body = c.do(http.MethodGet, "/accounts", nil, header)
+			if status != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", status, tt.wantStatus, body)
+			}
+			if code, _ := bankapi.ParseError(body); tt.wantCode != "" && code != tt.wantCode {
+				t.Errorf("code %q, want %q", code, tt.wantCode)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			adapter, err := bankapi.New("", "vbank", zap.NewNop())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = adapter.DecodeAccounts(body); tt.wantMalformed != (err != nil) {
+				t.Errorf("DecodeAccounts = %v, want malformed %v", err, tt.wantMalformed)
+			}
+		})
+	}
+}
+
+func TestFaultsEchoTheInteractionID(t *testing.T) {
+	srv := mockbanktest.NewServer(mockbank.Config{})
+	defer srv.Close()
+	req, err := http.NewRequest(http.MethodGet, srv.BaseURL("vbank")+"/accounts", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(bankapi.InteractionIDHeader, "interaction-1")
+	req.Header.Set(mockbank.FaultHeader, mockbank.FaultRateLimit)
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get(bankapi.InteractionIDHeader); got != "interaction-1" {
+		t.Errorf("interaction id %q, want interaction-1", got)
+	}
+	if got := resp.Header.Get("Retry-After"); got == "" {
+		t.Error("rate limited without Retry-After")
+	}
+}
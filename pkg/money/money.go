@@ -0,0 +1,36 @@
+// Package money does exact decimal arithmetic on amounts kept as strings.
+package money
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+)
+
+const Scale = 2
+
+var ErrInvalidAmount = errors.New("invalid amount")
+
+func Parse(s string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return nil, ErrInvalidAmount
+	}
+	return r, nil
+}
+
+// Format renders r with Scale decimals, rounding halves away from zero.
+func Format(r *big.Rat) string {
+	return FormatScale(r, Scale)
+}
+
+func FormatScale(r *big.Rat, scale int) string {
+	if r == nil {
+		return new(big.Rat).FloatString(scale)
+	}
+	return r.FloatString(scale)
+}
+
+func Zero() *big.Rat {
+	return new(big.Rat)
+}
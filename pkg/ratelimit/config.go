@@ -0,0 +1,12 @@
+package ratelimit
+
+import "time"
+
+// Config allows Rate events every Per, with bursts of up to Burst.
+// A zero Rate disables the limit.
+type Config struct {
+	Rate int           `json:"rate" yaml:"rate"`
+	Per  time.Duration `json:"per" yaml:"per"`
+	// Burst defaults to Rate.
+	Burst int `json:"burst" yaml:"burst"`
+}
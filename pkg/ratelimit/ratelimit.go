@@ -0,0 +1,134 @@
+// Package ratelimit implements keyed token buckets.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const sweepInterval = time.Minute
+
+// ErrLimited is returned when no token becomes available in time.
+var ErrLimited = errors.New("rate limit exceeded")
+
+// Limiter keeps a token bucket per key. Buckets are created full and
+// forgotten once they refill, so idle keys cost nothing.
+type Limiter struct {
+	mu sync.Mutex
+	// interval is the time it takes to earn one token.
+	interval  time.Duration
+	burst     float64
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// New returns a limiter for cfg, or nil if cfg disables limiting.
+// A nil *Limiter allows everything.
+func New(cfg Config) *Limiter {
+	if cfg.Rate <= 0 {
+		return nil
+	}
+	per := cfg.Per
+	if per <= 0 {
+		per = time.Second
+	}
+	burst := cfg.Burst
+	if burst <= 0 {
+		burst = cfg.Rate
+	}
+	return &Limiter{
+		interval:  per / time.Duration(cfg.Rate),
+		burst:     float64(burst),
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow takes a token for key if one is available. Otherwise it reports how
+// long until there is one.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.bucket(key, time.Now())
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, l.duration(1 - b.tokens)
+}
+
+// Wait takes a token for key, blocking until one is available. It fails with
+// ErrLimited without blocking when that would take longer than maxWait or
+// past the deadline of ctx.
+func (l *Limiter) Wait(ctx context.Context, key string, maxWait time.Duration) error {
+	if l == nil {
+		return nil
+	}
+	now := time.Now()
+	l.mu.Lock()
+	b := l.bucket(key, now)
+	// Taking the token ahead reserves it, the bucket may go negative.
+	b.tokens--
+	wait := l.duration(-b.tokens)
+	deadline, ok := ctx.Deadline()
+	if wait > maxWait || (ok && now.Add(wait).After(deadline)) {
+		b.tokens++
+		l.mu.Unlock()
+		return ErrLimited
+	}
+	l.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// bucket returns the bucket of key refilled up to now.
+func (l *Limiter) bucket(key string, now time.Time) *bucket {
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+		return b
+	}
+	b.tokens = min(l.burst, b.tokens+float64(now.Sub(b.updated))/float64(l.interval))
+	b.updated = now
+	return b
+}
+
+// sweep forgets the buckets that have refilled, they are the same as new ones.
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+float64(now.Sub(b.updated))/float64(l.interval) >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+func (l *Limiter) duration(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	return time.Duration(tokens * float64(l.interval))
+}
@@ -0,0 +1,156 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MichaelSBoop/lima-backend/pkg/ratelimit"
+)
+
+func TestAllow(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  ratelimit.Config
+		keys []string
+		// want tells whether each of keys is allowed, in order.
+		want []bool
+	}{
+		{
+			name: "burst defaults to rate",
+			cfg:  ratelimit.Config{Rate: 3, Per: time.Hour},
+			keys: []string{"a", "a", "a", "a"},
+			want: []bool{true, true, true, false},
+		},
+		{
+			name: "burst above rate",
+			cfg:  ratelimit.Config{Rate: 1, Per: time.Hour, Burst: 3},
+			keys: []string{"a", "a", "a", "a"},
+			want: []bool{true, true, true, false},
+		},
+		{
+			name: "keys have their own buckets",
+			cfg:  ratelimit.Config{Rate: 1, Per: time.Hour},
+			keys: []string{"a", "b", "a", "b", "c"},
+			want: []bool{true, true, false, false, true},
+		},
+		{
+			name: "zero rate disables the limit",
+			cfg:  ratelimit.Config{Per: time.Hour},
+			keys: []string{"a", "a", "a"},
+			want: []bool{true, true, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := ratelimit.New(tt.cfg)
+			for i, key := range tt.keys {
+				ok, retryAfter := l.Allow(key)
+				if ok != tt.want[i] {
+					t.Fatalf("request %d for %s: allowed = %v, want %v", i, key, ok, tt.want[i])
+				}
+				if ok && retryAfter != 0 {
+					t.Errorf("request %d: retry after %v when allowed", i, retryAfter)
+				}
+				if !ok && (retryAfter <= 0 || retryAfter > tt.cfg.Per) {
+					t.Errorf("request %d: retry after %v, want within (0, %v]", i, retryAfter, tt.cfg.Per)
+				}
+			}
+		})
+	}
+}
+
+func TestAllowRefills(t *testing.T) {
+	l := ratelimit.New(ratelimit.Config{Rate: 1, Per: 50 * time.Millisecond})
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("first request limited")
+	}
+	ok, retryAfter := l.Allow("a")
+	if ok {
+		t.Fatal("second request allowed before the bucket refilled")
+	}
+	time.Sleep(retryAfter)
+	if ok, _ = l.Allow("a"); !ok {
+		t.Fatalf("request limited after waiting %v", retryAfter)
+	}
+}
+
+func TestWait(t *testing.T) {
+	const interval = 50 * time.Millisecond
+	background := func() (context.Context, context.CancelFunc) {
+		return context.WithCancel(context.Background())
+	}
+	shortDeadline := func() (context.Context, context.CancelFunc) {
+		return context.WithTimeout(context.Background(), interval/5)
+	}
+	cancelled := func() (context.Context, context.CancelFunc) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(interval/5, cancel)
+		return ctx, cancel
+	}
+
+	tests := []struct {
+		name    string
+		ctx     func() (context.Context, context.CancelFunc)
+		maxWait time.Duration
+		wantErr error
+		// minWait is the least time Wait should block.
+		minWait time.Duration
+	}{
+		{name: "waits for the next token", ctx: background, maxWait: time.Second, minWait: interval * 4 / 5},
+		{name: "refuses to wait longer than maxWait", ctx: background, maxWait: interval / 5, wantErr: ratelimit.ErrLimited},
+		{name: "refuses to wait past the deadline", ctx: shortDeadline, maxWait: time.Second, wantErr: ratelimit.ErrLimited},
+		{name: "stops waiting on cancel", ctx: cancelled, maxWait: time.Second, wantErr: context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := ratelimit.New(ratelimit.Config{Rate: 1, Per: interval})
+			if err := l.Wait(context.Background(), "a", 0); err != nil {
+				t.Fatalf("first Wait: %v", err)
+			}
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			start := time.Now()
+			err := l.Wait(ctx, "a", tt.maxWait)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Wait = %v, want %v", err, tt.wantErr)
+			}
+			if elapsed := time.Since(start); elapsed < tt.minWait {
+				t.Errorf("Wait returned after %v, want at least %v", elapsed, tt.minWait)
+			}
+		})
+	}
+}
+
+func TestWaitRefusalKeepsToken(t *testing.T) {
+	const interval = 50 * time.Millisecond
+	l := ratelimit.New(ratelimit.Config{Rate: 1, Per: interval})
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("first request limited")
+	}
+	for range 3 {
+		if err := l.Wait(context.Background(), "a", 0); !errors.Is(err, ratelimit.ErrLimited) {
+			t.Fatalf("Wait = %v, want ErrLimited", err)
+		}
+	}
+	// The refused waits have not reserved tokens, so the next one is due
+	// after a single interval.
+	_, retryAfter := l.Allow("a")
+	if retryAfter > interval {
+		t.Errorf("retry after %v, want at most %v", retryAfter, interval)
+	}
+}
+
+func TestNilLimiter(t *testing.T) {
+	l := ratelimit.New(ratelimit.Config{})
+	if l != nil {
+		t.Fatal("New returned a limiter for a disabled config")
+	}
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("nil limiter limited Allow")
+	}
+	if err := l.Wait(context.Background(), "a", 0); err != nil {
+		t.Errorf("nil limiter Wait = %v", err)
+	}
+}